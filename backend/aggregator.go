@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 )
@@ -11,56 +10,112 @@ import (
 // BankAggregator агрегирует данные из нескольких банков
 type BankAggregator struct {
 	config  Config
-	clients map[string]*BankAPIClient
+	tenants map[string]*tenantClients // key: tenant ID - у каждого арендатора свои клиенты и токены
+	users   UserTenants               // арендатор пользователя для запросов без контекста аутентификации
+	manual  *ManualAccountStore       // счета, которые пользователь ведет вручную
 
-	// Кэш consent ID для каждого банка и пользователя
+	snapshots *BalanceSnapshotStore // ежедневные снимки балансов для истории
+	statuses  *AgreementStatusStore // последние известные статусы договоров
+	policies  *PolicyStore          // политики платежей: проверяются перед каждой отправкой
+	audit     *AuditLog             // журнал создания консентов, платежей и договоров
+
+	// Кэш consent ID для каждого арендатора, банка и пользователя
 	mu                     sync.RWMutex
-	consentCache           map[string]string // key: "bank|userID" - consentID (account consent)
-	paymentConsentCache    map[string]string // key: "bank|userID" - payment consent ID
-	paConsentCache         map[string]string // key: "bank|userID" - PA consent ID
+	consentCache           map[string]string // key: "tenant|bank|userID" - consentID (account consent)
+	paymentConsentCache    map[string]string // key: "tenant|bank|userID" - payment consent ID
+	paConsentCache         map[string]string // key: "tenant|bank|userID" - PA consent ID
+	consentOwners          map[string]string // key: "bank|consentID" - "tenant|bank|userID" владельца consent
+}
+
+// tenantClients банки арендатора и клиенты API с его учетными данными
+type tenantClients struct {
+	id      string
+	banks   []Bank
+	clients map[string]*BankAPIClient // key: bank code
+}
+
+// UserTenants определяет арендатора пользователя
+type UserTenants interface {
+	TenantOf(userID string) string
 }
 
 // NewBankAggregator создает новый агрегатор банков
-func NewBankAggregator(config Config) *BankAggregator {
+func NewBankAggregator(config Config, users UserTenants, manual *ManualAccountStore, snapshots *BalanceSnapshotStore, statuses *AgreementStatusStore, policies *PolicyStore, audit *AuditLog) *BankAggregator {
 	agg := &BankAggregator{
 		config:              config,
-		clients:             make(map[string]*BankAPIClient),
+		tenants:             make(map[string]*tenantClients),
+		users:               users,
+		manual:              manual,
+		snapshots:           snapshots,
+		statuses:            statuses,
+		policies:            policies,
+		audit:               audit,
 		consentCache:        make(map[string]string),
 		paymentConsentCache: make(map[string]string),
 		paConsentCache:      make(map[string]string),
+		consentOwners:       make(map[string]string),
 	}
 
-	// Создаем клиентов для каждого банка
-	for _, bank := range config.Banks {
-		agg.clients[bank.Code] = NewBankAPIClient(
-			bank.BaseURL,
-			config.TeamID,
-			config.ClientSecret,
-			config.TeamID,
-		)
-		log.Printf("Initialized client for bank: %s (%s)", bank.Code, bank.BaseURL)
+	// Создаем клиентов для каждого банка каждого арендатора
+	for _, tenant := range config.Tenants {
+		tc := &tenantClients{
+			id:      tenant.ID,
+			banks:   tenant.BankList(),
+			clients: make(map[string]*BankAPIClient),
+		}
+		for _, bank := range tenant.Banks {
+			// Наличие секретов проверено в LoadConfig
+			secret, source, _ := config.Secrets.ClientSecret(tenant, bank)
+			tc.clients[bank.Code] = NewBankAPIClient(
+				bank.BaseURL,
+				bank.ClientID,
+				secret,
+				bank.ClientID,
+				bank.SupportsIdempotencyKey,
+			)
+			aggregatorLog.Info("Initialized bank client", "tenant", tenant.ID, "bank", bank.Code, "base_url", bank.BaseURL, "secret_source", source)
+		}
+		agg.tenants[tenant.ID] = tc
 	}
 
 	return agg
 }
 
+// ReloadSecrets обновляет client_secret клиентов после изменения источников секретов.
+// Если секрет пропал из источника, клиент продолжает работать с прежним
+func (a *BankAggregator) ReloadSecrets() {
+	for _, tenant := range a.config.Tenants {
+		tc := a.tenants[tenant.ID]
+		for _, bank := range tenant.Banks {
+			secret, source, err := a.config.Secrets.ClientSecret(tenant, bank)
+			if err != nil {
+				aggregatorLog.Warn("Failed to reload client secret, keeping the previous one", "tenant", tenant.ID, "bank", bank.Code, "error", err)
+				continue
+			}
+			if tc.clients[bank.Code].SetClientSecret(secret) {
+				aggregatorLog.Info("Client secret updated", "tenant", tenant.ID, "bank", bank.Code, "secret_source", source)
+			}
+		}
+	}
+}
+
 // CONSENT MANAGEMENT
 
 // EnsureConsent создает consent если его нет, или возвращает существующий
 func (a *BankAggregator) EnsureConsent(ctx context.Context, bankCode, userID string) (string, error) {
-	cacheKey := bankCode + "|" + userID
+	cacheKey := a.cacheKey(ctx, bankCode, userID)
 
 	// Проверяем кэш
 	a.mu.RLock()
 	if consentID, exists := a.consentCache[cacheKey]; exists {
 		a.mu.RUnlock()
-		log.Printf("[DEBUG] Using cached consent for bank=%s user=%s: %s", bankCode, userID, consentID)
+		aggregatorLog.DebugContext(ctx, "Using cached consent", "bank", bankCode, "user_id", userID, "consent_id", consentID)
 		return consentID, nil
 	}
 	a.mu.RUnlock()
 
 	// Получаем клиент банка
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return "", err
 	}
@@ -73,26 +128,48 @@ func (a *BankAggregator) EnsureConsent(ctx context.Context, bankCode, userID str
 	}
 
 	consent, err := client.CreateConsent(ctx, userID, permissions, "FinHelper aggregation service")
+	if err == nil && consent.ConsentID == "" {
+		err = fmt.Errorf("empty consent_id for bank %s", bankCode)
+	}
+	targets := map[string]string{}
+	if consent != nil {
+		targets["consent_id"] = consent.ConsentID
+	}
+	a.audit.Record(ctx, AuditEvent{Action: AuditConsentCreate, Subject: userID, Bank: bankCode, Targets: targets, Err: err})
 	if err != nil {
 		return "", fmt.Errorf("create consent for %s: %w", bankCode, err)
 	}
 
-	if consent.ConsentID == "" {
-		return "", fmt.Errorf("empty consent_id for bank %s", bankCode)
-	}
-
 	// Сохраняем в кэш
 	a.mu.Lock()
 	a.consentCache[cacheKey] = consent.ConsentID
+	a.consentOwners[bankCode+"|"+consent.ConsentID] = cacheKey
 	a.mu.Unlock()
 
-	log.Printf("Created consent for bank=%s user=%s: %s", bankCode, userID, consent.ConsentID)
+	aggregatorLog.InfoContext(ctx, "Created consent", "bank", bankCode, "user_id", userID, "consent_id", consent.ConsentID)
 	return consent.ConsentID, nil
 }
 
-// GetConsentStatus получает статус согласия
-func (a *BankAggregator) GetConsentStatus(ctx context.Context, bankCode, consentID string) (*ConsentResponse, error) {
-	client, err := a.getClient(bankCode)
+// checkConsentOwner проверяет, что consent создан для пользователя. Чужой или
+// неизвестный consent не отличается от несуществующего (ErrNotFound)
+func (a *BankAggregator) checkConsentOwner(ctx context.Context, bankCode, userID, consentID string) error {
+	a.mu.RLock()
+	owner, exists := a.consentOwners[bankCode+"|"+consentID]
+	a.mu.RUnlock()
+
+	if !exists || owner != a.cacheKey(ctx, bankCode, userID) {
+		return fmt.Errorf("consent %s in %s: %w", consentID, bankCode, ErrNotFound)
+	}
+	return nil
+}
+
+// GetConsentStatus получает статус согласия пользователя
+func (a *BankAggregator) GetConsentStatus(ctx context.Context, bankCode, userID, consentID string) (*ConsentResponse, error) {
+	if err := a.checkConsentOwner(ctx, bankCode, userID, consentID); err != nil {
+		return nil, err
+	}
+
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -100,24 +177,28 @@ func (a *BankAggregator) GetConsentStatus(ctx context.Context, bankCode, consent
 	return client.GetConsentStatus(ctx, consentID)
 }
 
-// RevokeConsent отзывает согласие
-func (a *BankAggregator) RevokeConsent(ctx context.Context, bankCode, consentID string) error {
-	client, err := a.getClient(bankCode)
+// RevokeConsent отзывает согласие пользователя
+func (a *BankAggregator) RevokeConsent(ctx context.Context, bankCode, userID, consentID string) error {
+	if err := a.checkConsentOwner(ctx, bankCode, userID, consentID); err != nil {
+		return err
+	}
+
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return err
 	}
 
-	// Удаляем из кэша
+	// Удаляем из кэша пользователя
+	cacheKey := a.cacheKey(ctx, bankCode, userID)
 	a.mu.Lock()
-	for key, id := range a.consentCache {
-		if id == consentID {
-			delete(a.consentCache, key)
-			break
-		}
+	if a.consentCache[cacheKey] == consentID {
+		delete(a.consentCache, cacheKey)
 	}
 	a.mu.Unlock()
 
-	return client.RevokeConsent(ctx, consentID)
+	err = client.RevokeConsent(ctx, consentID)
+	a.audit.Record(ctx, AuditEvent{Action: AuditConsentRevoke, Subject: userID, Bank: bankCode, Targets: map[string]string{"consent_id": consentID}, Err: err})
+	return err
 }
 
 // ACCOUNTS
@@ -125,32 +206,40 @@ func (a *BankAggregator) RevokeConsent(ctx context.Context, bankCode, consentID
 // GetAccountsFromAllBanks получает счета из всех банков
 func (a *BankAggregator) GetAccountsFromAllBanks(ctx context.Context, userID string) ([]Account, error) {
 	var allAccounts []Account
+	banks := a.Banks(ctx, userID)
 
-	for _, bank := range a.config.Banks {
+	for _, bank := range banks {
 		accounts, err := a.GetAccountsFromBank(ctx, bank.Code, userID)
 		if err != nil {
-			log.Printf("Warning: failed to get accounts from %s: %v", bank.Code, err)
+			aggregatorLog.WarnContext(ctx, "Failed to get accounts", "bank", bank.Code, "error", err)
 			continue // продолжаем с другими банками
 		}
 		allAccounts = append(allAccounts, accounts...)
 	}
 
-	log.Printf("Aggregated %d accounts from %d banks for user %s", len(allAccounts), len(a.config.Banks), userID)
+	// Добавляем ручные счета (наличные, недвижимость и т.д.)
+	allAccounts = append(allAccounts, a.manual.LegacyAccounts(userID)...)
+
+	aggregatorLog.DebugContext(ctx, "Aggregated accounts", "user_id", userID, "accounts", len(allAccounts), "banks", len(banks))
 	return allAccounts, nil
 }
 
 // GetAccountsFromBank получает счета из конкретного банка
 func (a *BankAggregator) GetAccountsFromBank(ctx context.Context, bankCode, userID string) ([]Account, error) {
+	if bankCode == ManualBankCode {
+		return a.manual.LegacyAccounts(userID), nil
+	}
+
 	// Получаем или создаем consent
 	consentID, err := a.EnsureConsent(ctx, bankCode, userID)
 	if err != nil {
 		return nil, fmt.Errorf("ensure consent: %w", err)
 	}
 
-	log.Printf("[DEBUG] Using consent_id=%s for bank=%s user=%s", consentID, bankCode, userID)
+	aggregatorLog.DebugContext(ctx, "Using consent", "bank", bankCode, "user_id", userID, "consent_id", consentID)
 
 	// Получаем клиент
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -167,23 +256,104 @@ func (a *BankAggregator) GetAccountsFromBank(ctx context.Context, bankCode, user
 		accounts = append(accounts, detail.ToLegacyAccount(bankCode))
 	}
 
-	log.Printf("Fetched %d accounts from bank %s for user %s", len(accounts), bankCode, userID)
+	aggregatorLog.DebugContext(ctx, "Fetched accounts", "bank", bankCode, "user_id", userID, "accounts", len(accounts))
 	return accounts, nil
 }
 
+// FindAccountDetail ищет счет пользователя в банке по ID из /api/accounts
+// и возвращает его в исходном формате банка (со схемой и номером счета)
+func (a *BankAggregator) FindAccountDetail(ctx context.Context, bankCode, userID, accountID string) (*AccountDetail, error) {
+	consentID, err := a.EnsureConsent(ctx, bankCode, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ensure consent: %w", err)
+	}
+
+	client, err := a.getClient(ctx, bankCode, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accountDetails, err := client.GetAccounts(ctx, consentID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get accounts from %s: %w", bankCode, err)
+	}
+
+	for i := range accountDetails {
+		if accountDetails[i].AccountID == accountID {
+			return &accountDetails[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("account %s in %s: %w", accountID, bankCode, ErrNotFound)
+}
+
 // GetAccountBalances получает балансы для конкретного счета
 func (a *BankAggregator) GetAccountBalances(ctx context.Context, bankCode, userID, accountID string) ([]BalanceDetail, error) {
+	if bankCode == ManualBankCode {
+		account, err := a.manual.Get(userID, accountID)
+		if err != nil {
+			return nil, err
+		}
+		return account.ToBalanceDetails(), nil
+	}
+
 	consentID, err := a.EnsureConsent(ctx, bankCode, userID)
 	if err != nil {
 		return nil, fmt.Errorf("ensure consent: %w", err)
 	}
 
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.GetBalances(ctx, consentID, accountID, userID)
+	balances, err := client.GetBalances(ctx, consentID, accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Каждый полученный баланс сохраняем как снимок дня для истории балансов
+	a.recordBalanceSnapshot(ctx, bankCode, userID, accountID, balances)
+
+	return balances, nil
+}
+
+// GetCurrentBalance возвращает текущий баланс счета со знаком и валюту.
+// Предпочитает доступный остаток (InterimAvailable), затем проведенный (InterimBooked)
+func (a *BankAggregator) GetCurrentBalance(ctx context.Context, bankCode, userID, accountID string) (float64, string, error) {
+	balances, err := a.GetAccountBalances(ctx, bankCode, userID, accountID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	balance, ok := pickBalance(balances)
+	if !ok {
+		return 0, "", fmt.Errorf("no balances for account %s in %s", accountID, bankCode)
+	}
+
+	amount := parseAmount(balance.Amount.Amount)
+	if balance.CreditDebitIndicator == "Debit" {
+		amount = -amount
+	}
+
+	return amount, balance.Amount.Currency, nil
+}
+
+// pickBalance выбирает наиболее подходящий баланс из ответа банка
+func pickBalance(balances []BalanceDetail) (BalanceDetail, bool) {
+	for _, balanceType := range []string{"InterimAvailable", "InterimBooked"} {
+		for _, b := range balances {
+			if b.Type == balanceType {
+				return b, true
+			}
+		}
+	}
+
+	if len(balances) > 0 {
+		return balances[0], true
+	}
+
+	return BalanceDetail{}, false
 }
 
 // TRANSACTIONS
@@ -191,10 +361,14 @@ func (a *BankAggregator) GetAccountBalances(ctx context.Context, bankCode, userI
 // GetTransactions получает транзакции из одного или всех банков
 func (a *BankAggregator) GetTransactions(ctx context.Context, userID, bankFilter string, from, to *time.Time) ([]Transaction, error) {
 	// Определяем список банков для запроса
-	banks := a.config.Banks
-	if bankFilter != "" && bankFilter != "all" {
+	available := a.Banks(ctx, userID)
+	banks := available
+	includeManual := bankFilter == "" || bankFilter == "all" || bankFilter == ManualBankCode
+	if bankFilter == ManualBankCode {
+		banks = nil
+	} else if bankFilter != "" && bankFilter != "all" {
 		found := false
-		for _, b := range a.config.Banks {
+		for _, b := range available {
 			if b.Code == bankFilter {
 				banks = []Bank{b}
 				found = true
@@ -212,12 +386,16 @@ func (a *BankAggregator) GetTransactions(ctx context.Context, userID, bankFilter
 	for _, bank := range banks {
 		txs, err := a.getTransactionsFromBank(ctx, bank.Code, userID, from, to)
 		if err != nil {
-			log.Printf("Warning: failed to get transactions from %s: %v", bank.Code, err)
+			aggregatorLog.WarnContext(ctx, "Failed to get transactions", "bank", bank.Code, "error", err)
 			continue
 		}
 		allTransactions = append(allTransactions, txs...)
 	}
 
+	if includeManual {
+		allTransactions = append(allTransactions, a.manual.Transactions(userID, "", from, to)...)
+	}
+
 	// Дополнительная фильтрация по датам (на клиенте)
 	if from != nil || to != nil {
 		filtered := make([]Transaction, 0)
@@ -233,7 +411,7 @@ func (a *BankAggregator) GetTransactions(ctx context.Context, userID, bankFilter
 		allTransactions = filtered
 	}
 
-	log.Printf("Aggregated %d transactions from %d banks for user %s", len(allTransactions), len(banks), userID)
+	aggregatorLog.DebugContext(ctx, "Aggregated transactions", "user_id", userID, "transactions", len(allTransactions), "banks", len(banks))
 	return allTransactions, nil
 }
 
@@ -246,7 +424,7 @@ func (a *BankAggregator) getTransactionsFromBank(ctx context.Context, bankCode,
 	}
 
 	// Получаем клиент
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +449,7 @@ func (a *BankAggregator) getTransactionsFromBank(ctx context.Context, bankCode,
 
 		txDetails, err := client.GetTransactions(ctx, consentID, account.AccountID, userID, fromTime, toTime)
 		if err != nil {
-			log.Printf("Warning: failed to get transactions for account %s: %v", account.AccountID, err)
+			aggregatorLog.WarnContext(ctx, "Failed to get account transactions", "bank", bankCode, "account_id", account.AccountID, "error", err)
 			continue
 		}
 
@@ -286,12 +464,26 @@ func (a *BankAggregator) getTransactionsFromBank(ctx context.Context, bankCode,
 
 // GetAccountTransactions получает транзакции конкретного счета
 func (a *BankAggregator) GetAccountTransactions(ctx context.Context, bankCode, userID, accountID string, from, to time.Time) ([]Transaction, error) {
+	if bankCode == ManualBankCode {
+		if _, err := a.manual.Get(userID, accountID); err != nil {
+			return nil, err
+		}
+		var fromPtr, toPtr *time.Time
+		if !from.IsZero() {
+			fromPtr = &from
+		}
+		if !to.IsZero() {
+			toPtr = &to
+		}
+		return a.manual.Transactions(userID, accountID, fromPtr, toPtr), nil
+	}
+
 	consentID, err := a.EnsureConsent(ctx, bankCode, userID)
 	if err != nil {
 		return nil, fmt.Errorf("ensure consent: %w", err)
 	}
 
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -310,20 +502,104 @@ func (a *BankAggregator) GetAccountTransactions(ctx context.Context, bankCode, u
 	return transactions, nil
 }
 
+// GetAccountTransactionDetails получает транзакции счета в исходном формате банка
+// (с текущим остатком после операции, если банк его передает)
+func (a *BankAggregator) GetAccountTransactionDetails(ctx context.Context, bankCode, userID, accountID string, from, to time.Time) ([]TransactionDetail, error) {
+	consentID, err := a.EnsureConsent(ctx, bankCode, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ensure consent: %w", err)
+	}
+
+	client, err := a.getClient(ctx, bankCode, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	txDetails, err := client.GetTransactions(ctx, consentID, accountID, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("get transactions: %w", err)
+	}
+
+	return txDetails, nil
+}
+
+// FindTransaction ищет транзакцию пользователя в конкретном банке по ID
+func (a *BankAggregator) FindTransaction(ctx context.Context, bankCode, userID, transactionID string) (*Transaction, error) {
+	var transactions []Transaction
+	if bankCode == ManualBankCode {
+		transactions = a.manual.Transactions(userID, "", nil, nil)
+	} else {
+		txs, err := a.getTransactionsFromBank(ctx, bankCode, userID, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		transactions = txs
+	}
+
+	for _, tx := range transactions {
+		if tx.ID == transactionID {
+			return &tx, nil
+		}
+	}
+
+	return nil, fmt.Errorf("transaction %s in %s: %w", transactionID, bankCode, ErrNotFound)
+}
+
 // HELPERS
 
-// getClient возвращает клиент для указанного банка
-func (a *BankAggregator) getClient(bankCode string) (*BankAPIClient, error) {
-	client, exists := a.clients[bankCode]
+// tenantFor определяет арендатора: из контекста аутентификации, для фоновых
+// задач - по пользователю, иначе арендатор по умолчанию
+func (a *BankAggregator) tenantFor(ctx context.Context, userID string) (*tenantClients, error) {
+	tenantID := getTenantID(ctx)
+	if tenantID == "" && userID != "" && a.users != nil {
+		tenantID = a.users.TenantOf(userID)
+	}
+	if tenantID == "" {
+		tenantID = a.config.DefaultTenant
+	}
+
+	tenant, exists := a.tenants[tenantID]
+	if !exists {
+		return nil, fmt.Errorf("unknown tenant: %s", tenantID)
+	}
+	return tenant, nil
+}
+
+// getClient возвращает клиент указанного банка с учетными данными арендатора
+func (a *BankAggregator) getClient(ctx context.Context, bankCode, userID string) (*BankAPIClient, error) {
+	tenant, err := a.tenantFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	client, exists := tenant.clients[bankCode]
 	if !exists {
 		return nil, fmt.Errorf("unknown bank: %s", bankCode)
 	}
 	return client, nil
 }
 
-// GetBankByCode находит конфигурацию банка по коду
-func (a *BankAggregator) GetBankByCode(code string) (Bank, error) {
-	for _, bank := range a.config.Banks {
+// cacheKey ключ кэша consent: консенты разных арендаторов не пересекаются
+func (a *BankAggregator) cacheKey(ctx context.Context, bankCode, userID string) string {
+	tenantID := ""
+	if tenant, err := a.tenantFor(ctx, userID); err == nil {
+		tenantID = tenant.id
+	}
+	return tenantID + "|" + bankCode + "|" + userID
+}
+
+// Banks возвращает банки, подключенные арендатору пользователя
+func (a *BankAggregator) Banks(ctx context.Context, userID string) []Bank {
+	tenant, err := a.tenantFor(ctx, userID)
+	if err != nil {
+		aggregatorLog.WarnContext(ctx, "Failed to resolve banks", "user_id", userID, "error", err)
+		return nil
+	}
+	return tenant.banks
+}
+
+// GetBankByCode находит банк арендатора текущего запроса по коду
+func (a *BankAggregator) GetBankByCode(ctx context.Context, code string) (Bank, error) {
+	for _, bank := range a.Banks(ctx, "") {
 		if bank.Code == code {
 			return bank, nil
 		}
@@ -335,7 +611,7 @@ func (a *BankAggregator) GetBankByCode(code string) (Bank, error) {
 
 // EnsurePaymentConsent создает payment consent если его нет, или возвращает существующий
 func (a *BankAggregator) EnsurePaymentConsent(ctx context.Context, bankCode, userID string, paymentInfo PaymentInfo) (string, error) {
-	cacheKey := bankCode + "|" + userID
+	cacheKey := a.cacheKey(ctx, bankCode, userID)
 
 	// Проверяем кэш
 	a.mu.RLock()
@@ -346,14 +622,14 @@ func (a *BankAggregator) EnsurePaymentConsent(ctx context.Context, bankCode, use
 	a.mu.RUnlock()
 
 	// Получаем клиент банка
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return "", err
 	}
 
 	// Создаем payment consent
 	req := PaymentConsentRequest{
-		RequestingBank: a.config.TeamID,
+		RequestingBank: client.requestingBank,
 		ClientID:       userID,
 		PaymentDetails: paymentInfo,
 		Reason:         "FinHelper payment service",
@@ -361,26 +637,35 @@ func (a *BankAggregator) EnsurePaymentConsent(ctx context.Context, bankCode, use
 	}
 
 	consent, err := client.CreatePaymentConsent(ctx, req)
+	if err == nil && consent.ConsentID == "" {
+		err = fmt.Errorf("empty payment consent_id for bank %s", bankCode)
+	}
+	targets := map[string]string{}
+	if consent != nil {
+		targets["consent_id"] = consent.ConsentID
+	}
+	a.audit.Record(ctx, AuditEvent{Action: AuditPaymentConsentCreate, Subject: userID, Bank: bankCode, Targets: targets, Err: err})
 	if err != nil {
 		return "", fmt.Errorf("create payment consent for %s: %w", bankCode, err)
 	}
 
-	if consent.ConsentID == "" {
-		return "", fmt.Errorf("empty payment consent_id for bank %s", bankCode)
-	}
-
 	// Сохраняем в кэш
 	a.mu.Lock()
 	a.paymentConsentCache[cacheKey] = consent.ConsentID
+	a.consentOwners[bankCode+"|"+consent.ConsentID] = cacheKey
 	a.mu.Unlock()
 
-	log.Printf("Created payment consent for bank=%s user=%s: %s", bankCode, userID, consent.ConsentID)
+	aggregatorLog.InfoContext(ctx, "Created payment consent", "bank", bankCode, "user_id", userID, "consent_id", consent.ConsentID)
 	return consent.ConsentID, nil
 }
 
-// GetPaymentConsentStatus получает статус payment consent
-func (a *BankAggregator) GetPaymentConsentStatus(ctx context.Context, bankCode, consentID string) (*PaymentConsentResponse, error) {
-	client, err := a.getClient(bankCode)
+// GetPaymentConsentStatus получает статус payment consent пользователя
+func (a *BankAggregator) GetPaymentConsentStatus(ctx context.Context, bankCode, userID, consentID string) (*PaymentConsentResponse, error) {
+	if err := a.checkConsentOwner(ctx, bankCode, userID, consentID); err != nil {
+		return nil, err
+	}
+
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -390,8 +675,28 @@ func (a *BankAggregator) GetPaymentConsentStatus(ctx context.Context, bankCode,
 
 // PAYMENTS
 
-// CreatePayment создает платеж в указанном банке
+// CreatePayment создает платеж в указанном банке. Платеж, нарушающий политику
+// пользователя, в банк не отправляется (*PolicyViolation)
 func (a *BankAggregator) CreatePayment(ctx context.Context, bankCode, userID string, req PaymentRequest) (*PaymentResponse, error) {
+	evaluationID, err := a.policies.Authorize(ctx, userID, bankCode, req, time.Now().UTC())
+	if err != nil {
+		a.audit.Record(ctx, AuditEvent{Action: AuditPaymentCreate, Subject: userID, Bank: bankCode, Err: err})
+		return nil, err
+	}
+
+	payment, err := a.createPayment(ctx, bankCode, userID, req)
+	a.policies.RecordResult(evaluationID, payment, err)
+
+	targets := map[string]string{"evaluation_id": evaluationID, "idempotency_key": getIdempotencyKey(ctx)}
+	if payment != nil {
+		targets["payment_id"] = payment.PaymentID
+	}
+	a.audit.Record(ctx, AuditEvent{Action: AuditPaymentCreate, Subject: userID, Bank: bankCode, Targets: targets, Err: err})
+	return payment, err
+}
+
+// createPayment создает payment consent и сам платеж
+func (a *BankAggregator) createPayment(ctx context.Context, bankCode, userID string, req PaymentRequest) (*PaymentResponse, error) {
 	// Создаем payment consent
 	paymentInfo := PaymentInfo{
 		DebtorAccount:   req.DebtorAccount,
@@ -406,7 +711,7 @@ func (a *BankAggregator) CreatePayment(ctx context.Context, bankCode, userID str
 	}
 
 	// Получаем клиент
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -417,13 +722,13 @@ func (a *BankAggregator) CreatePayment(ctx context.Context, bankCode, userID str
 		return nil, fmt.Errorf("create payment: %w", err)
 	}
 
-	log.Printf("Created payment %s for bank=%s user=%s", payment.PaymentID, bankCode, userID)
+	aggregatorLog.InfoContext(ctx, "Created payment", "bank", bankCode, "user_id", userID, "payment_id", payment.PaymentID)
 	return payment, nil
 }
 
 // GetPaymentStatus получает статус платежа
 func (a *BankAggregator) GetPaymentStatus(ctx context.Context, bankCode, paymentID, userID string) (*PaymentResponse, error) {
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -435,7 +740,7 @@ func (a *BankAggregator) GetPaymentStatus(ctx context.Context, bankCode, payment
 
 // EnsureProductAgreementConsent создает PA consent если его нет, или возвращает существующий
 func (a *BankAggregator) EnsureProductAgreementConsent(ctx context.Context, bankCode, userID string) (string, error) {
-	cacheKey := bankCode + "|" + userID
+	cacheKey := a.cacheKey(ctx, bankCode, userID)
 
 	// Проверяем кэш
 	a.mu.RLock()
@@ -446,7 +751,7 @@ func (a *BankAggregator) EnsureProductAgreementConsent(ctx context.Context, bank
 	a.mu.RUnlock()
 
 	// Получаем клиент банка
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return "", err
 	}
@@ -460,7 +765,7 @@ func (a *BankAggregator) EnsureProductAgreementConsent(ctx context.Context, bank
 	}
 
 	req := ProductAgreementConsentRequest{
-		RequestingBank: a.config.TeamID,
+		RequestingBank: client.requestingBank,
 		ClientID:       userID,
 		Permissions:    permissions,
 		Reason:         "FinHelper product agreement service",
@@ -468,26 +773,30 @@ func (a *BankAggregator) EnsureProductAgreementConsent(ctx context.Context, bank
 	}
 
 	consent, err := client.CreateProductAgreementConsent(ctx, req)
+	if err == nil && consent.ConsentID == "" {
+		err = fmt.Errorf("empty PA consent_id for bank %s", bankCode)
+	}
+	targets := map[string]string{}
+	if consent != nil {
+		targets["consent_id"] = consent.ConsentID
+	}
+	a.audit.Record(ctx, AuditEvent{Action: AuditPAConsentCreate, Subject: userID, Bank: bankCode, Targets: targets, Err: err})
 	if err != nil {
 		return "", fmt.Errorf("create PA consent for %s: %w", bankCode, err)
 	}
 
-	if consent.ConsentID == "" {
-		return "", fmt.Errorf("empty PA consent_id for bank %s", bankCode)
-	}
-
 	// Сохраняем в кэш
 	a.mu.Lock()
 	a.paConsentCache[cacheKey] = consent.ConsentID
 	a.mu.Unlock()
 
-	log.Printf("Created PA consent for bank=%s user=%s: %s", bankCode, userID, consent.ConsentID)
+	aggregatorLog.InfoContext(ctx, "Created product agreement consent", "bank", bankCode, "user_id", userID, "consent_id", consent.ConsentID)
 	return consent.ConsentID, nil
 }
 
 // GetProductAgreementConsentStatus получает статус PA consent
 func (a *BankAggregator) GetProductAgreementConsentStatus(ctx context.Context, bankCode, consentID string) (*ProductAgreementConsentResponse, error) {
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, "")
 	if err != nil {
 		return nil, err
 	}
@@ -499,7 +808,7 @@ func (a *BankAggregator) GetProductAgreementConsentStatus(ctx context.Context, b
 
 // GetProducts получает список продуктов из банка
 func (a *BankAggregator) GetProducts(ctx context.Context, bankCode, userID, productType string) ([]Product, error) {
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -509,7 +818,7 @@ func (a *BankAggregator) GetProducts(ctx context.Context, bankCode, userID, prod
 		return nil, fmt.Errorf("get products from %s: %w", bankCode, err)
 	}
 
-	log.Printf("Fetched %d products from bank %s", len(products), bankCode)
+	aggregatorLog.DebugContext(ctx, "Fetched products", "bank", bankCode, "products", len(products))
 	return products, nil
 }
 
@@ -524,18 +833,23 @@ func (a *BankAggregator) OpenAgreement(ctx context.Context, bankCode, userID str
 	}
 
 	// Получаем клиент
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Открываем договор
 	agreement, err := client.OpenAgreement(ctx, paConsentID, userID, req)
+	targets := map[string]string{"product_id": req.ProductID}
+	if agreement != nil {
+		targets["agreement_id"] = agreement.AgreementID
+	}
+	a.audit.Record(ctx, AuditEvent{Action: AuditAgreementOpen, Subject: userID, Bank: bankCode, Targets: targets, Err: err})
 	if err != nil {
 		return nil, fmt.Errorf("open agreement: %w", err)
 	}
 
-	log.Printf("Opened agreement %s for bank=%s user=%s", agreement.AgreementID, bankCode, userID)
+	aggregatorLog.InfoContext(ctx, "Opened agreement", "bank", bankCode, "user_id", userID, "agreement_id", agreement.AgreementID)
 	return agreement, nil
 }
 
@@ -546,7 +860,7 @@ func (a *BankAggregator) GetAgreementDetails(ctx context.Context, bankCode, agre
 		return nil, fmt.Errorf("ensure PA consent: %w", err)
 	}
 
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -561,17 +875,18 @@ func (a *BankAggregator) CloseAgreement(ctx context.Context, bankCode, agreement
 		return nil, fmt.Errorf("ensure PA consent: %w", err)
 	}
 
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
 
 	agreement, err := client.CloseAgreement(ctx, paConsentID, agreementID, userID)
+	a.audit.Record(ctx, AuditEvent{Action: AuditAgreementClose, Subject: userID, Bank: bankCode, Targets: map[string]string{"agreement_id": agreementID}, Err: err})
 	if err != nil {
 		return nil, fmt.Errorf("close agreement: %w", err)
 	}
 
-	log.Printf("Closed agreement %s for bank=%s user=%s", agreementID, bankCode, userID)
+	aggregatorLog.InfoContext(ctx, "Closed agreement", "bank", bankCode, "user_id", userID, "agreement_id", agreementID)
 	return agreement, nil
 }
 
@@ -582,7 +897,7 @@ func (a *BankAggregator) GetAgreements(ctx context.Context, bankCode, userID str
 		return nil, fmt.Errorf("ensure PA consent: %w", err)
 	}
 
-	client, err := a.getClient(bankCode)
+	client, err := a.getClient(ctx, bankCode, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -592,6 +907,15 @@ func (a *BankAggregator) GetAgreements(ctx context.Context, bankCode, userID str
 		return nil, fmt.Errorf("get agreements from %s: %w", bankCode, err)
 	}
 
-	log.Printf("Fetched %d agreements from bank %s for user %s", len(agreements), bankCode, userID)
+	// Сравниваем со статусами прошлого запроса, чтобы уведомить о закрытии и погашении
+	events, err := a.statuses.Observe(userID, bankCode, agreements, time.Now().UTC())
+	if err != nil {
+		aggregatorLog.WarnContext(ctx, "Failed to store agreement statuses", "bank", bankCode, "error", err)
+	}
+	for _, event := range events {
+		aggregatorLog.InfoContext(ctx, "Agreement status changed", "bank", bankCode, "agreement_id", event.AgreementID, "event", event.Type, "old_status", event.OldStatus, "new_status", event.NewStatus)
+	}
+
+	aggregatorLog.DebugContext(ctx, "Fetched agreements", "bank", bankCode, "user_id", userID, "agreements", len(agreements))
 	return agreements, nil
 }
\ No newline at end of file
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Коллекции в хранилище
+const (
+	agreementStatesCollection = "agreement_states"
+	agreementEventsCollection = "agreement_events"
+)
+
+// maxAgreementEvents сколько последних событий хранится на пользователя
+const maxAgreementEvents = 200
+
+// Типы событий по договорам
+const (
+	AgreementEventStatusChanged = "status_changed"
+	AgreementEventClosed        = "closed"
+	AgreementEventMatured       = "matured"
+	AgreementEventDisappeared   = "disappeared" // банк перестал возвращать договор
+)
+
+// agreementClosedStatuses статусы, после которых договор считается закрытым
+var agreementClosedStatuses = map[string]bool{
+	"CLOSED":     true,
+	"TERMINATED": true,
+	"CANCELLED":  true,
+	"REPAID":     true,
+}
+
+// PortfolioAgreement договор с рассчитанными сроками
+type PortfolioAgreement struct {
+	Bank string `json:"bank"`
+	AgreementResponse
+	DaysToMaturity  *int       `json:"days_to_maturity,omitempty"` // отрицательное - срок прошел
+	MaturingSoon    bool       `json:"maturing_soon"`              // вклад закрывается в ближайшие дни
+	NextPaymentDate *time.Time `json:"next_payment_date,omitempty"`
+	PaymentDueSoon  bool       `json:"payment_due_soon"` // по кредиту скоро платеж
+}
+
+// AgreementPortfolio договоры пользователя во всех банках
+type AgreementPortfolio struct {
+	Agreements       []PortfolioAgreement `json:"agreements"`
+	MaturingSoon     int                  `json:"maturing_soon"`
+	PaymentsDueSoon  int                  `json:"payments_due_soon"`
+	UnavailableBanks map[string]string    `json:"unavailable_banks,omitempty"` // банк -> ошибка
+}
+
+// PortfolioOptions горизонты, в которых договоры помечаются как требующие внимания
+type PortfolioOptions struct {
+	MaturityDays int // вклады, закрывающиеся в ближайшие N дней
+	PaymentDays  int // кредиты с платежом в ближайшие N дней
+}
+
+// AgreementState последний известный статус договора
+type AgreementState struct {
+	UserID      string    `json:"user_id"`
+	Bank        string    `json:"bank"`
+	AgreementID string    `json:"agreement_id"`
+	ProductType string    `json:"product_type,omitempty"`
+	Status      string    `json:"status"`
+	Matured     bool      `json:"matured"` // событие о погашении уже создано
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// AgreementEvent изменение договора, о котором нужно уведомить пользователя
+type AgreementEvent struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Bank        string    `json:"bank"`
+	AgreementID string    `json:"agreement_id"`
+	ProductType string    `json:"product_type,omitempty"`
+	Type        string    `json:"type"`
+	OldStatus   string    `json:"old_status,omitempty"`
+	NewStatus   string    `json:"new_status,omitempty"`
+	DetectedAt  time.Time `json:"detected_at"`
+	Read        bool      `json:"read"`
+}
+
+// AgreementStatusStore запоминает статусы договоров между запросами и копит события
+type AgreementStatusStore struct {
+	store *JSONStore
+
+	mu     sync.RWMutex
+	states map[string]*AgreementState // key: "userID|bank|agreementID"
+	events []*AgreementEvent          // в порядке обнаружения
+}
+
+// NewAgreementStatusStore загружает статусы и события из хранилища
+func NewAgreementStatusStore(store *JSONStore) (*AgreementStatusStore, error) {
+	s := &AgreementStatusStore{
+		store:  store,
+		states: make(map[string]*AgreementState),
+	}
+
+	var states []*AgreementState
+	if err := store.Load(agreementStatesCollection, &states); err != nil {
+		return nil, fmt.Errorf("load agreement states: %w", err)
+	}
+	for _, state := range states {
+		s.states[annotationKey(state.UserID, state.Bank, state.AgreementID)] = state
+	}
+
+	if err := store.Load(agreementEventsCollection, &s.events); err != nil {
+		return nil, fmt.Errorf("load agreement events: %w", err)
+	}
+
+	return s, nil
+}
+
+// Observe сравнивает свежий список договоров банка с сохраненными статусами и
+// возвращает новые события. Договоры, увиденные впервые, событий не создают
+func (s *AgreementStatusStore) Observe(userID, bank string, agreements []AgreementResponse, now time.Time) ([]AgreementEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var created []*AgreementEvent
+	newEvent := func(state *AgreementState, eventType, oldStatus, newStatus string) {
+		created = append(created, &AgreementEvent{
+			ID:          "agr-event-" + uuid.New().String(),
+			UserID:      userID,
+			Bank:        bank,
+			AgreementID: state.AgreementID,
+			ProductType: state.ProductType,
+			Type:        eventType,
+			OldStatus:   oldStatus,
+			NewStatus:   newStatus,
+			DetectedAt:  now,
+		})
+	}
+
+	seen := make(map[string]bool, len(agreements))
+	changed := false
+
+	for _, agreement := range agreements {
+		key := annotationKey(userID, bank, agreement.AgreementID)
+		seen[key] = true
+		status := strings.ToUpper(agreement.Status)
+
+		state, known := s.states[key]
+		if !known {
+			state = &AgreementState{
+				UserID:      userID,
+				Bank:        bank,
+				AgreementID: agreement.AgreementID,
+				ProductType: agreement.ProductType,
+				Status:      status,
+				Matured:     !agreement.EndDate.IsZero() && !agreement.EndDate.After(now),
+			}
+			s.states[key] = state
+			changed = true
+		} else if state.Status != status {
+			eventType := AgreementEventStatusChanged
+			if agreementClosedStatuses[status] {
+				eventType = AgreementEventClosed
+			}
+			newEvent(state, eventType, state.Status, status)
+			state.Status = status
+			changed = true
+		}
+
+		// Срок договора истек, а банк еще не закрыл его - тоже повод уведомить
+		if !state.Matured && !agreement.EndDate.IsZero() && !agreement.EndDate.After(now) {
+			newEvent(state, AgreementEventMatured, "", status)
+			state.Matured = true
+			changed = true
+		}
+
+		state.LastSeen = now
+	}
+
+	for key, state := range s.states {
+		if state.UserID != userID || state.Bank != bank || seen[key] {
+			continue
+		}
+		if !agreementClosedStatuses[state.Status] {
+			newEvent(state, AgreementEventDisappeared, state.Status, "")
+		}
+		delete(s.states, key)
+		changed = true
+	}
+
+	if !changed {
+		return nil, nil
+	}
+
+	s.events = append(s.events, created...)
+	s.trimEvents(userID)
+
+	if err := s.persist(); err != nil {
+		return nil, err
+	}
+
+	result := make([]AgreementEvent, 0, len(created))
+	for _, event := range created {
+		result = append(result, *event)
+	}
+	return result, nil
+}
+
+// Events возвращает события пользователя, новые первыми
+func (s *AgreementStatusStore) Events(userID string, unreadOnly bool) []AgreementEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []AgreementEvent{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		if event.UserID != userID || (unreadOnly && event.Read) {
+			continue
+		}
+		result = append(result, *event)
+	}
+
+	return result
+}
+
+// MarkRead отмечает событие прочитанным
+func (s *AgreementStatusStore) MarkRead(userID, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range s.events {
+		if event.ID != eventID || event.UserID != userID {
+			continue
+		}
+		if event.Read {
+			return nil
+		}
+
+		event.Read = true
+		if err := s.persist(); err != nil {
+			event.Read = false
+			return err
+		}
+		return nil
+	}
+
+	return fmt.Errorf("agreement event %s: %w", eventID, ErrNotFound)
+}
+
+// trimEvents оставляет только последние события пользователя (вызывается под блокировкой)
+func (s *AgreementStatusStore) trimEvents(userID string) {
+	count := 0
+	for _, event := range s.events {
+		if event.UserID == userID {
+			count++
+		}
+	}
+	if count <= maxAgreementEvents {
+		return
+	}
+
+	drop := count - maxAgreementEvents
+	kept := s.events[:0]
+	for _, event := range s.events {
+		if event.UserID == userID && drop > 0 {
+			drop--
+			continue
+		}
+		kept = append(kept, event)
+	}
+	s.events = kept
+}
+
+// persist сохраняет статусы и события (вызывается под блокировкой)
+func (s *AgreementStatusStore) persist() error {
+	states := make([]*AgreementState, 0, len(s.states))
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+
+	if err := s.store.Save(agreementStatesCollection, states); err != nil {
+		return err
+	}
+	return s.store.Save(agreementEventsCollection, s.events)
+}
+
+// PORTFOLIO
+
+// GetAgreementPortfolio параллельно запрашивает договоры во всех банках и объединяет их.
+// Банки, которые не ответили, попадают в unavailable_banks
+func (a *BankAggregator) GetAgreementPortfolio(ctx context.Context, userID string, opts PortfolioOptions) AgreementPortfolio {
+	type bankResult struct {
+		bank       string
+		agreements []AgreementResponse
+		err        error
+	}
+
+	banks := a.Banks(ctx, userID)
+	results := make([]bankResult, len(banks))
+	var wg sync.WaitGroup
+	for i, bank := range banks {
+		wg.Add(1)
+		go func(i int, bankCode string) {
+			defer wg.Done()
+			agreements, err := a.GetAgreements(ctx, bankCode, userID)
+			results[i] = bankResult{bank: bankCode, agreements: agreements, err: err}
+		}(i, bank.Code)
+	}
+	wg.Wait()
+
+	portfolio := AgreementPortfolio{
+		Agreements:       []PortfolioAgreement{},
+		UnavailableBanks: make(map[string]string),
+	}
+	now := time.Now().UTC()
+
+	for _, res := range results {
+		if res.err != nil {
+			aggregatorLog.WarnContext(ctx, "Failed to get agreements", "bank", res.bank, "error", res.err)
+			portfolio.UnavailableBanks[res.bank] = res.err.Error()
+			continue
+		}
+
+		for _, agreement := range res.agreements {
+			item := describeAgreement(res.bank, agreement, now, opts)
+			if item.MaturingSoon {
+				portfolio.MaturingSoon++
+			}
+			if item.PaymentDueSoon {
+				portfolio.PaymentsDueSoon++
+			}
+			portfolio.Agreements = append(portfolio.Agreements, item)
+		}
+	}
+
+	// Ближайшие к погашению - первыми, бессрочные - в конце
+	sort.SliceStable(portfolio.Agreements, func(i, j int) bool {
+		a, b := portfolio.Agreements[i].DaysToMaturity, portfolio.Agreements[j].DaysToMaturity
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+
+	return portfolio
+}
+
+// describeAgreement считает дни до погашения и ближайший платеж по договору
+func describeAgreement(bank string, agreement AgreementResponse, now time.Time, opts PortfolioOptions) PortfolioAgreement {
+	item := PortfolioAgreement{Bank: bank, AgreementResponse: agreement}
+	active := !agreementClosedStatuses[strings.ToUpper(agreement.Status)]
+	today := truncatePeriod(now, IntervalDay)
+
+	if !agreement.EndDate.IsZero() {
+		days := int(truncatePeriod(agreement.EndDate.UTC(), IntervalDay).Sub(today).Hours() / 24)
+		item.DaysToMaturity = &days
+		item.MaturingSoon = active && strings.EqualFold(agreement.ProductType, "DEPOSIT") &&
+			days >= 0 && days <= opts.MaturityDays
+	}
+
+	if active && strings.EqualFold(agreement.ProductType, "LOAN") && !agreement.StartDate.IsZero() {
+		if next, ok := nextMonthlyPayment(agreement.StartDate.UTC(), agreement.EndDate.Time, today); ok {
+			item.NextPaymentDate = &next
+			item.PaymentDueSoon = int(next.Sub(today).Hours()/24) <= opts.PaymentDays
+		}
+	}
+
+	return item
+}
+
+// nextMonthlyPayment ближайшая дата ежемесячного платежа (в день начала договора) не раньше today
+func nextMonthlyPayment(start, end time.Time, today time.Time) (time.Time, bool) {
+	start = truncatePeriod(start, IntervalDay)
+
+	for n := 1; n <= maxCalcTermMonths; n++ {
+		next := start.AddDate(0, n, 0)
+		if !end.IsZero() && next.After(end) {
+			return time.Time{}, false
+		}
+		if !next.Before(today) {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
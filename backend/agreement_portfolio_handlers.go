@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// AGREEMENT PORTFOLIO ENDPOINTS
+
+// handleGetAgreementPortfolio возвращает договоры всех банков со сроками погашения.
+// maturity_days (по умолчанию 30) - горизонт для вкладов, payment_days (7) - для платежей по кредитам
+func (s *Server) handleGetAgreementPortfolio(w http.ResponseWriter, r *http.Request, userID string) {
+	opts := PortfolioOptions{MaturityDays: 30, PaymentDays: 7}
+
+	for param, target := range map[string]*int{
+		"maturity_days": &opts.MaturityDays,
+		"payment_days":  &opts.PaymentDays,
+	} {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid '"+param+"' (must be a non-negative integer)")
+			return
+		}
+		*target = days
+	}
+
+	writeJSON(w, http.StatusOK, s.aggregator.GetAgreementPortfolio(r.Context(), userID, opts))
+}
+
+// handleGetAgreementEvents возвращает уведомления об изменениях договоров (новые первыми)
+// GET /api/agreements/events?unread=true
+func (s *Server) handleGetAgreementEvents(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	writeJSON(w, http.StatusOK, s.statuses.Events(userID, unreadOnly))
+}
+
+// handleMarkAgreementEventRead отмечает уведомление прочитанным
+// POST /api/agreements/events/{id}/read
+func (s *Server) handleMarkAgreementEventRead(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("id")
+	if eventID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing event ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.statuses.MarkRead(userID, eventID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to mark agreement event read", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to mark event read: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Event marked as read",
+	})
+}
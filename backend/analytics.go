@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// uncategorized категория для транзакций без категории
+const uncategorized = "Uncategorized"
+
+// CategorySummary расходы и доходы по одной категории в одной валюте
+type CategorySummary struct {
+	Category string  `json:"category"`
+	Currency string  `json:"currency"`
+	Expense  float64 `json:"expense"`
+	Income   float64 `json:"income"`
+	Count    int     `json:"count"`
+}
+
+// SummarizeByCategory группирует транзакции по категории и валюте (расходы по убыванию)
+func SummarizeByCategory(transactions []Transaction) []CategorySummary {
+	index := make(map[string]*CategorySummary)
+	var order []*CategorySummary
+
+	for _, tx := range transactions {
+		category := tx.Category
+		if category == "" {
+			category = uncategorized
+		}
+
+		key := category + "|" + tx.Currency
+		summary, exists := index[key]
+		if !exists {
+			summary = &CategorySummary{Category: category, Currency: tx.Currency}
+			index[key] = summary
+			order = append(order, summary)
+		}
+
+		if tx.Amount < 0 {
+			summary.Expense = roundMoney(summary.Expense - tx.Amount)
+		} else {
+			summary.Income = roundMoney(summary.Income + tx.Amount)
+		}
+		summary.Count++
+	}
+
+	result := make([]CategorySummary, 0, len(order))
+	for _, summary := range order {
+		result = append(result, *summary)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Expense > result[j].Expense
+	})
+
+	return result
+}
+
+// ANALYTICS ENDPOINTS
+
+// handleGetCategoryAnalytics возвращает расходы и доходы по категориям.
+// Разбитые транзакции учитываются своими частями
+// GET /api/analytics/categories?bank=vbank&from=2025-01-01T00:00:00Z&to=2025-12-31T23:59:59Z
+func (s *Server) handleGetCategoryAnalytics(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	bankFilter := r.URL.Query().Get("bank")
+
+	var fromPtr, toPtr *time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'from' date format (use RFC3339)")
+			return
+		}
+		fromPtr = &t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'to' date format (use RFC3339)")
+			return
+		}
+		toPtr = &t
+	}
+
+	if bankFilter != "" && bankFilter != "all" && bankFilter != ManualBankCode {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), bankFilter); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankFilter)
+			return
+		}
+	}
+
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	transactions, err := s.aggregator.GetTransactions(r.Context(), userID, bankFilter, fromPtr, toPtr)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to fetch transactions for analytics", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to fetch transactions: "+err.Error())
+		return
+	}
+	transactions = s.annotations.Apply(userID, transactions, filter)
+	transactions = s.splits.Expand(userID, transactions)
+
+	writeJSON(w, http.StatusOK, SummarizeByCategory(transactions))
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// annotationsCollection имя коллекции в хранилище
+const annotationsCollection = "transaction_annotations"
+
+// Ограничения пользовательских аннотаций
+const (
+	maxTagsPerTransaction = 20
+	maxTagLength          = 32
+	maxNoteLength         = 2000
+	maxAttachmentSize     = 10 << 20 // 10 MB
+	maxAttachmentsPerTx   = 10
+)
+
+// allowedAttachmentTypes типы файлов, которые можно прикрепить (определяются по содержимому)
+var allowedAttachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// TransactionAnnotation пользовательский слой поверх банковской транзакции
+type TransactionAnnotation struct {
+	UserID        string       `json:"user_id"`
+	Bank          string       `json:"bank"`
+	TransactionID string       `json:"transaction_id"`
+	Tags          []string     `json:"tags"`
+	Note          string       `json:"note,omitempty"`
+	Attachments   []Attachment `json:"attachments"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// Attachment метаданные прикрепленного файла (сам файл хранится в BlobStore)
+type Attachment struct {
+	ID          string    `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AnnotationInput тело запроса на изменение тегов и заметки
+type AnnotationInput struct {
+	Tags []string `json:"tags"`
+	Note string   `json:"note"`
+}
+
+// TransactionFilter фильтр транзакций по пользовательским аннотациям
+type TransactionFilter struct {
+	Tags           []string // транзакция должна содержать все теги
+	HasNote        *bool
+	HasAttachments *bool
+}
+
+// clone возвращает глубокую копию аннотации
+func (a *TransactionAnnotation) clone() TransactionAnnotation {
+	c := *a
+	c.Tags = append([]string{}, a.Tags...)
+	c.Attachments = append([]Attachment{}, a.Attachments...)
+	return c
+}
+
+// isEmpty сообщает, что в аннотации не осталось пользовательских данных
+func (a *TransactionAnnotation) isEmpty() bool {
+	return len(a.Tags) == 0 && a.Note == "" && len(a.Attachments) == 0
+}
+
+// AnnotationStore хранит теги, заметки и вложения к транзакциям
+type AnnotationStore struct {
+	store *JSONStore
+	blobs *BlobStore
+
+	mu          sync.RWMutex
+	annotations map[string]*TransactionAnnotation // key: "userID|bank|transactionID"
+}
+
+// NewAnnotationStore загружает аннотации из хранилища
+func NewAnnotationStore(store *JSONStore, blobs *BlobStore) (*AnnotationStore, error) {
+	s := &AnnotationStore{
+		store:       store,
+		blobs:       blobs,
+		annotations: make(map[string]*TransactionAnnotation),
+	}
+
+	var annotations []*TransactionAnnotation
+	if err := store.Load(annotationsCollection, &annotations); err != nil {
+		return nil, fmt.Errorf("load transaction annotations: %w", err)
+	}
+	for _, a := range annotations {
+		s.annotations[annotationKey(a.UserID, a.Bank, a.TransactionID)] = a
+	}
+
+	return s, nil
+}
+
+// Get возвращает аннотацию транзакции (пустую, если пользователь ничего не добавлял)
+func (s *AnnotationStore) Get(userID, bank, transactionID string) TransactionAnnotation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if a, exists := s.annotations[annotationKey(userID, bank, transactionID)]; exists {
+		return a.clone()
+	}
+
+	return TransactionAnnotation{
+		UserID:        userID,
+		Bank:          bank,
+		TransactionID: transactionID,
+		Tags:          []string{},
+		Attachments:   []Attachment{},
+	}
+}
+
+// Set заменяет теги и заметку транзакции
+func (s *AnnotationStore) Set(userID, bank, transactionID string, input AnnotationInput) (*TransactionAnnotation, error) {
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+	note := strings.TrimSpace(input.Note)
+	if len([]rune(note)) > maxNoteLength {
+		return nil, fmt.Errorf("%w: note is longer than %d characters", ErrInvalidInput, maxNoteLength)
+	}
+
+	return s.mutate(userID, bank, transactionID, func(a *TransactionAnnotation) error {
+		a.Tags = tags
+		a.Note = note
+		return nil
+	})
+}
+
+// Delete удаляет аннотацию транзакции вместе с вложениями
+func (s *AnnotationStore) Delete(userID, bank, transactionID string) error {
+	key := annotationKey(userID, bank, transactionID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, exists := s.annotations[key]
+	if !exists {
+		return nil
+	}
+
+	delete(s.annotations, key)
+	if err := s.persist(); err != nil {
+		s.annotations[key] = a
+		return err
+	}
+
+	for _, att := range a.Attachments {
+		if err := s.blobs.Delete(att.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddAttachment проверяет тип и размер файла и прикрепляет его к транзакции
+func (s *AnnotationStore) AddAttachment(userID, bank, transactionID, fileName string, data []byte) (*Attachment, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidInput)
+	}
+	if len(data) > maxAttachmentSize {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", ErrInvalidInput, maxAttachmentSize)
+	}
+
+	// Не доверяем Content-Type клиента - определяем тип по содержимому
+	contentType := http.DetectContentType(data)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	ext, allowed := allowedAttachmentTypes[contentType]
+	if !allowed {
+		return nil, fmt.Errorf("%w: unsupported file type %s (allowed: images and PDF)", ErrInvalidInput, contentType)
+	}
+
+	attachment := Attachment{
+		ID:          uuid.New().String() + ext,
+		FileName:    sanitizeFileName(fileName, ext),
+		ContentType: contentType,
+		Size:        len(data),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err := s.blobs.Put(attachment.ID, data); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+
+	_, err := s.mutate(userID, bank, transactionID, func(a *TransactionAnnotation) error {
+		if len(a.Attachments) >= maxAttachmentsPerTx {
+			return fmt.Errorf("%w: no more than %d attachments per transaction", ErrInvalidInput, maxAttachmentsPerTx)
+		}
+		a.Attachments = append(a.Attachments, attachment)
+		return nil
+	})
+	if err != nil {
+		_ = s.blobs.Delete(attachment.ID)
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// GetAttachment возвращает метаданные и содержимое вложения
+func (s *AnnotationStore) GetAttachment(userID, bank, transactionID, attachmentID string) (*Attachment, []byte, error) {
+	a := s.Get(userID, bank, transactionID)
+
+	for _, att := range a.Attachments {
+		if att.ID == attachmentID {
+			data, err := s.blobs.Get(att.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &att, data, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("attachment %s: %w", attachmentID, ErrNotFound)
+}
+
+// DeleteAttachment открепляет и удаляет вложение
+func (s *AnnotationStore) DeleteAttachment(userID, bank, transactionID, attachmentID string) error {
+	_, err := s.mutate(userID, bank, transactionID, func(a *TransactionAnnotation) error {
+		for i, att := range a.Attachments {
+			if att.ID == attachmentID {
+				a.Attachments = append(a.Attachments[:i], a.Attachments[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("attachment %s: %w", attachmentID, ErrNotFound)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.blobs.Delete(attachmentID)
+}
+
+// Apply добавляет аннотации к транзакциям и оставляет только подходящие под фильтр
+func (s *AnnotationStore) Apply(userID string, transactions []Transaction, filter TransactionFilter) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		tx.Tags = []string{}
+		tx.Attachments = []Attachment{}
+		if a, exists := s.annotations[annotationKey(userID, tx.Bank, tx.ID)]; exists {
+			c := a.clone()
+			tx.Tags = c.Tags
+			tx.Note = c.Note
+			tx.Attachments = c.Attachments
+		}
+
+		if filter.matches(tx) {
+			result = append(result, tx)
+		}
+	}
+
+	return result
+}
+
+// Tags возвращает все теги пользователя с количеством транзакций
+func (s *AnnotationStore) Tags(userID string) map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, a := range s.annotations {
+		if a.UserID != userID {
+			continue
+		}
+		for _, tag := range a.Tags {
+			counts[tag]++
+		}
+	}
+
+	return counts
+}
+
+// mutate применяет изменение к аннотации (создавая ее при необходимости) и сохраняет коллекцию
+func (s *AnnotationStore) mutate(userID, bank, transactionID string, fn func(*TransactionAnnotation) error) (*TransactionAnnotation, error) {
+	key := annotationKey(userID, bank, transactionID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, exists := s.annotations[key]
+	if !exists {
+		a = &TransactionAnnotation{
+			UserID:        userID,
+			Bank:          bank,
+			TransactionID: transactionID,
+			Tags:          []string{},
+			Attachments:   []Attachment{},
+		}
+	}
+
+	backup := a.clone()
+	if err := fn(a); err != nil {
+		*a = backup
+		return nil, err
+	}
+	a.UpdatedAt = time.Now().UTC()
+
+	// Пустые аннотации не храним
+	if a.isEmpty() {
+		delete(s.annotations, key)
+	} else {
+		s.annotations[key] = a
+	}
+
+	if err := s.persist(); err != nil {
+		if exists {
+			*a = backup
+			s.annotations[key] = a
+		} else {
+			delete(s.annotations, key)
+		}
+		return nil, err
+	}
+
+	c := a.clone()
+	return &c, nil
+}
+
+// persist сохраняет все аннотации (вызывается под блокировкой)
+func (s *AnnotationStore) persist() error {
+	annotations := make([]*TransactionAnnotation, 0, len(s.annotations))
+	for _, a := range s.annotations {
+		annotations = append(annotations, a)
+	}
+
+	return s.store.Save(annotationsCollection, annotations)
+}
+
+// matches проверяет транзакцию с уже примененной аннотацией
+func (f TransactionFilter) matches(tx Transaction) bool {
+	for _, want := range f.Tags {
+		found := false
+		for _, tag := range tx.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.HasNote != nil && (tx.Note != "") != *f.HasNote {
+		return false
+	}
+	if f.HasAttachments != nil && (len(tx.Attachments) > 0) != *f.HasAttachments {
+		return false
+	}
+
+	return true
+}
+
+// annotationKey формирует ключ аннотации
+func annotationKey(userID, bank, transactionID string) string {
+	return userID + "|" + bank + "|" + transactionID
+}
+
+// normalizeTags приводит теги к нижнему регистру, убирает пустые и дубликаты
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidInput, tag, maxTagLength)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	if len(result) > maxTagsPerTransaction {
+		return nil, fmt.Errorf("%w: no more than %d tags per transaction", ErrInvalidInput, maxTagsPerTransaction)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// sanitizeFileName оставляет только имя файла без пути
+func sanitizeFileName(name, ext string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" || name == "." || name == ".." {
+		name = "attachment" + ext
+	}
+	return name
+}
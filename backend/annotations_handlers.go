@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TRANSACTION ANNOTATION ENDPOINTS
+
+// handleGetAnnotation возвращает теги, заметку и вложения транзакции
+// GET /api/transactions/{bank}/{id}/annotation
+func (s *Server) handleGetAnnotation(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.annotations.Get(userID, bankCode, transactionID))
+}
+
+// handleSetAnnotation заменяет теги и заметку транзакции
+// PUT /api/transactions/{bank}/{id}/annotation
+func (s *Server) handleSetAnnotation(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input AnnotationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	annotation, err := s.annotations.Set(userID, bankCode, transactionID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to save annotation", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to save annotation: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, annotation)
+}
+
+// handleDeleteAnnotation удаляет теги, заметку и все вложения транзакции
+// DELETE /api/transactions/{bank}/{id}/annotation
+func (s *Server) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.annotations.Delete(userID, bankCode, transactionID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete annotation", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete annotation: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Annotation deleted successfully",
+	})
+}
+
+// handleUploadAttachment прикрепляет чек (изображение или PDF) к транзакции
+// POST /api/transactions/{bank}/{id}/attachments (multipart/form-data, поле "file")
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	// Запас на заголовки multipart поверх лимита на файл
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+64<<10)
+	if err := r.ParseMultipartForm(maxAttachmentSize); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid multipart body (max %d bytes): %v", maxAttachmentSize, err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Missing 'file' form field")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+
+	attachment, err := s.annotations.AddAttachment(userID, bankCode, transactionID, header.Filename, data)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to add attachment", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to add attachment: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, attachment)
+}
+
+// handleGetAttachment отдает содержимое вложения
+// GET /api/transactions/{bank}/{id}/attachments/{attachmentId}
+func (s *Server) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	attachment, data, err := s.annotations.GetAttachment(userID, bankCode, transactionID, r.PathValue("attachmentId"))
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get attachment: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.FileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleDeleteAttachment удаляет вложение
+// DELETE /api/transactions/{bank}/{id}/attachments/{attachmentId}
+func (s *Server) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.annotations.DeleteAttachment(userID, bankCode, transactionID, r.PathValue("attachmentId")); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete attachment", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete attachment: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// handleGetTags возвращает теги пользователя с количеством транзакций
+// GET /api/tags
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.annotations.Tags(userID))
+}
+
+// annotationTarget извлекает банк и ID транзакции из пути и проверяет банк
+func (s *Server) annotationTarget(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	bankCode := r.PathValue("bank")
+	transactionID := r.PathValue("id")
+	if bankCode == "" || transactionID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing bank or transaction ID in path")
+		return "", "", false
+	}
+
+	if bankCode != ManualBankCode {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankCode)
+			return "", "", false
+		}
+	}
+
+	return bankCode, transactionID, true
+}
+
+// parseTransactionFilter читает фильтры по аннотациям: tag (повторяемый или через запятую), has_note, has_attachments
+func parseTransactionFilter(r *http.Request) (TransactionFilter, error) {
+	var filter TransactionFilter
+	query := r.URL.Query()
+
+	for _, value := range query["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+
+	for name, target := range map[string]**bool{
+		"has_note":        &filter.HasNote,
+		"has_attachments": &filter.HasAttachments,
+	} {
+		if v := query.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid '%s' value (use true or false)", name)
+			}
+			*target = &b
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeysCollection коллекция в хранилище
+const apiKeysCollection = "api_keys"
+
+const (
+	apiKeyPrefix         = "fhk_"
+	apiKeySecretSize     = 32
+	apiKeyDisplayLength  = 12 // начало ключа, по которому его можно узнать в списке
+	maxAPIKeysPerUser    = 20
+	maxAPIKeyTTLDays     = 365
+	apiKeyLastUsedPeriod = time.Minute // чаще last_used_at не сохраняется
+)
+
+// Области доступа API ключей
+const (
+	ScopeReadAccounts      = "read:accounts"
+	ScopeWriteAccounts     = "write:accounts"
+	ScopeReadTransactions  = "read:transactions"
+	ScopeWriteTransactions = "write:transactions"
+	ScopeReadPayments      = "read:payments"
+	ScopeWritePayments     = "write:payments"
+	ScopeReadProducts      = "read:products"
+	ScopeWriteProducts     = "write:products"
+	ScopeReadGoals         = "read:goals"
+	ScopeWriteGoals        = "write:goals"
+)
+
+// apiKeyScopes все допустимые области доступа
+var apiKeyScopes = []string{
+	ScopeReadAccounts, ScopeWriteAccounts,
+	ScopeReadTransactions, ScopeWriteTransactions,
+	ScopeReadPayments, ScopeWritePayments,
+	ScopeReadProducts, ScopeWriteProducts,
+	ScopeReadGoals, ScopeWriteGoals,
+}
+
+// scopeResources ресурс области доступа по первому сегменту пути после /api/.
+// Маршруты не из списка (учетная запись, TOTP, политики платежей, сами ключи) по API ключу
+// недоступны: ключ не должен снимать ограничения, которые проверяются для его же платежей
+var scopeResources = map[string]string{
+	"accounts":           "accounts",
+	"consents":           "accounts",
+	"banks":              "accounts",
+	"manual-accounts":    "accounts",
+	"transactions":       "transactions",
+	"tags":               "transactions",
+	"analytics":          "transactions",
+	"payments":           "payments",
+	"payment-consents":   "payments",
+	"payees":             "payments",
+	"payment-templates":  "payments",
+	"scheduled-payments": "payments",
+	"transfers":          "payments",
+	"products":           "products",
+	"agreements":         "products",
+	"pa-consents":        "products",
+	"calculator":         "products",
+	"goals":              "goals",
+}
+
+// APIKey ключ для доступа сервисов без входа пользователя. Сам ключ не хранится, только его SHA-256.
+// Ключ пользователя действует от его имени; ключ команды (TenantID) выпускает администратор,
+// и он действует от имени любого пользователя команды, указанного в запросе
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`             // владелец; для ключа команды - выпустивший администратор
+	TenantID   string     `json:"tenant_id,omitempty"` // ключ команды
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash,omitempty"`
+	Prefix     string     `json:"prefix"` // начало ключа для узнавания в списке
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyInput параметры нового ключа
+type APIKeyInput struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 - бессрочный
+}
+
+// TenantAPIKeyInput параметры ключа команды (только для администраторов)
+type TenantAPIKeyInput struct {
+	Tenant string `json:"tenant"`
+	APIKeyInput
+}
+
+// CreatedAPIKey ответ на создание ключа. Ключ показывается только здесь
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyStore хранит API ключи пользователей и проверяет их
+type APIKeyStore struct {
+	store *JSONStore
+
+	mu     sync.Mutex
+	keys   map[string]*APIKey // key: ID
+	hashes map[string]string  // hash -> ID
+}
+
+// NewAPIKeyStore загружает API ключи
+func NewAPIKeyStore(store *JSONStore) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		store:  store,
+		keys:   make(map[string]*APIKey),
+		hashes: make(map[string]string),
+	}
+
+	var keys []*APIKey
+	if err := store.Load(apiKeysCollection, &keys); err != nil {
+		return nil, fmt.Errorf("load api keys: %w", err)
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+		s.hashes[key.Hash] = key.ID
+	}
+
+	return s, nil
+}
+
+// Create выпускает ключ пользователя с указанными областями доступа
+func (s *APIKeyStore) Create(ctx context.Context, userID string, input APIKeyInput, now time.Time) (*CreatedAPIKey, error) {
+	return s.create(ctx, userID, "", input, now)
+}
+
+// CreateTenantKey выпускает ключ команды. Наличие команды проверяет вызывающий
+func (s *APIKeyStore) CreateTenantKey(ctx context.Context, adminID, tenantID string, input APIKeyInput, now time.Time) (*CreatedAPIKey, error) {
+	if tenantID == "" {
+		return nil, ValidationErrors{{Field: "tenant", Code: "required", Message: "tenant is required"}}
+	}
+	return s.create(ctx, adminID, tenantID, input, now)
+}
+
+// create выпускает ключ пользователя или, с tenantID, ключ команды
+func (s *APIKeyStore) create(ctx context.Context, userID, tenantID string, input APIKeyInput, now time.Time) (*CreatedAPIKey, error) {
+	scopes, err := input.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate api key: %w", err)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Лимит считается отдельно для ключей пользователя и для ключей каждой команды
+	active := 0
+	for _, key := range s.keys {
+		if key.usable(now) && key.TenantID == tenantID && (tenantID != "" || key.UserID == userID) {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, fmt.Errorf("%w: at most %d active API keys per user or tenant, revoke unused keys first", ErrInvalidInput, maxAPIKeysPerUser)
+	}
+
+	key := &APIKey{
+		ID:        "key-" + uuid.New().String(),
+		UserID:    userID,
+		TenantID:  tenantID,
+		Name:      strings.TrimSpace(input.Name),
+		Hash:      hashToken(secret),
+		Prefix:    secret[:apiKeyDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	s.keys[key.ID] = key
+	s.hashes[key.Hash] = key.ID
+	if err := s.persist(); err != nil {
+		delete(s.keys, key.ID)
+		delete(s.hashes, key.Hash)
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Created API key", "api_key_id", key.ID, "user_id", userID, "tenant", tenantID, "scopes", strings.Join(scopes, ","))
+	return &CreatedAPIKey{APIKey: key.view(), Key: secret}, nil
+}
+
+// List возвращает ключи пользователя (без хэшей), новые первыми
+func (s *APIKeyStore) List(userID string) []APIKey {
+	return s.list(func(key *APIKey) bool { return key.TenantID == "" && key.UserID == userID })
+}
+
+// ListTenantKeys возвращает ключи команд (без хэшей), новые первыми
+func (s *APIKeyStore) ListTenantKeys() []APIKey {
+	return s.list(func(key *APIKey) bool { return key.TenantID != "" })
+}
+
+// list возвращает подходящие ключи (без хэшей), новые первыми
+func (s *APIKeyStore) list(match func(key *APIKey) bool) []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]APIKey, 0)
+	for _, key := range s.keys {
+		if match(key) {
+			result = append(result, key.view())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// Revoke отзывает ключ пользователя. Запись остается в списке с revoked_at
+func (s *APIKeyStore) Revoke(ctx context.Context, userID, keyID string, now time.Time) (*APIKey, error) {
+	return s.revoke(ctx, keyID, now, func(key *APIKey) bool { return key.TenantID == "" && key.UserID == userID })
+}
+
+// RevokeTenantKey отзывает ключ команды
+func (s *APIKeyStore) RevokeTenantKey(ctx context.Context, keyID string, now time.Time) (*APIKey, error) {
+	return s.revoke(ctx, keyID, now, func(key *APIKey) bool { return key.TenantID != "" })
+}
+
+// revoke отзывает ключ, если он подходит под match
+func (s *APIKeyStore) revoke(ctx context.Context, keyID string, now time.Time, match func(key *APIKey) bool) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.keys[keyID]
+	if !exists || !match(key) {
+		return nil, fmt.Errorf("api key %s: %w", keyID, ErrNotFound)
+	}
+
+	if key.RevokedAt == nil {
+		key.RevokedAt = &now
+		if err := s.persist(); err != nil {
+			key.RevokedAt = nil
+			return nil, err
+		}
+		authLog.InfoContext(ctx, "Revoked API key", "api_key_id", keyID, "user_id", key.UserID, "tenant", key.TenantID)
+	}
+
+	result := key.view()
+	return &result, nil
+}
+
+// Authenticate находит действующий ключ и отмечает его использование
+func (s *APIKeyStore) Authenticate(ctx context.Context, secret string, now time.Time) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyID, exists := s.hashes[hashToken(secret)]
+	if !exists {
+		return nil, fmt.Errorf("%w: invalid API key", ErrUnauthorized)
+	}
+	key := s.keys[keyID]
+	if !key.usable(now) {
+		return nil, fmt.Errorf("%w: API key is revoked or expired", ErrUnauthorized)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedPeriod {
+		previous := key.LastUsedAt
+		key.LastUsedAt = &now
+		if err := s.persist(); err != nil {
+			key.LastUsedAt = previous
+			authLog.WarnContext(ctx, "Failed to save API key last use", "api_key_id", keyID, "error", err)
+		}
+	}
+
+	result := key.view()
+	return &result, nil
+}
+
+// persist сохраняет ключи (вызывается под блокировкой)
+func (s *APIKeyStore) persist() error {
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return s.store.Save(apiKeysCollection, keys)
+}
+
+// usable ключ не отозван и не истек
+func (k *APIKey) usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope сообщает, разрешена ли ключу область доступа. write включает read того же ресурса
+func (k *APIKey) HasScope(scope string) bool {
+	resource := strings.TrimPrefix(strings.TrimPrefix(scope, "read:"), "write:")
+	for _, s := range k.Scopes {
+		if s == scope || s == "write:"+resource {
+			return true
+		}
+	}
+	return false
+}
+
+// view копия ключа без хэша
+func (k *APIKey) view() APIKey {
+	c := *k
+	c.Hash = ""
+	c.Scopes = append([]string{}, k.Scopes...)
+	return c
+}
+
+// validate проверяет параметры ключа и возвращает области доступа без повторов
+func (in *APIKeyInput) validate() ([]string, error) {
+	var errs ValidationErrors
+
+	if name := strings.TrimSpace(in.Name); name == "" || len([]rune(name)) > 100 {
+		errs.add("name", "required", "name is required (up to 100 characters)")
+	}
+	if len(in.Scopes) == 0 {
+		errs.add("scopes", "required", "at least one scope is required")
+	}
+
+	var scopes []string
+	for i, scope := range in.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !containsString(apiKeyScopes, scope) {
+			errs.add(fmt.Sprintf("scopes[%d]", i), "invalid_value", "unknown scope %q (allowed: %s)", scope, strings.Join(apiKeyScopes, ", "))
+			continue
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if in.ExpiresInDays < 0 || in.ExpiresInDays > maxAPIKeyTTLDays {
+		errs.add("expires_in_days", "invalid_value", "expires_in_days must be between 0 and %d", maxAPIKeyTTLDays)
+	}
+
+	return scopes, errs.err()
+}
+
+// requiredScope область доступа, нужная для запроса. Пустая строка - маршрут
+// недоступен по API ключу. Калькулятор ничего не меняет и требует только чтения
+func requiredScope(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, "/api/")
+	if path == r.URL.Path {
+		return ""
+	}
+	segment, _, _ := strings.Cut(path, "/")
+
+	resource, ok := scopeResources[segment]
+	if !ok {
+		return ""
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || segment == "calculator" {
+		return "read:" + resource
+	}
+	return "write:" + resource
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API KEY ENDPOINTS
+
+// handleListAPIKeys возвращает API ключи пользователя без самих ключей
+// GET /api/api-keys
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	keys := s.apiKeys.List(userID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"count":    len(keys),
+		"scopes":   apiKeyScopes,
+	})
+}
+
+// handleCreateAPIKey выпускает API ключ. Ключ возвращается только в этом ответе
+// POST /api/api-keys
+// Тело: {"name": "reporting", "scopes": ["read:accounts", "read:transactions"], "expires_in_days": 90}
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input APIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	key, err := s.apiKeys.Create(r.Context(), userID, input, time.Now().UTC())
+	event := AuditEvent{Action: AuditAPIKeyCreate, Err: err}
+	if key != nil {
+		event.Targets = map[string]string{"api_key_id": key.ID}
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create API key", "error", err)
+		writeValidationError(w, r, "Failed to create API key", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// handleRevokeAPIKey отзывает API ключ
+// DELETE /api/api-keys/{id}
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	keyID := r.PathValue("id")
+	if keyID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing API key ID in path")
+		return
+	}
+
+	key, err := s.apiKeys.Revoke(r.Context(), userID, keyID, time.Now().UTC())
+	s.audit.Record(r.Context(), AuditEvent{Action: AuditAPIKeyRevoke, Targets: map[string]string{"api_key_id": keyID}, Err: err})
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to revoke API key: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, key)
+}
+
+// TENANT API KEYS (ADMIN)
+
+// handleListTenantAPIKeys возвращает ключи команд без самих ключей
+// GET /api/admin/api-keys
+func (s *Server) handleListTenantAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	keys := s.apiKeys.ListTenantKeys()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"count":    len(keys),
+		"scopes":   apiKeyScopes,
+	})
+}
+
+// handleCreateTenantAPIKey выпускает ключ команды. Ключ возвращается только в этом ответе
+// POST /api/admin/api-keys
+// Тело: {"tenant": "team053", "name": "reporting", "scopes": ["read:accounts"], "expires_in_days": 90}
+func (s *Server) handleCreateTenantAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var input TenantAPIKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var key *CreatedAPIKey
+	var err error
+	tenantID := strings.TrimSpace(input.Tenant)
+	if _, ok := s.config.FindTenant(tenantID); tenantID != "" && !ok {
+		err = ValidationErrors{{Field: "tenant", Code: "not_found", Message: "unknown tenant " + tenantID}}
+	} else {
+		key, err = s.apiKeys.CreateTenantKey(r.Context(), getUserID(r.Context()), tenantID, input.APIKeyInput, time.Now().UTC())
+	}
+
+	event := AuditEvent{Action: AuditAPIKeyCreate, Err: err}
+	if key != nil {
+		event.Targets = map[string]string{"api_key_id": key.ID, "tenant": key.TenantID}
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create tenant API key", "error", err)
+		writeValidationError(w, r, "Failed to create API key", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// handleRevokeTenantAPIKey отзывает ключ команды
+// DELETE /api/admin/api-keys/{id}
+func (s *Server) handleRevokeTenantAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	keyID := r.PathValue("id")
+	if keyID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing API key ID in path")
+		return
+	}
+
+	key, err := s.apiKeys.RevokeTenantKey(r.Context(), keyID, time.Now().UTC())
+	s.audit.Record(r.Context(), AuditEvent{Action: AuditAPIKeyRevoke, Targets: map[string]string{"api_key_id": keyID}, Err: err})
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to revoke API key: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, key)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/api/accounts", "read:accounts"},
+		{http.MethodPost, "/api/payments", "write:payments"},
+		{http.MethodGet, "/api/transfers/tr-1", "read:payments"},
+		{http.MethodPost, "/api/calculator/loan", "read:products"},
+		{http.MethodDelete, "/api/goals/g-1", "write:goals"},
+		// Только с токеном входа
+		{http.MethodGet, "/api/policies", ""},
+		{http.MethodPut, "/api/policies", ""},
+		{http.MethodGet, "/api/policies/evaluations", ""},
+		{http.MethodPost, "/api/api-keys", ""},
+		{http.MethodGet, "/api/auth/me", ""},
+		{http.MethodGet, "/health", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if got := requiredScope(r); got != tt.want {
+				t.Errorf("requiredScope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	auth := newTestAuthStore(t)
+	auth.users["team1-1"] = &AuthUser{ID: "team1-1", TenantID: "team1", Login: "alice"}
+	auth.users["team2-1"] = &AuthUser{ID: "team2-1", TenantID: "team2", Login: "bob"}
+
+	store, err := NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewAPIKeyStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	input := APIKeyInput{Name: "reporting", Scopes: []string{ScopeReadAccounts}}
+	userKey, err := keys.Create(ctx, "team1-1", input, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantKey, err := keys.CreateTenantKey(ctx, "admin-1", "team2", input, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.CreateTenantKey(ctx, "admin-1", "", input, now); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("tenant key without tenant error = %v, want ErrInvalidInput", err)
+	}
+
+	// Ключи команд не видны и не отзываются через ключи пользователя
+	if list := keys.List("admin-1"); len(list) != 0 {
+		t.Errorf("user list contains tenant keys: %+v", list)
+	}
+	if list := keys.ListTenantKeys(); len(list) != 1 || list[0].TenantID != "team2" {
+		t.Errorf("tenant keys = %+v", list)
+	}
+	if _, err := keys.Revoke(ctx, "admin-1", tenantKey.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("revoke tenant key as user error = %v, want ErrNotFound", err)
+	}
+
+	server := &Server{auth: auth, apiKeys: keys}
+	handler := server.withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(getUserID(r.Context()) + " " + getTenantID(r.Context())))
+	}))
+
+	tests := []struct {
+		name     string
+		key      string
+		path     string
+		userID   string
+		wantCode int
+		wantBody string
+	}{
+		{"user key", userKey.Key, "/api/accounts", "", http.StatusOK, "team1-1 team1"},
+		{"user key ignores X-User-Id", userKey.Key, "/api/accounts", "team2-1", http.StatusOK, "team1-1 team1"},
+		{"tenant key acts as tenant user", tenantKey.Key, "/api/accounts", "team2-1", http.StatusOK, "team2-1 team2"},
+		{"tenant key without user", tenantKey.Key, "/api/accounts", "", http.StatusBadRequest, ""},
+		{"tenant key for other tenant", tenantKey.Key, "/api/accounts", "team1-1", http.StatusForbidden, ""},
+		{"tenant key for unknown user", tenantKey.Key, "/api/accounts", "team2-99", http.StatusForbidden, ""},
+		{"tenant key without scope", tenantKey.Key, "/api/payments", "team2-1", http.StatusForbidden, ""},
+		{"unknown key", "fhk_unknown", "/api/accounts", "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Authorization", "ApiKey "+tt.key)
+			if tt.userID != "" {
+				r.Header.Set("X-User-Id", tt.userID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("user and tenant = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	if _, err := keys.RevokeTenantKey(ctx, tenantKey.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(ctx, tenantKey.Key, now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("revoked tenant key error = %v, want ErrUnauthorized", err)
+	}
+}
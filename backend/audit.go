@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Действия, попадающие в журнал аудита
+const (
+	AuditConsentCreate        = "consent.create"
+	AuditConsentRevoke        = "consent.revoke"
+	AuditPaymentConsentCreate = "payment_consent.create"
+	AuditPaymentCreate        = "payment.create"
+	AuditPAConsentCreate      = "pa_consent.create"
+	AuditAgreementOpen        = "agreement.open"
+	AuditAgreementClose       = "agreement.close"
+	AuditAuthRegister         = "auth.register"
+	AuditAuthLogin            = "auth.login"
+	AuditAuthRefresh          = "auth.refresh"
+	AuditAuthLogout           = "auth.logout"
+	AuditAPIKeyCreate         = "api_key.create"
+	AuditAPIKeyRevoke         = "api_key.revoke"
+	AuditInviteCreate         = "invite.create"
+	AuditInviteRevoke         = "invite.revoke"
+	AuditEncryptionReencrypt  = "encryption.reencrypt"
+)
+
+// Результаты операций
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied" // запрещено политикой, правами или неверными учетными данными
+)
+
+// auditAAD привязка зашифрованных строк к журналу аудита
+const auditAAD = "audit"
+
+const (
+	auditActorSystem    = "system"    // фоновые задачи (расписание, отслеживание статусов)
+	auditActorAnonymous = "anonymous" // вход и обновление токена с неверными данными
+	defaultAuditLimit   = 100
+	maxAuditLimit       = 1000
+)
+
+// AuditEntry запись журнала. Hash - SHA-256 от записи без Hash, включая PrevHash
+// предыдущей записи: изменение или удаление любой записи ломает цепочку
+type AuditEntry struct {
+	Seq       int64             `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Action    string            `json:"action"`
+	Actor     string            `json:"actor"` // пользователь, выполнивший операцию
+	APIKeyID  string            `json:"api_key_id,omitempty"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Subject   string            `json:"subject,omitempty"` // клиент банка, если отличается от actor
+	RequestID string            `json:"request_id,omitempty"`
+	Bank      string            `json:"bank,omitempty"`
+	Targets   map[string]string `json:"targets,omitempty"` // consent_id, payment_id, agreement_id, ...
+	Outcome   string            `json:"outcome"`
+	Error     string            `json:"error,omitempty"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+// AuditEvent операция для записи в журнал. Actor, ключ, арендатор и request ID
+// берутся из контекста запроса, если не заданы явно
+type AuditEvent struct {
+	Action  string
+	Actor   string
+	Subject string
+	Bank    string
+	Targets map[string]string
+	Err     error
+}
+
+// AuditFilter фильтр выборки журнала
+type AuditFilter struct {
+	Action    string // точное действие или группа: "auth" - все auth.*
+	Actor     string
+	Bank      string
+	Outcome   string
+	RequestID string
+	Target    string // ID в любом из targets
+	From      *time.Time
+	To        *time.Time
+	Limit     int // 0 - без ограничения
+}
+
+// AuditVerification результат проверки цепочки
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Entries  int    `json:"entries"`
+	HeadHash string `json:"head_hash,omitempty"` // хэш последней записи: сохраните его отдельно, чтобы обнаружить подмену всего журнала
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AuditLog журнал аудита: файл JSON Lines, в который записи только дописываются.
+// С включенным шифрованием каждая строка - конверт в base64 (см. Encryptor).
+// Записи в памяти не хранятся: выборки и выгрузки читают файл, для продолжения
+// цепочки достаточно номера и хэша последней записи
+type AuditLog struct {
+	path string
+	enc  *Encryptor
+
+	mu       sync.Mutex
+	file     *os.File
+	lastSeq  int64
+	lastHash string
+}
+
+// NewAuditLog открывает журнал и проверяет цепочку хэшей. Нарушенная цепочка
+// не мешает запуску, но попадает в лог и в /api/admin/audit/verify
+func NewAuditLog(path string, enc *Encryptor) (*AuditLog, error) {
+	var chain auditChain
+	if file, err := os.Open(path); err == nil {
+		err = scanAuditEntries(file, enc, func(entry AuditEntry) error {
+			chain.add(entry)
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	if result := chain.result(); !result.OK {
+		storageLog.Warn("Audit log chain is broken", "seq", result.BrokenAt, "error", result.Error)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &AuditLog{path: path, enc: enc, file: file, lastSeq: chain.last.Seq, lastHash: chain.last.Hash}, nil
+}
+
+// Record дописывает операцию в журнал. Ошибка записи не отменяет уже выполненную
+// операцию и только логируется
+func (l *AuditLog) Record(ctx context.Context, event AuditEvent) {
+	entry := AuditEntry{
+		Time:      time.Now().UTC(),
+		Action:    event.Action,
+		Actor:     event.Actor,
+		APIKeyID:  getAPIKeyID(ctx),
+		Tenant:    getTenantID(ctx),
+		RequestID: getRequestID(ctx),
+		Bank:      event.Bank,
+		Outcome:   auditOutcome(event.Err),
+	}
+	if entry.Actor == "" {
+		entry.Actor = getUserID(ctx)
+	}
+	if entry.Actor == "" {
+		entry.Actor = auditActorSystem
+	}
+	if event.Subject != entry.Actor {
+		entry.Subject = event.Subject
+	}
+	for key, value := range event.Targets {
+		if value == "" {
+			continue
+		}
+		if entry.Targets == nil {
+			entry.Targets = make(map[string]string)
+		}
+		entry.Targets[key] = value
+	}
+	if event.Err != nil {
+		entry.Error = event.Err.Error()
+	}
+
+	if err := l.append(entry); err != nil {
+		storageLog.ErrorContext(ctx, "Failed to write audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+// append вычисляет хэш и записывает запись в конец файла
+func (l *AuditLog) append(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.lastSeq + 1
+	entry.PrevHash = l.lastHash
+	hash, err := auditHash(entry)
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if line, err = sealAuditLine(l.enc, line); err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.lastSeq = entry.Seq
+	l.lastHash = entry.Hash
+	return nil
+}
+
+// Query возвращает записи по фильтру, новые первыми. Из файла в памяти
+// остаются только последние Limit подходящих записей
+func (l *AuditLog) Query(filter AuditFilter) ([]AuditEntry, error) {
+	result := make([]AuditEntry, 0)
+	_, err := l.scan(func(entry AuditEntry) error {
+		if !filter.matches(&entry) {
+			return nil
+		}
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			result = append(result[:0], result[1:]...)
+		}
+		result = append(result, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, nil
+}
+
+// Export передает в fn записи по фильтру в порядке записи, не собирая их в памяти
+func (l *AuditLog) Export(filter AuditFilter, fn func(entry AuditEntry) error) error {
+	_, err := l.scan(func(entry AuditEntry) error {
+		if !filter.matches(&entry) {
+			return nil
+		}
+		return fn(entry)
+	})
+	return err
+}
+
+// Verify перечитывает файл журнала и проверяет цепочку хэшей. Файл, в котором
+// записей меньше, чем было записано, считается урезанным
+func (l *AuditLog) Verify() AuditVerification {
+	var chain auditChain
+	lastSeq, err := l.scan(func(entry AuditEntry) error {
+		chain.add(entry)
+		return nil
+	})
+	if err != nil {
+		return AuditVerification{Error: err.Error()}
+	}
+	result := chain.result()
+	if result.OK && int64(result.Entries) < lastSeq {
+		return AuditVerification{Entries: result.Entries, BrokenAt: int64(result.Entries + 1), Error: "audit log file is truncated"}
+	}
+	return result
+}
+
+// scan читает записи файла по одной до конца последней записи на момент вызова и
+// возвращает ее номер. Дописывание и замена файла при перешифровании чтению не мешают
+func (l *AuditLog) scan(fn func(entry AuditEntry) error) (int64, error) {
+	l.mu.Lock()
+	lastSeq := l.lastSeq
+	file, err := os.Open(l.path)
+	var info os.FileInfo
+	if err == nil {
+		info, err = file.Stat()
+	}
+	l.mu.Unlock()
+
+	if errors.Is(err, os.ErrNotExist) {
+		return lastSeq, nil
+	}
+	if file != nil {
+		defer file.Close()
+	}
+	if err != nil {
+		return lastSeq, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return lastSeq, scanAuditEntries(io.LimitReader(file, info.Size()), l.enc, fn)
+}
+
+// keyIDs количество строк журнала по ключам шифрования
+func (l *AuditLog) keyIDs() (map[string]int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines, err := readAuditLines(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, line := range lines {
+		label := auditLineKeyID(l.enc, line)
+		if label == "" {
+			label = "plaintext"
+		}
+		counts[label]++
+	}
+	return counts, nil
+}
+
+// reencrypt переписывает журнал активным ключом. Хэши считаются от открытых
+// записей, поэтому цепочка после перешифрования не меняется
+func (l *AuditLog) reencrypt(report *ReencryptReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report.Checked++
+	lines, err := readAuditLines(l.path)
+	if err != nil {
+		report.Failed = append(report.Failed, "audit log: "+err.Error())
+		return
+	}
+
+	changed := false
+	var buf bytes.Buffer
+	for i, line := range lines {
+		plaintext, err := openAuditLine(l.enc, line)
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("audit log line %d: %v", i+1, err))
+			return
+		}
+		if auditLineKeyID(l.enc, line) != l.enc.keys.ActiveKeyID() {
+			if line, err = sealAuditLine(l.enc, plaintext); err != nil {
+				report.Failed = append(report.Failed, fmt.Sprintf("audit log line %d: %v", i+1, err))
+				return
+			}
+			changed = true
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if !changed {
+		return
+	}
+
+	// Файл подменяется целиком: дописывать дальше нужно в новый
+	if err := writeFileAtomic(l.path, buf.Bytes()); err != nil {
+		report.Failed = append(report.Failed, "audit log: "+err.Error())
+		return
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		report.Failed = append(report.Failed, "reopen audit log: "+err.Error())
+		return
+	}
+	l.file.Close()
+	l.file = file
+	report.Reencrypted++
+}
+
+// scanAuditEntries читает записи журнала по одной и передает в fn. Ошибка fn
+// прекращает чтение
+func scanAuditEntries(r io.Reader, enc *Encryptor, fn func(entry AuditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		data, err := openAuditLine(enc, line)
+		if err != nil {
+			return fmt.Errorf("audit log line %d: %w", n, err)
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("parse audit log line %d: %w", n, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read audit log: %w", err)
+	}
+
+	return nil
+}
+
+// readAuditLines читает непустые строки файла журнала
+func readAuditLines(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+
+	return lines, nil
+}
+
+// sealAuditLine шифрует строку журнала (без шифрования - возвращает как есть)
+func sealAuditLine(enc *Encryptor, line []byte) ([]byte, error) {
+	if !enc.Enabled() {
+		return line, nil
+	}
+	sealed, err := enc.Seal(auditAAD, line)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt audit entry: %w", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openAuditLine расшифровывает строку журнала; открытые строки начинаются с "{"
+// и с включенным шифрованием читаются только при миграции
+func openAuditLine(enc *Encryptor, line []byte) ([]byte, error) {
+	if bytes.HasPrefix(line, []byte("{")) {
+		if err := enc.checkPlaintext(); err != nil {
+			return nil, err
+		}
+		return line, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return nil, fmt.Errorf("decode encrypted entry: %w", err)
+	}
+	return enc.Open(auditAAD, data)
+}
+
+// auditLineKeyID мастер-ключ строки журнала ("" - строка открыта)
+func auditLineKeyID(enc *Encryptor, line []byte) string {
+	if bytes.HasPrefix(line, []byte("{")) {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		return ""
+	}
+	return enc.KeyID(data)
+}
+
+// auditChain проверяет цепочку хэшей по мере чтения журнала
+type auditChain struct {
+	entries  int
+	last     AuditEntry // последняя прочитанная запись
+	brokenAt int64
+	err      string
+}
+
+// add пересчитывает хэш записи и проверяет, что она продолжает предыдущую
+func (c *auditChain) add(entry AuditEntry) {
+	c.entries++
+	if c.err == "" {
+		if entry.PrevHash != c.last.Hash || entry.Seq != c.last.Seq+1 {
+			c.brokenAt, c.err = entry.Seq, "entry does not follow the previous one"
+		} else if hash, err := auditHash(entry); err != nil || hash != entry.Hash {
+			c.brokenAt, c.err = entry.Seq, "entry hash mismatch"
+		}
+	}
+	c.last = AuditEntry{Seq: entry.Seq, Hash: entry.Hash}
+}
+
+// result итог проверки прочитанных записей
+func (c *auditChain) result() AuditVerification {
+	if c.err != "" {
+		return AuditVerification{Entries: c.entries, BrokenAt: c.brokenAt, Error: c.err}
+	}
+	return AuditVerification{OK: true, Entries: c.entries, HeadHash: c.last.Hash}
+}
+
+// verifyAuditChain пересчитывает хэши и проверяет связность записей
+func verifyAuditChain(entries []AuditEntry) AuditVerification {
+	var chain auditChain
+	for _, entry := range entries {
+		chain.add(entry)
+	}
+	return chain.result()
+}
+
+// auditHash SHA-256 от JSON записи без поля Hash (ключи targets сортируются при сериализации)
+func auditHash(entry AuditEntry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("marshal audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// auditOutcome результат операции по ошибке
+func auditOutcome(err error) string {
+	var violation *PolicyViolation
+	switch {
+	case err == nil:
+		return AuditSuccess
+	case errors.As(err, &violation), errors.Is(err, ErrForbidden), errors.Is(err, ErrUnauthorized):
+		return AuditDenied
+	default:
+		return AuditFailure
+	}
+}
+
+// matches проверяет запись по фильтру
+func (f *AuditFilter) matches(entry *AuditEntry) bool {
+	if f.Action != "" && entry.Action != f.Action && !strings.HasPrefix(entry.Action, f.Action+".") {
+		return false
+	}
+	if f.Actor != "" && entry.Actor != f.Actor && entry.Subject != f.Actor {
+		return false
+	}
+	if f.Bank != "" && entry.Bank != f.Bank {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	if f.RequestID != "" && entry.RequestID != f.RequestID {
+		return false
+	}
+	if f.From != nil && entry.Time.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && entry.Time.After(*f.To) {
+		return false
+	}
+	if f.Target != "" {
+		found := false
+		for _, id := range entry.Targets {
+			if id == f.Target {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ADMIN AUDIT ENDPOINTS
+
+// handleQueryAudit возвращает записи журнала аудита по фильтрам (новые первыми)
+// GET /api/admin/audit?action=payment&actor=team053-1&bank=vbank&outcome=denied&target=pay-1&from=...&to=...&limit=100
+func (s *Server) handleQueryAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter.Limit = defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit' (use 1..%d)", maxAuditLimit))
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		handlersLog.ErrorContext(r.Context(), "Failed to read audit log", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to read audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// handleExportAudit выгружает записи журнала по фильтрам в порядке записи. В JSON Lines
+// записи выгружаются как есть, и цепочку хэшей можно проверить вне сервиса
+// GET /api/admin/audit/export?format=jsonl|csv
+func (s *Server) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		writeError(w, r, http.StatusBadRequest, "Invalid 'format' (use jsonl or csv)")
+		return
+	}
+
+	// Записи пишутся в ответ по мере чтения журнала. Заголовки отправляются с первой
+	// записью, чтобы ошибку чтения в начале файла можно было вернуть статусом
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		started = true
+		filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if format == "jsonl" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write([]string{"seq", "time", "action", "actor", "api_key_id", "tenant", "subject", "request_id", "bank", "targets", "outcome", "error", "prev_hash", "hash"})
+	}
+
+	err = s.audit.Export(filter, func(entry AuditEntry) error {
+		if !started {
+			start()
+		}
+		if format == "jsonl" {
+			return encoder.Encode(entry)
+		}
+		return csvWriter.Write([]string{
+			strconv.FormatInt(entry.Seq, 10),
+			entry.Time.Format(time.RFC3339Nano),
+			entry.Action,
+			entry.Actor,
+			entry.APIKeyID,
+			entry.Tenant,
+			entry.Subject,
+			entry.RequestID,
+			entry.Bank,
+			formatAuditTargets(entry.Targets),
+			entry.Outcome,
+			entry.Error,
+			entry.PrevHash,
+			entry.Hash,
+		})
+	})
+	if err != nil {
+		handlersLog.ErrorContext(r.Context(), "Failed to export audit log", "error", err)
+		if !started {
+			writeError(w, r, http.StatusInternalServerError, "Failed to read audit log")
+			return
+		}
+	}
+	if !started {
+		start()
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+}
+
+// handleVerifyAudit проверяет цепочку хэшей журнала
+// GET /api/admin/audit/verify
+func (s *Server) handleVerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.audit.Verify())
+}
+
+// requireAdmin пропускает только пользователей из ADMIN_USERS
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := getUserID(r.Context())
+	for _, admin := range s.config.AdminUsers {
+		if admin == userID {
+			return true
+		}
+	}
+
+	writeError(w, r, http.StatusForbidden, "Admin access required")
+	return false
+}
+
+// parseAuditFilter читает фильтры журнала: action, actor, bank, outcome, request_id, target, from, to (RFC3339)
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	query := r.URL.Query()
+	filter := AuditFilter{
+		Action:    strings.TrimSuffix(query.Get("action"), ".*"),
+		Actor:     query.Get("actor"),
+		Bank:      query.Get("bank"),
+		Outcome:   query.Get("outcome"),
+		RequestID: query.Get("request_id"),
+		Target:    query.Get("target"),
+	}
+
+	if filter.Outcome != "" && filter.Outcome != AuditSuccess && filter.Outcome != AuditFailure && filter.Outcome != AuditDenied {
+		return filter, fmt.Errorf("Invalid 'outcome' (use %s, %s or %s)", AuditSuccess, AuditFailure, AuditDenied)
+	}
+
+	for name, target := range map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid '%s' date format (use RFC3339)", name)
+			}
+			*target = &t
+		}
+	}
+
+	return filter, nil
+}
+
+// formatAuditTargets targets для CSV: "key=value;key=value" с сортировкой по ключу
+func formatAuditTargets(targets map[string]string) string {
+	parts := make([]string, 0, len(targets))
+	for key, value := range targets {
+		parts = append(parts, key+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestAuditLog журнал во временной директории с записями events
+func newTestAuditLog(t *testing.T, enc *Encryptor, events ...AuditEvent) (*AuditLog, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := NewAuditLog(path, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		log.Record(context.Background(), event)
+	}
+	return log, path
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	events := []AuditEvent{
+		{Action: AuditAuthLogin, Actor: "team1-1"},
+		{Action: AuditPaymentCreate, Actor: "team1-1", Bank: "vbank", Targets: map[string]string{"payment_id": "p-1"}},
+		{Action: AuditPaymentCreate, Actor: "team1-2", Bank: "abank", Err: errors.New("bank unavailable")},
+		{Action: AuditPaymentConsentCreate, Actor: "team1-1", Bank: "vbank"},
+		{Action: AuditPaymentCreate, Actor: "team1-1", Bank: "vbank", Targets: map[string]string{"payment_id": "p-2"}},
+	}
+	enc := newTestEncryptor(t, testMasterKey("k1", 1))
+	log, path := newTestAuditLog(t, enc, events...)
+
+	tests := []struct {
+		name    string
+		filter  AuditFilter
+		wantSeq []int64
+	}{
+		{"all, newest first", AuditFilter{}, []int64{5, 4, 3, 2, 1}},
+		{"limit keeps newest", AuditFilter{Limit: 2}, []int64{5, 4}},
+		{"action group", AuditFilter{Action: "payment"}, []int64{5, 3, 2}},
+		{"actor and limit", AuditFilter{Actor: "team1-1", Action: "payment", Limit: 1}, []int64{5}},
+		{"outcome", AuditFilter{Outcome: AuditFailure}, []int64{3}},
+		{"target", AuditFilter{Target: "p-1"}, []int64{2}},
+		{"no match", AuditFilter{Bank: "sbank"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, entry := range entries {
+				got = append(got, entry.Seq)
+			}
+			if len(got) != len(tt.wantSeq) {
+				t.Fatalf("seq = %v, want %v", got, tt.wantSeq)
+			}
+			for i := range got {
+				if got[i] != tt.wantSeq[i] {
+					t.Fatalf("seq = %v, want %v", got, tt.wantSeq)
+				}
+			}
+		})
+	}
+
+	var exported []int64
+	if err := log.Export(AuditFilter{Action: "payment", Limit: 1}, func(entry AuditEntry) error {
+		exported = append(exported, entry.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 3 || exported[0] != 2 || exported[2] != 5 {
+		t.Errorf("exported seq = %v, want [2 3 5] in write order", exported)
+	}
+
+	// После перезапуска цепочка продолжается с последней записи файла
+	reopened, err := NewAuditLog(path, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Record(context.Background(), AuditEvent{Action: AuditAuthLogout, Actor: "team1-1"})
+	if result := reopened.Verify(); !result.OK || result.Entries != 6 {
+		t.Errorf("verify after reopen = %+v", result)
+	}
+}
+
+func TestAuditVerifyTampering(t *testing.T) {
+	events := []AuditEvent{
+		{Action: AuditAuthLogin, Actor: "team1-1"},
+		{Action: AuditPaymentCreate, Actor: "team1-1", Bank: "vbank", Targets: map[string]string{"payment_id": "p-1"}},
+		{Action: AuditPaymentCreate, Actor: "team1-1", Bank: "vbank", Targets: map[string]string{"payment_id": "p-2"}},
+		{Action: AuditAuthLogout, Actor: "team1-1"},
+	}
+
+	// rewrite меняет запись с индексом i; rehash - подделка с пересчитанным хэшем
+	rewrite := func(i int, rehash bool) func(t *testing.T, entries []AuditEntry) []AuditEntry {
+		return func(t *testing.T, entries []AuditEntry) []AuditEntry {
+			entries[i].Targets = map[string]string{"payment_id": "p-evil"}
+			if rehash {
+				hash, err := auditHash(entries[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				entries[i].Hash = hash
+			}
+			return entries
+		}
+	}
+
+	tests := []struct {
+		name         string
+		tamper       func(t *testing.T, entries []AuditEntry) []AuditEntry
+		wantBrokenAt int64 // 0 - цепочка цела
+		wantError    string
+		headChanged  bool
+	}{
+		{"untouched", func(t *testing.T, entries []AuditEntry) []AuditEntry { return entries }, 0, "", false},
+		{"entry changed", rewrite(1, false), 2, "entry hash mismatch", false},
+		{"entry changed with new hash", rewrite(1, true), 3, "entry does not follow the previous one", false},
+		// Подмену последней записи видно только по сохраненному head_hash
+		{"last entry changed with new hash", rewrite(3, true), 0, "", true},
+		{"entry deleted", func(t *testing.T, entries []AuditEntry) []AuditEntry {
+			return append(entries[:1], entries[2:]...)
+		}, 3, "entry does not follow the previous one", false},
+		{"entries swapped", func(t *testing.T, entries []AuditEntry) []AuditEntry {
+			entries[1], entries[2] = entries[2], entries[1]
+			return entries
+		}, 3, "entry does not follow the previous one", false},
+		{"first entry deleted", func(t *testing.T, entries []AuditEntry) []AuditEntry {
+			return entries[1:]
+		}, 2, "entry does not follow the previous one", false},
+		{"last entry deleted", func(t *testing.T, entries []AuditEntry) []AuditEntry {
+			return entries[:3]
+		}, 4, "audit log file is truncated", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, path := newTestAuditLog(t, nil, events...)
+			before := log.Verify()
+			if !before.OK || before.Entries != len(events) {
+				t.Fatalf("verify before tampering = %+v", before)
+			}
+
+			var entries []AuditEntry
+			if _, err := log.scan(func(entry AuditEntry) error {
+				entries = append(entries, entry)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			for _, entry := range tt.tamper(t, entries) {
+				line, err := json.Marshal(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				buf.Write(append(line, '\n'))
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			result := log.Verify()
+			if tt.wantBrokenAt == 0 {
+				if !result.OK {
+					t.Fatalf("verify = %+v, want ok", result)
+				}
+				if (result.HeadHash != before.HeadHash) != tt.headChanged {
+					t.Errorf("head hash %s -> %s, want changed %v", before.HeadHash, result.HeadHash, tt.headChanged)
+				}
+				return
+			}
+			if result.OK || result.BrokenAt != tt.wantBrokenAt || result.Error != tt.wantError {
+				t.Errorf("verify = %+v, want broken at %d: %s", result, tt.wantBrokenAt, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestAuditVerifyEncryptedTampering(t *testing.T) {
+	enc := newTestEncryptor(t, testMasterKey("k1", 1))
+	log, path := newTestAuditLog(t, enc,
+		AuditEvent{Action: AuditAuthLogin, Actor: "team1-1"},
+		AuditEvent{Action: AuditAuthLogout, Actor: "team1-1"},
+	)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(raw), []byte("\n"))
+
+	tests := []struct {
+		name   string
+		second []byte
+		want   error
+	}{
+		// Открытая строка вместо зашифрованной не принимается
+		{"plaintext entry", []byte(`{"seq":2,"action":"auth.logout","actor":"team1-1","outcome":"success"}`), ErrPlaintext},
+		// Строка журнала не расшифровывается с привязкой другой коллекции
+		{"line from another file", sealedWithAAD(t, enc, "collection:users"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := bytes.Join([][]byte{lines[0], tt.second}, []byte("\n"))
+			if err := os.WriteFile(path, append(tampered, '\n'), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			result := log.Verify()
+			if result.OK || result.Error == "" {
+				t.Fatalf("verify = %+v, want error", result)
+			}
+			if tt.want != nil && !strings.Contains(result.Error, tt.want.Error()) {
+				t.Errorf("error = %q, want %v", result.Error, tt.want)
+			}
+		})
+	}
+}
+
+// sealedWithAAD строка журнала, зашифрованная для другого места хранения
+func sealedWithAAD(t *testing.T, enc *Encryptor, aad string) []byte {
+	t.Helper()
+
+	sealed, err := enc.Seal(aad, []byte(`{"seq":2,"action":"auth.logout"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sealed))
+}
@@ -0,0 +1,785 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Коллекции в хранилище
+const (
+	authUsersCollection           = "auth_users"
+	refreshTokensCollection       = "refresh_tokens"
+	registrationInvitesCollection = "registration_invites"
+)
+
+const (
+	passwordIterations = 600000 // PBKDF2-HMAC-SHA256, рекомендация OWASP
+	passwordSaltSize   = 16
+	passwordKeySize    = 32
+	minPasswordLength  = 8
+	maxPasswordLength  = 256
+	refreshTokenSize   = 32
+	accessTokenIssuer  = "finhelper"
+	inviteCodePrefix   = "fhi_"
+	inviteCodeSize     = 24
+	defaultInviteDays  = 7
+	maxInviteDays      = 30
+)
+
+// ErrUnauthorized неверные учетные данные или токен
+var ErrUnauthorized = errors.New("unauthorized")
+
+var reLogin = regexp.MustCompile(`^[a-z0-9][a-z0-9._@-]{2,63}$`)
+
+// AuthUser учетная запись. ID используется во всех хранилищах и как client_id в банках
+type AuthUser struct {
+	ID           string     `json:"id"`
+	TenantID     string     `json:"tenant_id"` // команда, с учетными данными которой идут запросы в банки
+	Login        string     `json:"login"`
+	PasswordHash string     `json:"password_hash"` // pbkdf2-sha256$<итерации>$<соль>$<ключ>
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
+
+// UserProfile учетная запись без хэша пароля
+type UserProfile struct {
+	ID          string     `json:"id"`
+	TenantID    string     `json:"tenant_id"`
+	Login       string     `json:"login"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// RegisterInput тело запроса регистрации
+type RegisterInput struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Invite   string `json:"invite,omitempty"` // код приглашения; без него создается user-<uuid> арендатора по умолчанию
+}
+
+// RegistrationInvite приглашение на регистрацию от администратора. Только по нему
+// учетная запись получает ID клиента в банках (<tenant>-N). Сам код не хранится, только его SHA-256
+type RegistrationInvite struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash,omitempty"`
+	TenantID  string     `json:"tenant_id"`
+	UserID    string     `json:"user_id,omitempty"` // пустой - user-<uuid>
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    string     `json:"used_by,omitempty"` // ID созданной учетной записи
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// InviteInput параметры приглашения
+type InviteInput struct {
+	Tenant        string `json:"tenant,omitempty"`  // пустая - арендатор по умолчанию
+	UserID        string `json:"user_id,omitempty"` // client_id в банках вида <tenant>-N; пустой - user-<uuid>
+	ExpiresInDays int    `json:"expires_in_days,omitempty"`
+}
+
+// CreatedInvite ответ на создание приглашения. Код показывается только здесь
+type CreatedInvite struct {
+	RegistrationInvite
+	Code string `json:"code"`
+}
+
+// LoginInput тело запроса входа
+type LoginInput struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// RefreshInput тело запросов обновления токенов и выхода
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthTokens пара токенов, выдаваемая при входе и обновлении
+type AuthTokens struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        int         `json:"expires_in"` // срок жизни access токена в секундах
+	RefreshToken     string      `json:"refresh_token"`
+	RefreshExpiresAt time.Time   `json:"refresh_expires_at"`
+	User             UserProfile `json:"user"`
+}
+
+// RefreshToken сохраненный refresh токен. Сам токен не хранится, только его SHA-256
+type RefreshToken struct {
+	Hash      string     `json:"hash"`
+	UserID    string     `json:"user_id"`
+	FamilyID  string     `json:"family_id"` // цепочка ротаций от одного входа
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"` // обменян на новый: повторное предъявление отзывает цепочку
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// accessClaims содержимое access токена (JWT, HS256)
+type accessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Tenant    string `json:"tid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// AuthStore хранит учетные записи и refresh токены, выдает и проверяет access токены
+type AuthStore struct {
+	store         *JSONStore
+	tenants       []Tenant
+	defaultTenant string
+	secret        []byte
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+
+	mu        sync.Mutex
+	users     map[string]*AuthUser           // key: ID
+	logins    map[string]string              // login -> ID
+	tokens    map[string]*RefreshToken       // key: hash
+	invites   map[string]*RegistrationInvite // key: ID
+	dummyHash string                         // для входа с неизвестным логином, чтобы время ответа не выдавало логины
+}
+
+// NewAuthStore загружает учетные записи и refresh токены
+func NewAuthStore(store *JSONStore, config Config) (*AuthStore, error) {
+	s := &AuthStore{
+		store:         store,
+		tenants:       config.Tenants,
+		defaultTenant: config.DefaultTenant,
+		secret:        []byte(config.AuthTokenSecret),
+		accessTTL:     config.AccessTokenTTL,
+		refreshTTL:    config.RefreshTokenTTL,
+		users:         make(map[string]*AuthUser),
+		logins:        make(map[string]string),
+		tokens:        make(map[string]*RefreshToken),
+		invites:       make(map[string]*RegistrationInvite),
+	}
+
+	if len(s.secret) == 0 {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, fmt.Errorf("generate token secret: %w", err)
+		}
+		authLog.Warn("AUTH_TOKEN_SECRET is not set, access tokens will be invalid after restart")
+	}
+
+	var users []*AuthUser
+	if err := store.Load(authUsersCollection, &users); err != nil {
+		return nil, fmt.Errorf("load users: %w", err)
+	}
+	for _, user := range users {
+		// Учетные записи до появления арендаторов относятся к арендатору по умолчанию
+		if user.TenantID == "" {
+			user.TenantID = s.defaultTenant
+		}
+		s.users[user.ID] = user
+		s.logins[user.Login] = user.ID
+	}
+
+	var tokens []*RefreshToken
+	if err := store.Load(refreshTokensCollection, &tokens); err != nil {
+		return nil, fmt.Errorf("load refresh tokens: %w", err)
+	}
+	for _, token := range tokens {
+		s.tokens[token.Hash] = token
+	}
+
+	var invites []*RegistrationInvite
+	if err := store.Load(registrationInvitesCollection, &invites); err != nil {
+		return nil, fmt.Errorf("load registration invites: %w", err)
+	}
+	for _, invite := range invites {
+		s.invites[invite.ID] = invite
+	}
+
+	dummy, err := hashPassword(uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	s.dummyHash = dummy
+
+	return s, nil
+}
+
+// Register создает учетную запись и сразу выполняет вход. ID клиента в банках и
+// команда задаются только приглашением, иначе создается пользователь user-<uuid>
+// арендатора по умолчанию
+func (s *AuthStore) Register(ctx context.Context, input RegisterInput, now time.Time) (*AuthTokens, error) {
+	login := strings.ToLower(strings.TrimSpace(input.Login))
+	code := strings.TrimSpace(input.Invite)
+	tenantID := s.defaultTenant
+
+	var errs ValidationErrors
+	if !reLogin.MatchString(login) {
+		errs.add("login", "invalid_format", "login must be 3-64 characters: letters, digits, '.', '_', '@', '-'")
+	}
+	if n := len([]rune(input.Password)); n < minPasswordLength || n > maxPasswordLength {
+		errs.add("password", "invalid_length", "password must be %d-%d characters", minPasswordLength, maxPasswordLength)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	// Хэширование медленное - делаем его вне блокировки
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID := "user-" + uuid.New().String()
+	var invite *RegistrationInvite
+	if code != "" {
+		invite = s.findInvite(code, now)
+		if invite == nil {
+			errs.add("invite", "invalid_value", "invite code is invalid, used or expired")
+		} else {
+			tenantID = invite.TenantID
+			if invite.UserID != "" {
+				userID = invite.UserID
+			}
+		}
+	}
+	if _, exists := s.logins[login]; exists {
+		errs.add("login", "taken", "login is already registered")
+	}
+	if _, exists := s.users[userID]; exists {
+		errs.add("invite", "taken", "user %s is already registered", userID)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	user := &AuthUser{ID: userID, TenantID: tenantID, Login: login, PasswordHash: hash, CreatedAt: now, LastLoginAt: &now}
+	s.users[userID] = user
+	s.logins[login] = userID
+	if err := s.persistUsers(); err != nil {
+		delete(s.users, userID)
+		delete(s.logins, login)
+		return nil, err
+	}
+
+	if invite != nil {
+		invite.UsedAt = &now
+		invite.UsedBy = userID
+		if err := s.persistInvites(); err != nil {
+			// Учетная запись уже создана: приглашение не сработает повторно, пока ID занят
+			authLog.WarnContext(ctx, "Failed to save used registration invite", "invite_id", invite.ID, "error", err)
+		}
+	}
+
+	authLog.InfoContext(ctx, "Registered user", "user_id", userID, "tenant", tenantID)
+	return s.issueTokens(user, uuid.New().String(), now)
+}
+
+// CreateInvite выпускает приглашение на регистрацию (только для администраторов)
+func (s *AuthStore) CreateInvite(ctx context.Context, adminID string, input InviteInput, now time.Time) (*CreatedInvite, error) {
+	tenantID := strings.TrimSpace(input.Tenant)
+	if tenantID == "" {
+		tenantID = s.defaultTenant
+	}
+	userID := strings.TrimSpace(input.UserID)
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = defaultInviteDays
+	}
+
+	var errs ValidationErrors
+	if !s.hasTenant(tenantID) {
+		errs.add("tenant", "not_found", "unknown tenant %s", tenantID)
+	} else if userID != "" && !isBankClientID(tenantID, userID) {
+		errs.add("user_id", "invalid_format", "user_id must look like %s-N", tenantID)
+	}
+	if days < 0 || days > maxInviteDays {
+		errs.add("expires_in_days", "invalid_value", "expires_in_days must be between 1 and %d", maxInviteDays)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate invite code: %w", err)
+	}
+	code := inviteCodePrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if userID != "" {
+		if _, exists := s.users[userID]; exists {
+			errs.add("user_id", "taken", "user_id is already registered")
+		}
+		for _, invite := range s.invites {
+			if invite.UserID == userID && invite.usable(now) {
+				errs.add("user_id", "taken", "user_id already has an active invite %s", invite.ID)
+				break
+			}
+		}
+		if err := errs.err(); err != nil {
+			return nil, err
+		}
+	}
+
+	invite := &RegistrationInvite{
+		ID:        "inv-" + uuid.New().String(),
+		Hash:      hashToken(code),
+		TenantID:  tenantID,
+		UserID:    userID,
+		CreatedBy: adminID,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, days),
+	}
+	s.invites[invite.ID] = invite
+	if err := s.persistInvites(); err != nil {
+		delete(s.invites, invite.ID)
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Created registration invite", "invite_id", invite.ID, "tenant", tenantID, "user_id", userID, "created_by", adminID)
+	return &CreatedInvite{RegistrationInvite: invite.view(), Code: code}, nil
+}
+
+// ListInvites возвращает приглашения (без хэшей), новые первыми
+func (s *AuthStore) ListInvites() []RegistrationInvite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]RegistrationInvite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		result = append(result, invite.view())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// RevokeInvite отзывает неиспользованное приглашение
+func (s *AuthStore) RevokeInvite(ctx context.Context, inviteID string, now time.Time) (*RegistrationInvite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, exists := s.invites[inviteID]
+	if !exists {
+		return nil, fmt.Errorf("invite %s: %w", inviteID, ErrNotFound)
+	}
+	if invite.UsedAt != nil {
+		return nil, fmt.Errorf("%w: invite %s is already used", ErrInvalidInput, inviteID)
+	}
+
+	if invite.RevokedAt == nil {
+		invite.RevokedAt = &now
+		if err := s.persistInvites(); err != nil {
+			invite.RevokedAt = nil
+			return nil, err
+		}
+		authLog.InfoContext(ctx, "Revoked registration invite", "invite_id", inviteID)
+	}
+
+	result := invite.view()
+	return &result, nil
+}
+
+// Login проверяет логин и пароль и выдает новую пару токенов
+func (s *AuthStore) Login(input LoginInput, now time.Time) (*AuthTokens, error) {
+	login := strings.ToLower(strings.TrimSpace(input.Login))
+
+	s.mu.Lock()
+	hash := s.dummyHash
+	userID, exists := s.logins[login]
+	if exists {
+		hash = s.users[userID].PasswordHash
+	}
+	s.mu.Unlock()
+
+	if !verifyPassword(input.Password, hash) || !exists {
+		return nil, fmt.Errorf("%w: invalid login or password", ErrUnauthorized)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.users[userID]
+	previous := user.LastLoginAt
+	user.LastLoginAt = &now
+	if err := s.persistUsers(); err != nil {
+		user.LastLoginAt = previous
+		return nil, err
+	}
+
+	return s.issueTokens(user, uuid.New().String(), now)
+}
+
+// Refresh обменивает refresh токен на новую пару (ротация). Повторное предъявление
+// уже обмененного токена означает утечку - вся цепочка отзывается
+func (s *AuthStore) Refresh(ctx context.Context, refreshToken string, now time.Time) (*AuthTokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[hashToken(refreshToken)]
+	if !exists || token.RevokedAt != nil || !now.Before(token.ExpiresAt) {
+		return nil, fmt.Errorf("%w: invalid or expired refresh token", ErrUnauthorized)
+	}
+	if token.UsedAt != nil {
+		authLog.WarnContext(ctx, "Reuse of refresh token detected, revoking session", "user_id", token.UserID)
+		s.revokeFamily(token.FamilyID, now)
+		if err := s.persistTokens(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: refresh token was already used, sign in again", ErrUnauthorized)
+	}
+
+	user, exists := s.users[token.UserID]
+	if !exists {
+		return nil, fmt.Errorf("%w: invalid or expired refresh token", ErrUnauthorized)
+	}
+
+	token.UsedAt = &now
+	tokens, err := s.issueTokens(user, token.FamilyID, now)
+	if err != nil {
+		token.UsedAt = nil
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout отзывает цепочку refresh токенов. Неизвестный токен не считается ошибкой
+func (s *AuthStore) Logout(refreshToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[hashToken(refreshToken)]
+	if !exists {
+		return nil
+	}
+	s.revokeFamily(token.FamilyID, now)
+	return s.persistTokens()
+}
+
+// Authenticate проверяет подпись и срок access токена и возвращает ID пользователя и его арендатора
+func (s *AuthStore) Authenticate(accessToken string, now time.Time) (string, string, error) {
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		return "", "", err
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return "", "", fmt.Errorf("%w: access token expired", ErrUnauthorized)
+	}
+
+	s.mu.Lock()
+	user, exists := s.users[claims.Subject]
+	s.mu.Unlock()
+	if !exists || user.TenantID != claims.Tenant {
+		return "", "", fmt.Errorf("%w: unknown user", ErrUnauthorized)
+	}
+
+	return claims.Subject, claims.Tenant, nil
+}
+
+// TenantOf возвращает арендатора пользователя (пустую строку для неизвестного)
+func (s *AuthStore) TenantOf(userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, exists := s.users[userID]; exists {
+		return user.TenantID
+	}
+	return ""
+}
+
+// Profile возвращает учетную запись пользователя
+func (s *AuthStore) Profile(userID string) (*UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[userID]
+	if !exists {
+		return nil, fmt.Errorf("user %s: %w", userID, ErrNotFound)
+	}
+	profile := user.profile()
+	return &profile, nil
+}
+
+// TokenOwner возвращает пользователя refresh токена (в том числе отозванного) для журнала аудита
+func (s *AuthStore) TokenOwner(refreshToken string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, exists := s.tokens[hashToken(refreshToken)]; exists {
+		return token.UserID
+	}
+	return ""
+}
+
+// FindByLogin ищет учетную запись по логину
+func (s *AuthStore) FindByLogin(login string) (*UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login = strings.ToLower(strings.TrimSpace(login))
+	userID, exists := s.logins[login]
+	if !exists {
+		return nil, fmt.Errorf("login %s: %w", login, ErrNotFound)
+	}
+	profile := s.users[userID].profile()
+	return &profile, nil
+}
+
+// issueTokens выдает access токен и refresh токен в цепочке familyID (вызывается под блокировкой)
+func (s *AuthStore) issueTokens(user *AuthUser, familyID string, now time.Time) (*AuthTokens, error) {
+	raw := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	accessToken, err := s.signAccessToken(user, now)
+	if err != nil {
+		return nil, err
+	}
+
+	s.purgeTokens(now)
+	token := &RefreshToken{
+		Hash:      hashToken(refreshToken),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}
+	s.tokens[token.Hash] = token
+	if err := s.persistTokens(); err != nil {
+		delete(s.tokens, token.Hash)
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(s.accessTTL / time.Second),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: token.ExpiresAt,
+		User:             user.profile(),
+	}, nil
+}
+
+// revokeFamily отзывает все токены цепочки (вызывается под блокировкой)
+func (s *AuthStore) revokeFamily(familyID string, now time.Time) {
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+}
+
+// purgeTokens удаляет истекшие токены. Обмененные хранятся до истечения,
+// чтобы распознать их повторное использование (вызывается под блокировкой)
+func (s *AuthStore) purgeTokens(now time.Time) {
+	for hash, token := range s.tokens {
+		if !now.Before(token.ExpiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+}
+
+// signAccessToken подписывает access токен (JWT, HS256)
+func (s *AuthStore) signAccessToken(user *AuthUser, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(accessClaims{
+		Issuer:    accessTokenIssuer,
+		Subject:   user.ID,
+		Tenant:    user.TenantID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.accessTTL).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal token claims: %w", err)
+	}
+
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + s.sign(signingInput), nil
+}
+
+// parseAccessToken проверяет подпись access токена и разбирает его содержимое
+func (s *AuthStore) parseAccessToken(accessToken string) (*accessClaims, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed access token", ErrUnauthorized)
+	}
+	if !hmac.Equal([]byte(s.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, fmt.Errorf("%w: invalid access token signature", ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims accessClaims
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: malformed access token", ErrUnauthorized)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Issuer != accessTokenIssuer || claims.Subject == "" {
+		return nil, fmt.Errorf("%w: malformed access token", ErrUnauthorized)
+	}
+
+	return &claims, nil
+}
+
+// sign HMAC-SHA256 подпись в base64url
+func (s *AuthStore) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hasTenant сообщает, настроен ли арендатор
+func (s *AuthStore) hasTenant(tenantID string) bool {
+	for _, tenant := range s.tenants {
+		if tenant.ID == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// isBankClientID сообщает, похож ли ID на client_id песочницы банков команды (<tenant>-N)
+func isBankClientID(tenantID, userID string) bool {
+	n, ok := strings.CutPrefix(userID, tenantID+"-")
+	if !ok || n == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(n, 10, 32)
+	return err == nil
+}
+
+// persistUsers сохраняет учетные записи (вызывается под блокировкой)
+func (s *AuthStore) persistUsers() error {
+	users := make([]*AuthUser, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return s.store.Save(authUsersCollection, users)
+}
+
+// findInvite ищет действующее приглашение по коду (вызывается под блокировкой)
+func (s *AuthStore) findInvite(code string, now time.Time) *RegistrationInvite {
+	hash := hashToken(code)
+	for _, invite := range s.invites {
+		if subtle.ConstantTimeCompare([]byte(invite.Hash), []byte(hash)) == 1 && invite.usable(now) {
+			return invite
+		}
+	}
+	return nil
+}
+
+// persistInvites сохраняет приглашения (вызывается под блокировкой)
+func (s *AuthStore) persistInvites() error {
+	invites := make([]*RegistrationInvite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		invites = append(invites, invite)
+	}
+	return s.store.Save(registrationInvitesCollection, invites)
+}
+
+// persistTokens сохраняет refresh токены (вызывается под блокировкой)
+func (s *AuthStore) persistTokens() error {
+	tokens := make([]*RefreshToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	return s.store.Save(refreshTokensCollection, tokens)
+}
+
+// profile учетная запись без хэша пароля
+func (u *AuthUser) profile() UserProfile {
+	profile := UserProfile{ID: u.ID, TenantID: u.TenantID, Login: u.Login, CreatedAt: u.CreatedAt}
+	if u.LastLoginAt != nil {
+		lastLoginAt := *u.LastLoginAt
+		profile.LastLoginAt = &lastLoginAt
+	}
+	return profile
+}
+
+// usable приглашение не использовано, не отозвано и не истекло
+func (i *RegistrationInvite) usable(now time.Time) bool {
+	return i.UsedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// view копия приглашения без хэша
+func (i *RegistrationInvite) view() RegistrationInvite {
+	c := *i
+	c.Hash = ""
+	return c
+}
+
+// PASSWORDS
+
+// hashPassword хэширует пароль PBKDF2-HMAC-SHA256 со случайной солью
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeySize)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword сверяет пароль с хэшем за постоянное время
+func verifyPassword(password, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// hashToken SHA-256 refresh токена для хранения
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publicPaths маршруты, доступные без access токена
+var publicPaths = map[string]bool{
+	"/health":            true,
+	"/healthz":           true,
+	"/api/auth/register": true,
+	"/api/auth/login":    true,
+	"/api/auth/refresh":  true,
+	"/api/auth/logout":   true,
+}
+
+// withAuth проверяет access токен (Authorization: Bearer) или API ключ
+// (Authorization: ApiKey) и кладет ID пользователя в контекст. Без действующих
+// учетных данных - 401, API ключ без нужной области доступа - 403
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now().UTC()
+		header := r.Header.Get("Authorization")
+
+		if secret, ok := strings.CutPrefix(header, "ApiKey "); ok {
+			key, err := s.apiKeys.Authenticate(r.Context(), strings.TrimSpace(secret), now)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `ApiKey realm="finhelper"`)
+				writeError(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			scope := requiredScope(r)
+			if scope == "" {
+				writeError(w, r, http.StatusForbidden, "This endpoint is not available with an API key")
+				return
+			}
+			if !key.HasScope(scope) {
+				writeError(w, r, http.StatusForbidden, "API key does not have scope "+scope)
+				return
+			}
+
+			userID, tenantID := key.UserID, s.auth.TenantOf(key.UserID)
+			if key.TenantID != "" {
+				// Ключ команды действует от имени пользователя этой команды из X-User-Id;
+				// банковский клиент выбирается по команде ключа
+				userID = strings.TrimSpace(r.Header.Get("X-User-Id"))
+				if userID == "" {
+					writeError(w, r, http.StatusBadRequest, "X-User-Id header is required with a tenant API key")
+					return
+				}
+				if s.auth.TenantOf(userID) != key.TenantID {
+					writeError(w, r, http.StatusForbidden, "User does not belong to the API key tenant")
+					return
+				}
+				tenantID = key.TenantID
+			}
+
+			ctx := context.WithValue(r.Context(), CtxUserID, userID)
+			ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+			ctx = context.WithValue(ctx, CtxAPIKeyID, key.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finhelper"`)
+			writeError(w, r, http.StatusUnauthorized, "Missing bearer access token or API key")
+			return
+		}
+
+		userID, tenantID, err := s.auth.Authenticate(token, now)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finhelper", error="invalid_token"`)
+			writeError(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), CtxUserID, userID)
+		ctx = context.WithValue(ctx, CtxTenantID, tenantID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AUTH ENDPOINTS
+
+// handleRegister создает учетную запись и возвращает пару токенов
+// POST /api/auth/register
+// Тело: {"login": "alice", "password": "...", "invite": "fhi_..."}
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var input RegisterInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	tokens, err := s.auth.Register(r.Context(), input, time.Now().UTC())
+	event := AuditEvent{Action: AuditAuthRegister, Actor: auditActorAnonymous, Targets: map[string]string{"login": input.Login}, Err: err}
+	if tokens != nil {
+		event.Actor = tokens.User.ID
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to register user", "error", err)
+		writeValidationError(w, r, "Failed to register", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, tokens)
+}
+
+// handleLogin проверяет логин и пароль и возвращает пару токенов
+// POST /api/auth/login
+// Тело: {"login": "alice", "password": "..."}
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var input LoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	tokens, err := s.auth.Login(input, time.Now().UTC())
+	event := AuditEvent{Action: AuditAuthLogin, Actor: auditActorAnonymous, Targets: map[string]string{"login": input.Login}, Err: err}
+	if tokens != nil {
+		event.Actor = tokens.User.ID
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to log in", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to log in: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// handleRefreshToken обменивает refresh токен на новую пару токенов
+// POST /api/auth/refresh
+// Тело: {"refresh_token": "..."}
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if input.RefreshToken == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'refresh_token'")
+		return
+	}
+
+	tokens, err := s.auth.Refresh(r.Context(), input.RefreshToken, time.Now().UTC())
+	event := AuditEvent{Action: AuditAuthRefresh, Actor: s.auth.TokenOwner(input.RefreshToken), Err: err}
+	if event.Actor == "" {
+		event.Actor = auditActorAnonymous
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to refresh token", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to refresh token: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// handleLogout отзывает refresh токен вместе со всей цепочкой ротаций
+// POST /api/auth/logout
+// Тело: {"refresh_token": "..."}
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var input RefreshInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if input.RefreshToken == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'refresh_token'")
+		return
+	}
+
+	err := s.auth.Logout(input.RefreshToken, time.Now().UTC())
+	event := AuditEvent{Action: AuditAuthLogout, Actor: s.auth.TokenOwner(input.RefreshToken), Err: err}
+	if event.Actor == "" {
+		event.Actor = auditActorAnonymous
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to log out", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to log out: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Logged out successfully",
+	})
+}
+
+// handleGetMe возвращает учетную запись текущего пользователя
+// GET /api/auth/me
+func (s *Server) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	profile, err := s.auth.Profile(getUserID(r.Context()))
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get user: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// REGISTRATION INVITE ENDPOINTS
+
+// handleListRegistrationInvites возвращает приглашения на регистрацию без кодов
+// GET /api/admin/invites
+func (s *Server) handleListRegistrationInvites(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	invites := s.auth.ListInvites()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"invites": invites,
+		"count":   len(invites),
+	})
+}
+
+// handleCreateRegistrationInvite выпускает приглашение на регистрацию. Код возвращается только в этом ответе
+// POST /api/admin/invites
+// Тело: {"tenant": "team053", "user_id": "team053-5", "expires_in_days": 7}
+func (s *Server) handleCreateRegistrationInvite(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var input InviteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	invite, err := s.auth.CreateInvite(r.Context(), getUserID(r.Context()), input, time.Now().UTC())
+	event := AuditEvent{Action: AuditInviteCreate, Err: err}
+	if invite != nil {
+		event.Targets = map[string]string{"invite_id": invite.ID, "tenant": invite.TenantID}
+		if invite.UserID != "" {
+			event.Targets["user_id"] = invite.UserID
+		}
+	}
+	s.audit.Record(r.Context(), event)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create registration invite", "error", err)
+		writeValidationError(w, r, "Failed to create invite", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, invite)
+}
+
+// handleRevokeRegistrationInvite отзывает неиспользованное приглашение
+// DELETE /api/admin/invites/{id}
+func (s *Server) handleRevokeRegistrationInvite(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	inviteID := r.PathValue("id")
+	if inviteID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing invite ID in path")
+		return
+	}
+
+	invite, err := s.auth.RevokeInvite(r.Context(), inviteID, time.Now().UTC())
+	s.audit.Record(r.Context(), AuditEvent{Action: AuditInviteRevoke, Targets: map[string]string{"invite_id": inviteID}, Err: err})
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to revoke invite: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invite)
+}
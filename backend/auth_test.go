@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAuthStore хранилище учетных записей во временной директории с арендатором team1
+func newTestAuthStore(t *testing.T) *AuthStore {
+	t.Helper()
+
+	store, err := NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuthStore(store, Config{
+		Tenants:         []Tenant{{ID: "team1"}, {ID: "team2"}},
+		DefaultTenant:   "team1",
+		AuthTokenSecret: "test-secret",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") {
+		t.Errorf("hash = %q, want pbkdf2-sha256 with 600000 iterations", hash)
+	}
+
+	other, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("same password hashed twice gives the same hash, salt is not random")
+	}
+
+	parts := strings.Split(hash, "$")
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		want     bool
+	}{
+		{"correct password", "correct horse", hash, true},
+		{"wrong password", "correct horse!", hash, false},
+		{"empty password", "", hash, false},
+		{"other salt", "correct horse", other, true},
+		{"unknown algorithm", "correct horse", "bcrypt$" + strings.Join(parts[1:], "$"), false},
+		{"zero iterations", "correct horse", strings.Join([]string{parts[0], "0", parts[2], parts[3]}, "$"), false},
+		{"changed iterations", "correct horse", strings.Join([]string{parts[0], "1", parts[2], parts[3]}, "$"), false},
+		{"broken salt", "correct horse", strings.Join([]string{parts[0], parts[1], "!!", parts[3]}, "$"), false},
+		{"missing part", "correct horse", strings.Join(parts[:3], "$"), false},
+		{"empty hash", "correct horse", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.password, tt.encoded); got != tt.want {
+				t.Errorf("verifyPassword = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	auth := newTestAuthStore(t)
+	now := time.Now()
+	user := &AuthUser{ID: "user-1", TenantID: "team1", Login: "alice"}
+	auth.users[user.ID] = user
+
+	token, err := auth.signAccessToken(user, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := auth.parseAccessToken(token)
+	if err != nil {
+		t.Fatalf("parseAccessToken: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Tenant != "team1" || claims.Issuer != accessTokenIssuer {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.ExpiresAt != now.Add(15*time.Minute).Unix() {
+		t.Errorf("expires at %d, want %d", claims.ExpiresAt, now.Add(15*time.Minute).Unix())
+	}
+
+	userID, tenantID, err := auth.Authenticate(token, now)
+	if err != nil || userID != "user-1" || tenantID != "team1" {
+		t.Errorf("Authenticate = %q, %q, %v", userID, tenantID, err)
+	}
+
+	parts := strings.Split(token, ".")
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	forged := encode(`{"iss":"finhelper","sub":"user-2","tid":"team1","exp":9999999999}`)
+
+	other := newTestAuthStore(t)
+	other.secret = []byte("other-secret")
+	foreign, err := other.signAccessToken(user, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"two parts", parts[0] + "." + parts[1]},
+		{"forged payload", parts[0] + "." + forged + "." + parts[2]},
+		{"alg none", encode(`{"alg":"none","typ":"JWT"}`) + "." + parts[1] + "."},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:len(parts[2])-1]},
+		{"other secret", foreign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.parseAccessToken(tt.token); !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("error = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		if _, _, err := auth.Authenticate(token, now.Add(15*time.Minute)); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("error = %v, want ErrUnauthorized", err)
+		}
+	})
+
+	t.Run("tenant changed", func(t *testing.T) {
+		user.TenantID = "team2"
+		defer func() { user.TenantID = "team1" }()
+		if _, _, err := auth.Authenticate(token, now); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("error = %v, want ErrUnauthorized", err)
+		}
+	})
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	auth := newTestAuthStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	first, err := auth.Register(ctx, RegisterInput{Login: "alice", Password: "password123"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := auth.Refresh(ctx, first.RefreshToken, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// Повторное предъявление обмененного токена отзывает всю цепочку
+	if _, err := auth.Refresh(ctx, first.RefreshToken, now.Add(2*time.Minute)); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("reuse error = %v, want ErrUnauthorized", err)
+	}
+	if _, err := auth.Refresh(ctx, second.RefreshToken, now.Add(3*time.Minute)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("refresh after reuse error = %v, want ErrUnauthorized", err)
+	}
+
+	// Другие сессии пользователя не затронуты
+	session, err := auth.Login(LoginInput{Login: "alice", Password: "password123"}, now.Add(4*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Refresh(ctx, session.RefreshToken, now.Add(5*time.Minute)); err != nil {
+		t.Errorf("refresh of new session: %v", err)
+	}
+
+	if _, err := auth.Refresh(ctx, session.RefreshToken, now.Add(25*time.Hour)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expired refresh error = %v, want ErrUnauthorized", err)
+	}
+	if _, err := auth.Refresh(ctx, "unknown", now); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unknown refresh error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRegisterInvite(t *testing.T) {
+	auth := newTestAuthStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	self, err := auth.Register(ctx, RegisterInput{Login: "alice", Password: "password123"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(self.User.ID, "user-") || self.User.TenantID != "team1" {
+		t.Errorf("self-registered user = %s in %s, want user-<uuid> in team1", self.User.ID, self.User.TenantID)
+	}
+
+	invite, err := auth.CreateInvite(ctx, "admin-1", InviteInput{Tenant: "team2", UserID: "team2-7"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.Register(ctx, RegisterInput{Login: "bob", Password: "password123", Invite: "fhi_wrong"}, now); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("wrong invite error = %v, want ErrInvalidInput", err)
+	}
+
+	bob, err := auth.Register(ctx, RegisterInput{Login: "bob", Password: "password123", Invite: invite.Code}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.User.ID != "team2-7" || bob.User.TenantID != "team2" {
+		t.Errorf("invited user = %s in %s, want team2-7 in team2", bob.User.ID, bob.User.TenantID)
+	}
+
+	if _, err := auth.Register(ctx, RegisterInput{Login: "carol", Password: "password123", Invite: invite.Code}, now); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("used invite error = %v, want ErrInvalidInput", err)
+	}
+}
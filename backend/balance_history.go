@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// balanceSnapshotsCollection имя коллекции в хранилище
+const balanceSnapshotsCollection = "balance_snapshots"
+
+// maxHistoryPoints ограничение на количество точек в одном ответе
+const maxHistoryPoints = 1000
+
+// Интервалы истории баланса
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Источники значения точки истории
+const (
+	BalanceSourceRunning       = "running_balance" // остаток после операции из данных банка
+	BalanceSourceSnapshot      = "snapshot"        // сохраненный или введенный вручную снимок
+	BalanceSourceReconstructed = "reconstructed"   // восстановлен от текущего баланса по операциям
+)
+
+// AccountBalanceSnapshot баланс банковского счета, зафиксированный за день
+type AccountBalanceSnapshot struct {
+	UserID     string    `json:"user_id"`
+	Bank       string    `json:"bank"`
+	AccountID  string    `json:"account_id"`
+	Date       string    `json:"date"` // YYYY-MM-DD (UTC)
+	CapturedAt time.Time `json:"captured_at"`
+	Balance    float64   `json:"balance"`
+	Currency   string    `json:"currency"`
+}
+
+// BalancePoint баланс на конец периода
+type BalancePoint struct {
+	Date     string  `json:"date"` // начало периода, YYYY-MM-DD
+	Balance  float64 `json:"balance"`
+	Currency string  `json:"currency"`
+	Source   string  `json:"source"`
+}
+
+// balanceMovement операция или снимок, по которым восстанавливается история
+type balanceMovement struct {
+	Date    time.Time
+	Amount  float64  // изменение баланса со знаком
+	Running *float64 // баланс сразу после операции, если известен
+	Source  string
+}
+
+// BalanceSnapshotStore хранит ежедневные снимки балансов банковских счетов
+type BalanceSnapshotStore struct {
+	store *JSONStore
+
+	mu        sync.RWMutex
+	snapshots map[string]*AccountBalanceSnapshot // key: "userID|bank|accountID|date"
+}
+
+// NewBalanceSnapshotStore загружает снимки балансов из хранилища
+func NewBalanceSnapshotStore(store *JSONStore) (*BalanceSnapshotStore, error) {
+	s := &BalanceSnapshotStore{
+		store:     store,
+		snapshots: make(map[string]*AccountBalanceSnapshot),
+	}
+
+	var snapshots []*AccountBalanceSnapshot
+	if err := store.Load(balanceSnapshotsCollection, &snapshots); err != nil {
+		return nil, fmt.Errorf("load balance snapshots: %w", err)
+	}
+	for _, snap := range snapshots {
+		s.snapshots[snapshotKey(snap.UserID, snap.Bank, snap.AccountID, snap.Date)] = snap
+	}
+
+	return s, nil
+}
+
+// Record сохраняет баланс счета за текущий день (последний снимок дня заменяет предыдущий)
+func (s *BalanceSnapshotStore) Record(userID, bank, accountID string, balance float64, currency string, at time.Time) error {
+	at = at.UTC()
+	snap := &AccountBalanceSnapshot{
+		UserID:     userID,
+		Bank:       bank,
+		AccountID:  accountID,
+		Date:       at.Format("2006-01-02"),
+		CapturedAt: at,
+		Balance:    roundMoney(balance),
+		Currency:   currency,
+	}
+	key := snapshotKey(userID, bank, accountID, snap.Date)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.snapshots[key]
+	if existed && previous.Balance == snap.Balance && previous.Currency == snap.Currency {
+		return nil // ничего не изменилось - не переписываем файл
+	}
+
+	s.snapshots[key] = snap
+	if err := s.persist(); err != nil {
+		if existed {
+			s.snapshots[key] = previous
+		} else {
+			delete(s.snapshots, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// List возвращает снимки счета начиная с указанной даты
+func (s *BalanceSnapshotStore) List(userID, bank, accountID string, from time.Time) []AccountBalanceSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []AccountBalanceSnapshot
+	for _, snap := range s.snapshots {
+		if snap.UserID == userID && snap.Bank == bank && snap.AccountID == accountID && !snap.CapturedAt.Before(from) {
+			result = append(result, *snap)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CapturedAt.Before(result[j].CapturedAt)
+	})
+
+	return result
+}
+
+// persist сохраняет все снимки (вызывается под блокировкой)
+func (s *BalanceSnapshotStore) persist() error {
+	snapshots := make([]*AccountBalanceSnapshot, 0, len(s.snapshots))
+	for _, snap := range s.snapshots {
+		snapshots = append(snapshots, snap)
+	}
+
+	return s.store.Save(balanceSnapshotsCollection, snapshots)
+}
+
+// snapshotKey формирует ключ снимка
+func snapshotKey(userID, bank, accountID, date string) string {
+	return userID + "|" + bank + "|" + accountID + "|" + date
+}
+
+// recordBalanceSnapshot сохраняет полученный от банка баланс как снимок текущего дня
+func (a *BankAggregator) recordBalanceSnapshot(ctx context.Context, bankCode, userID, accountID string, balances []BalanceDetail) {
+	balance, ok := pickBalance(balances)
+	if !ok {
+		return
+	}
+
+	amount := parseAmount(balance.Amount.Amount)
+	if balance.CreditDebitIndicator == "Debit" {
+		amount = -amount
+	}
+
+	if err := a.snapshots.Record(userID, bankCode, accountID, amount, balance.Amount.Currency, time.Now()); err != nil {
+		aggregatorLog.WarnContext(ctx, "Failed to record balance snapshot", "bank", bankCode, "account_id", accountID, "error", err)
+	}
+}
+
+// HISTORY
+
+// GetBalanceHistory восстанавливает балансы счета на конец каждого периода в [from, to].
+// Идет назад от текущего баланса по операциям, используя остатки после операций
+// из данных банка и сохраненные снимки как опорные точки
+func (a *BankAggregator) GetBalanceHistory(ctx context.Context, bankCode, userID, accountID string, from, to time.Time, interval string) ([]BalancePoint, error) {
+	now := time.Now().UTC()
+	if to.After(now) {
+		to = now
+	}
+
+	starts, err := periodStarts(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	current, currency, err := a.GetCurrentBalance(ctx, bankCode, userID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("get current balance: %w", err)
+	}
+
+	var movements []balanceMovement
+	if bankCode == ManualBankCode {
+		account, err := a.manual.Get(userID, accountID)
+		if err != nil {
+			return nil, err
+		}
+		movements = manualMovements(account)
+	} else {
+		// Операции нужны от начала первого периода до текущего момента
+		details, err := a.GetAccountTransactionDetails(ctx, bankCode, userID, accountID, starts[0], time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		movements = bankMovements(details)
+
+		for _, snap := range a.snapshots.List(userID, bankCode, accountID, starts[0]) {
+			balance := snap.Balance
+			movements = append(movements, balanceMovement{
+				Date:    snap.CapturedAt,
+				Running: &balance,
+				Source:  BalanceSourceSnapshot,
+			})
+		}
+	}
+
+	return buildBalanceHistory(current, currency, now, starts, interval, movements), nil
+}
+
+// buildBalanceHistory считает баланс на конец каждого периода, двигаясь от текущего баланса назад
+func buildBalanceHistory(current float64, currency string, now time.Time, starts []time.Time, interval string, movements []balanceMovement) []BalancePoint {
+	sort.SliceStable(movements, func(i, j int) bool {
+		return movements[i].Date.After(movements[j].Date)
+	})
+
+	points := make([]BalancePoint, len(starts))
+	balance := current
+	i := 0
+
+	for k := len(starts) - 1; k >= 0; k-- {
+		end := nextPeriod(starts[k], interval)
+		if end.After(now) {
+			end = now
+		}
+
+		// Откатываем операции, произошедшие после конца периода
+		for i < len(movements) && !movements[i].Date.Before(end) {
+			if movements[i].Running != nil {
+				balance = *movements[i].Running
+			}
+			balance -= movements[i].Amount
+			i++
+		}
+
+		point := BalancePoint{
+			Date:     starts[k].Format("2006-01-02"),
+			Balance:  roundMoney(balance),
+			Currency: currency,
+			Source:   BalanceSourceReconstructed,
+		}
+
+		// Если у последней операции периода известен остаток - берем его как есть
+		if i < len(movements) && movements[i].Running != nil {
+			point.Balance = roundMoney(*movements[i].Running)
+			point.Source = movements[i].Source
+		}
+
+		points[k] = point
+	}
+
+	return points
+}
+
+// bankMovements превращает банковские транзакции в изменения баланса
+func bankMovements(details []TransactionDetail) []balanceMovement {
+	movements := make([]balanceMovement, 0, len(details))
+
+	for _, td := range details {
+		amount := parseAmount(td.Amount.Amount)
+		if td.CreditDebitIndicator == "Debit" {
+			amount = -amount
+		}
+
+		m := balanceMovement{
+			Date:   td.BookingDateTime.Time,
+			Amount: amount,
+			Source: BalanceSourceRunning,
+		}
+
+		if td.Balance.Amount.Amount != "" {
+			running := parseAmount(td.Balance.Amount.Amount)
+			if td.Balance.CreditDebitIndicator == "Debit" {
+				running = -running
+			}
+			m.Running = &running
+		}
+
+		movements = append(movements, m)
+	}
+
+	return movements
+}
+
+// manualMovements превращает операции и снимки ручного счета в изменения баланса
+func manualMovements(account *ManualAccount) []balanceMovement {
+	movements := make([]balanceMovement, 0, len(account.Transactions)+len(account.Snapshots))
+
+	for _, tx := range account.Transactions {
+		movements = append(movements, balanceMovement{Date: tx.Date, Amount: tx.Amount})
+	}
+	for _, snap := range account.Snapshots {
+		balance := snap.Balance
+		movements = append(movements, balanceMovement{
+			Date:    snap.Date,
+			Running: &balance,
+			Source:  BalanceSourceSnapshot,
+		})
+	}
+
+	return movements
+}
+
+// periodStarts возвращает начала периодов, пересекающихся с [from, to]
+func periodStarts(from, to time.Time, interval string) ([]time.Time, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: 'from' must be before 'to'", ErrInvalidInput)
+	}
+
+	var starts []time.Time
+	for t := truncatePeriod(from.UTC(), interval); !t.After(to); t = nextPeriod(t, interval) {
+		starts = append(starts, t)
+		if len(starts) > maxHistoryPoints {
+			return nil, fmt.Errorf("%w: too many points (max %d), use a larger interval", ErrInvalidInput, maxHistoryPoints)
+		}
+	}
+
+	return starts, nil
+}
+
+// truncatePeriod возвращает начало периода, содержащего t (недели начинаются с понедельника)
+func truncatePeriod(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch interval {
+	case IntervalWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextPeriod возвращает начало следующего периода
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// BALANCE HISTORY ENDPOINTS
+
+// handleGetBalanceHistory возвращает баланс счета на конец каждого дня, недели или месяца.
+// По умолчанию: to - сегодня, from - 90 дней назад для day и год назад для week/month
+// GET /api/accounts/{id}/balance-history?bank=vbank&from=2025-01-01&to=2025-03-31&interval=week&owner=team053-1
+func (s *Server) handleGetBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	bankCode := r.URL.Query().Get("bank")
+	if bankCode == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
+		return
+	}
+	if bankCode != ManualBankCode {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankCode)
+			return
+		}
+	}
+
+	// ?owner= - счет, открытый пользователю участником домохозяйства
+	userID, err := s.accountUser(r, bankCode, accountID, false)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to access account: "+err.Error())
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		writeError(w, r, http.StatusBadRequest, "Invalid 'interval' (use day, week or month)")
+		return
+	}
+
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'to' date format (use YYYY-MM-DD)")
+			return
+		}
+		to = t
+	}
+
+	from := to.AddDate(-1, 0, 0)
+	if interval == IntervalDay {
+		from = to.AddDate(0, 0, -90)
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'from' date format (use YYYY-MM-DD)")
+			return
+		}
+		from = t
+	}
+
+	points, err := s.aggregator.GetBalanceHistory(r.Context(), bankCode, userID, accountID, from, to, interval)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to build balance history", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to build balance history: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"account_id": accountID,
+		"bank":       bankCode,
+		"interval":   interval,
+		"points":     points,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodStarts(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		interval string
+		want     []string
+	}{
+		{"days", "2025-02-27", "2025-03-01", IntervalDay, []string{"2025-02-27", "2025-02-28", "2025-03-01"}},
+		// Недели начинаются с понедельника, 2025-03-09 - воскресенье
+		{"week from Sunday", "2025-03-09", "2025-03-10", IntervalWeek, []string{"2025-03-03", "2025-03-10"}},
+		{"week from Monday", "2025-03-10", "2025-03-16", IntervalWeek, []string{"2025-03-10"}},
+		{"week across year", "2024-12-31", "2025-01-06", IntervalWeek, []string{"2024-12-30", "2025-01-06"}},
+		// С 31 января месяцы не сдвигаются на 3 марта
+		{"month from the 31st", "2025-01-31", "2025-03-15", IntervalMonth, []string{"2025-01-01", "2025-02-01", "2025-03-01"}},
+		{"month across year", "2024-12-15", "2025-01-01", IntervalMonth, []string{"2024-12-01", "2025-01-01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, err := periodStarts(date(tt.from), date(tt.to), tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(starts) != len(tt.want) {
+				t.Fatalf("starts = %v, want %v", starts, tt.want)
+			}
+			for i, start := range starts {
+				if got := start.Format("2006-01-02"); got != tt.want[i] {
+					t.Errorf("start %d = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := periodStarts(date("2025-03-02"), date("2025-03-01"), IntervalDay); err == nil {
+		t.Error("'to' before 'from' accepted")
+	}
+	if _, err := periodStarts(date("2020-01-01"), date("2025-03-01"), IntervalDay); err == nil {
+		t.Errorf("more than %d points accepted", maxHistoryPoints)
+	}
+}
+
+func TestBuildBalanceHistory(t *testing.T) {
+	at := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	running := func(v float64) *float64 { return &v }
+
+	// Текущий баланс 1000 на субботу 2025-03-15 12:00
+	now := at("2025-03-15 12:00")
+	const current = 1000.0
+
+	tests := []struct {
+		name        string
+		from        string
+		interval    string
+		movements   []balanceMovement
+		wantBalance []float64
+		wantSource  []string
+	}{
+		{
+			name:        "no movements",
+			from:        "2025-03-13 00:00",
+			interval:    IntervalDay,
+			wantBalance: []float64{1000, 1000, 1000},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceReconstructed, BalanceSourceReconstructed},
+		},
+		{
+			name:     "operations rolled back from current balance",
+			from:     "2025-03-12 00:00",
+			interval: IntervalDay,
+			movements: []balanceMovement{
+				{Date: at("2025-03-14 10:00"), Amount: 200},
+				{Date: at("2025-03-13 09:00"), Amount: -50.5},
+				{Date: at("2025-03-15 13:00"), Amount: 30}, // после now: уже в текущем балансе, откатывается
+			},
+			wantBalance: []float64{820.5, 770, 970, 970},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceReconstructed, BalanceSourceReconstructed, BalanceSourceReconstructed},
+		},
+		{
+			name:     "running balance anchors the period and earlier ones",
+			from:     "2025-03-13 00:00",
+			interval: IntervalDay,
+			movements: []balanceMovement{
+				{Date: at("2025-03-14 10:00"), Amount: -100, Running: running(500), Source: BalanceSourceRunning},
+			},
+			wantBalance: []float64{600, 500, 500},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceRunning, BalanceSourceRunning},
+		},
+		{
+			name:     "snapshot replaces reconstructed balance",
+			from:     "2025-03-12 00:00",
+			interval: IntervalDay,
+			movements: []balanceMovement{
+				{Date: at("2025-03-14 08:00"), Amount: 300},
+				{Date: at("2025-03-13 23:00"), Running: running(700), Source: BalanceSourceSnapshot},
+			},
+			wantBalance: []float64{700, 700, 1000, 1000},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceSnapshot, BalanceSourceReconstructed, BalanceSourceReconstructed},
+		},
+		{
+			name:     "operation at midnight Monday belongs to the new week",
+			from:     "2025-03-03 00:00",
+			interval: IntervalWeek,
+			movements: []balanceMovement{
+				{Date: at("2025-03-10 00:00"), Amount: 50},
+				{Date: at("2025-03-09 23:59"), Amount: 100},
+			},
+			wantBalance: []float64{950, 1000},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceReconstructed},
+		},
+		{
+			name:     "operation on the first of the month belongs to the new month",
+			from:     "2025-01-15 00:00",
+			interval: IntervalMonth,
+			movements: []balanceMovement{
+				{Date: at("2025-03-02 10:00"), Amount: 200},
+				{Date: at("2025-02-01 00:00"), Amount: 100},
+				{Date: at("2025-01-31 23:00"), Amount: -300},
+			},
+			wantBalance: []float64{700, 800, 1000},
+			wantSource:  []string{BalanceSourceReconstructed, BalanceSourceReconstructed, BalanceSourceReconstructed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts, err := periodStarts(at(tt.from), now, tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			points := buildBalanceHistory(current, "RUB", now, starts, tt.interval, tt.movements)
+
+			if len(points) != len(tt.wantBalance) {
+				t.Fatalf("got %d points, want %d: %+v", len(points), len(tt.wantBalance), points)
+			}
+			for i, point := range points {
+				if point.Balance != tt.wantBalance[i] || point.Source != tt.wantSource[i] {
+					t.Errorf("point %s = %.2f (%s), want %.2f (%s)",
+						point.Date, point.Balance, point.Source, tt.wantBalance[i], tt.wantSource[i])
+				}
+				if point.Date != starts[i].Format("2006-01-02") || point.Currency != "RUB" {
+					t.Errorf("point %d = %+v, want date %s in RUB", i, point, starts[i].Format("2006-01-02"))
+				}
+			}
+		})
+	}
+}
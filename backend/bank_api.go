@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"sync"
@@ -19,6 +18,8 @@ type BankAPIClient struct {
 	clientSecret   string
 	requestingBank string
 
+	supportsIdempotencyKey bool // передавать Idempotency-Key (банк его учитывает)
+
 	// Кэш токенов с защитой от race condition
 	mu          sync.RWMutex
 	accessToken string
@@ -26,17 +27,33 @@ type BankAPIClient struct {
 }
 
 // NewBankAPIClient создает новый клиент для Banking API
-func NewBankAPIClient(baseURL, clientID, clientSecret, requestingBank string) *BankAPIClient {
+func NewBankAPIClient(baseURL, clientID, clientSecret, requestingBank string, supportsIdempotencyKey bool) *BankAPIClient {
 	return &BankAPIClient{
-		httpClient:     NewHTTPClient(baseURL),
-		clientID:       clientID,
-		clientSecret:   clientSecret,
-		requestingBank: requestingBank,
+		httpClient:             NewHTTPClient(baseURL),
+		clientID:               clientID,
+		clientSecret:           clientSecret,
+		requestingBank:         requestingBank,
+		supportsIdempotencyKey: supportsIdempotencyKey,
 	}
 }
 
 // AUTHENTICATION
 
+// SetClientSecret меняет client_secret (после обновления в источнике секретов).
+// Кэшированный токен сбрасывается: следующий запрос авторизуется с новым секретом
+func (c *BankAPIClient) SetClientSecret(secret string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.clientSecret == secret {
+		return false
+	}
+	c.clientSecret = secret
+	c.accessToken = ""
+	c.tokenExpiry = time.Time{}
+	return true
+}
+
 // EnsureToken получает или возвращает кэшированный токен
 func (c *BankAPIClient) EnsureToken(ctx context.Context) (string, error) {
 	// Проверяем кэш с защитой от гонок
@@ -73,9 +90,8 @@ func (c *BankAPIClient) requestToken(ctx context.Context) (string, error) {
 	queryParams.Set("client_id", c.clientID)
 	queryParams.Set("client_secret", c.clientSecret)
 
-	// Debug логирование
-	log.Printf("[DEBUG] Requesting token with client_id=%s (secret length: %d)", 
-		c.clientID, len(c.clientSecret))
+	// Debug логирование (без сведений о секрете)
+	httpClientLog.DebugContext(ctx, "Requesting token", "client_id", c.clientID)
 
 	resp, err := c.httpClient.DoRequest(ctx, RequestOptions{
 		Method:      http.MethodPost,
@@ -88,9 +104,7 @@ func (c *BankAPIClient) requestToken(ctx context.Context) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		errBody := ReadErrorResponse(resp)
-		log.Printf("[ERROR] Token request failed: status=%d, body=%s", resp.StatusCode, errBody)
-		return "", fmt.Errorf("token request failed: %s", errBody)
+		return "", ReadBankError(ctx, resp, "token request")
 	}
 
 	var tokenResp TokenResponse
@@ -142,7 +156,7 @@ func (c *BankAPIClient) CreateConsent(ctx context.Context, clientID string, perm
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("create consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "create consent")
 	}
 
 	var consent ConsentResponse
@@ -175,7 +189,7 @@ func (c *BankAPIClient) GetConsentStatus(ctx context.Context, consentID string)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get consent")
 	}
 
 	var consent ConsentResponse
@@ -208,7 +222,7 @@ func (c *BankAPIClient) RevokeConsent(ctx context.Context, consentID string) err
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("revoke consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return ReadBankError(ctx, resp, "revoke consent")
 	}
 
 	resp.Body.Close()
@@ -247,15 +261,15 @@ func (c *BankAPIClient) GetAccounts(ctx context.Context, consentID, clientID str
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get accounts failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get accounts")
 	}
 
 	// Парсим ответ с поддержкой разных форматов
-	return c.parseAccountsResponse(resp)
+	return c.parseAccountsResponse(ctx, resp)
 }
 
 // parseAccountsResponse парсит разные форматы ответа со счетами
-func (c *BankAPIClient) parseAccountsResponse(resp *http.Response) ([]AccountDetail, error) {
+func (c *BankAPIClient) parseAccountsResponse(ctx context.Context, resp *http.Response) ([]AccountDetail, error) {
 	defer resp.Body.Close()
 	
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -272,35 +286,35 @@ func (c *BankAPIClient) parseAccountsResponse(resp *http.Response) ([]AccountDet
 	// Вариант 2 обертка с полем "accounts" или "account"
 	var wrapper AccountsWrapper
 	if err := json.Unmarshal(bodyBytes, &wrapper); err == nil {
-		log.Printf("[DEBUG PARSE] wrapper.Accounts=%d, wrapper.Account=%d, wrapper.Data.Accounts=%d, wrapper.Data.Account=%d",
-			len(wrapper.Accounts), len(wrapper.Account), len(wrapper.Data.Accounts), len(wrapper.Data.Account))
+		httpClientLog.DebugContext(ctx, "Parsed accounts wrapper",
+			"wrapper_accounts", len(wrapper.Accounts), "wrapper_account", len(wrapper.Account), "wrapper_data_accounts", len(wrapper.Data.Accounts), "wrapper_data_account", len(wrapper.Data.Account))
 
 		// Проверяем множественное число "accounts"
 		if len(wrapper.Accounts) > 0 {
-			log.Printf("[DEBUG PARSE] Returning wrapper.Accounts")
+			httpClientLog.DebugContext(ctx, "Using accounts from wrapper", "field", "accounts")
 			return wrapper.Accounts, nil
 		}
 		// Проверяем единственное число "account"
 		if len(wrapper.Account) > 0 {
-			log.Printf("[DEBUG PARSE] Returning wrapper.Account")
+			httpClientLog.DebugContext(ctx, "Using accounts from wrapper", "field", "account")
 			return wrapper.Account, nil
 		}
 		// Проверяем data.accounts
 		if len(wrapper.Data.Accounts) > 0 {
-			log.Printf("[DEBUG PARSE] Returning wrapper.Data.Accounts")
+			httpClientLog.DebugContext(ctx, "Using accounts from wrapper", "field", "data.accounts")
 			return wrapper.Data.Accounts, nil
 		}
 		// Проверяем data.account
 		if len(wrapper.Data.Account) > 0 {
-			log.Printf("[DEBUG PARSE] Returning wrapper.Data.Account")
+			httpClientLog.DebugContext(ctx, "Using accounts from wrapper", "field", "data.account")
 			return wrapper.Data.Account, nil
 		}
 	} else {
-		log.Printf("[DEBUG PARSE] Unmarshal error: %v", err)
+		httpClientLog.DebugContext(ctx, "Failed to unmarshal accounts wrapper", "error", err)
 	}
 
 	// Если ничего не распарсилось - возвращаем пустой массив
-	log.Printf("[DEBUG] Failed to parse accounts response, returning empty array. Body: %s", string(bodyBytes))
+	httpClientLog.WarnContext(ctx, "Failed to parse accounts response, returning empty array", "body", bodyBytes)
 	return []AccountDetail{}, nil
 }
 
@@ -334,7 +348,7 @@ func (c *BankAPIClient) GetAccountDetail(ctx context.Context, consentID, account
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get account failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get account")
 	}
 
 	var account AccountDetail
@@ -377,7 +391,7 @@ func (c *BankAPIClient) GetBalances(ctx context.Context, consentID, accountID, c
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get balances failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get balances")
 	}
 
 	return c.parseBalancesResponse(resp)
@@ -456,7 +470,7 @@ func (c *BankAPIClient) GetTransactions(ctx context.Context, consentID, accountI
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get transactions failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get transactions")
 	}
 
 	return c.parseTransactionsResponse(resp)
@@ -516,7 +530,7 @@ func (c *BankAPIClient) CreatePaymentConsent(ctx context.Context, req PaymentCon
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("create payment consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "create payment consent")
 	}
 
 	var consent PaymentConsentResponse
@@ -549,7 +563,7 @@ func (c *BankAPIClient) GetPaymentConsentStatus(ctx context.Context, consentID s
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get payment consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get payment consent")
 	}
 
 	var consent PaymentConsentResponse
@@ -574,6 +588,7 @@ func (c *BankAPIClient) CreatePayment(ctx context.Context, paymentConsentID, cli
 		"X-Requesting-Bank":      c.requestingBank,
 		"X-Payment-Consent-Id":   paymentConsentID,
 	}
+	c.setIdempotencyKey(ctx, headers)
 
 	// Добавляем client_id в query если указан
 	queryParams := url.Values{}
@@ -593,7 +608,7 @@ func (c *BankAPIClient) CreatePayment(ctx context.Context, paymentConsentID, cli
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("create payment failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "create payment")
 	}
 
 	var payment PaymentResponse
@@ -633,7 +648,7 @@ func (c *BankAPIClient) GetPaymentStatus(ctx context.Context, paymentID, clientI
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get payment failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get payment")
 	}
 
 	var payment PaymentResponse
@@ -669,7 +684,7 @@ func (c *BankAPIClient) CreateProductAgreementConsent(ctx context.Context, req P
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("create PA consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "create PA consent")
 	}
 
 	var consent ProductAgreementConsentResponse
@@ -702,7 +717,7 @@ func (c *BankAPIClient) GetProductAgreementConsentStatus(ctx context.Context, co
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get PA consent failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get PA consent")
 	}
 
 	var consent ProductAgreementConsentResponse
@@ -746,7 +761,7 @@ func (c *BankAPIClient) GetProducts(ctx context.Context, clientID string, produc
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get products failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get products")
 	}
 
 	return c.parseProductsResponse(resp)
@@ -794,6 +809,7 @@ func (c *BankAPIClient) OpenAgreement(ctx context.Context, paConsentID, clientID
 		"Authorization":                   "Bearer " + token,
 		"X-Product-Agreement-Consent-Id":  paConsentID,
 	}
+	c.setIdempotencyKey(ctx, headers)
 
 	// Добавляем client_id в query если указан
 	queryParams := url.Values{}
@@ -813,7 +829,7 @@ func (c *BankAPIClient) OpenAgreement(ctx context.Context, paConsentID, clientID
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("open agreement failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "open agreement")
 	}
 
 	var agreement AgreementResponse
@@ -853,7 +869,7 @@ func (c *BankAPIClient) GetAgreementDetails(ctx context.Context, paConsentID, ag
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get agreement failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get agreement")
 	}
 
 	var agreement AgreementResponse
@@ -893,7 +909,7 @@ func (c *BankAPIClient) CloseAgreement(ctx context.Context, paConsentID, agreeme
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return nil, fmt.Errorf("close agreement failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "close agreement")
 	}
 
 	// Для DELETE может вернуться 204 No Content
@@ -942,7 +958,7 @@ func (c *BankAPIClient) GetAgreements(ctx context.Context, paConsentID, clientID
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get agreements failed (%d): %s", resp.StatusCode, ReadErrorResponse(resp))
+		return nil, ReadBankError(ctx, resp, "get agreements")
 	}
 
 	return c.parseAgreementsResponse(resp)
@@ -975,4 +991,15 @@ func (c *BankAPIClient) parseAgreementsResponse(resp *http.Response) ([]Agreemen
 	}
 
 	return []AgreementResponse{}, nil
-}
\ No newline at end of file
+}
+
+// setIdempotencyKey передает ключ идемпотентности банку, который его поддерживает.
+// Без заголовка HTTPClient не повторяет POST: банк без поддержки провел бы его дважды
+func (c *BankAPIClient) setIdempotencyKey(ctx context.Context, headers map[string]string) {
+	if !c.supportsIdempotencyKey {
+		return
+	}
+	if key := getIdempotencyKey(ctx); key != "" {
+		headers["Idempotency-Key"] = key
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxCalcTermMonths максимальный срок расчета (50 лет)
+const maxCalcTermMonths = 600
+
+// Способы начисления процентов по вкладу
+const (
+	CapitalizationNone    = "none"    // проценты выплачиваются, сумма вклада не растет
+	CapitalizationMonthly = "monthly" // проценты ежемесячно прибавляются к вкладу
+)
+
+// Способы погашения кредита
+const (
+	RepaymentAnnuity        = "annuity"        // равные платежи
+	RepaymentDifferentiated = "differentiated" // равные доли основного долга
+)
+
+// DepositProjection доходность вклада при простых процентах и ежемесячной капитализации
+type DepositProjection struct {
+	Principal      float64         `json:"principal"`
+	Rate           float64         `json:"rate"` // годовая ставка, %
+	TermMonths     int             `json:"term_months"`
+	Capitalization string          `json:"capitalization"` // выбранный способ; interest и maturity_value по нему
+	Interest       float64         `json:"interest"`
+	MaturityValue  float64         `json:"maturity_value"`
+	Simple         DepositOutcome  `json:"simple"`
+	Capitalized    DepositOutcome  `json:"capitalized"`
+	Schedule       []DepositPeriod `json:"schedule"`
+}
+
+// DepositOutcome итог вклада при одном способе начисления
+type DepositOutcome struct {
+	Interest      float64 `json:"interest"`
+	MaturityValue float64 `json:"maturity_value"`
+}
+
+// DepositPeriod начисление процентов за один месяц
+type DepositPeriod struct {
+	Month    int        `json:"month"`
+	Date     *time.Time `json:"date,omitempty"`
+	Interest float64    `json:"interest"`
+	Balance  float64    `json:"balance"` // сумма вклада после начисления
+}
+
+// LoanSchedule график погашения кредита
+type LoanSchedule struct {
+	Principal      float64       `json:"principal"`
+	Rate           float64       `json:"rate"` // годовая ставка, %
+	TermMonths     int           `json:"term_months"`
+	Method         string        `json:"method"`
+	MonthlyPayment float64       `json:"monthly_payment"` // для дифференцированного - первый платеж
+	TotalPaid      float64       `json:"total_paid"`
+	Overpayment    float64       `json:"overpayment"`
+	Payments       []LoanPayment `json:"payments"`
+}
+
+// LoanPayment один платеж по кредиту
+type LoanPayment struct {
+	Number    int        `json:"number"`
+	Date      *time.Time `json:"date,omitempty"`
+	Payment   float64    `json:"payment"`
+	Principal float64    `json:"principal"`
+	Interest  float64    `json:"interest"`
+	Remaining float64    `json:"remaining"`
+}
+
+// validateCalcParams проверяет общие параметры расчета
+func validateCalcParams(amount, rate float64, termMonths int) error {
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidInput)
+	}
+	if rate < 0 || rate > 100 || math.IsNaN(rate) {
+		return fmt.Errorf("%w: rate must be between 0 and 100 percent", ErrInvalidInput)
+	}
+	if termMonths <= 0 || termMonths > maxCalcTermMonths {
+		return fmt.Errorf("%w: term must be between 1 and %d months", ErrInvalidInput, maxCalcTermMonths)
+	}
+	return nil
+}
+
+// CalculateDeposit считает доход по вкладу. Простые проценты начисляются на исходную сумму,
+// при капитализации проценты каждого месяца (с округлением до копеек) прибавляются к вкладу.
+// График строится для выбранного способа; start может быть нулевым - тогда без дат
+func CalculateDeposit(amount, rate float64, termMonths int, capitalization string, start time.Time) (*DepositProjection, error) {
+	if err := validateCalcParams(amount, rate, termMonths); err != nil {
+		return nil, err
+	}
+	if capitalization == "" {
+		capitalization = CapitalizationNone
+	}
+	if capitalization != CapitalizationNone && capitalization != CapitalizationMonthly {
+		return nil, fmt.Errorf("%w: capitalization must be %q or %q", ErrInvalidInput, CapitalizationNone, CapitalizationMonthly)
+	}
+
+	principal := roundMoney(amount)
+	monthly := rate / 100 / 12
+
+	p := &DepositProjection{
+		Principal:      principal,
+		Rate:           rate,
+		TermMonths:     termMonths,
+		Capitalization: capitalization,
+		Schedule:       make([]DepositPeriod, 0, termMonths),
+	}
+
+	balance := principal
+	var simpleTotal float64
+
+	for month := 1; month <= termMonths; month++ {
+		// Простые проценты считаем нарастающим итогом, чтобы округление не копилось
+		accrued := roundMoney(principal * monthly * float64(month))
+		simpleMonthly := roundMoney(accrued - simpleTotal)
+		simpleTotal = accrued
+
+		compound := roundMoney(balance * monthly)
+		balance = roundMoney(balance + compound)
+
+		period := DepositPeriod{Month: month, Date: scheduleDate(start, month)}
+		if capitalization == CapitalizationMonthly {
+			period.Interest = compound
+			period.Balance = balance
+		} else {
+			period.Interest = simpleMonthly
+			period.Balance = principal
+		}
+		p.Schedule = append(p.Schedule, period)
+	}
+
+	p.Simple = DepositOutcome{Interest: simpleTotal, MaturityValue: roundMoney(principal + simpleTotal)}
+	p.Capitalized = DepositOutcome{Interest: roundMoney(balance - principal), MaturityValue: balance}
+
+	chosen := p.Simple
+	if capitalization == CapitalizationMonthly {
+		chosen = p.Capitalized
+	}
+	p.Interest = chosen.Interest
+	p.MaturityValue = chosen.MaturityValue
+
+	return p, nil
+}
+
+// CalculateLoan строит график погашения кредита. Проценты месяца считаются от остатка долга,
+// последний платеж закрывает остаток с учетом накопленного округления
+func CalculateLoan(amount, rate float64, termMonths int, method string, start time.Time) (*LoanSchedule, error) {
+	if err := validateCalcParams(amount, rate, termMonths); err != nil {
+		return nil, err
+	}
+	if method == "" {
+		method = RepaymentAnnuity
+	}
+	if method != RepaymentAnnuity && method != RepaymentDifferentiated {
+		return nil, fmt.Errorf("%w: method must be %q or %q", ErrInvalidInput, RepaymentAnnuity, RepaymentDifferentiated)
+	}
+
+	principal := roundMoney(amount)
+	monthly := rate / 100 / 12
+
+	s := &LoanSchedule{
+		Principal:  principal,
+		Rate:       rate,
+		TermMonths: termMonths,
+		Method:     method,
+		Payments:   make([]LoanPayment, 0, termMonths),
+	}
+
+	annuity := annuityPayment(principal, monthly, termMonths)
+	principalPart := roundMoney(principal / float64(termMonths))
+	remaining := principal
+
+	for n := 1; n <= termMonths; n++ {
+		interest := roundMoney(remaining * monthly)
+
+		var part float64
+		if method == RepaymentAnnuity {
+			part = roundMoney(annuity - interest)
+		} else {
+			part = principalPart
+		}
+		if n == termMonths || part > remaining {
+			part = remaining
+		}
+
+		remaining = roundMoney(remaining - part)
+		payment := roundMoney(part + interest)
+
+		s.Payments = append(s.Payments, LoanPayment{
+			Number:    n,
+			Date:      scheduleDate(start, n),
+			Payment:   payment,
+			Principal: part,
+			Interest:  interest,
+			Remaining: remaining,
+		})
+		s.TotalPaid = roundMoney(s.TotalPaid + payment)
+	}
+
+	s.MonthlyPayment = s.Payments[0].Payment
+	s.Overpayment = roundMoney(s.TotalPaid - principal)
+
+	return s, nil
+}
+
+// annuityPayment размер аннуитетного платежа (до копеек)
+func annuityPayment(principal, monthly float64, termMonths int) float64 {
+	if monthly == 0 {
+		return roundMoney(principal / float64(termMonths))
+	}
+	return roundMoney(principal * monthly / (1 - math.Pow(1+monthly, -float64(termMonths))))
+}
+
+// scheduleDate дата n-го месяца от начала (nil, если начало не задано). День начала,
+// которого нет в коротком месяце, переносится на последний день месяца (31 января - 28 февраля)
+func scheduleDate(start time.Time, n int) *time.Time {
+	if start.IsZero() {
+		return nil
+	}
+	first := time.Date(start.Year(), start.Month()+time.Month(n), 1,
+		start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	day := start.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	d := first.AddDate(0, 0, day-1)
+	return &d
+}
+
+// agreementTermMonths срок договора в месяцах: по датам начала и окончания,
+// а если их нет - по сроку договора
+func agreementTermMonths(agreement *AgreementResponse) (int, error) {
+	if !agreement.StartDate.IsZero() && !agreement.EndDate.IsZero() {
+		return monthsUntil(agreement.StartDate.Time, agreement.EndDate.Time), nil
+	}
+
+	if agreement.Term > 0 {
+		months, err := convertTermToMonths(float64(agreement.Term), agreement.TermUnit)
+		if err != nil {
+			return 0, err
+		}
+		return int(math.Ceil(months)), nil
+	}
+
+	return 0, fmt.Errorf("%w: agreement %s has no term or start/end dates", ErrInvalidInput, agreement.AgreementID)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// CalculatorInput параметры расчета. Если указан product_id, ставка и допустимые
+// сумма и срок берутся из продукта банка; явный rate переопределяет ставку продукта
+type CalculatorInput struct {
+	Bank           string       `json:"bank,omitempty"`
+	ProductID      string       `json:"product_id,omitempty"`
+	Amount         float64      `json:"amount"`
+	Rate           *float64     `json:"rate,omitempty"` // годовая ставка, %
+	Term           float64      `json:"term,omitempty"`
+	TermUnit       string       `json:"term_unit,omitempty"` // DAYS, MONTHS (по умолчанию), YEARS
+	Capitalization string       `json:"capitalization,omitempty"`
+	Method         string       `json:"method,omitempty"`
+	StartDate      FlexibleTime `json:"start_date,omitempty"`
+}
+
+// CALCULATOR ENDPOINTS
+
+// handleCalculateDeposit считает доход по вкладу до открытия договора
+// POST /api/calculator/deposit
+func (s *Server) handleCalculateDeposit(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	input, ok := s.decodeCalculatorInput(w, r)
+	if !ok {
+		return
+	}
+
+	rate, months, err := s.resolveCalculatorInput(r.Context(), userID, input, "DEPOSIT")
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to calculate deposit: "+err.Error())
+		return
+	}
+
+	projection, err := CalculateDeposit(input.Amount, rate, months, input.Capitalization, input.StartDate.Time)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to calculate deposit: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, projection)
+}
+
+// handleCalculateLoan строит график платежей по кредиту до открытия договора
+// POST /api/calculator/loan
+func (s *Server) handleCalculateLoan(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	input, ok := s.decodeCalculatorInput(w, r)
+	if !ok {
+		return
+	}
+
+	rate, months, err := s.resolveCalculatorInput(r.Context(), userID, input, "LOAN")
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to calculate loan: "+err.Error())
+		return
+	}
+
+	schedule, err := CalculateLoan(input.Amount, rate, months, input.Method, input.StartDate.Time)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to calculate loan: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// handleGetAgreementSchedule строит график по существующему договору
+// (по датам начала и окончания, сумме и ставке договора)
+// GET /api/agreements/{id}/schedule?bank=vbank&capitalization=monthly&method=annuity
+func (s *Server) handleGetAgreementSchedule(w http.ResponseWriter, r *http.Request) {
+	agreementID := r.PathValue("id")
+	if agreementID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing agreement ID in path")
+		return
+	}
+
+	bankCode := r.URL.Query().Get("bank")
+	if bankCode == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	agreement, err := s.aggregator.GetAgreementDetails(r.Context(), bankCode, agreementID, userID)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to get agreement details", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to get agreement details: "+err.Error())
+		return
+	}
+
+	rate := parseLooseNumber(agreement.InterestRate)
+	if rate == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Agreement has no interest rate")
+		return
+	}
+
+	months, err := agreementTermMonths(agreement)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Failed to build schedule: "+err.Error())
+		return
+	}
+
+	amount := parseAmount(agreement.Amount.Amount)
+	result := map[string]interface{}{
+		"agreement_id": agreement.AgreementID,
+		"product_type": agreement.ProductType,
+		"currency":     agreement.Amount.Currency,
+	}
+
+	if strings.EqualFold(agreement.ProductType, "LOAN") {
+		schedule, err := CalculateLoan(amount, *rate, months, r.URL.Query().Get("method"), agreement.StartDate.Time)
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "Failed to build schedule: "+err.Error())
+			return
+		}
+		result["loan"] = schedule
+	} else {
+		projection, err := CalculateDeposit(amount, *rate, months, r.URL.Query().Get("capitalization"), agreement.StartDate.Time)
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "Failed to build schedule: "+err.Error())
+			return
+		}
+		result["deposit"] = projection
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// decodeCalculatorInput читает тело запроса калькулятора
+func (s *Server) decodeCalculatorInput(w http.ResponseWriter, r *http.Request) (CalculatorInput, bool) {
+	var input CalculatorInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return input, false
+	}
+	return input, true
+}
+
+// resolveCalculatorInput определяет ставку и срок в месяцах, при необходимости по продукту банка,
+// и проверяет, что сумма и срок укладываются в условия продукта
+func (s *Server) resolveCalculatorInput(ctx context.Context, userID string, input CalculatorInput, productType string) (float64, int, error) {
+	var product *CatalogProduct
+	if input.ProductID != "" {
+		if input.Bank == "" {
+			return 0, 0, fmt.Errorf("%w: bank is required with product_id", ErrInvalidInput)
+		}
+		if _, err := s.aggregator.GetBankByCode(ctx, input.Bank); err != nil {
+			return 0, 0, fmt.Errorf("%w: unknown bank %s", ErrInvalidInput, input.Bank)
+		}
+
+		p, err := s.aggregator.FindProduct(ctx, input.Bank, userID, input.ProductID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !strings.EqualFold(p.ProductType, productType) {
+			return 0, 0, fmt.Errorf("%w: product %s is %s, not %s", ErrInvalidInput, p.ProductID, p.ProductType, productType)
+		}
+		product = p
+	}
+
+	var rate float64
+	switch {
+	case input.Rate != nil:
+		rate = *input.Rate
+	case product != nil && product.EffectiveRate != nil:
+		rate = *product.EffectiveRate
+	default:
+		return 0, 0, fmt.Errorf("%w: rate is required", ErrInvalidInput)
+	}
+
+	var months float64
+	switch {
+	case input.Term > 0:
+		m, err := convertTermToMonths(input.Term, input.TermUnit)
+		if err != nil {
+			return 0, 0, err
+		}
+		months = m
+	case product != nil && product.TermMinMonths != nil:
+		months = *product.TermMinMonths
+	default:
+		return 0, 0, fmt.Errorf("%w: term is required", ErrInvalidInput)
+	}
+
+	if product != nil {
+		filter := CatalogFilter{Amount: &input.Amount, TermMonths: &months}
+		if !filter.matches(*product) {
+			return 0, 0, fmt.Errorf("%w: amount or term is outside product %s limits", ErrInvalidInput, product.ProductID)
+		}
+	}
+
+	// Расчет идет помесячно, неполный месяц считается целым
+	return rate, int(math.Ceil(months - 1e-9)), nil
+}
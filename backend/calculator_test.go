@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalculateDeposit(t *testing.T) {
+	tests := []struct {
+		name           string
+		amount, rate   float64
+		termMonths     int
+		capitalization string
+		simple         DepositOutcome
+		capitalized    DepositOutcome
+		lastPeriod     DepositPeriod
+	}{
+		{
+			name: "simple interest", amount: 100000, rate: 12, termMonths: 12, capitalization: CapitalizationNone,
+			simple:      DepositOutcome{Interest: 12000, MaturityValue: 112000},
+			capitalized: DepositOutcome{Interest: 12682.51, MaturityValue: 112682.51},
+			lastPeriod:  DepositPeriod{Month: 12, Interest: 1000, Balance: 100000},
+		},
+		{
+			name: "monthly capitalization", amount: 100000, rate: 12, termMonths: 12, capitalization: CapitalizationMonthly,
+			simple:      DepositOutcome{Interest: 12000, MaturityValue: 112000},
+			capitalized: DepositOutcome{Interest: 12682.51, MaturityValue: 112682.51},
+			lastPeriod:  DepositPeriod{Month: 12, Interest: 1115.67, Balance: 112682.51},
+		},
+		{
+			name: "fractional rate", amount: 50000, rate: 7.5, termMonths: 6, capitalization: CapitalizationMonthly,
+			simple:      DepositOutcome{Interest: 1875, MaturityValue: 51875},
+			capitalized: DepositOutcome{Interest: 1904.55, MaturityValue: 51904.55},
+			lastPeriod:  DepositPeriod{Month: 6, Interest: 322.39, Balance: 51904.55},
+		},
+		{
+			name: "default capitalization is none", amount: 1000, rate: 0, termMonths: 3,
+			simple:      DepositOutcome{Interest: 0, MaturityValue: 1000},
+			capitalized: DepositOutcome{Interest: 0, MaturityValue: 1000},
+			lastPeriod:  DepositPeriod{Month: 3, Interest: 0, Balance: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := CalculateDeposit(tt.amount, tt.rate, tt.termMonths, tt.capitalization, time.Time{})
+			if err != nil {
+				t.Fatalf("CalculateDeposit: %v", err)
+			}
+
+			if p.Simple != tt.simple {
+				t.Errorf("simple = %+v, want %+v", p.Simple, tt.simple)
+			}
+			if p.Capitalized != tt.capitalized {
+				t.Errorf("capitalized = %+v, want %+v", p.Capitalized, tt.capitalized)
+			}
+
+			chosen := tt.simple
+			if tt.capitalization == CapitalizationMonthly {
+				chosen = tt.capitalized
+			}
+			if p.Interest != chosen.Interest || p.MaturityValue != chosen.MaturityValue {
+				t.Errorf("interest, maturity = %v, %v, want %v, %v", p.Interest, p.MaturityValue, chosen.Interest, chosen.MaturityValue)
+			}
+
+			if len(p.Schedule) != tt.termMonths {
+				t.Fatalf("schedule has %d periods, want %d", len(p.Schedule), tt.termMonths)
+			}
+			if last := p.Schedule[len(p.Schedule)-1]; last != tt.lastPeriod {
+				t.Errorf("last period = %+v, want %+v", last, tt.lastPeriod)
+			}
+
+			var total float64
+			for _, period := range p.Schedule {
+				total = roundMoney(total + period.Interest)
+			}
+			if total != p.Interest {
+				t.Errorf("schedule interest sums to %v, want %v", total, p.Interest)
+			}
+		})
+	}
+}
+
+func TestCalculateLoan(t *testing.T) {
+	tests := []struct {
+		name           string
+		amount, rate   float64
+		termMonths     int
+		method         string
+		monthlyPayment float64
+		totalPaid      float64
+		overpayment    float64
+		first, last    LoanPayment
+	}{
+		{
+			name: "annuity", amount: 120000, rate: 12, termMonths: 12, method: RepaymentAnnuity,
+			monthlyPayment: 10661.85, totalPaid: 127942.26, overpayment: 7942.26,
+			first: LoanPayment{Number: 1, Payment: 10661.85, Principal: 9461.85, Interest: 1200, Remaining: 110538.15},
+			// Последний платеж закрывает остаток с накопленным округлением
+			last: LoanPayment{Number: 12, Payment: 10661.91, Principal: 10556.35, Interest: 105.56, Remaining: 0},
+		},
+		{
+			name: "annuity long term", amount: 1000000, rate: 9.9, termMonths: 240, method: RepaymentAnnuity,
+			monthlyPayment: 9584.06, totalPaid: 2300170.79, overpayment: 1300170.79,
+			first: LoanPayment{Number: 1, Payment: 9584.06, Principal: 1334.06, Interest: 8250, Remaining: 998665.94},
+			last:  LoanPayment{Number: 240, Payment: 9580.45, Principal: 9502.06, Interest: 78.39, Remaining: 0},
+		},
+		{
+			name: "annuity zero rate", amount: 100000, rate: 0, termMonths: 3, method: RepaymentAnnuity,
+			monthlyPayment: 33333.33, totalPaid: 100000, overpayment: 0,
+			first: LoanPayment{Number: 1, Payment: 33333.33, Principal: 33333.33, Interest: 0, Remaining: 66666.67},
+			last:  LoanPayment{Number: 3, Payment: 33333.34, Principal: 33333.34, Interest: 0, Remaining: 0},
+		},
+		{
+			name: "differentiated", amount: 120000, rate: 12, termMonths: 12, method: RepaymentDifferentiated,
+			monthlyPayment: 11200, totalPaid: 127800, overpayment: 7800,
+			first: LoanPayment{Number: 1, Payment: 11200, Principal: 10000, Interest: 1200, Remaining: 110000},
+			last:  LoanPayment{Number: 12, Payment: 10100, Principal: 10000, Interest: 100, Remaining: 0},
+		},
+		{
+			name: "differentiated zero rate remainder", amount: 100000, rate: 0, termMonths: 3, method: RepaymentDifferentiated,
+			monthlyPayment: 33333.33, totalPaid: 100000, overpayment: 0,
+			first: LoanPayment{Number: 1, Payment: 33333.33, Principal: 33333.33, Interest: 0, Remaining: 66666.67},
+			last:  LoanPayment{Number: 3, Payment: 33333.34, Principal: 33333.34, Interest: 0, Remaining: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := CalculateLoan(tt.amount, tt.rate, tt.termMonths, tt.method, time.Time{})
+			if err != nil {
+				t.Fatalf("CalculateLoan: %v", err)
+			}
+
+			if s.MonthlyPayment != tt.monthlyPayment || s.TotalPaid != tt.totalPaid || s.Overpayment != tt.overpayment {
+				t.Errorf("monthly, total, overpayment = %v, %v, %v, want %v, %v, %v",
+					s.MonthlyPayment, s.TotalPaid, s.Overpayment, tt.monthlyPayment, tt.totalPaid, tt.overpayment)
+			}
+			if len(s.Payments) != tt.termMonths {
+				t.Fatalf("schedule has %d payments, want %d", len(s.Payments), tt.termMonths)
+			}
+			if first := s.Payments[0]; first != tt.first {
+				t.Errorf("first payment = %+v, want %+v", first, tt.first)
+			}
+			if last := s.Payments[len(s.Payments)-1]; last != tt.last {
+				t.Errorf("last payment = %+v, want %+v", last, tt.last)
+			}
+
+			var principal float64
+			for _, payment := range s.Payments {
+				principal = roundMoney(principal + payment.Principal)
+			}
+			if principal != s.Principal {
+				t.Errorf("principal parts sum to %v, want %v", principal, s.Principal)
+			}
+		})
+	}
+}
+
+func TestCalculatorInvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		err  func() error
+	}{
+		{"zero amount", func() error { _, err := CalculateDeposit(0, 10, 12, "", time.Time{}); return err }},
+		{"negative rate", func() error { _, err := CalculateDeposit(1000, -1, 12, "", time.Time{}); return err }},
+		{"rate over 100", func() error { _, err := CalculateLoan(1000, 101, 12, "", time.Time{}); return err }},
+		{"zero term", func() error { _, err := CalculateLoan(1000, 10, 0, "", time.Time{}); return err }},
+		{"term over limit", func() error { _, err := CalculateLoan(1000, 10, maxCalcTermMonths+1, "", time.Time{}); return err }},
+		{"unknown capitalization", func() error { _, err := CalculateDeposit(1000, 10, 12, "daily", time.Time{}); return err }},
+		{"unknown method", func() error { _, err := CalculateLoan(1000, 10, 12, "balloon", time.Time{}); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.err(); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("error = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestScheduleDate(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		n     int
+		want  time.Time
+	}{
+		{"next month", date(2025, time.March, 15), 1, date(2025, time.April, 15)},
+		{"end of January to February", date(2025, time.January, 31), 1, date(2025, time.February, 28)},
+		{"end of January to leap February", date(2024, time.January, 31), 1, date(2024, time.February, 29)},
+		{"end of January to March keeps day", date(2025, time.January, 31), 2, date(2025, time.March, 31)},
+		{"31st to 30-day month", date(2025, time.March, 31), 1, date(2025, time.April, 30)},
+		{"next year", date(2025, time.November, 30), 3, date(2026, time.February, 28)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scheduleDate(tt.start, tt.n)
+			if got == nil || !got.Equal(tt.want) {
+				t.Errorf("scheduleDate(%s, %d) = %v, want %s", tt.start.Format(time.DateOnly), tt.n, got, tt.want)
+			}
+		})
+	}
+
+	if got := scheduleDate(time.Time{}, 1); got != nil {
+		t.Errorf("scheduleDate without start = %v, want nil", got)
+	}
+}
+
+func TestAgreementTermMonths(t *testing.T) {
+	date := func(s string) FlexibleTime {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FlexibleTime{Time: d}
+	}
+
+	tests := []struct {
+		name      string
+		agreement AgreementResponse
+		want      int
+		wantErr   bool
+	}{
+		{"dates one year", AgreementResponse{StartDate: date("2025-01-15"), EndDate: date("2026-01-15")}, 12, false},
+		{"dates partial month rounds up", AgreementResponse{StartDate: date("2025-01-15"), EndDate: date("2025-04-20")}, 4, false},
+		{"dates win over term", AgreementResponse{StartDate: date("2025-01-01"), EndDate: date("2025-07-01"), Term: 12}, 6, false},
+		{"term in months", AgreementResponse{Term: 18, TermUnit: "months"}, 18, false},
+		{"term without unit is months", AgreementResponse{Term: 9}, 9, false},
+		{"term in years", AgreementResponse{Term: 2, TermUnit: "years"}, 24, false},
+		{"term in days", AgreementResponse{Term: 365, TermUnit: "days"}, 12, false},
+		{"term in days rounds up", AgreementResponse{Term: 100, TermUnit: "days"}, 4, false},
+		{"unknown unit", AgreementResponse{Term: 3, TermUnit: "weeks"}, 0, true},
+		{"no term", AgreementResponse{AgreementID: "agr-1"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := agreementTermMonths(&tt.agreement)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidInput) {
+					t.Errorf("error = %v, want ErrInvalidInput", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("agreementTermMonths: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("agreementTermMonths = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
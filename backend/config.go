@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 	"github.com/joho/godotenv"
 )
 
@@ -12,15 +13,34 @@ import (
 type Bank struct {
 	Code    string
 	BaseURL string
+
+	SupportsIdempotencyKey bool // банк учитывает Idempotency-Key: только таким банкам POST можно повторять
 }
 
 // Config содержит конфигурацию приложения
 type Config struct {
 	TeamID       string
-	ClientSecret string
 	Banks        []Bank
 	CORSOrigin   string
 	Port         string
+	DataDir      string // директория для пользовательских данных (ручные счета и т.д.)
+
+	SchedulerInterval time.Duration // как часто проверять платежи по расписанию
+
+	Tenants       []Tenant // команды со своими учетными данными в банках
+	DefaultTenant string   // арендатор для регистрации без явного tenant
+
+	AuthTokenSecret string        // ключ подписи access токенов; пустой - случайный на время работы процесса
+	AccessTokenTTL  time.Duration // срок жизни access токена
+	RefreshTokenTTL time.Duration // срок жизни refresh токена
+
+	AdminUsers []string // ID пользователей с доступом к /api/admin (журнал аудита)
+
+	EncryptionKeys   []MasterKey // мастер-ключи шифрования данных, первый - активный; пусто - без шифрования
+	MigratePlaintext bool        // однократная миграция: принять открытые файлы при запуске и зашифровать их
+
+	Secrets               *Secrets      // источники client_secret банков: хранилище, файлы, окружение
+	SecretsReloadInterval time.Duration // как часто перечитывать источники секретов
 }
 
 // LoadConfig загружает конфигурацию из .env и переменных окружения
@@ -28,11 +48,14 @@ func LoadConfig() (Config, error) {
 	// Загружаем .env файл (игнорируем ошибку если файла нет)
 	_ = godotenv.Load()
 
+	// С TENANTS_FILE учетные данные банков задаются в файле для каждой команды
+	tenantsFile := os.Getenv("TENANTS_FILE")
+
 	cfg := Config{
-		TeamID:       mustEnv("TEAM_ID"),
-		ClientSecret: mustEnv("CLIENT_SECRET"),
-		CORSOrigin:   env("CORS_ORIGIN", "http://localhost:5173"),
-		Port:         env("PORT", "8080"),
+		TeamID:     os.Getenv("TEAM_ID"),
+		CORSOrigin: env("CORS_ORIGIN", "http://localhost:5173"),
+		Port:       env("PORT", "8080"),
+		DataDir:    env("DATA_DIR", "data"),
 	}
 
 	// Парсим банки
@@ -42,6 +65,64 @@ func LoadConfig() (Config, error) {
 	}
 	cfg.Banks = banks
 
+	if tenantsFile != "" {
+		tenants, err := loadTenants(tenantsFile, banks)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Tenants = tenants
+		cfg.DefaultTenant = tenants[0].ID
+		if _, ok := cfg.FindTenant(cfg.TeamID); ok {
+			cfg.DefaultTenant = cfg.TeamID
+		}
+	} else {
+		cfg.TeamID = mustEnv("TEAM_ID")
+		cfg.Tenants = []Tenant{envTenant(cfg.TeamID, banks)}
+		cfg.DefaultTenant = cfg.TeamID
+	}
+
+	if cfg.EncryptionKeys, err = loadMasterKeys(os.Getenv("ENCRYPTION_KEYS_FILE"), os.Getenv("ENCRYPTION_KEYS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.MigratePlaintext, err = strconv.ParseBool(env("ENCRYPTION_MIGRATE_PLAINTEXT", "false")); err != nil {
+		return Config{}, fmt.Errorf("invalid ENCRYPTION_MIGRATE_PLAINTEXT: %q", os.Getenv("ENCRYPTION_MIGRATE_PLAINTEXT"))
+	}
+
+	// Секреты проверяются при запуске: без client_secret банк недоступен
+	if cfg.Secrets, err = loadSecrets(os.Getenv("SECRETS_KEYSTORE"), os.Getenv("SECRETS_DIR"), cfg.EncryptionKeys); err != nil {
+		return Config{}, fmt.Errorf("load secrets: %w", err)
+	}
+	for _, tenant := range cfg.Tenants {
+		for _, bank := range tenant.Banks {
+			if _, _, err := cfg.Secrets.ClientSecret(tenant, bank); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+	if cfg.SecretsReloadInterval, err = parsePositiveDuration("SECRETS_RELOAD_INTERVAL", "30s"); err != nil {
+		return Config{}, err
+	}
+
+	interval, err := time.ParseDuration(env("SCHEDULER_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		return Config{}, fmt.Errorf("invalid SCHEDULER_INTERVAL: %q", os.Getenv("SCHEDULER_INTERVAL"))
+	}
+	cfg.SchedulerInterval = interval
+
+	cfg.AuthTokenSecret = os.Getenv("AUTH_TOKEN_SECRET")
+	if cfg.AccessTokenTTL, err = parsePositiveDuration("AUTH_ACCESS_TTL", "15m"); err != nil {
+		return Config{}, err
+	}
+	if cfg.RefreshTokenTTL, err = parsePositiveDuration("AUTH_REFRESH_TTL", "720h"); err != nil {
+		return Config{}, err
+	}
+
+	for _, userID := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if userID = strings.TrimSpace(userID); userID != "" {
+			cfg.AdminUsers = append(cfg.AdminUsers, userID)
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -61,7 +142,7 @@ func parseBanks() ([]Bank, error) {
 		baseURL := os.Getenv(envKey)
 		
 		if baseURL == "" {
-			log.Printf("Warning: %s not set, skipping bank %s", envKey, code)
+			mainLog.Warn("Bank base URL is not set, skipping bank", "env", envKey, "bank", code)
 			continue
 		}
 
@@ -70,9 +151,17 @@ func parseBanks() ([]Bank, error) {
 			return nil, fmt.Errorf("invalid URL for bank %s: %s (must start with http:// or https://)", code, baseURL)
 		}
 
+		// Поддержка Idempotency-Key включается явно: банк без нее проведет повтор как новый платеж
+		idempotencyKey := "SUPPORTS_IDEMPOTENCY_KEY_" + strings.ToUpper(code)
+		supportsKey, err := strconv.ParseBool(env(idempotencyKey, "false"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q", idempotencyKey, os.Getenv(idempotencyKey))
+		}
+
 		banks = append(banks, Bank{
-			Code:    code,
-			BaseURL: strings.TrimSuffix(baseURL, "/"), // убираем trailing slash
+			Code:                   code,
+			BaseURL:                strings.TrimSuffix(baseURL, "/"), // убираем trailing slash
+			SupportsIdempotencyKey: supportsKey,
 		})
 	}
 
@@ -83,11 +172,21 @@ func parseBanks() ([]Bank, error) {
 	return banks, nil
 }
 
+// parsePositiveDuration читает положительную длительность из переменной окружения
+func parsePositiveDuration(key, defaultValue string) (time.Duration, error) {
+	d, err := time.ParseDuration(env(key, defaultValue))
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, os.Getenv(key))
+	}
+	return d, nil
+}
+
 // mustEnv возвращает значение переменной окружения или падает с ошибкой
 func mustEnv(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
-		log.Fatalf("Required environment variable %s is not set", key)
+		mainLog.Error("Required environment variable is not set", "env", key)
+		os.Exit(1)
 	}
 	return value
 }
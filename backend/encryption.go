@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// envelopeMagic начало зашифрованного файла. Данные без него - открытые: с
+// включенным шифрованием они читаются только при миграции (AllowPlaintext)
+var envelopeMagic = []byte("FHE1\n")
+
+var reMasterKeyID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ErrUnknownKey ключ, которым зашифрованы данные, не загружен
+var ErrUnknownKey = errors.New("unknown master key")
+
+// ErrPlaintext открытые данные при включенном шифровании: подложенный файл или
+// данные до включения шифрования, не прошедшие миграцию
+var ErrPlaintext = errors.New("data is not encrypted")
+
+// KeyProvider хранит мастер-ключи и оборачивает ими ключи данных. Сами мастер-ключи
+// наружу не выдаются, поэтому вместо локальных ключей можно подключить HSM или KMS
+type KeyProvider interface {
+	// ActiveKeyID ключ, которым оборачиваются новые ключи данных
+	ActiveKeyID() string
+	// KeyIDs все загруженные ключи (старые нужны для чтения до перешифрования)
+	KeyIDs() []string
+	// WrapKey оборачивает ключ данных активным мастер-ключом
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey разворачивает ключ данных мастер-ключом keyID
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// MasterKey мастер-ключ AES-256
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// LocalKeyProvider мастер-ключи из ENCRYPTION_KEYS или ENCRYPTION_KEYS_FILE.
+// Активный - первый в списке
+type LocalKeyProvider struct {
+	active string
+	keys   map[string]cipher.AEAD
+	order  []string
+}
+
+// NewLocalKeyProvider создает провайдер из списка ключей (первый - активный)
+func NewLocalKeyProvider(keys []MasterKey) (*LocalKeyProvider, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no master keys")
+	}
+
+	p := &LocalKeyProvider{active: keys[0].ID, keys: make(map[string]cipher.AEAD)}
+	for _, key := range keys {
+		if _, exists := p.keys[key.ID]; exists {
+			return nil, fmt.Errorf("master key %s is defined twice", key.ID)
+		}
+		aead, err := newAEAD(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", key.ID, err)
+		}
+		p.keys[key.ID] = aead
+		p.order = append(p.order, key.ID)
+	}
+
+	return p, nil
+}
+
+// ActiveKeyID ключ для новых записей
+func (p *LocalKeyProvider) ActiveKeyID() string {
+	return p.active
+}
+
+// KeyIDs загруженные ключи, активный первым
+func (p *LocalKeyProvider) KeyIDs() []string {
+	return append([]string(nil), p.order...)
+}
+
+// WrapKey шифрует ключ данных активным мастер-ключом (AES-GCM, ID ключа - AAD)
+func (p *LocalKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.active], dataKey, []byte(p.active))
+	if err != nil {
+		return "", nil, err
+	}
+	return p.active, wrapped, nil
+}
+
+// UnwrapKey расшифровывает ключ данных
+func (p *LocalKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	dataKey, err := open(aead, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with %s: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+// envelopeHeader заголовок зашифрованных данных: обернутый ключ данных и ID мастер-ключа
+type envelopeHeader struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey string `json:"wrapped_key"` // base64
+}
+
+// Encryptor конвертное шифрование: для каждой записи новый ключ данных AES-256-GCM,
+// обернутый мастер-ключом провайдера. nil - шифрование выключено
+type Encryptor struct {
+	keys KeyProvider
+
+	allowPlaintext atomic.Bool // идет миграция открытых данных
+}
+
+// NewEncryptor создает шифратор. Без провайдера данные пишутся открыто
+func NewEncryptor(keys KeyProvider) *Encryptor {
+	if keys == nil {
+		return nil
+	}
+	return &Encryptor{keys: keys}
+}
+
+// Enabled включено ли шифрование
+func (e *Encryptor) Enabled() bool {
+	return e != nil
+}
+
+// AllowPlaintext разрешает читать открытые данные на время однократной миграции
+// (ENCRYPTION_MIGRATE_PLAINTEXT). После перешифрования чтение снова запрещается
+func (e *Encryptor) AllowPlaintext(allow bool) {
+	if e != nil {
+		e.allowPlaintext.Store(allow)
+	}
+}
+
+// checkPlaintext можно ли принять открытые данные: без шифрования или при миграции
+func (e *Encryptor) checkPlaintext() error {
+	if e == nil {
+		return nil
+	}
+	if !e.allowPlaintext.Load() {
+		return fmt.Errorf("%w (set ENCRYPTION_MIGRATE_PLAINTEXT=true once to encrypt files written before encryption was enabled)", ErrPlaintext)
+	}
+	return nil
+}
+
+// Seal шифрует данные. aad привязывает шифротекст к месту хранения (коллекции,
+// ID файла): зашифрованный файл нельзя подложить вместо другого
+func (e *Encryptor) Seal(aad string, plaintext []byte) ([]byte, error) {
+	if e == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := e.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	header, err := json.Marshal(envelopeHeader{KeyID: keyID, WrappedKey: base64.StdEncoding.EncodeToString(wrapped)})
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(aead, plaintext, []byte(aad))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(ciphertext)
+	return buf.Bytes(), nil
+}
+
+// Open расшифровывает данные. Открытые данные (без заголовка) возвращаются как есть,
+// только если шифрование выключено или идет миграция, иначе - ErrPlaintext
+func (e *Encryptor) Open(aad string, data []byte) ([]byte, error) {
+	header, ciphertext, ok, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := e.checkPlaintext(); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	if e == nil {
+		return nil, fmt.Errorf("data is encrypted with %s, but encryption keys are not configured", header.KeyID)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(header.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped key: %w", err)
+	}
+	dataKey, err := e.keys.UnwrapKey(header.KeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(aead, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// KeyID мастер-ключ, которым зашифрованы данные ("" - данные открыты)
+func (e *Encryptor) KeyID(data []byte) string {
+	header, _, ok, err := parseEnvelope(data)
+	if err != nil || !ok {
+		return ""
+	}
+	return header.KeyID
+}
+
+// NeedsReencrypt нужно ли перешифровать данные: открытые или зашифрованные не активным ключом
+func (e *Encryptor) NeedsReencrypt(data []byte) bool {
+	if e == nil {
+		return false
+	}
+	return e.KeyID(data) != e.keys.ActiveKeyID()
+}
+
+// parseEnvelope разбирает зашифрованные данные; ok=false - данные открыты
+func parseEnvelope(data []byte) (envelopeHeader, []byte, bool, error) {
+	var header envelopeHeader
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return header, nil, false, nil
+	}
+
+	rest := data[len(envelopeMagic):]
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		return header, nil, true, fmt.Errorf("malformed encrypted data: no header")
+	}
+	if err := json.Unmarshal(rest[:end], &header); err != nil {
+		return header, nil, true, fmt.Errorf("malformed encrypted data: %w", err)
+	}
+	return header, rest[end+1:], true, nil
+}
+
+// newAEAD AES-256-GCM по ключу
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрует со случайным nonce в начале результата
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open расшифровывает результат seal
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+// parseMasterKeys читает ключи вида "id:base64" через запятую или по строкам
+// (строки с # пропускаются). Первый ключ - активный
+func parseMasterKeys(r io.Reader) ([]MasterKey, error) {
+	var keys []MasterKey
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, item := range strings.Split(scanner.Text(), ",") {
+			item = strings.TrimSpace(item)
+			if item == "" || strings.HasPrefix(item, "#") {
+				continue
+			}
+
+			id, encoded, found := strings.Cut(item, ":")
+			if !found || !reMasterKeyID.MatchString(id) {
+				return nil, fmt.Errorf("invalid master key %q (use id:base64)", truncateKeyID(item))
+			}
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(key) != 32 {
+				return nil, fmt.Errorf("master key %s must be 32 bytes in base64", id)
+			}
+			keys = append(keys, MasterKey{ID: id, Key: key})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// loadMasterKeys загружает мастер-ключи из файла (ENCRYPTION_KEYS_FILE) или строки
+// (ENCRYPTION_KEYS). Без обоих шифрование выключено
+func loadMasterKeys(path, value string) ([]MasterKey, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption keys file: %w", err)
+		}
+		keys, err := parseMasterKeys(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse encryption keys file %s: %w", path, err)
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("encryption keys file %s has no keys", path)
+		}
+		return keys, nil
+	}
+
+	keys, err := parseMasterKeys(strings.NewReader(value))
+	if err != nil {
+		return nil, fmt.Errorf("parse ENCRYPTION_KEYS: %w", err)
+	}
+	return keys, nil
+}
+
+// truncateKeyID начало строки ключа для сообщения об ошибке (без самого ключа)
+func truncateKeyID(item string) string {
+	if id, _, found := strings.Cut(item, ":"); found {
+		return id + ":..."
+	}
+	if len(item) > 8 {
+		return item[:8] + "..."
+	}
+	return item
+}
+
+// ReencryptReport результат перешифрования
+type ReencryptReport struct {
+	ActiveKeyID string         `json:"active_key_id"`
+	Checked     int            `json:"checked"`
+	Reencrypted int            `json:"reencrypted"`
+	Failed      []string       `json:"failed,omitempty"`
+	Before      map[string]int `json:"before"` // распределение по ключам до перешифрования (как в EncryptionStatus)
+}
+
+// EncryptionStatus распределение данных по мастер-ключам
+type EncryptionStatus struct {
+	Enabled     bool           `json:"enabled"`
+	ActiveKeyID string         `json:"active_key_id,omitempty"`
+	KeyIDs      []string       `json:"key_ids,omitempty"`
+	Items       map[string]int `json:"items"` // ID ключа (plaintext - открытые) - число коллекций, вложений и строк журнала аудита
+}
+
+// encryptedFile файл под шифрованием: чтение ключа и перешифрование
+type encryptedFile interface {
+	keyIDs() (map[string]int, error)
+	reencrypt(report *ReencryptReport)
+}
+
+// Reencryptor перешифровывает все хранилища активным мастер-ключом после ротации
+type Reencryptor struct {
+	enc   *Encryptor
+	files []encryptedFile
+}
+
+// NewReencryptor создает задачу перешифрования коллекций, вложений и журнала аудита
+func NewReencryptor(enc *Encryptor, store *JSONStore, blobs *BlobStore, audit *AuditLog) *Reencryptor {
+	return &Reencryptor{enc: enc, files: []encryptedFile{store, blobs, audit}}
+}
+
+// Status считает файлы по ключам шифрования
+func (r *Reencryptor) Status() (EncryptionStatus, error) {
+	status := EncryptionStatus{Enabled: r.enc.Enabled(), Items: make(map[string]int)}
+	if r.enc.Enabled() {
+		status.ActiveKeyID = r.enc.keys.ActiveKeyID()
+		status.KeyIDs = r.enc.keys.KeyIDs()
+	}
+
+	for _, f := range r.files {
+		counts, err := f.keyIDs()
+		if err != nil {
+			return status, err
+		}
+		for keyID, n := range counts {
+			status.Items[keyID] += n
+		}
+	}
+	return status, nil
+}
+
+// Run перешифровывает открытые данные и данные под старыми ключами. После
+// успешного прогона старые ключи можно убрать из ENCRYPTION_KEYS
+func (r *Reencryptor) Run() (ReencryptReport, error) {
+	if !r.enc.Enabled() {
+		return ReencryptReport{}, fmt.Errorf("%w: encryption is not configured", ErrInvalidInput)
+	}
+
+	status, err := r.Status()
+	if err != nil {
+		return ReencryptReport{}, err
+	}
+
+	report := ReencryptReport{ActiveKeyID: r.enc.keys.ActiveKeyID(), Before: status.Items}
+	for _, f := range r.files {
+		f.reencrypt(&report)
+	}
+	sort.Strings(report.Failed)
+	return report, nil
+}
+
+// fileKeyLabel метка ключа файла для статистики
+func fileKeyLabel(enc *Encryptor, data []byte) string {
+	if keyID := enc.KeyID(data); keyID != "" {
+		return keyID
+	}
+	return "plaintext"
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ADMIN ENCRYPTION ENDPOINTS
+
+// handleGetEncryptionStatus возвращает активный мастер-ключ и число файлов под каждым ключом
+// GET /api/admin/encryption
+func (s *Server) handleGetEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	status, err := s.encryption.Status()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to get encryption status: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleReencrypt перешифровывает данные активным мастер-ключом (после ротации)
+// POST /api/admin/encryption/reencrypt
+func (s *Server) handleReencrypt(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	report, err := s.encryption.Run()
+	if err == nil && len(report.Failed) > 0 {
+		err = fmt.Errorf("%d files failed", len(report.Failed))
+	}
+	s.audit.Record(r.Context(), AuditEvent{Action: AuditEncryptionReencrypt, Targets: map[string]string{"key_id": report.ActiveKeyID}, Err: err})
+	if err != nil && len(report.Failed) == 0 {
+		writeError(w, r, errorStatus(err), "Failed to re-encrypt data: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
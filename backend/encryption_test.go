@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testMasterKey мастер-ключ из повторяющегося байта
+func testMasterKey(id string, b byte) MasterKey {
+	return MasterKey{ID: id, Key: bytes.Repeat([]byte{b}, 32)}
+}
+
+// newTestEncryptor шифратор с ключами в порядке keys (первый - активный)
+func newTestEncryptor(t *testing.T, keys ...MasterKey) *Encryptor {
+	t.Helper()
+
+	provider, err := NewLocalKeyProvider(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptor(provider)
+}
+
+func TestEncryptorSealOpen(t *testing.T) {
+	enc := newTestEncryptor(t, testMasterKey("k1", 1))
+	plaintext := []byte(`[{"id":"acc-1","balance":"1500.00"}]`)
+
+	sealed, err := enc.Seal("collection:accounts", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, envelopeMagic) || bytes.Contains(sealed, []byte("balance")) {
+		t.Fatalf("sealed data is not an envelope: %q", sealed)
+	}
+	if got := enc.KeyID(sealed); got != "k1" {
+		t.Errorf("KeyID = %q, want k1", got)
+	}
+
+	opened, err := enc.Open("collection:accounts", sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, want %q", opened, plaintext)
+	}
+
+	again, err := enc.Seal("collection:accounts", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, sealed) {
+		t.Error("sealing twice gives the same ciphertext")
+	}
+
+	// Открытые данные читаются как есть только без шифрования или при миграции
+	if _, err := enc.Open("collection:accounts", plaintext); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("Open(plaintext) error = %v, want ErrPlaintext", err)
+	}
+	var disabled *Encryptor
+	if opened, err := disabled.Open("collection:accounts", plaintext); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open(plaintext) without encryption = %q, %v", opened, err)
+	}
+	enc.AllowPlaintext(true)
+	if opened, err := enc.Open("collection:accounts", plaintext); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open(plaintext) during migration = %q, %v", opened, err)
+	}
+	enc.AllowPlaintext(false)
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		enc     *Encryptor
+		aad     string
+		data    []byte
+		unknown bool
+	}{
+		{"wrong AAD", enc, "collection:payments", sealed, false},
+		{"tampered ciphertext", enc, "collection:accounts", tampered, false},
+		{"unknown key ID", newTestEncryptor(t, testMasterKey("k2", 2)), "collection:accounts", sealed, true},
+		{"same key ID, other key", newTestEncryptor(t, testMasterKey("k1", 2)), "collection:accounts", sealed, false},
+		{"encryption disabled", nil, "collection:accounts", sealed, false},
+		{"no header", enc, "collection:accounts", envelopeMagic, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.enc.Open(tt.aad, tt.data)
+			if err == nil {
+				t.Fatal("Open succeeded, want error")
+			}
+			if errors.Is(err, ErrUnknownKey) != tt.unknown {
+				t.Errorf("error = %v, ErrUnknownKey = %v", err, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestNewLocalKeyProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []MasterKey
+	}{
+		{"no keys", nil},
+		{"duplicate ID", []MasterKey{testMasterKey("k1", 1), testMasterKey("k1", 2)}},
+		{"short key", []MasterKey{{ID: "k1", Key: []byte("short")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLocalKeyProvider(tt.keys); err == nil {
+				t.Error("NewLocalKeyProvider succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestReencryptAfterRotation(t *testing.T) {
+	dir := t.TempDir()
+	accounts := []map[string]string{{"id": "acc-1", "balance": "1500.00"}}
+
+	// Одна коллекция записана открыто, другая - старым ключом k1
+	plain, err := NewJSONStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Save("goals", []string{"car"}); err != nil {
+		t.Fatal(err)
+	}
+	old, err := NewJSONStore(dir, newTestEncryptor(t, testMasterKey("k1", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Save("accounts", accounts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ротация: k2 активный, k1 оставлен для чтения
+	enc := newTestEncryptor(t, testMasterKey("k2", 2), testMasterKey("k1", 1))
+	store, err := NewJSONStore(dir, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Reencryptor{enc: enc, files: []encryptedFile{store}}
+
+	// Без миграции открытая коллекция не перешифровывается
+	if report, err := r.Run(); err != nil || report.Reencrypted != 1 || len(report.Failed) != 1 {
+		t.Fatalf("run without migration = %+v, %v", report, err)
+	}
+	enc.AllowPlaintext(true)
+
+	status, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ActiveKeyID != "k2" || status.Items["k2"] != 1 || status.Items["plaintext"] != 1 {
+		t.Errorf("status before = %+v", status)
+	}
+
+	report, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 2 || report.Reencrypted != 1 || len(report.Failed) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+
+	status, err = r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Items["k2"] != 2 || len(status.Items) != 1 {
+		t.Errorf("status after = %+v, want all under k2", status.Items)
+	}
+
+	// Повторный прогон ничего не меняет
+	enc.AllowPlaintext(false)
+	if report, err := r.Run(); err != nil || report.Reencrypted != 0 || len(report.Failed) != 0 {
+		t.Errorf("second run = %+v, %v", report, err)
+	}
+
+	// После перешифрования старый ключ можно убрать
+	rotated, err := NewJSONStore(dir, newTestEncryptor(t, testMasterKey("k2", 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded []map[string]string
+	if err := rotated.Load("accounts", &loaded); err != nil {
+		t.Fatalf("load without old key: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0]["balance"] != "1500.00" {
+		t.Errorf("loaded = %v", loaded)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "goals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "car") {
+		t.Error("plaintext collection was not encrypted")
+	}
+}
+
+func TestPlaintextRejected(t *testing.T) {
+	dir := t.TempDir()
+
+	// Файлы записаны до включения шифрования или подложены в DATA_DIR
+	plain, err := NewJSONStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Save("users", []string{"mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.log")
+	if err := os.WriteFile(auditPath, []byte(`{"seq":1,"action":"auth.login","actor":"mallory"}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	enc := newTestEncryptor(t, testMasterKey("k1", 1))
+	store, err := NewJSONStore(dir, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []string
+	if err := store.Load("users", &users); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("load plaintext collection error = %v, want ErrPlaintext", err)
+	}
+	if _, err := NewAuditLog(auditPath, enc); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("open plaintext audit log error = %v, want ErrPlaintext", err)
+	}
+
+	// Однократная миграция читает и шифрует открытые файлы
+	enc.AllowPlaintext(true)
+	if err := store.Load("users", &users); err != nil || len(users) != 1 {
+		t.Fatalf("load during migration = %v, %v", users, err)
+	}
+	report, err := (&Reencryptor{enc: enc, files: []encryptedFile{store}}).Run()
+	if err != nil || report.Reencrypted != 1 {
+		t.Fatalf("migration = %+v, %v", report, err)
+	}
+	enc.AllowPlaintext(false)
+
+	if err := store.Load("users", &users); err != nil {
+		t.Errorf("load after migration: %v", err)
+	}
+}
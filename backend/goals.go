@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// goalsCollection имя коллекции в хранилище
+const goalsCollection = "savings_goals"
+
+// goalVelocityWindow период, по которому считается скорость пополнений
+const goalVelocityWindow = 90 * 24 * time.Hour
+
+// SavingsGoal цель накоплений, привязанная к реальным счетам и вкладам
+type SavingsGoal struct {
+	ID           string       `json:"id"`
+	UserID       string       `json:"user_id"`
+	Name         string       `json:"name"`
+	TargetAmount float64      `json:"target_amount"`
+	Currency     string       `json:"currency"`
+	Deadline     FlexibleTime `json:"deadline"`
+	Links        []GoalLink   `json:"links"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// GoalLink привязка цели к счету или договору вклада (или к доле его баланса)
+type GoalLink struct {
+	Bank        string  `json:"bank"`
+	AccountID   string  `json:"account_id,omitempty"`
+	AgreementID string  `json:"agreement_id,omitempty"`
+	Share       float64 `json:"share"` // доля баланса (0..1], по умолчанию 1
+}
+
+// GoalInput тело запроса на создание/изменение цели
+type GoalInput struct {
+	Name         string       `json:"name"`
+	TargetAmount float64      `json:"target_amount"`
+	Currency     string       `json:"currency"`
+	Deadline     FlexibleTime `json:"deadline"`
+	Links        []GoalLink   `json:"links"`
+}
+
+// GoalProgress цель вместе с прогрессом, посчитанным по живым балансам
+type GoalProgress struct {
+	SavingsGoal
+	CurrentAmount       float64    `json:"current_amount"`
+	RemainingAmount     float64    `json:"remaining_amount"`
+	PercentComplete     float64    `json:"percent_complete"`
+	MonthsLeft          int        `json:"months_left"`
+	RequiredMonthly     float64    `json:"required_monthly"`
+	MonthlyDeposits     float64    `json:"monthly_deposits"` // средние пополнения за последние 90 дней
+	ProjectedCompletion *time.Time `json:"projected_completion,omitempty"`
+	OnTrack             bool       `json:"on_track"`
+	LinkErrors          []string   `json:"link_errors,omitempty"`
+}
+
+// GoalStore хранит цели накоплений пользователей
+type GoalStore struct {
+	store *JSONStore
+
+	mu    sync.RWMutex
+	goals map[string]*SavingsGoal // key: goal ID
+}
+
+// NewGoalStore загружает цели из хранилища
+func NewGoalStore(store *JSONStore) (*GoalStore, error) {
+	s := &GoalStore{
+		store: store,
+		goals: make(map[string]*SavingsGoal),
+	}
+
+	var goals []*SavingsGoal
+	if err := store.Load(goalsCollection, &goals); err != nil {
+		return nil, fmt.Errorf("load savings goals: %w", err)
+	}
+	for _, goal := range goals {
+		s.goals[goal.ID] = goal
+	}
+
+	return s, nil
+}
+
+// List возвращает цели пользователя, ближайший дедлайн первым
+func (s *GoalStore) List(userID string) []SavingsGoal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]SavingsGoal, 0)
+	for _, goal := range s.goals {
+		if goal.UserID == userID {
+			result = append(result, goal.clone())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Deadline.Before(result[j].Deadline.Time)
+	})
+
+	return result
+}
+
+// Get возвращает цель пользователя
+func (s *GoalStore) Get(userID, goalID string) (*SavingsGoal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	goal, exists := s.goals[goalID]
+	if !exists || goal.UserID != userID {
+		return nil, fmt.Errorf("goal %s: %w", goalID, ErrNotFound)
+	}
+
+	c := goal.clone()
+	return &c, nil
+}
+
+// Create создает цель накоплений
+func (s *GoalStore) Create(userID string, input GoalInput) (*SavingsGoal, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	goal := &SavingsGoal{
+		ID:        "goal-" + uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: now,
+	}
+	input.apply(goal)
+	goal.UpdatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.goals[goal.ID] = goal
+	if err := s.persist(); err != nil {
+		delete(s.goals, goal.ID)
+		return nil, err
+	}
+
+	c := goal.clone()
+	return &c, nil
+}
+
+// Update заменяет параметры и привязки цели
+func (s *GoalStore) Update(userID, goalID string, input GoalInput) (*SavingsGoal, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	return s.mutate(userID, goalID, func(goal *SavingsGoal) error {
+		input.apply(goal)
+		return nil
+	})
+}
+
+// LinkAgreement привязывает договор вклада к цели (например, сразу после открытия)
+func (s *GoalStore) LinkAgreement(userID, goalID, bank, agreementID string) (*SavingsGoal, error) {
+	return s.mutate(userID, goalID, func(goal *SavingsGoal) error {
+		for _, link := range goal.Links {
+			if link.Bank == bank && link.AgreementID == agreementID {
+				return nil
+			}
+		}
+		goal.Links = append(goal.Links, GoalLink{Bank: bank, AgreementID: agreementID, Share: 1})
+		return nil
+	})
+}
+
+// Delete удаляет цель
+func (s *GoalStore) Delete(userID, goalID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	goal, exists := s.goals[goalID]
+	if !exists || goal.UserID != userID {
+		return fmt.Errorf("goal %s: %w", goalID, ErrNotFound)
+	}
+
+	delete(s.goals, goalID)
+	if err := s.persist(); err != nil {
+		s.goals[goalID] = goal
+		return err
+	}
+
+	return nil
+}
+
+// mutate применяет изменение к цели и сохраняет коллекцию
+func (s *GoalStore) mutate(userID, goalID string, fn func(*SavingsGoal) error) (*SavingsGoal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	goal, exists := s.goals[goalID]
+	if !exists || goal.UserID != userID {
+		return nil, fmt.Errorf("goal %s: %w", goalID, ErrNotFound)
+	}
+
+	backup := goal.clone()
+	if err := fn(goal); err != nil {
+		*goal = backup
+		return nil, err
+	}
+	goal.UpdatedAt = time.Now().UTC()
+
+	if err := s.persist(); err != nil {
+		*goal = backup
+		return nil, err
+	}
+
+	c := goal.clone()
+	return &c, nil
+}
+
+// persist сохраняет все цели (вызывается под блокировкой)
+func (s *GoalStore) persist() error {
+	goals := make([]*SavingsGoal, 0, len(s.goals))
+	for _, goal := range s.goals {
+		goals = append(goals, goal)
+	}
+
+	return s.store.Save(goalsCollection, goals)
+}
+
+// clone возвращает глубокую копию цели
+func (g *SavingsGoal) clone() SavingsGoal {
+	c := *g
+	c.Links = append([]GoalLink{}, g.Links...)
+	return c
+}
+
+// validate проверяет параметры цели
+func (in *GoalInput) validate() error {
+	if strings.TrimSpace(in.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if in.TargetAmount <= 0 {
+		return fmt.Errorf("%w: target_amount must be positive", ErrInvalidInput)
+	}
+	if len(in.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrInvalidInput)
+	}
+	if in.Deadline.IsZero() {
+		return fmt.Errorf("%w: deadline is required", ErrInvalidInput)
+	}
+
+	for i, link := range in.Links {
+		if link.Bank == "" {
+			return fmt.Errorf("%w: link %d: bank is required", ErrInvalidInput, i+1)
+		}
+		if (link.AccountID == "") == (link.AgreementID == "") {
+			return fmt.Errorf("%w: link %d: exactly one of account_id or agreement_id is required", ErrInvalidInput, i+1)
+		}
+		if link.Share < 0 || link.Share > 1 {
+			return fmt.Errorf("%w: link %d: share must be between 0 and 1", ErrInvalidInput, i+1)
+		}
+	}
+
+	return nil
+}
+
+// apply переносит параметры из запроса в цель
+func (in *GoalInput) apply(goal *SavingsGoal) {
+	goal.Name = strings.TrimSpace(in.Name)
+	goal.TargetAmount = roundMoney(in.TargetAmount)
+	goal.Currency = strings.ToUpper(in.Currency)
+	goal.Deadline = in.Deadline
+
+	goal.Links = make([]GoalLink, 0, len(in.Links))
+	for _, link := range in.Links {
+		if link.Share == 0 {
+			link.Share = 1
+		}
+		goal.Links = append(goal.Links, link)
+	}
+}
+
+// PROGRESS
+
+// GoalProgress считает прогресс цели по живым балансам привязанных счетов и вкладов.
+// Недоступные банки не роняют расчет - ошибки возвращаются в LinkErrors
+func (a *BankAggregator) GoalProgress(ctx context.Context, goal SavingsGoal) GoalProgress {
+	now := time.Now().UTC()
+	since := now.Add(-goalVelocityWindow)
+
+	var current, deposits float64
+	var linkErrors []string
+
+	for _, link := range goal.Links {
+		share := link.Share
+		if share == 0 {
+			share = 1
+		}
+
+		if link.AgreementID != "" {
+			agreement, err := a.GetAgreementDetails(ctx, link.Bank, link.AgreementID, goal.UserID)
+			if err != nil {
+				linkErrors = append(linkErrors, fmt.Sprintf("%s/%s: %v", link.Bank, link.AgreementID, err))
+				continue
+			}
+			if agreement.Amount.Currency != "" && !strings.EqualFold(agreement.Amount.Currency, goal.Currency) {
+				linkErrors = append(linkErrors, fmt.Sprintf("%s/%s: currency %s does not match goal currency %s",
+					link.Bank, link.AgreementID, agreement.Amount.Currency, goal.Currency))
+				continue
+			}
+			current += parseAmount(agreement.Amount.Amount) * share
+			continue
+		}
+
+		balance, currency, err := a.GetCurrentBalance(ctx, link.Bank, goal.UserID, link.AccountID)
+		if err != nil {
+			linkErrors = append(linkErrors, fmt.Sprintf("%s/%s: %v", link.Bank, link.AccountID, err))
+			continue
+		}
+		if currency != "" && !strings.EqualFold(currency, goal.Currency) {
+			linkErrors = append(linkErrors, fmt.Sprintf("%s/%s: currency %s does not match goal currency %s",
+				link.Bank, link.AccountID, currency, goal.Currency))
+			continue
+		}
+		current += balance * share
+
+		// Скорость накоплений - поступления на счет за последние 90 дней
+		txs, err := a.GetAccountTransactions(ctx, link.Bank, goal.UserID, link.AccountID, since, time.Time{})
+		if err != nil {
+			linkErrors = append(linkErrors, fmt.Sprintf("%s/%s: transactions: %v", link.Bank, link.AccountID, err))
+			continue
+		}
+		for _, tx := range txs {
+			if tx.Amount > 0 && !tx.Date.Before(since) {
+				deposits += tx.Amount * share
+			}
+		}
+	}
+
+	progress := calculateGoalProgress(goal, current, deposits/3, now)
+	progress.LinkErrors = linkErrors
+	return progress
+}
+
+// calculateGoalProgress считает показатели цели по текущей сумме и средним пополнениям в месяц
+func calculateGoalProgress(goal SavingsGoal, current, monthlyDeposits float64, now time.Time) GoalProgress {
+	progress := GoalProgress{
+		SavingsGoal:     goal,
+		CurrentAmount:   roundMoney(current),
+		MonthlyDeposits: roundMoney(monthlyDeposits),
+	}
+
+	remaining := math.Max(0, goal.TargetAmount-current)
+	progress.RemainingAmount = roundMoney(remaining)
+	progress.PercentComplete = math.Min(100, math.Round(current/goal.TargetAmount*10000)/100)
+
+	progress.MonthsLeft = monthsUntil(now, goal.Deadline.Time)
+	if remaining > 0 {
+		progress.RequiredMonthly = roundMoney(remaining / float64(max(progress.MonthsLeft, 1)))
+	}
+
+	switch {
+	case remaining == 0:
+		progress.ProjectedCompletion = &now
+		progress.OnTrack = true
+	case monthlyDeposits > 0:
+		months := remaining / monthlyDeposits
+		projected := now.Add(time.Duration(months * 30.44 * 24 * float64(time.Hour)))
+		progress.ProjectedCompletion = &projected
+		progress.OnTrack = !projected.After(goal.Deadline.Time)
+	}
+
+	return progress
+}
+
+// monthsUntil количество месяцев (с округлением вверх) до даты; 0, если дата прошла
+func monthsUntil(now, deadline time.Time) int {
+	if !deadline.After(now) {
+		return 0
+	}
+
+	months := (deadline.Year()-now.Year())*12 + int(deadline.Month()-now.Month())
+	if deadline.Day() > now.Day() || months == 0 {
+		months++
+	}
+
+	return months
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SAVINGS GOAL ENDPOINTS
+
+// handleListGoals возвращает цели пользователя с прогрессом по живым балансам
+// GET /api/goals
+func (s *Server) handleListGoals(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	goals := s.goals.List(userID)
+
+	result := make([]GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		result = append(result, s.aggregator.GoalProgress(r.Context(), goal))
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleCreateGoal создает цель накоплений
+// POST /api/goals
+func (s *Server) handleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input GoalInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if !s.validGoalLinks(w, r, input.Links) {
+		return
+	}
+
+	goal, err := s.goals.Create(userID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create goal", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create goal: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s.aggregator.GoalProgress(r.Context(), *goal))
+}
+
+// handleGetGoal возвращает цель с прогрессом
+// GET /api/goals/{id}
+func (s *Server) handleGetGoal(w http.ResponseWriter, r *http.Request) {
+	goalID := r.PathValue("id")
+	if goalID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing goal ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	goal, err := s.goals.Get(userID, goalID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get goal: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.aggregator.GoalProgress(r.Context(), *goal))
+}
+
+// handleUpdateGoal заменяет параметры и привязки цели
+// PUT /api/goals/{id}
+func (s *Server) handleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	goalID := r.PathValue("id")
+	if goalID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing goal ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input GoalInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if !s.validGoalLinks(w, r, input.Links) {
+		return
+	}
+
+	goal, err := s.goals.Update(userID, goalID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to update goal", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to update goal: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.aggregator.GoalProgress(r.Context(), *goal))
+}
+
+// handleDeleteGoal удаляет цель
+// DELETE /api/goals/{id}
+func (s *Server) handleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goalID := r.PathValue("id")
+	if goalID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing goal ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.goals.Delete(userID, goalID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete goal", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete goal: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Goal deleted successfully",
+	})
+}
+
+// validGoalLinks проверяет, что привязки ссылаются на известные банки
+func (s *Server) validGoalLinks(w http.ResponseWriter, r *http.Request, links []GoalLink) bool {
+	for _, link := range links {
+		if link.Bank == ManualBankCode {
+			continue
+		}
+		if _, err := s.aggregator.GetBankByCode(r.Context(), link.Bank); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code in goal link: "+link.Bank)
+			return false
+		}
+	}
+	return true
+}
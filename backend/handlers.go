@@ -2,23 +2,182 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"path/filepath"
 	"time"
 )
 
 // Server обрабатывает HTTP запросы
 type Server struct {
-	aggregator *BankAggregator
-	config     Config
+	aggregator     *BankAggregator
+	manualAccounts *ManualAccountStore
+	annotations    *AnnotationStore
+	splits         *SplitStore
+	goals          *GoalStore
+	statuses       *AgreementStatusStore
+	payees         *PayeeStore
+	scheduler      *PaymentScheduler
+	tracker        *PaymentTracker
+	batches        *PaymentBatchStore
+	transfers      *TransferStore
+	drafts         *PaymentDraftStore
+	otp            *OTPStore
+	policies       *PolicyStore
+	auth           *AuthStore
+	apiKeys        *APIKeyStore
+	households     *HouseholdStore
+	audit          *AuditLog
+	encryption     *Reencryptor
+	idempotency    *IdempotencyStore
+	config         Config
 }
 
 // NewServer создает новый HTTP сервер
-func NewServer(config Config) *Server {
-	return &Server{
-		aggregator: NewBankAggregator(config),
-		config:     config,
+func NewServer(config Config) (*Server, error) {
+	// Без мастер-ключей данные хранятся открыто, как раньше
+	var keys KeyProvider
+	if len(config.EncryptionKeys) > 0 {
+		local, err := NewLocalKeyProvider(config.EncryptionKeys)
+		if err != nil {
+			return nil, fmt.Errorf("load encryption keys: %w", err)
+		}
+		keys = local
+	}
+	enc := NewEncryptor(keys)
+	enc.AllowPlaintext(config.MigratePlaintext)
+
+	store, err := NewJSONStore(config.DataDir, enc)
+	if err != nil {
+		return nil, fmt.Errorf("open data store: %w", err)
+	}
+
+	blobs, err := NewBlobStore(filepath.Join(config.DataDir, "blobs"), enc)
+	if err != nil {
+		return nil, fmt.Errorf("open blob store: %w", err)
+	}
+
+	audit, err := NewAuditLog(filepath.Join(config.DataDir, "audit.log"), enc)
+	if err != nil {
+		return nil, err
+	}
+
+	manualAccounts, err := NewManualAccountStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := NewBalanceSnapshotStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := NewAgreementStatusStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	payees, err := NewPayeeStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	idempotency, err := NewIdempotencyStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := NewAuthStore(store, config)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := NewAPIKeyStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	households, err := NewHouseholdStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := NewOTPStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := NewPolicyStore(store, payees)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations, err := NewAnnotationStore(store, blobs)
+	if err != nil {
+		return nil, err
 	}
+
+	splits, err := NewSplitStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := NewGoalStore(store)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregator := NewBankAggregator(config, auth, manualAccounts, snapshots, statuses, policies, audit)
+
+	tracker, err := NewPaymentTracker(store, aggregator, config.SchedulerInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduler, err := NewPaymentScheduler(store, aggregator, tracker, config.SchedulerInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	batches, err := NewPaymentBatchStore(store, aggregator, tracker)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := NewTransferStore(store, aggregator, tracker, config.SchedulerInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts, err := NewPaymentDraftStore(store, aggregator, tracker, batches, transfers, scheduler, payees, otp, households, LogCodeNotifier{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		aggregator:     aggregator,
+		manualAccounts: manualAccounts,
+		annotations:    annotations,
+		splits:         splits,
+		goals:          goals,
+		statuses:       statuses,
+		payees:         payees,
+		scheduler:      scheduler,
+		tracker:        tracker,
+		batches:        batches,
+		transfers:      transfers,
+		drafts:         drafts,
+		otp:            otp,
+		policies:       policies,
+		auth:           auth,
+		apiKeys:        apiKeys,
+		households:     households,
+		audit:          audit,
+		encryption:     NewReencryptor(enc, store, blobs, audit),
+		idempotency:    idempotency,
+		config:         config,
+	}, nil
 }
 
 // HEALTH CHECK
@@ -41,13 +200,10 @@ func (s *Server) handleCreateConsent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "team053-1" // default для тестирования
-	}
+	userID := getUserID(r.Context())
 
 	// Проверяем что банк существует
-	if _, err := s.aggregator.GetBankByCode(bankCode); err != nil {
+	if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
 		writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankCode)
 		return
 	}
@@ -55,7 +211,7 @@ func (s *Server) handleCreateConsent(w http.ResponseWriter, r *http.Request) {
 	// Создаем consent
 	consentID, err := s.aggregator.EnsureConsent(r.Context(), bankCode, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to create consent: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to create consent", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to create consent: "+err.Error())
 		return
 	}
@@ -84,10 +240,10 @@ func (s *Server) handleGetConsentStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	consent, err := s.aggregator.GetConsentStatus(r.Context(), bankCode, consentID)
+	consent, err := s.aggregator.GetConsentStatus(r.Context(), bankCode, getUserID(r.Context()), consentID)
 	if err != nil {
-		log.Printf("[%s] Failed to get consent status: %v", getRequestID(r.Context()), err)
-		writeError(w, r, http.StatusInternalServerError, "Failed to get consent status: "+err.Error())
+		handlersLog.WarnContext(r.Context(), "Failed to get consent status", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to get consent status: "+err.Error())
 		return
 	}
 
@@ -109,9 +265,9 @@ func (s *Server) handleRevokeConsent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.aggregator.RevokeConsent(r.Context(), bankCode, consentID); err != nil {
-		log.Printf("[%s] Failed to revoke consent: %v", getRequestID(r.Context()), err)
-		writeError(w, r, http.StatusInternalServerError, "Failed to revoke consent: "+err.Error())
+	if err := s.aggregator.RevokeConsent(r.Context(), bankCode, getUserID(r.Context()), consentID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to revoke consent", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to revoke consent: "+err.Error())
 		return
 	}
 
@@ -131,22 +287,18 @@ func (s *Server) handleConnectBank(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Валидация банка
-	validBanks := map[string]bool{"vbank": true, "abank": true, "sbank": true}
-	if !validBanks[bankCode] {
-		writeError(w, r, http.StatusBadRequest, "Invalid bank. Allowed: vbank, abank, sbank")
-		return
-	}
+	userID := getUserID(r.Context())
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+	// Проверяем что банк подключен арендатору пользователя
+	if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankCode)
+		return
 	}
 
 	// Создаем consent
 	consentID, err := s.aggregator.EnsureConsent(r.Context(), bankCode, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to connect bank: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to connect bank", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to connect: "+err.Error())
 		return
 	}
@@ -163,12 +315,9 @@ func (s *Server) handleConnectBank(w http.ResponseWriter, r *http.Request) {
 // ACCOUNT ENDPOINTS
 
 // handleGetAccounts получает счета пользователя
-// GET /api/accounts?user=user-123&bank=vbank
+// GET /api/accounts?bank=vbank
 func (s *Server) handleGetAccounts(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	bankFilter := r.URL.Query().Get("bank")
 
@@ -184,11 +333,14 @@ func (s *Server) handleGetAccounts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("[%s] Failed to fetch accounts: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to fetch accounts", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to fetch accounts: "+err.Error())
 		return
 	}
 
+	// Счета, открытые пользователю участниками домохозяйства (с отметкой shared)
+	accounts = append(accounts, s.sharedAccounts(r.Context(), userID, bankFilter)...)
+
 	// Возвращаем пустой массив вместо null
 	if accounts == nil {
 		accounts = []Account{}
@@ -212,14 +364,16 @@ func (s *Server) handleGetAccountBalances(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+	// ?owner= - счет, открытый пользователю участником домохозяйства
+	userID, err := s.accountUser(r, bankCode, accountID, false)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to access account: "+err.Error())
+		return
 	}
 
 	balances, err := s.aggregator.GetAccountBalances(r.Context(), bankCode, userID, accountID)
 	if err != nil {
-		log.Printf("[%s] Failed to fetch balances: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to fetch balances", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to fetch balances: "+err.Error())
 		return
 	}
@@ -246,9 +400,13 @@ func (s *Server) handleGetAccountTransactions(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+	userID := getUserID(r.Context())
+
+	// ?owner= - счет, открытый пользователю участником домохозяйства
+	accountUserID, err := s.accountUser(r, bankCode, accountID, false)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to access account: "+err.Error())
+		return
 	}
 
 	// Парсим даты
@@ -270,12 +428,25 @@ func (s *Server) handleGetAccountTransactions(w http.ResponseWriter, r *http.Req
 		toTime = t
 	}
 
-	transactions, err := s.aggregator.GetAccountTransactions(r.Context(), bankCode, userID, accountID, fromTime, toTime)
+	filter, err := parseTransactionFilter(r)
 	if err != nil {
-		log.Printf("[%s] Failed to fetch account transactions: %v", getRequestID(r.Context()), err)
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	transactions, err := s.aggregator.GetAccountTransactions(r.Context(), bankCode, accountUserID, accountID, fromTime, toTime)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to fetch account transactions", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to fetch transactions: "+err.Error())
 		return
 	}
+	if accountUserID != userID {
+		for i := range transactions {
+			transactions[i].OwnerID = accountUserID
+		}
+	}
+	transactions = s.annotations.Apply(userID, transactions, filter)
+	transactions = s.applySplits(r, userID, transactions)
 
 	// Форматируем ответ
 	response := formatTransactionsResponse(transactions)
@@ -285,12 +456,9 @@ func (s *Server) handleGetAccountTransactions(w http.ResponseWriter, r *http.Req
 
 // TRANSACTION ENDPOINTS
 // handleGetTransactions получает транзакции со всех счетов или из конкретного банка
-// GET /api/transactions?user=user-123&bank=vbank&from=2025-01-01T00:00:00Z&to=2025-12-31T23:59:59Z
+// GET /api/transactions?bank=vbank&from=2025-01-01T00:00:00Z&to=2025-12-31T23:59:59Z&tag=food&has_note=true&splits=expand
 func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	bankFilter := r.URL.Query().Get("bank")
 
@@ -314,19 +482,28 @@ func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Валидация банка
-	if bankFilter != "" && bankFilter != "all" {
-		if _, err := s.aggregator.GetBankByCode(bankFilter); err != nil {
+	if bankFilter != "" && bankFilter != "all" && bankFilter != ManualBankCode {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), bankFilter); err != nil {
 			writeError(w, r, http.StatusBadRequest, "Invalid bank code: "+bankFilter)
 			return
 		}
 	}
 
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	transactions, err := s.aggregator.GetTransactions(r.Context(), userID, bankFilter, fromPtr, toPtr)
 	if err != nil {
-		log.Printf("[%s] Failed to fetch transactions: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to fetch transactions", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to fetch transactions: "+err.Error())
 		return
 	}
+	transactions = append(transactions, s.sharedTransactions(r.Context(), userID, bankFilter, fromPtr, toPtr)...)
+	transactions = s.annotations.Apply(userID, transactions, filter)
+	transactions = s.applySplits(r, userID, transactions)
 
 	// Форматируем ответ
 	response := formatTransactionsResponse(transactions)
@@ -336,7 +513,7 @@ func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
 // PAYMENT CONSENT ENDPOINTS
 
 // handleCreatePaymentConsent создает согласие на платеж
-// POST /api/payment-consents?bank=vbank&user=user-123
+// POST /api/payment-consents?bank=vbank&owner=team053-1 (owner - для счета участника домохозяйства, нужна роль payer)
 func (s *Server) handleCreatePaymentConsent(w http.ResponseWriter, r *http.Request) {
 	bankCode := r.URL.Query().Get("bank")
 	if bankCode == "" {
@@ -344,10 +521,7 @@ func (s *Server) handleCreatePaymentConsent(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	// Парсим тело запроса
 	var paymentInfo PaymentInfo
@@ -356,9 +530,20 @@ func (s *Server) handleCreatePaymentConsent(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	consentID, err := s.aggregator.EnsurePaymentConsent(r.Context(), bankCode, userID, paymentInfo)
+	if err := ValidatePaymentInfo(paymentInfo); err != nil {
+		writeValidationError(w, r, "Invalid payment details", err)
+		return
+	}
+
+	accountUserID, err := s.accountUser(r, bankCode, paymentInfo.DebtorAccount.Identification, true)
 	if err != nil {
-		log.Printf("[%s] Failed to create payment consent: %v", getRequestID(r.Context()), err)
+		writeError(w, r, errorStatus(err), "Failed to access debtor account: "+err.Error())
+		return
+	}
+
+	consentID, err := s.aggregator.EnsurePaymentConsent(r.Context(), bankCode, accountUserID, paymentInfo)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create payment consent", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to create payment consent: "+err.Error())
 		return
 	}
@@ -387,10 +572,10 @@ func (s *Server) handleGetPaymentConsentStatus(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	consent, err := s.aggregator.GetPaymentConsentStatus(r.Context(), bankCode, consentID)
+	consent, err := s.aggregator.GetPaymentConsentStatus(r.Context(), bankCode, getUserID(r.Context()), consentID)
 	if err != nil {
-		log.Printf("[%s] Failed to get payment consent status: %v", getRequestID(r.Context()), err)
-		writeError(w, r, http.StatusInternalServerError, "Failed to get payment consent status: "+err.Error())
+		handlersLog.WarnContext(r.Context(), "Failed to get payment consent status", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to get payment consent status: "+err.Error())
 		return
 	}
 
@@ -399,39 +584,78 @@ func (s *Server) handleGetPaymentConsentStatus(w http.ResponseWriter, r *http.Re
 
 // PAYMENT ENDPOINTS
 
-// handleCreatePayment создает платеж
-// POST /api/payments?bank=vbank&user=user-123
+// handleCreatePayment проверяет платеж и создает черновик, ожидающий подтверждения кодом.
+// Вместо полных реквизитов можно передать template_id или payee_id;
+// bank можно не указывать, если он задан в шаблоне
+// POST /api/payments?bank=vbank&owner=team053-1 (owner - для счета участника домохозяйства, нужна роль payer)
 func (s *Server) handleCreatePayment(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	// Парсим тело запроса
+	var input PaymentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	paymentReq, templateBank, err := s.payees.ResolvePayment(userID, input)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to resolve payment: "+err.Error())
+		return
+	}
+
 	bankCode := r.URL.Query().Get("bank")
+	if bankCode == "" {
+		bankCode = templateBank
+	}
 	if bankCode == "" {
 		writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+	// Проверяем реквизиты до отправки, чтобы опечатки не доходили до банка
+	if err := ValidatePaymentRequest(paymentReq); err != nil {
+		writeValidationError(w, r, "Invalid payment details", err)
+		return
 	}
 
-	// Парсим тело запроса
-	var paymentReq PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&paymentReq); err != nil {
-		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+	if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	payment, err := s.aggregator.CreatePayment(r.Context(), bankCode, userID, paymentReq)
+	// Со счета участника домохозяйства (?owner=) можно платить только с ролью payer,
+	// в банк платеж уходит от имени владельца и по его политике
+	accountUserID, err := s.accountUser(r, bankCode, paymentReq.DebtorAccount.Identification, true)
 	if err != nil {
-		log.Printf("[%s] Failed to create payment: %v", getRequestID(r.Context()), err)
-		writeError(w, r, http.StatusInternalServerError, "Failed to create payment: "+err.Error())
+		writeError(w, r, errorStatus(err), "Failed to access debtor account: "+err.Error())
+		return
+	}
+	ownerID := ""
+	if accountUserID != userID {
+		ownerID = accountUserID
+	}
+
+	// Платеж, который запретит политика, не подтверждаем: код пользователю не отправляется
+	if err := s.policies.Check(accountUserID, paymentReq, nil, time.Now().UTC()); err != nil {
+		writeValidationError(w, r, "Payment blocked by policy", err)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, payment)
+	// В банк платеж уйдет только после подтверждения кодом (POST /api/payments/{id}/confirm)
+	draft, err := s.drafts.Create(r.Context(), userID, ownerID, bankCode, input, paymentReq, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create payment draft", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create payment draft: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, draft)
 }
 
-// handleGetPaymentStatus получает статус платежа
-// GET /api/payments/{id}?bank=vbank&user=user-123
+// handleGetPaymentStatus получает статус платежа. Для платежей из истории
+// банк можно не указывать, свежий статус сохраняется в историю
+// GET /api/payments/{id}?bank=vbank
 func (s *Server) handleGetPaymentStatus(w http.ResponseWriter, r *http.Request) {
 	paymentID := r.PathValue("id")
 	if paymentID == "" {
@@ -439,31 +663,36 @@ func (s *Server) handleGetPaymentStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	userID := getUserID(r.Context())
+
 	bankCode := r.URL.Query().Get("bank")
 	if bankCode == "" {
-		writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
-		return
-	}
-
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+		tracked, err := s.tracker.Get(userID, paymentID)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
+			return
+		}
+		bankCode = tracked.Bank
 	}
 
 	payment, err := s.aggregator.GetPaymentStatus(r.Context(), bankCode, paymentID, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to get payment status: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to get payment status", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to get payment status: "+err.Error())
 		return
 	}
 
+	if err := s.tracker.UpdateStatus(userID, bankCode, payment, time.Now().UTC()); err != nil && !errors.Is(err, ErrNotFound) {
+		handlersLog.WarnContext(r.Context(), "Failed to record payment status", "payment_id", paymentID, "error", err)
+	}
+
 	writeJSON(w, http.StatusOK, payment)
 }
 
 // PRODUCT AGREEMENT CONSENT ENDPOINTS
 
 // handleCreatePAConsent создает PA consent
-// POST /api/pa-consents?bank=vbank&user=user-123
+// POST /api/pa-consents?bank=vbank
 func (s *Server) handleCreatePAConsent(w http.ResponseWriter, r *http.Request) {
 	bankCode := r.URL.Query().Get("bank")
 	if bankCode == "" {
@@ -471,14 +700,11 @@ func (s *Server) handleCreatePAConsent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	consentID, err := s.aggregator.EnsureProductAgreementConsent(r.Context(), bankCode, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to create PA consent: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to create PA consent", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to create PA consent: "+err.Error())
 		return
 	}
@@ -509,7 +735,7 @@ func (s *Server) handleGetPAConsentStatus(w http.ResponseWriter, r *http.Request
 
 	consent, err := s.aggregator.GetProductAgreementConsentStatus(r.Context(), bankCode, consentID)
 	if err != nil {
-		log.Printf("[%s] Failed to get PA consent status: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to get PA consent status", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to get PA consent status: "+err.Error())
 		return
 	}
@@ -520,7 +746,7 @@ func (s *Server) handleGetPAConsentStatus(w http.ResponseWriter, r *http.Request
 // PRODUCT ENDPOINTS
 
 // handleGetProducts получает список продуктов
-// GET /api/products?bank=vbank&user=user-123&type=DEPOSIT
+// GET /api/products?bank=vbank&type=DEPOSIT
 func (s *Server) handleGetProducts(w http.ResponseWriter, r *http.Request) {
 	bankCode := r.URL.Query().Get("bank")
 	if bankCode == "" {
@@ -528,16 +754,13 @@ func (s *Server) handleGetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	productType := r.URL.Query().Get("type")
 
 	products, err := s.aggregator.GetProducts(r.Context(), bankCode, userID, productType)
 	if err != nil {
-		log.Printf("[%s] Failed to get products: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to get products", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to get products: "+err.Error())
 		return
 	}
@@ -551,8 +774,8 @@ func (s *Server) handleGetProducts(w http.ResponseWriter, r *http.Request) {
 
 // AGREEMENT ENDPOINTS
 
-// handleOpenAgreement открывает договор
-// POST /api/agreements?bank=vbank&user=user-123
+// handleOpenAgreement открывает договор (goal_id привязывает открытый вклад к цели накоплений)
+// POST /api/agreements?bank=vbank&goal_id=goal-123
 func (s *Server) handleOpenAgreement(w http.ResponseWriter, r *http.Request) {
 	bankCode := r.URL.Query().Get("bank")
 	if bankCode == "" {
@@ -560,9 +783,15 @@ func (s *Server) handleOpenAgreement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
+	userID := getUserID(r.Context())
+
+	// Проверяем цель до открытия договора, чтобы не открыть вклад "в никуда"
+	goalID := r.URL.Query().Get("goal_id")
+	if goalID != "" {
+		if _, err := s.goals.Get(userID, goalID); err != nil {
+			writeError(w, r, errorStatus(err), "Invalid goal_id: "+err.Error())
+			return
+		}
 	}
 
 	// Парсим тело запроса
@@ -574,31 +803,37 @@ func (s *Server) handleOpenAgreement(w http.ResponseWriter, r *http.Request) {
 
 	agreement, err := s.aggregator.OpenAgreement(r.Context(), bankCode, userID, agreementReq)
 	if err != nil {
-		log.Printf("[%s] Failed to open agreement: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to open agreement", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to open agreement: "+err.Error())
 		return
 	}
 
+	if goalID != "" && agreement.AgreementID != "" {
+		if _, err := s.goals.LinkAgreement(userID, goalID, bankCode, agreement.AgreementID); err != nil {
+			// Договор уже открыт - не проваливаем запрос, привязку можно сделать через PUT /api/goals/{id}
+			handlersLog.WarnContext(r.Context(), "Failed to link agreement to goal", "agreement_id", agreement.AgreementID, "goal_id", goalID, "error", err)
+		}
+	}
+
 	writeJSON(w, http.StatusCreated, agreement)
 }
 
-// handleGetAgreements получает список договоров
-// GET /api/agreements?bank=vbank&user=user-123
+// handleGetAgreements получает список договоров банка или, без bank, портфель по всем банкам
+// GET /api/agreements?bank=vbank
+// GET /api/agreements?maturity_days=30&payment_days=7
 func (s *Server) handleGetAgreements(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	// Без банка возвращаем портфель договоров во всех банках
 	bankCode := r.URL.Query().Get("bank")
-	if bankCode == "" {
-		writeError(w, r, http.StatusBadRequest, "Missing 'bank' query parameter")
+	if bankCode == "" || bankCode == "all" {
+		s.handleGetAgreementPortfolio(w, r, userID)
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
-
 	agreements, err := s.aggregator.GetAgreements(r.Context(), bankCode, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to get agreements: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to get agreements", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to get agreements: "+err.Error())
 		return
 	}
@@ -611,7 +846,7 @@ func (s *Server) handleGetAgreements(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleGetAgreementDetails получает детали договора
-// GET /api/agreements/{id}?bank=vbank&user=user-123
+// GET /api/agreements/{id}?bank=vbank
 func (s *Server) handleGetAgreementDetails(w http.ResponseWriter, r *http.Request) {
 	agreementID := r.PathValue("id")
 	if agreementID == "" {
@@ -625,14 +860,11 @@ func (s *Server) handleGetAgreementDetails(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	agreement, err := s.aggregator.GetAgreementDetails(r.Context(), bankCode, agreementID, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to get agreement details: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to get agreement details", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to get agreement details: "+err.Error())
 		return
 	}
@@ -641,7 +873,7 @@ func (s *Server) handleGetAgreementDetails(w http.ResponseWriter, r *http.Reques
 }
 
 // handleCloseAgreement закрывает договор
-// DELETE /api/agreements/{id}?bank=vbank&user=user-123
+// DELETE /api/agreements/{id}?bank=vbank
 func (s *Server) handleCloseAgreement(w http.ResponseWriter, r *http.Request) {
 	agreementID := r.PathValue("id")
 	if agreementID == "" {
@@ -655,14 +887,11 @@ func (s *Server) handleCloseAgreement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user")
-	if userID == "" {
-		userID = "demo-user-1"
-	}
+	userID := getUserID(r.Context())
 
 	agreement, err := s.aggregator.CloseAgreement(r.Context(), bankCode, agreementID, userID)
 	if err != nil {
-		log.Printf("[%s] Failed to close agreement: %v", getRequestID(r.Context()), err)
+		handlersLog.WarnContext(r.Context(), "Failed to close agreement", "error", err)
 		writeError(w, r, http.StatusInternalServerError, "Failed to close agreement: "+err.Error())
 		return
 	}
@@ -678,7 +907,7 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 	
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Failed to encode JSON response: %v", err)
+		handlersLog.Error("Failed to encode JSON response", "error", err)
 	}
 }
 
@@ -695,6 +924,62 @@ func writeError(w http.ResponseWriter, r *http.Request, status int, message stri
 	writeJSON(w, status, response)
 }
 
+// writeValidationError отдает ошибки валидации по полям со статусом 422,
+// нарушение политики платежей - со статусом 403 и сработавшим правилом
+func writeValidationError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	var violation *PolicyViolation
+	if errors.As(err, &violation) {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{
+			Error:     http.StatusText(http.StatusForbidden),
+			Message:   message + ": " + violation.Message,
+			RequestID: getRequestID(r.Context()),
+			Policy:    violation,
+		})
+		return
+	}
+
+	var fields ValidationErrors
+	if !errors.As(err, &fields) {
+		writeError(w, r, errorStatus(err), message+": "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{
+		Error:     http.StatusText(http.StatusUnprocessableEntity),
+		Message:   message,
+		RequestID: getRequestID(r.Context()),
+		Fields:    fields,
+	})
+}
+
+// errorStatus определяет HTTP статус для ошибок пользовательских хранилищ
+func errorStatus(err error) int {
+	var fields ValidationErrors
+	var violation *PolicyViolation
+	switch {
+	case errors.As(err, &fields):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &violation):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDraftExpired):
+		return http.StatusGone
+	case errors.Is(err, ErrDraftLocked):
+		return http.StatusLocked
+	case errors.Is(err, ErrDraftClosed):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // formatTransactionsResponse форматирует транзакции для ответа
 func formatTransactionsResponse(transactions []Transaction) []map[string]interface{} {
 	response := make([]map[string]interface{}, len(transactions))
@@ -709,6 +994,12 @@ func formatTransactionsResponse(transactions []Transaction) []map[string]interfa
 			"category":    tx.Category,
 			"description": tx.Description,
 			"bank":        tx.Bank,
+			"tags":        tx.Tags,
+			"note":        tx.Note,
+			"attachments": tx.Attachments,
+			"splits":      tx.Splits,
+			"parent_id":   tx.ParentID,
+			"owner_id":    tx.OwnerID,
 		}
 	}
 	
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestAggregator агрегатор арендатора team1 с банком vbank по адресу baseURL
+func newTestAggregator(t *testing.T, baseURL string) *BankAggregator {
+	t.Helper()
+
+	audit, err := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBankAggregator(Config{
+		DefaultTenant: "team1",
+		Tenants: []Tenant{{ID: "team1", Banks: []TenantBank{
+			{Code: "vbank", BaseURL: baseURL, ClientID: "team1", ClientSecret: "secret"},
+		}}},
+		Secrets: &Secrets{},
+	}, nil, nil, nil, nil, nil, audit)
+}
+
+func TestConsentOwnership(t *testing.T) {
+	var bankCalls atomic.Int32
+	bank := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/auth/bank-token":
+			w.Write([]byte(`{"access_token":"t","token_type":"bearer","expires_in":3600}`))
+		case strings.HasSuffix(r.URL.Path, "/request"):
+			w.Write([]byte(`{"status":"approved","consent_id":"c-1","client_id":"team1-1"}`))
+		default:
+			bankCalls.Add(1)
+			w.Write([]byte(`{"status":"approved","consent_id":"c-1","client_id":"team1-1"}`))
+		}
+	}))
+	defer bank.Close()
+
+	agg := newTestAggregator(t, bank.URL)
+	if _, err := agg.EnsureConsent(context.Background(), "vbank", "team1-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agg.EnsurePaymentConsent(context.Background(), "vbank", "team1-1", PaymentInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{aggregator: agg}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		path     string
+		userID   string
+		consent  string
+		wantCode int
+	}{
+		{"owner reads consent", server.handleGetConsentStatus, http.MethodGet, "/api/consents/c-1?bank=vbank", "team1-1", "c-1", http.StatusOK},
+		{"other user reads consent", server.handleGetConsentStatus, http.MethodGet, "/api/consents/c-1?bank=vbank", "team1-2", "c-1", http.StatusNotFound},
+		{"unknown consent", server.handleGetConsentStatus, http.MethodGet, "/api/consents/c-2?bank=vbank", "team1-1", "c-2", http.StatusNotFound},
+		{"other user reads payment consent", server.handleGetPaymentConsentStatus, http.MethodGet, "/api/payment-consents/c-1?bank=vbank", "team1-2", "c-1", http.StatusNotFound},
+		{"owner reads payment consent", server.handleGetPaymentConsentStatus, http.MethodGet, "/api/payment-consents/c-1?bank=vbank", "team1-1", "c-1", http.StatusOK},
+		{"other user revokes consent", server.handleRevokeConsent, http.MethodDelete, "/api/consents/c-1?bank=vbank", "team1-2", "c-1", http.StatusNotFound},
+		{"owner revokes consent", server.handleRevokeConsent, http.MethodDelete, "/api/consents/c-1?bank=vbank", "team1-1", "c-1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := bankCalls.Load()
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.SetPathValue("id", tt.consent)
+			r = r.WithContext(context.WithValue(r.Context(), CtxUserID, tt.userID))
+			w := httptest.NewRecorder()
+			tt.handler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			// Запрос к чужому consent не доходит до банка
+			if tt.wantCode == http.StatusNotFound && bankCalls.Load() != before {
+				t.Error("request for another user's consent was sent to the bank")
+			}
+		})
+	}
+}
+
+func TestConnectBankTenantBanks(t *testing.T) {
+	bank := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/auth/bank-token" {
+			w.Write([]byte(`{"access_token":"t","token_type":"bearer","expires_in":3600}`))
+			return
+		}
+		w.Write([]byte(`{"status":"approved","consent_id":"c-1"}`))
+	}))
+	defer bank.Close()
+
+	server := &Server{aggregator: newTestAggregator(t, bank.URL)}
+
+	tests := []struct {
+		bank     string
+		wantCode int
+	}{
+		{"vbank", http.StatusOK},
+		// abank есть у других команд, но не подключен team1
+		{"abank", http.StatusBadRequest},
+		{"unknown", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bank, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/banks/"+tt.bank+"/connect", nil)
+			r.SetPathValue("bank", tt.bank)
+			ctx := context.WithValue(r.Context(), CtxUserID, "team1-1")
+			r = r.WithContext(context.WithValue(ctx, CtxTenantID, "team1"))
+			w := httptest.NewRecorder()
+			server.handleConnectBank(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// householdsCollection коллекция в хранилище
+const householdsCollection = "households"
+
+// Роли участников домохозяйства
+const (
+	RoleHouseholdOwner  = "owner"  // создатель: приглашает и исключает участников
+	RoleHouseholdMember = "member" // участник
+)
+
+// Права участника на чужой счет. Владелец счета - пользователь, подключивший банк
+const (
+	AccessViewer = "viewer" // счет, баланс и операции
+	AccessPayer  = "payer"  // то же и платежи со счета
+)
+
+// Статусы приглашения
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+const (
+	maxHouseholdMembers = 10
+	invitationTTL       = 7 * 24 * time.Hour
+)
+
+// Household группа пользователей, открывающих друг другу доступ к своим счетам
+type Household struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	OwnerID     string                `json:"owner_id"`
+	Members     []HouseholdMember     `json:"members"`
+	Invitations []HouseholdInvitation `json:"invitations,omitempty"` // видны только создателю
+	Shares      []AccountShare        `json:"shares"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// HouseholdMember участник домохозяйства
+type HouseholdMember struct {
+	UserID   string    `json:"user_id"`
+	Login    string    `json:"login"`
+	Role     string    `json:"role"` // owner | member
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// HouseholdInvitation приглашение пользователя в домохозяйство
+type HouseholdInvitation struct {
+	ID            string     `json:"id"`
+	HouseholdID   string     `json:"household_id"`
+	HouseholdName string     `json:"household_name"`
+	UserID        string     `json:"user_id"`
+	Login         string     `json:"login"`
+	InvitedBy     string     `json:"invited_by"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+}
+
+// AccountShare доступ участника к банковскому счету другого участника
+type AccountShare struct {
+	ID        string    `json:"id"`
+	OwnerID   string    `json:"owner_id"`  // владелец счета; запросы в банк идут от его имени
+	MemberID  string    `json:"member_id"` // кому открыт доступ
+	Bank      string    `json:"bank"`
+	AccountID string    `json:"account_id"`
+	ExtID     string    `json:"ext_id,omitempty"` // номер счета: по нему проверяется счет списания платежа
+	Currency  string    `json:"currency,omitempty"`
+	Nickname  string    `json:"nickname,omitempty"`
+	Role      string    `json:"role"` // viewer | payer
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountSharing отметка в списке счетов: чей это счет и какие на него права
+type AccountSharing struct {
+	ShareID    string `json:"share_id"`
+	OwnerID    string `json:"owner_id"`
+	OwnerLogin string `json:"owner_login,omitempty"`
+	Role       string `json:"role"`
+}
+
+// HouseholdInput тело создания домохозяйства
+type HouseholdInput struct {
+	Name string `json:"name"`
+}
+
+// InvitationInput тело приглашения
+type InvitationInput struct {
+	Login string `json:"login"`
+}
+
+// ShareInput тело открытия доступа к счету
+type ShareInput struct {
+	MemberID  string `json:"member_id"`
+	Bank      string `json:"bank"`
+	AccountID string `json:"account_id"`
+	Role      string `json:"role"`
+}
+
+// HouseholdStore хранит домохозяйства, приглашения и доступы к счетам.
+// Пользователь состоит не более чем в одном домохозяйстве
+type HouseholdStore struct {
+	store *JSONStore
+
+	mu         sync.Mutex
+	households map[string]*Household // key: ID
+}
+
+// NewHouseholdStore загружает домохозяйства
+func NewHouseholdStore(store *JSONStore) (*HouseholdStore, error) {
+	s := &HouseholdStore{
+		store:      store,
+		households: make(map[string]*Household),
+	}
+
+	var households []*Household
+	if err := store.Load(householdsCollection, &households); err != nil {
+		return nil, fmt.Errorf("load households: %w", err)
+	}
+	for _, household := range households {
+		s.households[household.ID] = household
+	}
+
+	return s, nil
+}
+
+// Get возвращает домохозяйство пользователя
+func (s *HouseholdStore) Get(userID string, now time.Time) (*Household, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household := s.householdOf(userID)
+	if household == nil {
+		return nil, fmt.Errorf("household: %w", ErrNotFound)
+	}
+
+	result := household.view(userID, now)
+	return &result, nil
+}
+
+// Create создает домохозяйство, пользователь становится его создателем
+func (s *HouseholdStore) Create(ctx context.Context, userID, login string, input HouseholdInput, now time.Time) (*Household, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len([]rune(name)) > 100 {
+		var errs ValidationErrors
+		errs.add("name", "required", "name is required (up to 100 characters)")
+		return nil, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.householdOf(userID) != nil {
+		return nil, fmt.Errorf("%w: leave the current household first", ErrInvalidInput)
+	}
+
+	household := &Household{
+		ID:        "hh-" + uuid.New().String(),
+		Name:      name,
+		OwnerID:   userID,
+		Members:   []HouseholdMember{{UserID: userID, Login: login, Role: RoleHouseholdOwner, JoinedAt: now}},
+		Shares:    []AccountShare{},
+		CreatedAt: now,
+	}
+	s.households[household.ID] = household
+	if err := s.persist(); err != nil {
+		delete(s.households, household.ID)
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Created household", "household_id", household.ID, "user_id", userID)
+	result := household.view(userID, now)
+	return &result, nil
+}
+
+// Leave выводит пользователя из домохозяйства и закрывает доступы к его счетам и от
+// него к чужим. Если уходит создатель, домохозяйство распускается
+func (s *HouseholdStore) Leave(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household := s.householdOf(userID)
+	if household == nil {
+		return fmt.Errorf("household: %w", ErrNotFound)
+	}
+
+	if household.OwnerID == userID {
+		delete(s.households, household.ID)
+		if err := s.persist(); err != nil {
+			s.households[household.ID] = household
+			return err
+		}
+		authLog.InfoContext(ctx, "Disbanded household", "household_id", household.ID, "user_id", userID)
+		return nil
+	}
+
+	previous := household.clone()
+	household.removeMember(userID)
+	if err := s.persist(); err != nil {
+		*household = previous
+		return err
+	}
+
+	authLog.InfoContext(ctx, "User left household", "household_id", household.ID, "user_id", userID)
+	return nil
+}
+
+// Invite приглашает пользователя. Приглашать может только создатель
+func (s *HouseholdStore) Invite(ctx context.Context, ownerID, inviteeID, inviteeLogin string, now time.Time) (*HouseholdInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household, err := s.ownedHousehold(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if household.member(inviteeID) != nil {
+		return nil, fmt.Errorf("%w: user is already a member", ErrInvalidInput)
+	}
+	if s.householdOf(inviteeID) != nil {
+		return nil, fmt.Errorf("%w: user is already in another household", ErrInvalidInput)
+	}
+	if len(household.Members) >= maxHouseholdMembers {
+		return nil, fmt.Errorf("%w: at most %d members per household", ErrInvalidInput, maxHouseholdMembers)
+	}
+	for i := range household.Invitations {
+		invitation := &household.Invitations[i]
+		if invitation.UserID == inviteeID && invitation.pending(now) {
+			return nil, fmt.Errorf("%w: user already has a pending invitation", ErrInvalidInput)
+		}
+	}
+
+	invitation := HouseholdInvitation{
+		ID:            "inv-" + uuid.New().String(),
+		HouseholdID:   household.ID,
+		HouseholdName: household.Name,
+		UserID:        inviteeID,
+		Login:         inviteeLogin,
+		InvitedBy:     ownerID,
+		Status:        InvitationPending,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(invitationTTL),
+	}
+
+	previous := household.clone()
+	household.purgeInvitations(now)
+	household.Invitations = append(household.Invitations, invitation)
+	if err := s.persist(); err != nil {
+		*household = previous
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Invited household member", "household_id", household.ID, "user_id", ownerID, "invitee_id", inviteeID)
+	return &invitation, nil
+}
+
+// Invitations возвращает действующие приглашения пользователю
+func (s *HouseholdStore) Invitations(userID string, now time.Time) []HouseholdInvitation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]HouseholdInvitation, 0)
+	for _, household := range s.households {
+		for _, invitation := range household.Invitations {
+			if invitation.UserID == userID && invitation.pending(now) {
+				result = append(result, invitation)
+			}
+		}
+	}
+
+	return result
+}
+
+// Respond принимает или отклоняет приглашение
+func (s *HouseholdStore) Respond(ctx context.Context, userID, invitationID, login string, accept bool, now time.Time) (*HouseholdInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household, invitation := s.findInvitation(invitationID)
+	if invitation == nil || invitation.UserID != userID {
+		return nil, fmt.Errorf("invitation %s: %w", invitationID, ErrNotFound)
+	}
+	if !invitation.pending(now) {
+		return nil, fmt.Errorf("%w: invitation is %s", ErrInvalidInput, invitation.status(now))
+	}
+	if accept {
+		if s.householdOf(userID) != nil {
+			return nil, fmt.Errorf("%w: leave the current household first", ErrInvalidInput)
+		}
+		if len(household.Members) >= maxHouseholdMembers {
+			return nil, fmt.Errorf("%w: household already has %d members", ErrInvalidInput, maxHouseholdMembers)
+		}
+	}
+
+	previous := household.clone()
+	invitation.RespondedAt = &now
+	if accept {
+		invitation.Status = InvitationAccepted
+		household.Members = append(household.Members, HouseholdMember{UserID: userID, Login: login, Role: RoleHouseholdMember, JoinedAt: now})
+	} else {
+		invitation.Status = InvitationDeclined
+	}
+	result := *invitation
+	if err := s.persist(); err != nil {
+		*household = previous
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Responded to household invitation", "invitation_id", invitationID, "user_id", userID, "status", result.Status)
+	return &result, nil
+}
+
+// RevokeInvitation отзывает приглашение (только создатель)
+func (s *HouseholdStore) RevokeInvitation(ownerID, invitationID string, now time.Time) (*HouseholdInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household, err := s.ownedHousehold(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	var invitation *HouseholdInvitation
+	for i := range household.Invitations {
+		if household.Invitations[i].ID == invitationID {
+			invitation = &household.Invitations[i]
+		}
+	}
+	if invitation == nil {
+		return nil, fmt.Errorf("invitation %s: %w", invitationID, ErrNotFound)
+	}
+	if !invitation.pending(now) {
+		return nil, fmt.Errorf("%w: invitation is %s", ErrInvalidInput, invitation.status(now))
+	}
+
+	previous := household.clone()
+	invitation.Status = InvitationRevoked
+	invitation.RespondedAt = &now
+	result := *invitation
+	if err := s.persist(); err != nil {
+		*household = previous
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// RemoveMember исключает участника (только создатель) и закрывает его доступы
+func (s *HouseholdStore) RemoveMember(ctx context.Context, ownerID, memberID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household, err := s.ownedHousehold(ownerID)
+	if err != nil {
+		return err
+	}
+	if memberID == ownerID {
+		return fmt.Errorf("%w: the owner cannot be removed, disband the household instead", ErrInvalidInput)
+	}
+	if household.member(memberID) == nil {
+		return fmt.Errorf("member %s: %w", memberID, ErrNotFound)
+	}
+
+	previous := household.clone()
+	household.removeMember(memberID)
+	if err := s.persist(); err != nil {
+		*household = previous
+		return err
+	}
+
+	authLog.InfoContext(ctx, "Removed household member", "household_id", household.ID, "user_id", ownerID, "member_id", memberID)
+	return nil
+}
+
+// Share открывает участнику доступ к счету пользователя или меняет роль уже открытого.
+// account - счет из банка владельца, проверенный вызывающим
+func (s *HouseholdStore) Share(ctx context.Context, ownerID string, input ShareInput, account Account, now time.Time) (*AccountShare, error) {
+	var errs ValidationErrors
+	if input.Role != AccessViewer && input.Role != AccessPayer {
+		errs.add("role", "invalid_value", "role must be %s or %s", AccessViewer, AccessPayer)
+	}
+	if input.MemberID == ownerID {
+		errs.add("member_id", "invalid_value", "cannot share an account with yourself")
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household := s.householdOf(ownerID)
+	if household == nil {
+		return nil, fmt.Errorf("household: %w", ErrNotFound)
+	}
+	if household.member(input.MemberID) == nil {
+		errs.add("member_id", "not_found", "user %s is not a member of the household", input.MemberID)
+		return nil, errs
+	}
+
+	previous := household.clone()
+	var share *AccountShare
+	for i := range household.Shares {
+		existing := &household.Shares[i]
+		if existing.OwnerID == ownerID && existing.MemberID == input.MemberID && existing.Bank == input.Bank && existing.AccountID == input.AccountID {
+			share = existing
+		}
+	}
+	if share == nil {
+		household.Shares = append(household.Shares, AccountShare{
+			ID:        "share-" + uuid.New().String(),
+			OwnerID:   ownerID,
+			MemberID:  input.MemberID,
+			Bank:      input.Bank,
+			AccountID: input.AccountID,
+			CreatedAt: now,
+		})
+		share = &household.Shares[len(household.Shares)-1]
+	}
+	share.ExtID = account.ExtID
+	share.Currency = account.Currency
+	share.Nickname = account.Nickname
+	share.Role = input.Role
+	share.UpdatedAt = now
+
+	result := *share
+	if err := s.persist(); err != nil {
+		*household = previous
+		return nil, err
+	}
+
+	authLog.InfoContext(ctx, "Shared account", "user_id", ownerID, "bank", input.Bank, "account_id", input.AccountID, "member_id", input.MemberID, "role", input.Role)
+	return &result, nil
+}
+
+// Unshare закрывает доступ к счету. Закрыть может владелец счета или тот, кому он открыт
+func (s *HouseholdStore) Unshare(ctx context.Context, userID, shareID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	household := s.householdOf(userID)
+	if household == nil {
+		return fmt.Errorf("share %s: %w", shareID, ErrNotFound)
+	}
+
+	for i, share := range household.Shares {
+		if share.ID != shareID || (share.OwnerID != userID && share.MemberID != userID) {
+			continue
+		}
+
+		previous := household.clone()
+		household.Shares = append(household.Shares[:i:i], household.Shares[i+1:]...)
+		if err := s.persist(); err != nil {
+			*household = previous
+			return err
+		}
+		authLog.InfoContext(ctx, "Revoked account share", "share_id", shareID, "user_id", userID)
+		return nil
+	}
+
+	return fmt.Errorf("share %s: %w", shareID, ErrNotFound)
+}
+
+// SharedWith возвращает счета, открытые пользователю другими участниками
+func (s *HouseholdStore) SharedWith(userID string) []AccountShare {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]AccountShare, 0)
+	if household := s.householdOf(userID); household != nil {
+		for _, share := range household.Shares {
+			if share.MemberID == userID {
+				result = append(result, share)
+			}
+		}
+	}
+
+	return result
+}
+
+// Access возвращает доступ пользователя к счету владельца: account - ID счета или
+// его номер. ErrNotFound - счет пользователю не открыт
+func (s *HouseholdStore) Access(userID, ownerID, bank, account string) (*AccountShare, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if household := s.householdOf(userID); household != nil {
+		for _, share := range household.Shares {
+			if share.MemberID == userID && share.OwnerID == ownerID && share.Bank == bank &&
+				(share.AccountID == account || (share.ExtID != "" && share.ExtID == account)) {
+				return &share, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("account %s of user %s: %w", account, ownerID, ErrNotFound)
+}
+
+// MemberLogin возвращает логин участника домохозяйства пользователя
+func (s *HouseholdStore) MemberLogin(userID, memberID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if household := s.householdOf(userID); household != nil {
+		if member := household.member(memberID); member != nil {
+			return member.Login
+		}
+	}
+	return ""
+}
+
+// householdOf ищет домохозяйство участника (вызывается под блокировкой)
+func (s *HouseholdStore) householdOf(userID string) *Household {
+	for _, household := range s.households {
+		if household.member(userID) != nil {
+			return household
+		}
+	}
+	return nil
+}
+
+// ownedHousehold домохозяйство, созданное пользователем (вызывается под блокировкой)
+func (s *HouseholdStore) ownedHousehold(userID string) (*Household, error) {
+	household := s.householdOf(userID)
+	if household == nil {
+		return nil, fmt.Errorf("household: %w", ErrNotFound)
+	}
+	if household.OwnerID != userID {
+		return nil, fmt.Errorf("%w: only the household owner can manage members", ErrForbidden)
+	}
+	return household, nil
+}
+
+// findInvitation ищет приглашение во всех домохозяйствах (вызывается под блокировкой)
+func (s *HouseholdStore) findInvitation(invitationID string) (*Household, *HouseholdInvitation) {
+	for _, household := range s.households {
+		for i := range household.Invitations {
+			if household.Invitations[i].ID == invitationID {
+				return household, &household.Invitations[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// persist сохраняет домохозяйства (вызывается под блокировкой)
+func (s *HouseholdStore) persist() error {
+	households := make([]*Household, 0, len(s.households))
+	for _, household := range s.households {
+		households = append(households, household)
+	}
+	return s.store.Save(householdsCollection, households)
+}
+
+// member ищет участника
+func (h *Household) member(userID string) *HouseholdMember {
+	for i := range h.Members {
+		if h.Members[i].UserID == userID {
+			return &h.Members[i]
+		}
+	}
+	return nil
+}
+
+// removeMember удаляет участника и все доступы от него и к нему
+func (h *Household) removeMember(userID string) {
+	members := make([]HouseholdMember, 0, len(h.Members))
+	for _, member := range h.Members {
+		if member.UserID != userID {
+			members = append(members, member)
+		}
+	}
+	h.Members = members
+
+	shares := make([]AccountShare, 0, len(h.Shares))
+	for _, share := range h.Shares {
+		if share.OwnerID != userID && share.MemberID != userID {
+			shares = append(shares, share)
+		}
+	}
+	h.Shares = shares
+}
+
+// purgeInvitations удаляет приглашения, на которые уже ответили или которые истекли
+func (h *Household) purgeInvitations(now time.Time) {
+	invitations := make([]HouseholdInvitation, 0, len(h.Invitations))
+	for _, invitation := range h.Invitations {
+		if invitation.pending(now) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	h.Invitations = invitations
+}
+
+// clone глубокая копия для отката изменений
+func (h *Household) clone() Household {
+	c := *h
+	c.Members = append([]HouseholdMember{}, h.Members...)
+	c.Invitations = append([]HouseholdInvitation{}, h.Invitations...)
+	c.Shares = append([]AccountShare{}, h.Shares...)
+	return c
+}
+
+// view копия для пользователя: приглашения видит только создатель
+func (h *Household) view(userID string, now time.Time) Household {
+	c := h.clone()
+	c.Invitations = nil
+	if userID == h.OwnerID {
+		for _, invitation := range h.Invitations {
+			invitation.Status = invitation.status(now)
+			c.Invitations = append(c.Invitations, invitation)
+		}
+	}
+	return c
+}
+
+// pending приглашение ждет ответа и не истекло
+func (i *HouseholdInvitation) pending(now time.Time) bool {
+	return i.Status == InvitationPending && now.Before(i.ExpiresAt)
+}
+
+// status статус с учетом срока действия
+func (i *HouseholdInvitation) status(now time.Time) string {
+	if i.Status == InvitationPending && !now.Before(i.ExpiresAt) {
+		return InvitationExpired
+	}
+	return i.Status
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HOUSEHOLD ENDPOINTS
+
+// handleGetHousehold возвращает домохозяйство пользователя с участниками и доступами к счетам
+// GET /api/household
+func (s *Server) handleGetHousehold(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	household, err := s.households.Get(userID, time.Now().UTC())
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get household: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, household)
+}
+
+// handleCreateHousehold создает домохозяйство
+// POST /api/household
+// Тело: {"name": "Семья"}
+func (s *Server) handleCreateHousehold(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input HouseholdInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	profile, err := s.auth.Profile(userID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to create household: "+err.Error())
+		return
+	}
+
+	household, err := s.households.Create(r.Context(), userID, profile.Login, input, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create household", "error", err)
+		writeValidationError(w, r, "Failed to create household", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, household)
+}
+
+// handleLeaveHousehold выводит пользователя из домохозяйства, создатель его распускает
+// DELETE /api/household
+func (s *Server) handleLeaveHousehold(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	if err := s.households.Leave(r.Context(), userID); err != nil {
+		writeError(w, r, errorStatus(err), "Failed to leave household: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Left household",
+	})
+}
+
+// handleListInvitations возвращает приглашения пользователю
+// GET /api/household/invitations
+func (s *Server) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	invitations := s.households.Invitations(userID, time.Now().UTC())
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"invitations": invitations,
+		"count":       len(invitations),
+	})
+}
+
+// handleInviteMember приглашает пользователя в домохозяйство по логину
+// POST /api/household/invitations
+// Тело: {"login": "bob"}
+func (s *Server) handleInviteMember(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input InvitationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Пригласить можно только пользователя той же команды: доступ к счетам идет
+	// через учетные данные команды владельца
+	invitee, err := s.auth.FindByLogin(input.Login)
+	if err != nil || invitee.TenantID != s.auth.TenantOf(userID) {
+		var errs ValidationErrors
+		errs.add("login", "not_found", "user %s not found", input.Login)
+		writeValidationError(w, r, "Failed to invite member", errs)
+		return
+	}
+
+	invitation, err := s.households.Invite(r.Context(), userID, invitee.ID, invitee.Login, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to invite member", "error", err)
+		writeValidationError(w, r, "Failed to invite member", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, invitation)
+}
+
+// handleAcceptInvitation принимает приглашение
+// POST /api/household/invitations/{id}/accept
+func (s *Server) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondInvitation(w, r, true)
+}
+
+// handleDeclineInvitation отклоняет приглашение
+// POST /api/household/invitations/{id}/decline
+func (s *Server) handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondInvitation(w, r, false)
+}
+
+// respondInvitation общий обработчик ответа на приглашение
+func (s *Server) respondInvitation(w http.ResponseWriter, r *http.Request, accept bool) {
+	invitationID := r.PathValue("id")
+	if invitationID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing invitation ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	profile, err := s.auth.Profile(userID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to respond to invitation: "+err.Error())
+		return
+	}
+
+	invitation, err := s.households.Respond(r.Context(), userID, invitationID, profile.Login, accept, time.Now().UTC())
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to respond to invitation: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invitation)
+}
+
+// handleRevokeInvitation отзывает приглашение
+// DELETE /api/household/invitations/{id}
+func (s *Server) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	invitationID := r.PathValue("id")
+	if invitationID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing invitation ID in path")
+		return
+	}
+
+	invitation, err := s.households.RevokeInvitation(userID, invitationID, time.Now().UTC())
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to revoke invitation: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, invitation)
+}
+
+// handleRemoveMember исключает участника
+// DELETE /api/household/members/{userId}
+func (s *Server) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	memberID := r.PathValue("userId")
+	if memberID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing member ID in path")
+		return
+	}
+
+	if err := s.households.RemoveMember(r.Context(), userID, memberID); err != nil {
+		writeError(w, r, errorStatus(err), "Failed to remove member: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Member removed",
+	})
+}
+
+// handleShareAccount открывает участнику доступ к своему банковскому счету
+// или меняет роль уже открытого
+// POST /api/household/shares
+// Тело: {"member_id": "team053-2", "bank": "vbank", "account_id": "acc-1", "role": "payer"}
+func (s *Server) handleShareAccount(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input ShareInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	var errs ValidationErrors
+	if _, err := s.aggregator.GetBankByCode(r.Context(), input.Bank); err != nil {
+		errs.add("bank", "invalid_value", "unknown bank %s", input.Bank)
+	}
+	if input.AccountID == "" {
+		errs.add("account_id", "required", "account_id is required")
+	}
+	if err := errs.err(); err != nil {
+		writeValidationError(w, r, "Failed to share account", err)
+		return
+	}
+
+	// Открыть можно только свой счет: проверяем его по счетам из банка
+	accounts, err := s.aggregator.GetAccountsFromBank(r.Context(), input.Bank, userID)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to fetch accounts", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to fetch accounts: "+err.Error())
+		return
+	}
+	var account *Account
+	for i := range accounts {
+		if accounts[i].ID == input.AccountID {
+			account = &accounts[i]
+		}
+	}
+	if account == nil {
+		errs.add("account_id", "not_found", "account %s not found in %s", input.AccountID, input.Bank)
+		writeValidationError(w, r, "Failed to share account", errs)
+		return
+	}
+
+	share, err := s.households.Share(r.Context(), userID, input, *account, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to share account", "error", err)
+		writeValidationError(w, r, "Failed to share account", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, share)
+}
+
+// handleUnshareAccount закрывает доступ к счету
+// DELETE /api/household/shares/{id}
+func (s *Server) handleUnshareAccount(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	shareID := r.PathValue("id")
+	if shareID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing share ID in path")
+		return
+	}
+
+	if err := s.households.Unshare(r.Context(), userID, shareID); err != nil {
+		writeError(w, r, errorStatus(err), "Failed to revoke share: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Share revoked",
+	})
+}
+
+// accountUser определяет, от чьего имени запрашивать счет в банке. Без ?owner= (или
+// с собственным ID) - сам пользователь, иначе владелец, если он открыл счет
+// пользователю; для платежей нужна роль payer
+func (s *Server) accountUser(r *http.Request, bank, account string, payment bool) (string, error) {
+	userID := getUserID(r.Context())
+
+	ownerID := r.URL.Query().Get("owner")
+	if ownerID == "" || ownerID == userID {
+		return userID, nil
+	}
+
+	share, err := s.households.Access(userID, ownerID, bank, account)
+	if err != nil {
+		return "", err
+	}
+	if payment && share.Role != AccessPayer {
+		return "", fmt.Errorf("%w: account %s is shared with you as %s, payer role required", ErrForbidden, account, share.Role)
+	}
+	return ownerID, nil
+}
+
+// sharedAccounts счета, открытые пользователю участниками домохозяйства. Счета
+// каждого владельца запрашиваются из банка один раз; недоступные пропускаются
+func (s *Server) sharedAccounts(ctx context.Context, userID, bankFilter string) []Account {
+	fetched := make(map[string][]Account) // owner|bank -> счета
+	var result []Account
+
+	for _, share := range s.households.SharedWith(userID) {
+		if bankFilter != "" && bankFilter != "all" && bankFilter != share.Bank {
+			continue
+		}
+
+		key := share.OwnerID + "|" + share.Bank
+		accounts, ok := fetched[key]
+		if !ok {
+			var err error
+			accounts, err = s.aggregator.GetAccountsFromBank(ctx, share.Bank, share.OwnerID)
+			if err != nil {
+				handlersLog.WarnContext(ctx, "Failed to get shared accounts", "owner_id", share.OwnerID, "bank", share.Bank, "error", err)
+			}
+			fetched[key] = accounts
+		}
+
+		for _, account := range accounts {
+			if account.ID != share.AccountID {
+				continue
+			}
+			account.Shared = &AccountSharing{
+				ShareID:    share.ID,
+				OwnerID:    share.OwnerID,
+				OwnerLogin: s.households.MemberLogin(userID, share.OwnerID),
+				Role:       share.Role,
+			}
+			result = append(result, account)
+		}
+	}
+
+	return result
+}
+
+// sharedTransactions операции по счетам, открытым пользователю, с отметкой владельца
+func (s *Server) sharedTransactions(ctx context.Context, userID, bankFilter string, from, to *time.Time) []Transaction {
+	var fromTime, toTime time.Time
+	if from != nil {
+		fromTime = *from
+	}
+	if to != nil {
+		toTime = *to
+	}
+
+	var result []Transaction
+	for _, share := range s.households.SharedWith(userID) {
+		if bankFilter != "" && bankFilter != "all" && bankFilter != share.Bank {
+			continue
+		}
+
+		transactions, err := s.aggregator.GetAccountTransactions(ctx, share.Bank, share.OwnerID, share.AccountID, fromTime, toTime)
+		if err != nil {
+			handlersLog.WarnContext(ctx, "Failed to get shared transactions", "bank", share.Bank, "account_id", share.AccountID, "error", err)
+			continue
+		}
+		for _, tx := range transactions {
+			if (from != nil && tx.Date.Before(*from)) || (to != nil && tx.Date.After(*to)) {
+				continue
+			}
+			tx.OwnerID = share.OwnerID
+			result = append(result, tx)
+		}
+	}
+
+	return result
+}
@@ -6,9 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -59,16 +59,22 @@ func (c *HTTPClient) DoRequest(ctx context.Context, opts RequestOptions) (*http.
 			return nil, fmt.Errorf("marshal request body: %w", err)
 		}
 		bodyReader = bytes.NewReader(bodyBytes)
-		
-		// Debug: логируем тело запроса
-		log.Printf("[DEBUG HTTP] %s %s | Body: %s", opts.Method, fullURL, string(bodyBytes))
-	} else {
-		log.Printf("[DEBUG HTTP] %s %s | No body", opts.Method, fullURL)
 	}
 
-	// Retry логика (до 3 попыток)
+	// Debug: логируем запрос. URL без query - в query бывает client_secret,
+	// параметры и тело маскируются по полям
+	httpClientLog.DebugContext(ctx, "Bank request", "method", opts.Method, "url", c.baseURL+opts.Path, "query", opts.QueryParams, "body", bodyBytes)
+
+	// Retry логика (до 3 попыток). Повторяются только GET/HEAD и запросы с Idempotency-Key
+	// (его получают только банки, которые его учитывают): иначе POST, дошедший до банка
+	// до ошибки, может быть проведен дважды
+	attempts := 1
+	if opts.Method == "" || opts.Method == http.MethodGet || opts.Method == http.MethodHead || opts.Headers["Idempotency-Key"] != "" {
+		attempts = 3
+	}
+
 	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
+	for attempt := 0; attempt < attempts; attempt++ {
 		if attempt > 0 {
 			// Экспоненциальная задержка между попытками
 			time.Sleep(time.Duration(attempt) * time.Second)
@@ -97,8 +103,7 @@ func (c *HTTPClient) DoRequest(ctx context.Context, opts RequestOptions) (*http.
 
 		// Debug: логируем важные заголовки
 		if consentID := req.Header.Get("X-Consent-Id"); consentID != "" {
-			log.Printf("[DEBUG HTTP] Headers: X-Consent-Id=%s, X-Requesting-Bank=%s",
-				consentID, req.Header.Get("X-Requesting-Bank"))
+			httpClientLog.DebugContext(ctx, "Bank request headers", "x_consent_id", consentID, "x_requesting_bank", req.Header.Get("X-Requesting-Bank"))
 		}
 
 		// Выполняем запрос
@@ -111,20 +116,22 @@ func (c *HTTPClient) DoRequest(ctx context.Context, opts RequestOptions) (*http.
 		// КРИТИЧЕСКАЯ ПРОВЕРКА: Content-Type должен быть application/json
 		contentType := resp.Header.Get("Content-Type")
 		if !strings.Contains(contentType, "application/json") {
-			// Читаем первые 256 байт для диагностики
+			// Первые 256 байт - в лог для диагностики (тело не попадает в текст ошибки,
+			// в логе оно маскируется)
 			preview := make([]byte, 256)
 			n, _ := io.ReadFull(resp.Body, preview)
 			resp.Body.Close()
-			
-			return nil, fmt.Errorf("invalid Content-Type: %s (expected application/json). Response preview: %s", 
-				contentType, string(preview[:n]))
+			httpClientLog.WarnContext(ctx, "Bank response is not JSON", "status", resp.StatusCode, "content_type", contentType, "body", preview[:n])
+
+			return nil, fmt.Errorf("invalid Content-Type: %s (expected application/json)", contentType)
 		}
 
 		// Retry на 5xx ошибки
 		if resp.StatusCode >= 500 && resp.StatusCode < 600 {
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+			httpClientLog.WarnContext(ctx, "Bank server error", "status", resp.StatusCode, "attempt", attempt+1, "body", body)
+			lastErr = fmt.Errorf("server error %d", resp.StatusCode)
 			continue // retry
 		}
 
@@ -132,7 +139,10 @@ func (c *HTTPClient) DoRequest(ctx context.Context, opts RequestOptions) (*http.
 		return resp, nil
 	}
 
-	return nil, fmt.Errorf("request failed after 3 attempts: %w", lastErr)
+	if attempts == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("request failed after %d attempts: %w", attempts, lastErr)
 }
 
 // ParseJSONResponse парсит JSON ответ из response body
@@ -145,20 +155,60 @@ func ParseJSONResponse(resp *http.Response, target interface{}) error {
 	}
 
 	if err := json.Unmarshal(bodyBytes, target); err != nil {
-		return fmt.Errorf("parse JSON (body: %s): %w", string(bodyBytes), err)
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+		httpClientLog.WarnContext(ctx, "Failed to parse bank response", "status", resp.StatusCode, "error", err, "body", bodyBytes)
+		return fmt.Errorf("parse JSON: %w", err)
 	}
 
 	return nil
 }
 
-// ReadErrorResponse читает тело ошибки для диагностики
-func ReadErrorResponse(resp *http.Response) string {
+// reBankErrorCode код ошибки банка, который можно показать: слова через _ . - без цифр
+// (строка с цифрами может оказаться токеном или номером счета)
+var reBankErrorCode = regexp.MustCompile(`^[A-Za-z]+([_.-][A-Za-z]+)*$`)
+
+// BankError ответ банка с ошибкой. Тело ответа в текст ошибки не попадает: в нем бывают
+// токены, номера счетов и имена, а текст ошибки сохраняется в черновиках, журналах и логах
+type BankError struct {
+	Operation  string // операция, например "create payment"
+	StatusCode int
+	Code       string // код ошибки из тела ответа (error или code), если он похож на идентификатор
+}
+
+// Error реализует интерфейс error
+func (e *BankError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s failed (%d): %s", e.Operation, e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("%s failed (%d)", e.Operation, e.StatusCode)
+}
+
+// ReadBankError читает ответ банка с ошибкой: тело пишется в лог под атрибутом body
+// (с маскированием полей), в ошибку попадают только операция, код ответа и код ошибки банка
+func ReadBankError(ctx context.Context, resp *http.Response, operation string) error {
 	defer resp.Body.Close()
-	
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Sprintf("failed to read error body: %v", err)
+		httpClientLog.WarnContext(ctx, "Failed to read bank error response", "operation", operation, "status", resp.StatusCode, "error", err)
 	}
-	
-	return string(body)
-}
\ No newline at end of file
+	httpClientLog.WarnContext(ctx, "Bank request failed", "operation", operation, "status", resp.StatusCode, "body", body)
+
+	bankErr := &BankError{Operation: operation, StatusCode: resp.StatusCode}
+	var parsed struct {
+		Error interface{} `json:"error"`
+		Code  interface{} `json:"code"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		for _, value := range []interface{}{parsed.Error, parsed.Code} {
+			if code, ok := value.(string); ok && len(code) <= 64 && reBankErrorCode.MatchString(code) {
+				bankErr.Code = code
+				break
+			}
+		}
+	}
+	return bankErr
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDoRequestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		headers   map[string]string
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"POST without idempotency key is sent once", http.MethodPost, nil, 1, true},
+		{"POST with idempotency key is retried", http.MethodPost, map[string]string{"Idempotency-Key": "k1"}, 2, false},
+		{"GET is retried", http.MethodGet, nil, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Первая попытка - 503, вторая - успех
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"error":"unavailable"}`))
+					return
+				}
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			resp, err := NewHTTPClient(server.URL).DoRequest(context.Background(), RequestOptions{
+				Method:  tt.method,
+				Path:    "/payments",
+				Body:    map[string]string{"amount": "100.00"},
+				Headers: tt.headers,
+			})
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("bank got %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCreatePaymentIdempotencyKeySupport(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported bool
+		wantPosts int32
+		wantKey   bool
+	}{
+		// Банк без поддержки ключа проводит каждый POST: повтор после 503 списал бы деньги дважды
+		{"bank ignores the key", false, 1, false},
+		{"bank supports the key", true, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts atomic.Int32
+			var sentKey atomic.Bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/auth/bank-token" {
+					w.Write([]byte(`{"access_token":"t","token_type":"bearer","expires_in":3600}`))
+					return
+				}
+				if r.Header.Get("Idempotency-Key") != "" {
+					sentKey.Store(true)
+				}
+				if posts.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"error":"unavailable"}`))
+					return
+				}
+				w.Write([]byte(`{"payment_id":"p-1"}`))
+			}))
+			defer server.Close()
+
+			client := NewBankAPIClient(server.URL, "team1", "secret", "team1", tt.supported)
+			ctx := context.WithValue(context.Background(), CtxIdempotencyKey, "key-1")
+			_, err := client.CreatePayment(ctx, "pc-1", "team1-1", PaymentRequest{})
+
+			if (err != nil) != (tt.wantPosts == 1) {
+				t.Errorf("error = %v", err)
+			}
+			if got := posts.Load(); got != tt.wantPosts {
+				t.Errorf("bank got %d POSTs, want %d", got, tt.wantPosts)
+			}
+			if sentKey.Load() != tt.wantKey {
+				t.Errorf("Idempotency-Key sent = %v, want %v", sentKey.Load(), tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestBankBodyNotInErrors(t *testing.T) {
+	const secret = "40817810938160925982"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{"account":"` + secret + `"`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL)
+	ctx := context.Background()
+
+	_, err := client.DoRequest(ctx, RequestOptions{Method: http.MethodPost, Path: "/broken"})
+	if err == nil || strings.Contains(err.Error(), secret) {
+		t.Errorf("server error = %v, want error without response body", err)
+	}
+
+	resp, err := client.DoRequest(ctx, RequestOptions{Method: http.MethodGet, Path: "/truncated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var target map[string]string
+	err = ParseJSONResponse(resp, &target)
+	if err == nil || strings.Contains(err.Error(), secret) {
+		t.Errorf("parse error = %v, want error without response body", err)
+	}
+}
+
+func TestReadBankError(t *testing.T) {
+	const token = "eyJhbGciOiJIUzI1NiJ9.c2VjcmV0.sig"
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"code in error field", `{"error":"invalid_request","access_token":"` + token + `"}`, "create payment failed (400): invalid_request"},
+		{"code in code field", `{"code":"consent.expired","message":"token ` + token + `"}`, "create payment failed (400): consent.expired"},
+		{"token in error field", `{"error":"` + token + `"}`, "create payment failed (400)"},
+		{"account number in error field", `{"error":"account 40817810938160925982 is blocked"}`, "create payment failed (400)"},
+		{"not JSON", "bad token " + token, "create payment failed (400)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			resp, err := NewHTTPClient(server.URL).DoRequest(context.Background(), RequestOptions{Method: http.MethodGet, Path: "/payments"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ReadBankError(context.Background(), resp, "create payment")
+
+			if err.Error() != tt.want {
+				t.Errorf("error = %q, want %q", err, tt.want)
+			}
+			if strings.Contains(err.Error(), token) {
+				t.Errorf("error contains the token from the bank response: %q", err)
+			}
+			var bankErr *BankError
+			if !errors.As(err, &bankErr) || bankErr.StatusCode != http.StatusBadRequest {
+				t.Errorf("error = %#v, want *BankError with status 400", err)
+			}
+		})
+	}
+}
+
+func TestTokenRequestErrorHidesBody(t *testing.T) {
+	const secret = "s3cr3t-client-secret"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_client","client_secret":"` + r.URL.Query().Get("client_secret") + `"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewBankAPIClient(server.URL, "team1", secret, "team1", false).EnsureToken(context.Background())
+	if err == nil || strings.Contains(err.Error(), secret) {
+		t.Fatalf("error = %v, want error without client secret", err)
+	}
+	if !strings.Contains(err.Error(), "token request failed (401): invalid_client") {
+		t.Errorf("error = %q, want operation, status and bank error code", err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idempotencyCollection коллекция в хранилище
+const idempotencyCollection = "idempotency_keys"
+
+const (
+	idempotencyKeyTTL       = 24 * time.Hour // сколько хранится ответ по ключу
+	maxIdempotencyKeyLength = 255
+)
+
+// Области действия ключей: один и тот же ключ можно использовать для разных операций
+const (
+	IdempotencyScopePayments   = "payments"
+	IdempotencyScopeAgreements = "agreements"
+	IdempotencyScopeScheduled  = "scheduled"
+	IdempotencyScopeBatch      = "batch"
+	IdempotencyScopeTransfers  = "transfers"
+)
+
+var (
+	// ErrIdempotencyInProgress запрос с этим ключом еще выполняется
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+	// ErrIdempotencyKeyReused ключ уже использован с другим телом запроса
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+)
+
+// IdempotencyRecord сохраненный ответ на запрос с Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string          `json:"key"`
+	UserID      string          `json:"user_id"`
+	Scope       string          `json:"scope"`
+	RequestHash string          `json:"request_hash"`
+	Completed   bool            `json:"completed"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// IdempotencyStore хранит ответы на запросы с Idempotency-Key.
+// Незавершенные запросы держатся только в памяти: после перезапуска сервера
+// такой запрос можно повторить с тем же ключом
+type IdempotencyStore struct {
+	store *JSONStore
+
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord // key: "userID|scope|key"
+}
+
+// NewIdempotencyStore загружает сохраненные ответы, пропуская просроченные
+func NewIdempotencyStore(store *JSONStore) (*IdempotencyStore, error) {
+	s := &IdempotencyStore{
+		store:   store,
+		records: make(map[string]*IdempotencyRecord),
+	}
+
+	var records []*IdempotencyRecord
+	if err := store.Load(idempotencyCollection, &records); err != nil {
+		return nil, fmt.Errorf("load idempotency keys: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, record := range records {
+		if record.ExpiresAt.After(now) {
+			s.records[idempotencyRecordKey(record.UserID, record.Scope, record.Key)] = record
+		}
+	}
+
+	return s, nil
+}
+
+// Begin резервирует ключ за запросом. Если запрос с этим ключом уже выполнен,
+// возвращает сохраненный ответ; если выполняется или ключ занят другим запросом - ошибку
+func (s *IdempotencyStore) Begin(userID, scope, key, requestHash string, now time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired(now)
+
+	id := idempotencyRecordKey(userID, scope, key)
+	if record, exists := s.records[id]; exists {
+		if record.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if !record.Completed {
+			return nil, ErrIdempotencyInProgress
+		}
+		result := *record
+		return &result, nil
+	}
+
+	s.records[id] = &IdempotencyRecord{
+		Key:         key,
+		UserID:      userID,
+		Scope:       scope,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyKeyTTL),
+	}
+	return nil, nil
+}
+
+// Complete сохраняет ответ на выполненный запрос
+func (s *IdempotencyStore) Complete(userID, scope, key string, statusCode int, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, exists := s.records[idempotencyRecordKey(userID, scope, key)]
+	if !exists {
+		return fmt.Errorf("idempotency key %s: %w", key, ErrNotFound)
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.Response = json.RawMessage(response)
+
+	if err := s.persist(); err != nil {
+		record.Completed = false
+		record.StatusCode = 0
+		record.Response = nil
+		return err
+	}
+	return nil
+}
+
+// Release освобождает ключ, если запрос не удался: его можно повторить с тем же ключом
+func (s *IdempotencyStore) Release(userID, scope, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyRecordKey(userID, scope, key)
+	if record, exists := s.records[id]; exists && !record.Completed {
+		delete(s.records, id)
+	}
+}
+
+// purgeExpired удаляет просроченные ключи (вызывается под блокировкой)
+func (s *IdempotencyStore) purgeExpired(now time.Time) {
+	for id, record := range s.records {
+		if !record.ExpiresAt.After(now) {
+			delete(s.records, id)
+		}
+	}
+}
+
+// persist сохраняет завершенные запросы (вызывается под блокировкой)
+func (s *IdempotencyStore) persist() error {
+	records := make([]*IdempotencyRecord, 0, len(s.records))
+	for _, record := range s.records {
+		if record.Completed {
+			records = append(records, record)
+		}
+	}
+	return s.store.Save(idempotencyCollection, records)
+}
+
+// MIDDLEWARE
+
+// withIdempotency выполняет обработчик один раз для пары (пользователь, Idempotency-Key).
+// Повтор с тем же телом получает сохраненный ответ с заголовком Idempotent-Replayed,
+// повтор с другим телом - 422, параллельный повтор - 409. Сохраняются только успешные
+// ответы, после ошибки запрос можно повторить с тем же ключом. Ключ передается в банк
+func (s *Server) withIdempotency(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+			return
+		}
+
+		userID := getUserID(r.Context())
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Failed to read request body: "+err.Error())
+			return
+		}
+
+		record, err := s.idempotency.Begin(userID, scope, key, idempotencyRequestHash(r, body), time.Now().UTC())
+		switch {
+		case errors.Is(err, ErrIdempotencyInProgress):
+			writeError(w, r, http.StatusConflict, "Idempotency-Key: "+err.Error())
+			return
+		case errors.Is(err, ErrIdempotencyKeyReused):
+			writeError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key: "+err.Error())
+			return
+		case err != nil:
+			writeError(w, r, http.StatusInternalServerError, "Idempotency-Key: "+err.Error())
+			return
+		case record != nil:
+			handlersLog.InfoContext(r.Context(), "Replaying stored response", "idempotency_key", key)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Response)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ctx := context.WithValue(r.Context(), CtxIdempotencyKey, bankIdempotencyKey(userID, scope, key))
+
+		recorder := &idempotencyRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r.WithContext(ctx))
+
+		if recorder.statusCode >= 300 {
+			s.idempotency.Release(userID, scope, key)
+			return
+		}
+		if err := s.idempotency.Complete(userID, scope, key, recorder.statusCode, recorder.body.Bytes()); err != nil {
+			s.idempotency.Release(userID, scope, key)
+			handlersLog.WarnContext(r.Context(), "Failed to store idempotent response", "idempotency_key", key, "error", err)
+		}
+	}
+}
+
+// idempotencyRecorder пропускает ответ клиенту и запоминает его для повторов
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	rec.statusCode = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotencyRequestHash хэш запроса: путь, параметры и тело без учета пробелов в JSON
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		compact.Reset()
+		compact.Write(body)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.Query().Encode())
+	h.Write(compact.Bytes())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyRecordKey ключ записи в хранилище: ключ клиента действует в пределах
+// пользователя и операции
+func idempotencyRecordKey(userID, scope, key string) string {
+	return userID + "|" + scope + "|" + key
+}
+
+// bankIdempotencyKey ключ для банка. Все запросы идут от одной команды,
+// поэтому ключ клиента смешивается с пользователем и операцией
+func bankIdempotencyKey(userID, scope, key string) string {
+	sum := sha256.Sum256([]byte(userID + "|" + scope + "|" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// getIdempotencyKey извлекает ключ для банка из контекста
+func getIdempotencyKey(ctx context.Context) string {
+	if key, ok := ctx.Value(CtxIdempotencyKey).(string); ok {
+		return key
+	}
+	return ""
+}
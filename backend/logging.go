@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Компоненты логирования: уровень каждого задается в LOG_LEVELS
+const (
+	logComponentMain       = "main"
+	logComponentHTTP       = "http"        // входящие запросы (middleware)
+	logComponentHTTPClient = "http_client" // запросы в банки
+	logComponentAggregator = "aggregator"
+	logComponentHandlers   = "handlers"
+	logComponentPayments   = "payments" // расписание, статусы, пакеты, переводы, черновики, политики
+	logComponentAuth       = "auth"     // пользователи, API ключи, домохозяйства, OTP
+	logComponentStorage    = "storage"  // журнал аудита, шифрование, секреты
+)
+
+var (
+	logOutput     slog.Handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactAttr})
+	logLevels                  = make(map[string]*slog.LevelVar)
+	logComponents              = []string{logComponentMain, logComponentHTTP, logComponentHTTPClient, logComponentAggregator, logComponentHandlers, logComponentPayments, logComponentAuth, logComponentStorage}
+
+	mainLog       = newLogger(logComponentMain)
+	httpLog       = newLogger(logComponentHTTP)
+	httpClientLog = newLogger(logComponentHTTPClient)
+	aggregatorLog = newLogger(logComponentAggregator)
+	handlersLog   = newLogger(logComponentHandlers)
+	paymentsLog   = newLogger(logComponentPayments)
+	authLog       = newLogger(logComponentAuth)
+	storageLog    = newLogger(logComponentStorage)
+)
+
+// newLogger логгер компонента со своим уровнем (по умолчанию info)
+func newLogger(component string) *slog.Logger {
+	level, exists := logLevels[component]
+	if !exists {
+		level = new(slog.LevelVar)
+		logLevels[component] = level
+	}
+
+	return slog.New(&componentHandler{
+		next:  logOutput.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		level: level,
+	})
+}
+
+// configureLogging задает уровни: LOG_LEVEL для всех компонентов и LOG_LEVELS
+// вида "http_client=debug,handlers=warn" для отдельных. Стандартный log (сторонние
+// пакеты) пишет через компонент main
+func configureLogging(defaultLevel, componentLevels string) error {
+	level := slog.LevelInfo
+	if defaultLevel != "" {
+		if err := level.UnmarshalText([]byte(defaultLevel)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q (use debug, info, warn or error)", defaultLevel)
+		}
+	}
+	for _, component := range logComponents {
+		logLevels[component].Set(level)
+	}
+
+	for _, item := range strings.Split(componentLevels, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, value, _ := strings.Cut(item, "=")
+		componentLevel, exists := logLevels[strings.TrimSpace(component)]
+		if !exists {
+			return fmt.Errorf("invalid LOG_LEVELS: unknown component %q (use %s)", component, strings.Join(logComponents, ", "))
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+			return fmt.Errorf("invalid LOG_LEVELS: level %q for %s", value, component)
+		}
+		componentLevel.Set(l)
+	}
+
+	slog.SetDefault(mainLog)
+	log.SetFlags(0)
+	return nil
+}
+
+// componentHandler фильтрует записи по уровню компонента и добавляет request_id из контекста
+type componentHandler struct {
+	next  slog.Handler
+	level *slog.LevelVar
+}
+
+// Enabled пропускает записи не ниже уровня компонента
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle добавляет request_id запроса, в рамках которого пишется запись.
+// У записей фоновых задач и запуска request_id нет
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID, ok := ctx.Value(CtxRequestID).(string); ok {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+	}
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs логгер с дополнительными полями
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+// WithGroup логгер с группой полей
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{next: h.next.WithGroup(name), level: h.level}
+}
+
+// REDACTION
+
+// Как маскируется поле, по имени без регистра, "_" и "-" (access_token и accessToken - одно поле)
+const (
+	redactSecret  = iota + 1 // полностью
+	redactAccount            // последние 4 символа
+	redactName               // первая буква
+)
+
+var redactedFields = map[string]int{
+	"token":            redactSecret,
+	"accesstoken":      redactSecret,
+	"refreshtoken":     redactSecret,
+	"idtoken":          redactSecret,
+	"authorization":    redactSecret,
+	"clientsecret":     redactSecret,
+	"secret":           redactSecret,
+	"password":         redactSecret,
+	"apikey":           redactSecret,
+	"otp":              redactSecret,
+	"account":          redactAccount,
+	"accountid":        redactAccount,
+	"accountnumber":    redactAccount,
+	"identification":   redactAccount,
+	"extid":            redactAccount,
+	"iban":             redactAccount,
+	"pan":              redactAccount,
+	"debtoraccount":    redactAccount,
+	"creditoraccount":  redactAccount,
+	"consentid":        redactAccount,
+	"paymentconsentid": redactAccount,
+	"paconsentid":      redactAccount,
+	"xconsentid":       redactAccount,
+	"name":             redactName,
+	"fullname":         redactName,
+	"nickname":         redactName,
+	"ownername":        redactName,
+	"debtorname":       redactName,
+	"creditorname":     redactName,
+	"payeename":        redactName,
+}
+
+// redactAttr маскирует чувствительные поля записи. Поле body (тела запросов и
+// ответов банков) разбирается как JSON и маскируется по полям; не JSON не выводится
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	if mode := redactedFields[normalizeFieldName(attr.Key)]; mode != 0 {
+		return slog.String(attr.Key, redactString(attr.Value.Resolve().String(), mode))
+	}
+
+	if attr.Key == "body" {
+		return slog.Any(attr.Key, redactBody(attr.Value.Resolve()))
+	}
+
+	// Структуры и карты маскируются по вложенным полям
+	if attr.Value.Kind() == slog.KindAny {
+		switch attr.Value.Any().(type) {
+		case error, fmt.Stringer:
+			return attr
+		}
+		data, err := json.Marshal(attr.Value.Any())
+		if err != nil {
+			return attr
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return attr
+		}
+		return slog.Any(attr.Key, redactValue(value))
+	}
+
+	return attr
+}
+
+// redactBody тело запроса или ответа: JSON с маскированными полями или только размер
+func redactBody(value slog.Value) interface{} {
+	var data []byte
+	switch v := value.Any().(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		data = []byte(value.String())
+	}
+	if len(data) == 0 {
+		return ""
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return fmt.Sprintf("[%d bytes, not JSON]", len(data))
+	}
+	return redactValue(parsed)
+}
+
+// redactValue маскирует поля в разобранном JSON
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if mode := redactedFields[normalizeFieldName(key)]; mode != 0 {
+				result[key] = redactAny(item, mode)
+				continue
+			}
+			result[key] = redactValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redactValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// redactAny маскирует значение чувствительного поля любого типа
+func redactAny(value interface{}, mode int) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redactString(v, mode)
+	case nil:
+		return nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = redactAny(item, mode)
+		}
+		return result
+	case map[string]interface{}:
+		// Например, account: {identification, name} - маскируются вложенные поля
+		return redactValue(v)
+	default:
+		return redactString(fmt.Sprint(v), mode)
+	}
+}
+
+// redactString маскирует строку по способу поля
+func redactString(value string, mode int) string {
+	if value == "" {
+		return ""
+	}
+
+	switch mode {
+	case redactAccount:
+		if utf8.RuneCountInString(value) <= 4 {
+			return "****"
+		}
+		runes := []rune(value)
+		return "****" + string(runes[len(runes)-4:])
+	case redactName:
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + "***"
+	default:
+		return "[REDACTED]"
+	}
+}
+
+// normalizeFieldName имя поля без регистра и разделителей
+func normalizeFieldName(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
@@ -1,31 +1,89 @@
 package main
 
 import (
-	"log"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
 )
 
 func main() {
-	log.Println("Starting FinHelper Banking Aggregator")
+	// .env читается до настройки логирования: LOG_LEVEL и LOG_LEVELS могут быть заданы в нем
+	_ = godotenv.Load()
+	if err := configureLogging(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_LEVELS")); err != nil {
+		mainLog.Error("Failed to configure logging", "error", err)
+		os.Exit(1)
+	}
+
+	// Управление хранилищем секретов: backend keystore list | set <name> | delete <name>
+	if len(os.Args) > 1 && os.Args[1] == "keystore" {
+		if err := runKeystoreCommand(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			mainLog.Error("Keystore command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	mainLog.Info("Starting FinHelper Banking Aggregator")
 
 	// Загружаем конфигурацию (включая .env файл)
 	config, err := LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		mainLog.Error("Failed to load config", "error", err)
+		os.Exit(1)
 	}
 
-	log.Printf(" Configuration loaded")
-	log.Printf(" Team ID: %s", config.TeamID)
-	log.Printf(" Configured banks: %d", len(config.Banks))
+	tenants := make(map[string]string, len(config.Tenants))
+	for _, tenant := range config.Tenants {
+		codes := make([]string, 0, len(tenant.Banks))
+		for _, bank := range tenant.Banks {
+			codes = append(codes, bank.Code)
+		}
+		tenants[tenant.ID] = strings.Join(codes, ",")
+	}
+	banks := make(map[string]string, len(config.Banks))
 	for _, bank := range config.Banks {
-		log.Printf("    - %s: %s", bank.Code, bank.BaseURL)
+		banks[bank.Code] = bank.BaseURL
 	}
-	log.Printf(" CORS Origin: %s", config.CORSOrigin)
-	log.Printf(" Port: %s", config.Port)
+	mainLog.Info("Configuration loaded",
+		"tenants", tenants,
+		"default_tenant", config.DefaultTenant,
+		"banks", banks,
+		"secret_sources", config.Secrets.Providers(),
+		"secrets_reload_interval", config.SecretsReloadInterval.String(),
+		"cors_origin", config.CORSOrigin,
+		"port", config.Port,
+	)
 
 	// Создаем HTTP сервер
-	server := NewServer(config)
-	
+	server, err := NewServer(config)
+	if err != nil {
+		mainLog.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
+
+	// Данные, записанные открыто или старым мастер-ключом, перешифровываются до приема запросов
+	if len(config.EncryptionKeys) > 0 {
+		report, err := server.encryption.Run()
+		if err != nil {
+			mainLog.Error("Failed to re-encrypt data", "error", err)
+			os.Exit(1)
+		}
+		mainLog.Info("Encryption at rest enabled", "key_id", report.ActiveKeyID, "keys", len(config.EncryptionKeys),
+			"reencrypted", report.Reencrypted, "checked", report.Checked)
+		for _, failure := range report.Failed {
+			storageLog.Warn("Failed to re-encrypt data", "error", failure)
+		}
+		if config.MigratePlaintext {
+			// Миграция однократная: после перешифрования открытые файлы снова не принимаются
+			server.encryption.enc.AllowPlaintext(false)
+			storageLog.Warn("Plaintext data migrated, remove ENCRYPTION_MIGRATE_PLAINTEXT", "plaintext", report.Before["plaintext"], "failed", len(report.Failed))
+		}
+	} else {
+		mainLog.Warn("ENCRYPTION_KEYS is not set, data is stored unencrypted", "data_dir", config.DataDir)
+	}
+
 	// Создаем роутер
 	mux := http.NewServeMux()
 
@@ -33,6 +91,29 @@ func main() {
 	mux.HandleFunc("GET /healthz", server.handleHealth)
 	mux.HandleFunc("GET /health", server.handleHealth)
 
+	// Auth endpoints
+	mux.HandleFunc("POST /api/auth/register", server.handleRegister)
+	mux.HandleFunc("POST /api/auth/login", server.handleLogin)
+	mux.HandleFunc("POST /api/auth/refresh", server.handleRefreshToken)
+	mux.HandleFunc("POST /api/auth/logout", server.handleLogout)
+	mux.HandleFunc("GET /api/auth/me", server.handleGetMe)
+	mux.HandleFunc("GET /api/api-keys", server.handleListAPIKeys)
+	mux.HandleFunc("POST /api/api-keys", server.handleCreateAPIKey)
+	mux.HandleFunc("DELETE /api/api-keys/{id}", server.handleRevokeAPIKey)
+
+	// Household endpoints (совместный доступ к счетам)
+	mux.HandleFunc("GET /api/household", server.handleGetHousehold)
+	mux.HandleFunc("POST /api/household", server.handleCreateHousehold)
+	mux.HandleFunc("DELETE /api/household", server.handleLeaveHousehold)
+	mux.HandleFunc("GET /api/household/invitations", server.handleListInvitations)
+	mux.HandleFunc("POST /api/household/invitations", server.handleInviteMember)
+	mux.HandleFunc("POST /api/household/invitations/{id}/accept", server.handleAcceptInvitation)
+	mux.HandleFunc("POST /api/household/invitations/{id}/decline", server.handleDeclineInvitation)
+	mux.HandleFunc("DELETE /api/household/invitations/{id}", server.handleRevokeInvitation)
+	mux.HandleFunc("DELETE /api/household/members/{userId}", server.handleRemoveMember)
+	mux.HandleFunc("POST /api/household/shares", server.handleShareAccount)
+	mux.HandleFunc("DELETE /api/household/shares/{id}", server.handleUnshareAccount)
+
 	// Consent management endpoints
 	mux.HandleFunc("POST /api/consents", server.handleCreateConsent)
 	mux.HandleFunc("GET /api/consents/{id}", server.handleGetConsentStatus)
@@ -45,17 +126,109 @@ func main() {
 	mux.HandleFunc("GET /api/accounts", server.handleGetAccounts)
 	mux.HandleFunc("GET /api/accounts/{id}/balances", server.handleGetAccountBalances)
 	mux.HandleFunc("GET /api/accounts/{id}/transactions", server.handleGetAccountTransactions)
+	mux.HandleFunc("GET /api/accounts/{id}/balance-history", server.handleGetBalanceHistory)
 
 	// Transaction endpoints
 	mux.HandleFunc("GET /api/transactions", server.handleGetTransactions)
 
+	// Transaction annotation endpoints (теги, заметки, вложения)
+	mux.HandleFunc("GET /api/tags", server.handleGetTags)
+	mux.HandleFunc("GET /api/transactions/{bank}/{id}/annotation", server.handleGetAnnotation)
+	mux.HandleFunc("PUT /api/transactions/{bank}/{id}/annotation", server.handleSetAnnotation)
+	mux.HandleFunc("DELETE /api/transactions/{bank}/{id}/annotation", server.handleDeleteAnnotation)
+	mux.HandleFunc("POST /api/transactions/{bank}/{id}/attachments", server.handleUploadAttachment)
+	mux.HandleFunc("GET /api/transactions/{bank}/{id}/attachments/{attachmentId}", server.handleGetAttachment)
+	mux.HandleFunc("DELETE /api/transactions/{bank}/{id}/attachments/{attachmentId}", server.handleDeleteAttachment)
+
+	// Transaction split endpoints
+	mux.HandleFunc("GET /api/transactions/{bank}/{id}/splits", server.handleGetSplit)
+	mux.HandleFunc("PUT /api/transactions/{bank}/{id}/splits", server.handleSetSplit)
+	mux.HandleFunc("DELETE /api/transactions/{bank}/{id}/splits", server.handleDeleteSplit)
+
+	// Savings goal endpoints
+	mux.HandleFunc("GET /api/goals", server.handleListGoals)
+	mux.HandleFunc("POST /api/goals", server.handleCreateGoal)
+	mux.HandleFunc("GET /api/goals/{id}", server.handleGetGoal)
+	mux.HandleFunc("PUT /api/goals/{id}", server.handleUpdateGoal)
+	mux.HandleFunc("DELETE /api/goals/{id}", server.handleDeleteGoal)
+
+	// Analytics endpoints
+	mux.HandleFunc("GET /api/analytics/categories", server.handleGetCategoryAnalytics)
+
+	// Manual account endpoints
+	mux.HandleFunc("GET /api/manual-accounts", server.handleListManualAccounts)
+	mux.HandleFunc("POST /api/manual-accounts", server.handleCreateManualAccount)
+	mux.HandleFunc("GET /api/manual-accounts/{id}", server.handleGetManualAccount)
+	mux.HandleFunc("PUT /api/manual-accounts/{id}", server.handleUpdateManualAccount)
+	mux.HandleFunc("DELETE /api/manual-accounts/{id}", server.handleDeleteManualAccount)
+	mux.HandleFunc("POST /api/manual-accounts/{id}/snapshots", server.handleAddManualSnapshot)
+	mux.HandleFunc("POST /api/manual-accounts/{id}/transactions", server.handleAddManualTransaction)
+	mux.HandleFunc("DELETE /api/manual-accounts/{id}/transactions/{txId}", server.handleDeleteManualTransaction)
+
 	// Payment consent endpoints
 	mux.HandleFunc("POST /api/payment-consents", server.handleCreatePaymentConsent)
 	mux.HandleFunc("GET /api/payment-consents/{id}", server.handleGetPaymentConsentStatus)
 
 	// Payment endpoints
-	mux.HandleFunc("POST /api/payments", server.handleCreatePayment)
+	mux.HandleFunc("GET /api/payments", server.handleListPayments)
+	mux.HandleFunc("POST /api/payments", server.withIdempotency(IdempotencyScopePayments, server.handleCreatePayment))
 	mux.HandleFunc("GET /api/payments/{id}", server.handleGetPaymentStatus)
+	mux.HandleFunc("POST /api/payments/{id}/confirm", server.handleConfirmPayment)
+	mux.HandleFunc("POST /api/payments/{id}/resend-code", server.handleResendPaymentCode)
+	mux.HandleFunc("GET /api/payments/drafts", server.handleListPaymentDrafts)
+	mux.HandleFunc("GET /api/payments/drafts/{id}", server.handleGetPaymentDraft)
+	mux.HandleFunc("GET /api/payments/batch", server.handleListPaymentBatches)
+	mux.HandleFunc("POST /api/payments/batch", server.withIdempotency(IdempotencyScopeBatch, server.handleCreatePaymentBatch))
+	mux.HandleFunc("GET /api/payments/batch/{id}", server.handleGetPaymentBatch)
+
+	// Payee and payment template endpoints
+	mux.HandleFunc("GET /api/payees", server.handleListPayees)
+	mux.HandleFunc("POST /api/payees", server.handleCreatePayee)
+	mux.HandleFunc("GET /api/payees/{id}", server.handleGetPayee)
+	mux.HandleFunc("PUT /api/payees/{id}", server.handleUpdatePayee)
+	mux.HandleFunc("DELETE /api/payees/{id}", server.handleDeletePayee)
+	mux.HandleFunc("GET /api/payment-templates", server.handleListTemplates)
+	mux.HandleFunc("POST /api/payment-templates", server.handleCreateTemplate)
+	mux.HandleFunc("GET /api/payment-templates/{id}", server.handleGetTemplate)
+	mux.HandleFunc("PUT /api/payment-templates/{id}", server.handleUpdateTemplate)
+	mux.HandleFunc("DELETE /api/payment-templates/{id}", server.handleDeleteTemplate)
+
+	// Admin endpoints (журнал аудита, шифрование, приглашения, ключи команд)
+	mux.HandleFunc("GET /api/admin/audit", server.handleQueryAudit)
+	mux.HandleFunc("GET /api/admin/audit/export", server.handleExportAudit)
+	mux.HandleFunc("GET /api/admin/audit/verify", server.handleVerifyAudit)
+	mux.HandleFunc("GET /api/admin/encryption", server.handleGetEncryptionStatus)
+	mux.HandleFunc("POST /api/admin/encryption/reencrypt", server.handleReencrypt)
+	mux.HandleFunc("GET /api/admin/invites", server.handleListRegistrationInvites)
+	mux.HandleFunc("POST /api/admin/invites", server.handleCreateRegistrationInvite)
+	mux.HandleFunc("DELETE /api/admin/invites/{id}", server.handleRevokeRegistrationInvite)
+	mux.HandleFunc("GET /api/admin/api-keys", server.handleListTenantAPIKeys)
+	mux.HandleFunc("POST /api/admin/api-keys", server.handleCreateTenantAPIKey)
+	mux.HandleFunc("DELETE /api/admin/api-keys/{id}", server.handleRevokeTenantAPIKey)
+
+	// Payment policy endpoints
+	mux.HandleFunc("GET /api/policies", server.handleGetPolicy)
+	mux.HandleFunc("PUT /api/policies", server.handleSetPolicy)
+	mux.HandleFunc("GET /api/policies/evaluations", server.handleListPolicyEvaluations)
+
+	// Scheduled payment endpoints
+	mux.HandleFunc("GET /api/scheduled-payments", server.handleListScheduledPayments)
+	mux.HandleFunc("POST /api/scheduled-payments", server.handleCreateScheduledPayment)
+	mux.HandleFunc("GET /api/scheduled-payments/{id}", server.handleGetScheduledPayment)
+	mux.HandleFunc("POST /api/scheduled-payments/{id}/pause", server.handlePauseScheduledPayment)
+	mux.HandleFunc("POST /api/scheduled-payments/{id}/resume", server.handleResumeScheduledPayment)
+	mux.HandleFunc("POST /api/scheduled-payments/{id}/cancel", server.handleCancelScheduledPayment)
+
+	// TOTP endpoints (подтверждение платежей)
+	mux.HandleFunc("GET /api/otp/totp", server.handleGetTOTP)
+	mux.HandleFunc("POST /api/otp/totp", server.handleEnrollTOTP)
+	mux.HandleFunc("POST /api/otp/totp/activate", server.handleActivateTOTP)
+	mux.HandleFunc("DELETE /api/otp/totp", server.handleRemoveTOTP)
+
+	// Transfer endpoints (переводы между своими счетами)
+	mux.HandleFunc("GET /api/transfers", server.handleListTransfers)
+	mux.HandleFunc("POST /api/transfers", server.withIdempotency(IdempotencyScopeTransfers, server.handleCreateTransfer))
+	mux.HandleFunc("GET /api/transfers/{id}", server.handleGetTransfer)
 
 	// Product agreement consent endpoints
 	mux.HandleFunc("POST /api/pa-consents", server.handleCreatePAConsent)
@@ -63,57 +236,41 @@ func main() {
 
 	// Product endpoints
 	mux.HandleFunc("GET /api/products", server.handleGetProducts)
+	mux.HandleFunc("GET /api/products/catalog", server.handleGetProductCatalog)
 
 	// Agreement endpoints
-	mux.HandleFunc("POST /api/agreements", server.handleOpenAgreement)
+	mux.HandleFunc("POST /api/agreements", server.withIdempotency(IdempotencyScopeAgreements, server.handleOpenAgreement))
 	mux.HandleFunc("GET /api/agreements", server.handleGetAgreements)
 	mux.HandleFunc("GET /api/agreements/{id}", server.handleGetAgreementDetails)
 	mux.HandleFunc("DELETE /api/agreements/{id}", server.handleCloseAgreement)
+	mux.HandleFunc("GET /api/agreements/{id}/schedule", server.handleGetAgreementSchedule)
+	mux.HandleFunc("GET /api/agreements/events", server.handleGetAgreementEvents)
+	mux.HandleFunc("POST /api/agreements/events/{id}/read", server.handleMarkAgreementEventRead)
+
+	// Calculator endpoints
+	mux.HandleFunc("POST /api/calculator/deposit", server.handleCalculateDeposit)
+	mux.HandleFunc("POST /api/calculator/loan", server.handleCalculateLoan)
+
+	// Запускаем исполнение платежей по расписанию и отслеживание статусов
+	server.scheduler.Start()
+	server.tracker.Start()
+	server.batches.Start()
+	server.transfers.Start()
+	mainLog.Info("Payment scheduler and status tracker started", "interval", config.SchedulerInterval.String())
+
+	// Обновленные секреты (смонтированные файлы, хранилище) подхватываются без перезапуска
+	config.Secrets.Start(config.SecretsReloadInterval, server.aggregator.ReloadSecrets)
 
 	// Применяем middleware в правильном порядке
-	handler := ApplyMiddleware(mux, config.CORSOrigin)
+	// Аутентификация внутри CORS: preflight запросы проходят без токена
+	handler := ApplyMiddleware(server.withAuth(mux), config.CORSOrigin)
 
 	// Запускаем сервер
 	addr := ":" + config.Port
-	log.Printf(" Server listening on %s", addr)
-	log.Println(" Ready to accept requests")
-	log.Println()
-	log.Println("Available endpoints:")
-	log.Println(" GET  /healthz")
-	log.Println()
-	log.Println("Account Consents:")
-	log.Println(" POST /api/consents?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/consents/{id}?bank=<bank>")
-	log.Println(" DELETE /api/consents/{id}?bank=<bank>")
-	log.Println()
-	log.Println("Accounts & Transactions:")
-	log.Println(" POST /api/banks/{bank}/connect?user=<user>")
-	log.Println(" GET  /api/accounts?user=<user>&bank=<bank>")
-	log.Println(" GET  /api/accounts/{id}/balances?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/accounts/{id}/transactions?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/transactions?user=<user>&bank=<bank>&from=<date>&to=<date>")
-	log.Println()
-	log.Println("Payment Consents:")
-	log.Println(" POST /api/payment-consents?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/payment-consents/{id}?bank=<bank>")
-	log.Println()
-	log.Println("Payments:")
-	log.Println(" POST /api/payments?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/payments/{id}?bank=<bank>&user=<user>")
-	log.Println()
-	log.Println("Product Agreement Consents:")
-	log.Println(" POST /api/pa-consents?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/pa-consents/{id}?bank=<bank>")
-	log.Println()
-	log.Println("Products & Agreements:")
-	log.Println(" GET  /api/products?bank=<bank>&user=<user>&type=<DEPOSIT|LOAN|CARD>")
-	log.Println(" POST /api/agreements?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/agreements?bank=<bank>&user=<user>")
-	log.Println(" GET  /api/agreements/{id}?bank=<bank>&user=<user>")
-	log.Println(" DELETE /api/agreements/{id}?bank=<bank>&user=<user>")
-	log.Println()
+	mainLog.Info("Server listening", "addr", addr)
 
 	if err := http.ListenAndServe(addr, handler); err != nil {
-		log.Fatalf("Server failed: %v", err)
+		mainLog.Error("Server failed", "error", err)
+		os.Exit(1)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ManualBankCode псевдо-банк для счетов, которые пользователь ведет вручную
+const ManualBankCode = "manual"
+
+// Типы ручных счетов
+const (
+	ManualAccountCash       = "CASH"
+	ManualAccountRealEstate = "REAL_ESTATE"
+	ManualAccountVehicle    = "VEHICLE"
+	ManualAccountCrypto     = "CRYPTO"
+	ManualAccountOther      = "OTHER"
+)
+
+// manualAccountsCollection имя коллекции в хранилище
+const manualAccountsCollection = "manual_accounts"
+
+// ManualAccount счет вне банковских API (наличные, недвижимость, авто, крипта)
+type ManualAccount struct {
+	ID           string              `json:"id"`
+	UserID       string              `json:"user_id"`
+	Name         string              `json:"name"`
+	Type         string              `json:"type"`
+	Currency     string              `json:"currency"`
+	Snapshots    []BalanceSnapshot   `json:"snapshots"`
+	Transactions []ManualTransaction `json:"transactions"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// BalanceSnapshot баланс ручного счета, введенный пользователем на дату
+type BalanceSnapshot struct {
+	Date    time.Time `json:"date"`
+	Balance float64   `json:"balance"`
+	Note    string    `json:"note,omitempty"`
+}
+
+// ManualTransaction операция по ручному счету (сумма со знаком: минус - расход)
+type ManualTransaction struct {
+	ID          string    `json:"id"`
+	Date        time.Time `json:"date"`
+	Amount      float64   `json:"amount"`
+	Merchant    string    `json:"merchant,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// ManualAccountInput тело запроса на создание/изменение ручного счета
+type ManualAccountInput struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Currency string   `json:"currency"`
+	Balance  *float64 `json:"balance,omitempty"` // начальный снимок при создании
+}
+
+// CurrentBalance возвращает последний снимок плюс операции после него
+func (m *ManualAccount) CurrentBalance() float64 {
+	var balance float64
+	var since time.Time
+
+	if len(m.Snapshots) > 0 {
+		last := m.Snapshots[len(m.Snapshots)-1]
+		balance = last.Balance
+		since = last.Date
+	}
+
+	for _, tx := range m.Transactions {
+		if tx.Date.After(since) {
+			balance += tx.Amount
+		}
+	}
+
+	return roundMoney(balance)
+}
+
+// ToLegacyAccount конвертирует ручной счет в упрощенную модель для фронтенда
+func (m *ManualAccount) ToLegacyAccount() Account {
+	return Account{
+		ID:       m.ID,
+		Bank:     ManualBankCode,
+		Type:     m.Type,
+		Currency: m.Currency,
+		Balance:  m.CurrentBalance(),
+		Nickname: m.Name,
+	}
+}
+
+// ToBalanceDetails представляет баланс ручного счета в формате банковского API
+func (m *ManualAccount) ToBalanceDetails() []BalanceDetail {
+	balance := m.CurrentBalance()
+
+	detail := BalanceDetail{
+		AccountID:            m.ID,
+		CreditDebitIndicator: "Credit",
+		Type:                 "InterimAvailable",
+		DateTime:             m.UpdatedAt.Format(time.RFC3339),
+	}
+	if balance < 0 {
+		detail.CreditDebitIndicator = "Debit"
+		balance = -balance
+	}
+	detail.Amount.Amount = fmt.Sprintf("%.2f", balance)
+	detail.Amount.Currency = m.Currency
+
+	return []BalanceDetail{detail}
+}
+
+// ToLegacyTransaction конвертирует ручную операцию в упрощенную модель
+func (tx *ManualTransaction) ToLegacyTransaction(currency string) Transaction {
+	return Transaction{
+		ID:          tx.ID,
+		Date:        tx.Date,
+		Amount:      tx.Amount,
+		Currency:    currency,
+		Merchant:    tx.Merchant,
+		Category:    tx.Category,
+		Description: tx.Description,
+		Bank:        ManualBankCode,
+	}
+}
+
+// clone возвращает глубокую копию счета
+func (m *ManualAccount) clone() ManualAccount {
+	c := *m
+	c.Snapshots = append([]BalanceSnapshot{}, m.Snapshots...)
+	c.Transactions = append([]ManualTransaction{}, m.Transactions...)
+	return c
+}
+
+// ManualAccountStore хранит ручные счета пользователей
+type ManualAccountStore struct {
+	store *JSONStore
+
+	mu       sync.RWMutex
+	accounts map[string]*ManualAccount // key: account ID
+}
+
+// NewManualAccountStore загружает ручные счета из хранилища
+func NewManualAccountStore(store *JSONStore) (*ManualAccountStore, error) {
+	s := &ManualAccountStore{
+		store:    store,
+		accounts: make(map[string]*ManualAccount),
+	}
+
+	var accounts []*ManualAccount
+	if err := store.Load(manualAccountsCollection, &accounts); err != nil {
+		return nil, fmt.Errorf("load manual accounts: %w", err)
+	}
+	for _, account := range accounts {
+		s.accounts[account.ID] = account
+	}
+
+	return s, nil
+}
+
+// List возвращает ручные счета пользователя в порядке создания
+func (s *ManualAccountStore) List(userID string) []ManualAccount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]ManualAccount, 0)
+	for _, account := range s.accounts {
+		if account.UserID == userID {
+			result = append(result, account.clone())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// Get возвращает ручной счет пользователя
+func (s *ManualAccountStore) Get(userID, accountID string) (*ManualAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, err := s.find(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := account.clone()
+	return &c, nil
+}
+
+// Create создает ручной счет, опционально с начальным снимком баланса
+func (s *ManualAccountStore) Create(userID string, input ManualAccountInput) (*ManualAccount, error) {
+	if err := input.validate(true); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	account := &ManualAccount{
+		ID:           "manual-" + uuid.New().String(),
+		UserID:       userID,
+		Name:         strings.TrimSpace(input.Name),
+		Type:         strings.ToUpper(input.Type),
+		Currency:     strings.ToUpper(input.Currency),
+		Snapshots:    []BalanceSnapshot{},
+		Transactions: []ManualTransaction{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if input.Balance != nil {
+		account.Snapshots = append(account.Snapshots, BalanceSnapshot{
+			Date:    now,
+			Balance: roundMoney(*input.Balance),
+			Note:    "initial balance",
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[account.ID] = account
+	if err := s.persist(); err != nil {
+		delete(s.accounts, account.ID)
+		return nil, err
+	}
+
+	c := account.clone()
+	return &c, nil
+}
+
+// Update изменяет название, тип или валюту ручного счета
+func (s *ManualAccountStore) Update(userID, accountID string, input ManualAccountInput) (*ManualAccount, error) {
+	if err := input.validate(false); err != nil {
+		return nil, err
+	}
+
+	return s.mutate(userID, accountID, func(account *ManualAccount) error {
+		if name := strings.TrimSpace(input.Name); name != "" {
+			account.Name = name
+		}
+		if input.Type != "" {
+			account.Type = strings.ToUpper(input.Type)
+		}
+		if input.Currency != "" {
+			account.Currency = strings.ToUpper(input.Currency)
+		}
+		return nil
+	})
+}
+
+// Delete удаляет ручной счет
+func (s *ManualAccountStore) Delete(userID, accountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.find(userID, accountID)
+	if err != nil {
+		return err
+	}
+
+	delete(s.accounts, accountID)
+	if err := s.persist(); err != nil {
+		s.accounts[accountID] = account
+		return err
+	}
+
+	return nil
+}
+
+// AddSnapshot добавляет снимок баланса (снимки хранятся по возрастанию даты)
+func (s *ManualAccountStore) AddSnapshot(userID, accountID string, snapshot BalanceSnapshot) (*ManualAccount, error) {
+	if snapshot.Date.IsZero() {
+		snapshot.Date = time.Now().UTC()
+	}
+	snapshot.Balance = roundMoney(snapshot.Balance)
+
+	return s.mutate(userID, accountID, func(account *ManualAccount) error {
+		account.Snapshots = append(account.Snapshots, snapshot)
+		sort.SliceStable(account.Snapshots, func(i, j int) bool {
+			return account.Snapshots[i].Date.Before(account.Snapshots[j].Date)
+		})
+		return nil
+	})
+}
+
+// AddTransaction добавляет ручную операцию
+func (s *ManualAccountStore) AddTransaction(userID, accountID string, tx ManualTransaction) (*ManualAccount, error) {
+	if tx.Amount == 0 {
+		return nil, fmt.Errorf("%w: amount must be non-zero", ErrInvalidInput)
+	}
+	if tx.Date.IsZero() {
+		tx.Date = time.Now().UTC()
+	}
+	tx.ID = "manual-tx-" + uuid.New().String()
+	tx.Amount = roundMoney(tx.Amount)
+
+	return s.mutate(userID, accountID, func(account *ManualAccount) error {
+		account.Transactions = append(account.Transactions, tx)
+		sort.SliceStable(account.Transactions, func(i, j int) bool {
+			return account.Transactions[i].Date.Before(account.Transactions[j].Date)
+		})
+		return nil
+	})
+}
+
+// DeleteTransaction удаляет ручную операцию
+func (s *ManualAccountStore) DeleteTransaction(userID, accountID, transactionID string) (*ManualAccount, error) {
+	return s.mutate(userID, accountID, func(account *ManualAccount) error {
+		for i, tx := range account.Transactions {
+			if tx.ID == transactionID {
+				account.Transactions = append(account.Transactions[:i], account.Transactions[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("transaction %s: %w", transactionID, ErrNotFound)
+	})
+}
+
+// LegacyAccounts возвращает ручные счета пользователя в формате Account
+func (s *ManualAccountStore) LegacyAccounts(userID string) []Account {
+	accounts := s.List(userID)
+
+	result := make([]Account, 0, len(accounts))
+	for i := range accounts {
+		result = append(result, accounts[i].ToLegacyAccount())
+	}
+
+	return result
+}
+
+// Transactions возвращает ручные операции пользователя за период
+func (s *ManualAccountStore) Transactions(userID, accountID string, from, to *time.Time) []Transaction {
+	var result []Transaction
+
+	for _, account := range s.List(userID) {
+		if accountID != "" && account.ID != accountID {
+			continue
+		}
+		for _, tx := range account.Transactions {
+			if from != nil && tx.Date.Before(*from) {
+				continue
+			}
+			if to != nil && tx.Date.After(*to) {
+				continue
+			}
+			result = append(result, tx.ToLegacyTransaction(account.Currency))
+		}
+	}
+
+	return result
+}
+
+// mutate применяет изменение к счету и сохраняет коллекцию; при ошибке записи изменение откатывается
+func (s *ManualAccountStore) mutate(userID, accountID string, fn func(*ManualAccount) error) (*ManualAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, err := s.find(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := account.clone()
+	if err := fn(account); err != nil {
+		*account = backup
+		return nil, err
+	}
+	account.UpdatedAt = time.Now().UTC()
+
+	if err := s.persist(); err != nil {
+		*account = backup
+		return nil, err
+	}
+
+	c := account.clone()
+	return &c, nil
+}
+
+// find ищет счет пользователя (вызывается под блокировкой)
+func (s *ManualAccountStore) find(userID, accountID string) (*ManualAccount, error) {
+	account, exists := s.accounts[accountID]
+	if !exists || account.UserID != userID {
+		return nil, fmt.Errorf("manual account %s: %w", accountID, ErrNotFound)
+	}
+	return account, nil
+}
+
+// persist сохраняет все ручные счета (вызывается под блокировкой)
+func (s *ManualAccountStore) persist() error {
+	accounts := make([]*ManualAccount, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+
+	return s.store.Save(manualAccountsCollection, accounts)
+}
+
+// validate проверяет поля ручного счета (при создании обязательны все поля)
+func (in *ManualAccountInput) validate(create bool) error {
+	if create && strings.TrimSpace(in.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if create && in.Currency == "" {
+		return fmt.Errorf("%w: currency is required", ErrInvalidInput)
+	}
+	if in.Currency != "" && len(in.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrInvalidInput)
+	}
+
+	switch strings.ToUpper(in.Type) {
+	case ManualAccountCash, ManualAccountRealEstate, ManualAccountVehicle, ManualAccountCrypto, ManualAccountOther:
+	case "":
+		if create {
+			return fmt.Errorf("%w: type is required", ErrInvalidInput)
+		}
+	default:
+		return fmt.Errorf("%w: unknown account type %q", ErrInvalidInput, in.Type)
+	}
+
+	return nil
+}
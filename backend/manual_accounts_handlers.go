@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// MANUAL ACCOUNT ENDPOINTS
+
+// handleListManualAccounts возвращает ручные счета пользователя
+// GET /api/manual-accounts
+func (s *Server) handleListManualAccounts(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.manualAccounts.List(userID))
+}
+
+// handleCreateManualAccount создает ручной счет
+// POST /api/manual-accounts
+func (s *Server) handleCreateManualAccount(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input ManualAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	account, err := s.manualAccounts.Create(userID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create manual account", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create manual account: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// handleGetManualAccount возвращает ручной счет
+// GET /api/manual-accounts/{id}
+func (s *Server) handleGetManualAccount(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	account, err := s.manualAccounts.Get(userID, accountID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get manual account: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
+
+// handleUpdateManualAccount изменяет название, тип или валюту ручного счета
+// PUT /api/manual-accounts/{id}
+func (s *Server) handleUpdateManualAccount(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input ManualAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	account, err := s.manualAccounts.Update(userID, accountID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to update manual account", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to update manual account: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
+
+// handleDeleteManualAccount удаляет ручной счет
+// DELETE /api/manual-accounts/{id}
+func (s *Server) handleDeleteManualAccount(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.manualAccounts.Delete(userID, accountID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete manual account", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete manual account: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Manual account deleted successfully",
+	})
+}
+
+// handleAddManualSnapshot добавляет снимок баланса ручного счета
+// POST /api/manual-accounts/{id}/snapshots
+func (s *Server) handleAddManualSnapshot(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var snapshot BalanceSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	account, err := s.manualAccounts.AddSnapshot(userID, accountID, snapshot)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to add balance snapshot", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to add balance snapshot: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// handleAddManualTransaction добавляет операцию по ручному счету
+// POST /api/manual-accounts/{id}/transactions
+func (s *Server) handleAddManualTransaction(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var tx ManualTransaction
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	account, err := s.manualAccounts.AddTransaction(userID, accountID, tx)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to add manual transaction", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to add manual transaction: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// handleDeleteManualTransaction удаляет операцию по ручному счету
+// DELETE /api/manual-accounts/{id}/transactions/{txId}
+func (s *Server) handleDeleteManualTransaction(w http.ResponseWriter, r *http.Request) {
+	accountID := r.PathValue("id")
+	transactionID := r.PathValue("txId")
+	if accountID == "" || transactionID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing account or transaction ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	account, err := s.manualAccounts.DeleteTransaction(userID, accountID, transactionID)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete manual transaction", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete manual transaction: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
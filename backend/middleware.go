@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"runtime/debug"
 	"strings"
@@ -18,6 +17,14 @@ type ContextKey string
 const (
 	// CtxRequestID ключ для Request ID в контексте
 	CtxRequestID ContextKey = "requestID"
+	// CtxIdempotencyKey ключ идемпотентности для банка
+	CtxIdempotencyKey ContextKey = "idempotencyKey"
+	// CtxUserID ключ для ID аутентифицированного пользователя
+	CtxUserID ContextKey = "userID"
+	// CtxAPIKeyID ключ для ID API ключа, если запрос аутентифицирован им
+	CtxAPIKeyID ContextKey = "apiKeyID"
+	// CtxTenantID ключ для арендатора (команды) аутентифицированного пользователя
+	CtxTenantID ContextKey = "tenantID"
 )
 
 // MIDDLEWARE КОМПОЗИЦИЯ
@@ -45,7 +52,7 @@ func withRecovery(next http.Handler) http.Handler {
 				requestID := getRequestID(r.Context())
 				
 				stack := debug.Stack()
-				log.Printf("[%s] 🚨 PANIC RECOVERED: %v\n%s", requestID, err, string(stack))
+				httpLog.ErrorContext(r.Context(), "Panic recovered", "panic", fmt.Sprint(err), "stack", string(stack))
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -83,9 +90,6 @@ func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		// Берем request ID из КОНТЕКСТА
-		requestID := getRequestID(r.Context())
-
 		// Wrapper для захвата status code
 		wrapped := &responseWriter{
 			ResponseWriter: w,
@@ -96,16 +100,15 @@ func withLogging(next http.Handler) http.Handler {
 		authHeader := r.Header.Get("Authorization")
 		maskedAuth := maskBearer(authHeader)
 
-		log.Printf("[%s] → %s %s | Auth: %s", 
-			requestID, r.Method, r.URL.Path, maskedAuth)
+		httpLog.DebugContext(r.Context(), "Request started", "method", r.Method, "path", r.URL.Path, "auth", maskedAuth)
 
 		// Выполняем запрос
 		next.ServeHTTP(wrapped, r)
 
 		// Логируем результат
 		duration := time.Since(start)
-		log.Printf("[%s] ← %s %s | Status: %d | Duration: %v",
-			requestID, r.Method, r.URL.Path, wrapped.statusCode, duration)
+		httpLog.InfoContext(r.Context(), "Request completed", "method", r.Method, "path", r.URL.Path,
+			"status", wrapped.statusCode, "duration_ms", duration.Milliseconds())
 	})
 }
 
@@ -131,11 +134,11 @@ func withCORS(next http.Handler, allowedOrigin string) http.Handler {
 		
 		// Разрешаем все необходимые заголовки
 		w.Header().Set("Access-Control-Allow-Headers", 
-			"Content-Type, X-Request-Id, X-Consent-Id, Authorization")
+			"Content-Type, X-Request-Id, X-Consent-Id, Authorization, Idempotency-Key")
 		
 		// Разрешаем клиенту читать заголовки ответа
 		w.Header().Set("Access-Control-Expose-Headers", 
-			"X-Request-Id, X-Consent-Id")
+			"X-Request-Id, X-Consent-Id, Idempotent-Replayed")
 
 		// Обрабатываем preflight запросы
 		if r.Method == http.MethodOptions {
@@ -157,6 +160,30 @@ func getRequestID(ctx context.Context) string {
 	return "unknown"
 }
 
+// getUserID извлекает ID пользователя, которого аутентифицировал withAuth
+func getUserID(ctx context.Context) string {
+	if userID, ok := ctx.Value(CtxUserID).(string); ok {
+		return userID
+	}
+	return ""
+}
+
+// getAPIKeyID извлекает ID API ключа, которым аутентифицирован запрос
+func getAPIKeyID(ctx context.Context) string {
+	if keyID, ok := ctx.Value(CtxAPIKeyID).(string); ok {
+		return keyID
+	}
+	return ""
+}
+
+// getTenantID извлекает арендатора, которого определил withAuth
+func getTenantID(ctx context.Context) string {
+	if tenantID, ok := ctx.Value(CtxTenantID).(string); ok {
+		return tenantID
+	}
+	return ""
+}
+
 // maskBearer маскирует Bearer токены для безопасного логирования
 func maskBearer(value string) string {
 	if value == "" {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -205,13 +206,15 @@ type TransactionsWrapper struct {
 
 // Account упрощенная модель счета для фронтенда
 type Account struct {
-	ID       string  `json:"id"`
-	ExtID    string  `json:"ext_id,omitempty"`
-	Bank     string  `json:"bank"`
-	Type     string  `json:"type"`
-	Currency string  `json:"currency"`
-	Balance  float64 `json:"balance"`
-	Owner    string  `json:"owner,omitempty"`
+	ID       string          `json:"id"`
+	ExtID    string          `json:"ext_id,omitempty"`
+	Bank     string          `json:"bank"`
+	Type     string          `json:"type"`
+	Currency string          `json:"currency"`
+	Balance  float64         `json:"balance"`
+	Owner    string          `json:"owner,omitempty"`
+	Nickname string          `json:"nickname,omitempty"`
+	Shared   *AccountSharing `json:"shared,omitempty"` // счет другого участника домохозяйства
 }
 
 // Transaction упрощенная модель транзакции для фронтенда
@@ -224,13 +227,27 @@ type Transaction struct {
 	Category    string    `json:"category,omitempty"`
 	Description string    `json:"description,omitempty"`
 	Bank        string    `json:"bank"`
+
+	// Пользовательские аннотации (заполняются AnnotationStore)
+	Tags        []string     `json:"tags,omitempty"`
+	Note        string       `json:"note,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Разбиение по категориям (заполняется SplitStore)
+	Splits   []SplitPart `json:"splits,omitempty"`
+	ParentID string      `json:"parent_id,omitempty"` // для частей разбитой транзакции
+
+	// Владелец счета, если счет открыт пользователю участником домохозяйства
+	OwnerID string `json:"owner_id,omitempty"`
 }
 
 // ErrorResponse представляет ошибку API
 type ErrorResponse struct {
-	Error     string `json:"error"`
-	Message   string `json:"message"`
-	RequestID string `json:"request_id,omitempty"`
+	Error     string           `json:"error"`
+	Message   string           `json:"message"`
+	RequestID string           `json:"request_id,omitempty"`
+	Fields    []FieldError     `json:"fields,omitempty"` // ошибки по полям для 422
+	Policy    *PolicyViolation `json:"policy,omitempty"` // сработавшее правило политики для 403
 }
 
 // CONVERSION HELPERS
@@ -252,6 +269,7 @@ func (ad *AccountDetail) ToLegacyAccount(bank string) Account {
 		Currency: ad.Currency,
 		Balance:  0, // баланс получаем отдельным запросом
 		Owner:    owner,
+		Nickname: ad.Nickname,
 	}
 }
 
@@ -290,6 +308,11 @@ func parseAmount(s string) float64 {
 	return f
 }
 
+// roundMoney округляет сумму до копеек
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
 // PAYMENT CONSENT MODELS
 
 // PaymentConsentRequest запрос на создание согласия для платежа
@@ -311,9 +334,13 @@ type PaymentInfo struct {
 
 // AccountInfo информация о счёте
 type AccountInfo struct {
-	SchemeName     string `json:"scheme_name"`
-	Identification string `json:"identification"`
-	Name           string `json:"name,omitempty"`
+	SchemeName           string `json:"scheme_name"`
+	Identification       string `json:"identification"`
+	Name                 string `json:"name,omitempty"`
+	BIC                  string `json:"bic,omitempty"`                   // БИК банка счета
+	CorrespondentAccount string `json:"correspondent_account,omitempty"` // корсчет банка
+	INN                  string `json:"inn,omitempty"`
+	KPP                  string `json:"kpp,omitempty"`
 }
 
 // PaymentConsentResponse ответ с информацией о payment consent
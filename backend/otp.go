@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otpSecretsCollection коллекция в хранилище
+const otpSecretsCollection = "otp_secrets"
+
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSkewSteps  = 1  // допускается расхождение часов на один шаг в каждую сторону
+	totpSecretSize = 20 // байт, как у Google Authenticator
+	totpIssuer     = "FinHelper"
+)
+
+// totpEncoding base32 без выравнивания, как в otpauth:// ссылках
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// OTPSecret секрет TOTP пользователя (RFC 6238)
+type OTPSecret struct {
+	UserID      string     `json:"user_id"`
+	Secret      string     `json:"secret"`    // base32
+	Active      bool       `json:"active"`    // подключение подтверждено первым кодом
+	LastStep    int64      `json:"last_step"` // последний принятый шаг: один код нельзя использовать дважды
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+}
+
+// TOTPEnrollment ответ на подключение TOTP. Секрет показывается только здесь
+type TOTPEnrollment struct {
+	Secret     string    `json:"secret"`
+	OTPAuthURL string    `json:"otpauth_url"` // для QR-кода в приложении-аутентификаторе
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TOTPStatus состояние TOTP пользователя без секрета
+type TOTPStatus struct {
+	Enrolled    bool       `json:"enrolled"`
+	Active      bool       `json:"active"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+}
+
+// OTPStore хранит секреты TOTP пользователей и проверяет коды
+type OTPStore struct {
+	store *JSONStore
+
+	mu      sync.Mutex
+	secrets map[string]*OTPSecret // key: userID
+}
+
+// NewOTPStore загружает секреты TOTP
+func NewOTPStore(store *JSONStore) (*OTPStore, error) {
+	s := &OTPStore{
+		store:   store,
+		secrets: make(map[string]*OTPSecret),
+	}
+
+	var secrets []*OTPSecret
+	if err := store.Load(otpSecretsCollection, &secrets); err != nil {
+		return nil, fmt.Errorf("load otp secrets: %w", err)
+	}
+	for _, secret := range secrets {
+		s.secrets[secret.UserID] = secret
+	}
+
+	return s, nil
+}
+
+// Enroll создает новый секрет. Он начинает действовать после Activate;
+// подключенный секрет нужно сначала удалить
+func (s *OTPStore) Enroll(userID string, now time.Time) (*TOTPEnrollment, error) {
+	key := make([]byte, totpSecretSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate totp secret: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.secrets[userID]
+	if exists && previous.Active {
+		return nil, fmt.Errorf("%w: TOTP is already active, remove it first", ErrInvalidInput)
+	}
+
+	secret := &OTPSecret{
+		UserID:    userID,
+		Secret:    totpEncoding.EncodeToString(key),
+		CreatedAt: now,
+	}
+	s.secrets[userID] = secret
+	if err := s.persist(); err != nil {
+		if exists {
+			s.secrets[userID] = previous
+		} else {
+			delete(s.secrets, userID)
+		}
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:     secret.Secret,
+		OTPAuthURL: totpURL(userID, secret.Secret),
+		Active:     false,
+		CreatedAt:  now,
+	}, nil
+}
+
+// Activate подтверждает подключение первым кодом из приложения
+func (s *OTPStore) Activate(userID, code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[userID]
+	if !exists {
+		return fmt.Errorf("totp for user %s: %w", userID, ErrNotFound)
+	}
+	if secret.Active {
+		return fmt.Errorf("%w: TOTP is already active", ErrInvalidInput)
+	}
+
+	previous := *secret
+	if !secret.verify(code, now) {
+		var errs ValidationErrors
+		errs.add("code", "invalid_code", "invalid code")
+		return errs
+	}
+	secret.Active = true
+	secret.ActivatedAt = &now
+
+	if err := s.persist(); err != nil {
+		*secret = previous
+		return err
+	}
+	return nil
+}
+
+// Remove отключает TOTP. Подключенный секрет удаляется только с действующим кодом
+func (s *OTPStore) Remove(userID, code string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[userID]
+	if !exists {
+		return fmt.Errorf("totp for user %s: %w", userID, ErrNotFound)
+	}
+	if secret.Active && !secret.verify(code, now) {
+		var errs ValidationErrors
+		errs.add("code", "invalid_code", "invalid code")
+		return errs
+	}
+
+	delete(s.secrets, userID)
+	if err := s.persist(); err != nil {
+		s.secrets[userID] = secret
+		return err
+	}
+	return nil
+}
+
+// Status возвращает состояние TOTP пользователя
+func (s *OTPStore) Status(userID string) TOTPStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[userID]
+	if !exists {
+		return TOTPStatus{}
+	}
+
+	createdAt := secret.CreatedAt
+	status := TOTPStatus{Enrolled: true, Active: secret.Active, CreatedAt: &createdAt}
+	if secret.ActivatedAt != nil {
+		activatedAt := *secret.ActivatedAt
+		status.ActivatedAt = &activatedAt
+	}
+	return status
+}
+
+// Active сообщает, подключен ли у пользователя TOTP
+func (s *OTPStore) Active(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[userID]
+	return exists && secret.Active
+}
+
+// Verify проверяет код подключенного TOTP. Принятый код запоминается и повторно не подходит
+func (s *OTPStore) Verify(userID, code string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[userID]
+	if !exists || !secret.Active {
+		return false, fmt.Errorf("%w: TOTP is not enabled", ErrInvalidInput)
+	}
+
+	lastStep := secret.LastStep
+	if !secret.verify(code, now) {
+		return false, nil
+	}
+	if err := s.persist(); err != nil {
+		secret.LastStep = lastStep
+		return false, err
+	}
+	return true, nil
+}
+
+// verify сверяет код с соседними шагами и сдвигает LastStep (вызывается под блокировкой)
+func (s *OTPSecret) verify(code string, now time.Time) bool {
+	key, err := totpEncoding.DecodeString(s.Secret)
+	if err != nil || len(code) != totpDigits {
+		return false
+	}
+
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		if step <= s.LastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			s.LastStep = step
+			return true
+		}
+	}
+	return false
+}
+
+// persist сохраняет секреты (вызывается под блокировкой)
+func (s *OTPStore) persist() error {
+	secrets := make([]*OTPSecret, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		secrets = append(secrets, secret)
+	}
+	return s.store.Save(otpSecretsCollection, secrets)
+}
+
+// totpCode вычисляет код для шага (HOTP из RFC 4226 с HMAC-SHA1)
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits)))
+}
+
+// totpURL ссылка otpauth:// для приложений-аутентификаторов
+func totpURL(userID, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	params.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+userID) + "?" + params.Encode()
+}
+
+// generateCode случайный цифровой код заданной длины
+func generateCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// NOTIFIERS
+
+// CodeNotifier доставляет одноразовый код пользователю (SMS, push, email)
+type CodeNotifier interface {
+	SendCode(ctx context.Context, userID, code, purpose string) error
+}
+
+// LogCodeNotifier пишет коды в лог сервера - для локальной разработки и демо
+type LogCodeNotifier struct{}
+
+// SendCode реализует CodeNotifier
+func (LogCodeNotifier) SendCode(ctx context.Context, userID, code, purpose string) error {
+	authLog.InfoContext(ctx, fmt.Sprintf("Code for user %s: %s", userID, code), "purpose", strings.TrimSpace(purpose))
+	return nil
+}
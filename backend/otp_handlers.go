@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TOTP ENDPOINTS
+
+// handleGetTOTP возвращает состояние TOTP пользователя
+// GET /api/otp/totp
+func (s *Server) handleGetTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.otp.Status(userID))
+}
+
+// handleEnrollTOTP создает секрет TOTP; он действует после подтверждения первым кодом
+// POST /api/otp/totp
+func (s *Server) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	enrollment, err := s.otp.Enroll(userID, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to enroll TOTP", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to enroll TOTP: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, enrollment)
+}
+
+// handleActivateTOTP подтверждает подключение TOTP кодом из приложения
+// POST /api/otp/totp/activate
+// Тело: {"code": "123456"}
+func (s *Server) handleActivateTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input ConfirmPaymentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := s.otp.Activate(userID, input.Code, time.Now().UTC()); err != nil {
+		writeValidationError(w, r, "Failed to activate TOTP", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.otp.Status(userID))
+}
+
+// handleRemoveTOTP отключает TOTP; для подключенного нужен действующий код
+// DELETE /api/otp/totp?code=123456
+func (s *Server) handleRemoveTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	if err := s.otp.Remove(userID, r.URL.Query().Get("code"), time.Now().UTC()); err != nil {
+		writeValidationError(w, r, "Failed to remove TOTP", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "TOTP removed successfully",
+	})
+}
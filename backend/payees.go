@@ -0,0 +1,538 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Коллекции в хранилище
+const (
+	payeesCollection           = "payees"
+	paymentTemplatesCollection = "payment_templates"
+)
+
+// Payee сохраненный получатель платежа
+type Payee struct {
+	ID               string      `json:"id"`
+	UserID           string      `json:"user_id"`
+	Name             string      `json:"name"` // отображаемое имя ("Арендодатель")
+	Account          AccountInfo `json:"account"`
+	DefaultReference string      `json:"default_reference,omitempty"`
+	UsageCount       int         `json:"usage_count"`
+	LastUsedAt       *time.Time  `json:"last_used_at,omitempty"`
+	AccountSince     time.Time   `json:"account_since"` // когда сохранен текущий счет (для периода ожидания новых получателей)
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+// PayeeInput тело запроса на создание/изменение получателя
+type PayeeInput struct {
+	Name             string      `json:"name"`
+	Account          AccountInfo `json:"account"`
+	DefaultReference string      `json:"default_reference,omitempty"`
+}
+
+// PaymentTemplate шаблон платежа: откуда, кому, сколько и с каким назначением
+type PaymentTemplate struct {
+	ID            string      `json:"id"`
+	UserID        string      `json:"user_id"`
+	Name          string      `json:"name"`
+	Bank          string      `json:"bank,omitempty"` // банк по умолчанию для отправки
+	DebtorAccount AccountInfo `json:"debtor_account"`
+	PayeeID       string      `json:"payee_id"`
+	Amount        AmountObj   `json:"amount"` // пустая сумма - указывается при каждом платеже
+	Reference     string      `json:"reference,omitempty"`
+	UsageCount    int         `json:"usage_count"`
+	LastUsedAt    *time.Time  `json:"last_used_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// TemplateInput тело запроса на создание/изменение шаблона
+type TemplateInput struct {
+	Name          string      `json:"name"`
+	Bank          string      `json:"bank,omitempty"`
+	DebtorAccount AccountInfo `json:"debtor_account"`
+	PayeeID       string      `json:"payee_id"`
+	Amount        AmountObj   `json:"amount"`
+	Reference     string      `json:"reference,omitempty"`
+}
+
+// PaymentInput тело POST /api/payments: полный PaymentRequest или ссылка
+// на шаблон/получателя; заполненные поля запроса переопределяют шаблон
+type PaymentInput struct {
+	PaymentRequest
+	TemplateID string `json:"template_id,omitempty"`
+	PayeeID    string `json:"payee_id,omitempty"`
+}
+
+// PayeeStore хранит получателей и шаблоны платежей пользователей
+type PayeeStore struct {
+	store *JSONStore
+
+	mu        sync.RWMutex
+	payees    map[string]*Payee           // key: payee ID
+	templates map[string]*PaymentTemplate // key: template ID
+}
+
+// NewPayeeStore загружает получателей и шаблоны из хранилища
+func NewPayeeStore(store *JSONStore) (*PayeeStore, error) {
+	s := &PayeeStore{
+		store:     store,
+		payees:    make(map[string]*Payee),
+		templates: make(map[string]*PaymentTemplate),
+	}
+
+	var payees []*Payee
+	if err := store.Load(payeesCollection, &payees); err != nil {
+		return nil, fmt.Errorf("load payees: %w", err)
+	}
+	for _, payee := range payees {
+		s.payees[payee.ID] = payee
+	}
+
+	var templates []*PaymentTemplate
+	if err := store.Load(paymentTemplatesCollection, &templates); err != nil {
+		return nil, fmt.Errorf("load payment templates: %w", err)
+	}
+	for _, template := range templates {
+		s.templates[template.ID] = template
+	}
+
+	return s, nil
+}
+
+// PAYEES
+
+// ListPayees возвращает получателей пользователя, часто используемые первыми
+func (s *PayeeStore) ListPayees(userID string) []Payee {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Payee, 0)
+	for _, payee := range s.payees {
+		if payee.UserID == userID {
+			result = append(result, *payee)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UsageCount != result[j].UsageCount {
+			return result[i].UsageCount > result[j].UsageCount
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// GetPayee возвращает получателя пользователя
+func (s *PayeeStore) GetPayee(userID, payeeID string) (*Payee, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payee, err := s.payee(userID, payeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *payee
+	return &c, nil
+}
+
+// PayeeSince возвращает, с какого момента счет сохранен у пользователя как получатель
+// (самый ранний из получателей с этим номером счета)
+func (s *PayeeStore) PayeeSince(userID, identification string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var since time.Time
+	found := false
+	for _, payee := range s.payees {
+		if payee.UserID != userID || payee.Account.Identification != identification {
+			continue
+		}
+		t := payee.AccountSince
+		if t.IsZero() {
+			t = payee.CreatedAt
+		}
+		if !found || t.Before(since) {
+			since, found = t, true
+		}
+	}
+
+	return since, found
+}
+
+// CreatePayee проверяет реквизиты и сохраняет получателя
+func (s *PayeeStore) CreatePayee(userID string, input PayeeInput) (*Payee, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	payee := &Payee{
+		ID:           "payee-" + uuid.New().String(),
+		UserID:       userID,
+		AccountSince: now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	input.apply(payee)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payees[payee.ID] = payee
+	if err := s.persist(); err != nil {
+		delete(s.payees, payee.ID)
+		return nil, err
+	}
+
+	c := *payee
+	return &c, nil
+}
+
+// UpdatePayee заменяет реквизиты получателя (статистика использования сохраняется)
+func (s *PayeeStore) UpdatePayee(userID, payeeID string, input PayeeInput) (*Payee, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payee, err := s.payee(userID, payeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := *payee
+	input.apply(payee)
+	payee.UpdatedAt = time.Now().UTC()
+	if payee.Account.Identification != backup.Account.Identification {
+		payee.AccountSince = payee.UpdatedAt
+	}
+
+	if err := s.persist(); err != nil {
+		*payee = backup
+		return nil, err
+	}
+
+	c := *payee
+	return &c, nil
+}
+
+// DeletePayee удаляет получателя, если на него не ссылаются шаблоны
+func (s *PayeeStore) DeletePayee(userID, payeeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payee, err := s.payee(userID, payeeID)
+	if err != nil {
+		return err
+	}
+
+	for _, template := range s.templates {
+		if template.PayeeID == payeeID {
+			return fmt.Errorf("%w: payee is used by template %q", ErrInvalidInput, template.Name)
+		}
+	}
+
+	delete(s.payees, payeeID)
+	if err := s.persist(); err != nil {
+		s.payees[payeeID] = payee
+		return err
+	}
+
+	return nil
+}
+
+// TEMPLATES
+
+// ListTemplates возвращает шаблоны пользователя, часто используемые первыми
+func (s *PayeeStore) ListTemplates(userID string) []PaymentTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]PaymentTemplate, 0)
+	for _, template := range s.templates {
+		if template.UserID == userID {
+			result = append(result, *template)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UsageCount != result[j].UsageCount {
+			return result[i].UsageCount > result[j].UsageCount
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// GetTemplate возвращает шаблон пользователя
+func (s *PayeeStore) GetTemplate(userID, templateID string) (*PaymentTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, err := s.template(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *template
+	return &c, nil
+}
+
+// CreateTemplate сохраняет шаблон платежа для существующего получателя
+func (s *PayeeStore) CreateTemplate(userID string, input TemplateInput) (*PaymentTemplate, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	template := &PaymentTemplate{
+		ID:        "template-" + uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	input.apply(template)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.payee(userID, input.PayeeID); err != nil {
+		return nil, fmt.Errorf("%w: payee_id: %v", ErrInvalidInput, err)
+	}
+
+	s.templates[template.ID] = template
+	if err := s.persist(); err != nil {
+		delete(s.templates, template.ID)
+		return nil, err
+	}
+
+	c := *template
+	return &c, nil
+}
+
+// UpdateTemplate заменяет параметры шаблона
+func (s *PayeeStore) UpdateTemplate(userID, templateID string, input TemplateInput) (*PaymentTemplate, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, err := s.template(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.payee(userID, input.PayeeID); err != nil {
+		return nil, fmt.Errorf("%w: payee_id: %v", ErrInvalidInput, err)
+	}
+
+	backup := *template
+	input.apply(template)
+	template.UpdatedAt = time.Now().UTC()
+
+	if err := s.persist(); err != nil {
+		*template = backup
+		return nil, err
+	}
+
+	c := *template
+	return &c, nil
+}
+
+// DeleteTemplate удаляет шаблон
+func (s *PayeeStore) DeleteTemplate(userID, templateID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, err := s.template(userID, templateID)
+	if err != nil {
+		return err
+	}
+
+	delete(s.templates, templateID)
+	if err := s.persist(); err != nil {
+		s.templates[templateID] = template
+		return err
+	}
+
+	return nil
+}
+
+// PAYMENTS
+
+// ResolvePayment собирает PaymentRequest из шаблона или получателя.
+// Поля, заполненные в самом запросе, имеют приоритет. Возвращает также банк шаблона
+func (s *PayeeStore) ResolvePayment(userID string, input PaymentInput) (PaymentRequest, string, error) {
+	req := input.PaymentRequest
+	if input.TemplateID == "" && input.PayeeID == "" {
+		return req, "", nil
+	}
+	if input.TemplateID != "" && input.PayeeID != "" {
+		return req, "", fmt.Errorf("%w: use either template_id or payee_id, not both", ErrInvalidInput)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bank string
+	payeeID := input.PayeeID
+
+	if input.TemplateID != "" {
+		template, err := s.template(userID, input.TemplateID)
+		if err != nil {
+			return req, "", err
+		}
+
+		bank = template.Bank
+		payeeID = template.PayeeID
+		if req.DebtorAccount.Identification == "" {
+			req.DebtorAccount = template.DebtorAccount
+		}
+		if req.Amount.Amount == "" {
+			req.Amount = template.Amount
+		}
+		if req.Reference == "" {
+			req.Reference = template.Reference
+		}
+	}
+
+	payee, err := s.payee(userID, payeeID)
+	if err != nil {
+		return req, "", err
+	}
+
+	req.CreditorAccount = payee.Account
+	if req.CreditorAccount.Name == "" {
+		req.CreditorAccount.Name = payee.Name
+	}
+	if req.Reference == "" {
+		req.Reference = payee.DefaultReference
+	}
+
+	return req, bank, nil
+}
+
+// RecordUsage увеличивает счетчики использования шаблона и получателя после успешного платежа
+func (s *PayeeStore) RecordUsage(userID string, input PaymentInput) error {
+	if input.TemplateID == "" && input.PayeeID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	payeeID := input.PayeeID
+
+	if input.TemplateID != "" {
+		template, err := s.template(userID, input.TemplateID)
+		if err != nil {
+			return err
+		}
+		template.UsageCount++
+		template.LastUsedAt = &now
+		payeeID = template.PayeeID
+	}
+
+	if payee, err := s.payee(userID, payeeID); err == nil {
+		payee.UsageCount++
+		payee.LastUsedAt = &now
+	}
+
+	return s.persist()
+}
+
+// payee ищет получателя пользователя (вызывается под блокировкой)
+func (s *PayeeStore) payee(userID, payeeID string) (*Payee, error) {
+	payee, exists := s.payees[payeeID]
+	if !exists || payee.UserID != userID {
+		return nil, fmt.Errorf("payee %s: %w", payeeID, ErrNotFound)
+	}
+	return payee, nil
+}
+
+// template ищет шаблон пользователя (вызывается под блокировкой)
+func (s *PayeeStore) template(userID, templateID string) (*PaymentTemplate, error) {
+	template, exists := s.templates[templateID]
+	if !exists || template.UserID != userID {
+		return nil, fmt.Errorf("payment template %s: %w", templateID, ErrNotFound)
+	}
+	return template, nil
+}
+
+// persist сохраняет получателей и шаблоны (вызывается под блокировкой)
+func (s *PayeeStore) persist() error {
+	payees := make([]*Payee, 0, len(s.payees))
+	for _, payee := range s.payees {
+		payees = append(payees, payee)
+	}
+	if err := s.store.Save(payeesCollection, payees); err != nil {
+		return err
+	}
+
+	templates := make([]*PaymentTemplate, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+	return s.store.Save(paymentTemplatesCollection, templates)
+}
+
+// validate проверяет получателя один раз при сохранении
+func (in *PayeeInput) validate() error {
+	var errs ValidationErrors
+	if strings.TrimSpace(in.Name) == "" {
+		errs.add("name", "required", "name is required")
+	}
+	validateTextLength(&errs, "name", in.Name, maxPayeeNameLength)
+	validateAccountInfo(&errs, "account", in.Account)
+	validateTextLength(&errs, "default_reference", in.DefaultReference, maxPaymentReferenceLength)
+	return errs.err()
+}
+
+// apply переносит поля запроса в получателя
+func (in *PayeeInput) apply(payee *Payee) {
+	payee.Name = strings.TrimSpace(in.Name)
+	payee.Account = in.Account
+	payee.DefaultReference = strings.TrimSpace(in.DefaultReference)
+}
+
+// validate проверяет шаблон (получатель проверяется при сохранении получателя)
+func (in *TemplateInput) validate() error {
+	var errs ValidationErrors
+	if strings.TrimSpace(in.Name) == "" {
+		errs.add("name", "required", "name is required")
+	}
+	if in.PayeeID == "" {
+		errs.add("payee_id", "required", "payee_id is required")
+	}
+	validateAccountInfo(&errs, "debtor_account", in.DebtorAccount)
+	if in.Amount.Amount != "" || in.Amount.Currency != "" {
+		validatePaymentAmount(&errs, "amount", in.Amount)
+	}
+	validateTextLength(&errs, "reference", in.Reference, maxPaymentReferenceLength)
+	return errs.err()
+}
+
+// apply переносит поля запроса в шаблон
+func (in *TemplateInput) apply(template *PaymentTemplate) {
+	template.Name = strings.TrimSpace(in.Name)
+	template.Bank = in.Bank
+	template.DebtorAccount = in.DebtorAccount
+	template.PayeeID = in.PayeeID
+	template.Amount = in.Amount
+	template.Reference = strings.TrimSpace(in.Reference)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PAYEE ENDPOINTS
+
+// handleListPayees возвращает получателей пользователя
+// GET /api/payees
+func (s *Server) handleListPayees(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.payees.ListPayees(userID))
+}
+
+// handleCreatePayee создает получателя
+// POST /api/payees
+func (s *Server) handleCreatePayee(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input PayeeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	payee, err := s.payees.CreatePayee(userID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create payee", "error", err)
+		writeValidationError(w, r, "Failed to create payee", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, payee)
+}
+
+// handleGetPayee возвращает получателя
+// GET /api/payees/{id}
+func (s *Server) handleGetPayee(w http.ResponseWriter, r *http.Request) {
+	payeeID := r.PathValue("id")
+	if payeeID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payee ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	payee, err := s.payees.GetPayee(userID, payeeID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get payee: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payee)
+}
+
+// handleUpdatePayee заменяет получателя
+// PUT /api/payees/{id}
+func (s *Server) handleUpdatePayee(w http.ResponseWriter, r *http.Request) {
+	payeeID := r.PathValue("id")
+	if payeeID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payee ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input PayeeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	payee, err := s.payees.UpdatePayee(userID, payeeID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to update payee", "error", err)
+		writeValidationError(w, r, "Failed to update payee", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payee)
+}
+
+// handleDeletePayee удаляет получателя
+// DELETE /api/payees/{id}
+func (s *Server) handleDeletePayee(w http.ResponseWriter, r *http.Request) {
+	payeeID := r.PathValue("id")
+	if payeeID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payee ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.payees.DeletePayee(userID, payeeID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete payee", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete payee: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Payee deleted successfully",
+	})
+}
+
+// PAYMENT TEMPLATE ENDPOINTS
+
+// handleListTemplates возвращает шаблоны платежей пользователя
+// GET /api/payment-templates
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.payees.ListTemplates(userID))
+}
+
+// handleCreateTemplate создает шаблон платежа
+// POST /api/payment-templates
+func (s *Server) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input TemplateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if input.Bank != "" {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), input.Bank); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code in template: "+input.Bank)
+			return
+		}
+	}
+
+	template, err := s.payees.CreateTemplate(userID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create template", "error", err)
+		writeValidationError(w, r, "Failed to create template", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, template)
+}
+
+// handleGetTemplate возвращает шаблон платежа
+// GET /api/payment-templates/{id}
+func (s *Server) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID := r.PathValue("id")
+	if templateID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing template ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	template, err := s.payees.GetTemplate(userID, templateID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get template: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+// handleUpdateTemplate заменяет шаблон платежа
+// PUT /api/payment-templates/{id}
+func (s *Server) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID := r.PathValue("id")
+	if templateID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing template ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input TemplateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if input.Bank != "" {
+		if _, err := s.aggregator.GetBankByCode(r.Context(), input.Bank); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid bank code in template: "+input.Bank)
+			return
+		}
+	}
+
+	template, err := s.payees.UpdateTemplate(userID, templateID, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to update template", "error", err)
+		writeValidationError(w, r, "Failed to update template", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+// handleDeleteTemplate удаляет шаблон платежа
+// DELETE /api/payment-templates/{id}
+func (s *Server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	templateID := r.PathValue("id")
+	if templateID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing template ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.payees.DeleteTemplate(userID, templateID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete template", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete template: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Payment template deleted successfully",
+	})
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// paymentBatchesCollection коллекция в хранилище
+const paymentBatchesCollection = "payment_batches"
+
+const (
+	maxBatchRows            = 500
+	maxBatchFileSize        = 5 << 20 // 5 MB
+	defaultBatchConcurrency = 4
+	maxBatchConcurrency     = 8
+)
+
+// Статусы пакета
+const (
+	BatchRunning         = "running"
+	BatchCompleted       = "completed"        // все платежи созданы
+	BatchPartiallyFailed = "partially_failed" // часть платежей не создана
+	BatchFailed          = "failed"           // ни один платеж не создан
+)
+
+// Статусы строки пакета
+const (
+	BatchRowPending     = "pending"
+	BatchRowSending     = "sending"
+	BatchRowSucceeded   = "succeeded"
+	BatchRowFailed      = "failed"
+	BatchRowInterrupted = "interrupted" // сервер остановился во время отправки, проверьте платеж в банке
+)
+
+// batchCSVColumns колонки CSV и куда они попадают в PaymentInput
+var batchCSVColumns = map[string]func(in *PaymentInput, v string){
+	"debtor_account":                 func(in *PaymentInput, v string) { in.DebtorAccount.Identification = v },
+	"debtor_scheme":                  func(in *PaymentInput, v string) { in.DebtorAccount.SchemeName = v },
+	"debtor_name":                    func(in *PaymentInput, v string) { in.DebtorAccount.Name = v },
+	"debtor_bic":                     func(in *PaymentInput, v string) { in.DebtorAccount.BIC = v },
+	"creditor_account":               func(in *PaymentInput, v string) { in.CreditorAccount.Identification = v },
+	"creditor_scheme":                func(in *PaymentInput, v string) { in.CreditorAccount.SchemeName = v },
+	"creditor_name":                  func(in *PaymentInput, v string) { in.CreditorAccount.Name = v },
+	"creditor_bic":                   func(in *PaymentInput, v string) { in.CreditorAccount.BIC = v },
+	"creditor_correspondent_account": func(in *PaymentInput, v string) { in.CreditorAccount.CorrespondentAccount = v },
+	"creditor_inn":                   func(in *PaymentInput, v string) { in.CreditorAccount.INN = v },
+	"creditor_kpp":                   func(in *PaymentInput, v string) { in.CreditorAccount.KPP = v },
+	"amount":                         func(in *PaymentInput, v string) { in.Amount.Amount = v },
+	"currency":                       func(in *PaymentInput, v string) { in.Amount.Currency = v },
+	"reference":                      func(in *PaymentInput, v string) { in.Reference = v },
+	"remittance_information":         func(in *PaymentInput, v string) { in.RemittanceInfo = v },
+	"template_id":                    func(in *PaymentInput, v string) { in.TemplateID = v },
+	"payee_id":                       func(in *PaymentInput, v string) { in.PayeeID = v },
+}
+
+// BatchInput JSON-тело пакета; можно передать и просто массив платежей
+type BatchInput struct {
+	Bank     string         `json:"bank,omitempty"`
+	Payments []PaymentInput `json:"payments"`
+}
+
+// BatchRow один платеж пакета
+type BatchRow struct {
+	Row           int            `json:"row"` // номер строки в файле, с 1 (без заголовка CSV)
+	Bank          string         `json:"bank"`
+	Payment       PaymentRequest `json:"payment"`
+	TemplateID    string         `json:"template_id,omitempty"`
+	PayeeID       string         `json:"payee_id,omitempty"`
+	Status        string         `json:"status"`
+	PaymentID     string         `json:"payment_id,omitempty"`
+	PaymentStatus string         `json:"payment_status,omitempty"` // статус банка при создании
+	Error         string         `json:"error,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+}
+
+// BatchSummary счетчики строк и суммы пакета по валютам
+type BatchSummary struct {
+	Total     int                `json:"total"`
+	Pending   int                `json:"pending"` // еще не отправлены или отправляются
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"` // включая прерванные
+	Amounts   map[string]float64 `json:"amounts"`
+}
+
+// PaymentBatch пакет платежей
+type PaymentBatch struct {
+	ID          string       `json:"id"`
+	UserID      string       `json:"user_id"`
+	Status      string       `json:"status"`
+	Concurrency int          `json:"concurrency"`
+	Summary     BatchSummary `json:"summary"`
+	Rows        []BatchRow   `json:"rows,omitempty"` // в списке пакетов не возвращаются
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+}
+
+// BatchValidation результат проверки пакета без отправки (dry_run)
+type BatchValidation struct {
+	DryRun  bool         `json:"dry_run"`
+	Valid   bool         `json:"valid"`
+	Summary BatchSummary `json:"summary"`
+	Rows    []BatchRow   `json:"rows"`
+	Errors  []FieldError `json:"errors"` // поля вида rows[3].amount.amount
+}
+
+// PaymentBatchStore хранит пакеты платежей и отправляет их в фоне
+type PaymentBatchStore struct {
+	store      *JSONStore
+	aggregator *BankAggregator
+	tracker    *PaymentTracker
+
+	mu      sync.RWMutex
+	batches map[string]*PaymentBatch // key: batch ID
+	resume  []string                 // пакеты, прерванные перезапуском сервера
+}
+
+// NewPaymentBatchStore загружает пакеты. Строки, которые отправлялись в момент
+// остановки сервера, помечаются interrupted; неотправленные строки дошлет Start
+func NewPaymentBatchStore(store *JSONStore, aggregator *BankAggregator, tracker *PaymentTracker) (*PaymentBatchStore, error) {
+	s := &PaymentBatchStore{
+		store:      store,
+		aggregator: aggregator,
+		tracker:    tracker,
+		batches:    make(map[string]*PaymentBatch),
+	}
+
+	var batches []*PaymentBatch
+	if err := store.Load(paymentBatchesCollection, &batches); err != nil {
+		return nil, fmt.Errorf("load payment batches: %w", err)
+	}
+
+	interrupted := false
+	for _, batch := range batches {
+		s.batches[batch.ID] = batch
+		if batch.Status != BatchRunning {
+			continue
+		}
+
+		for i := range batch.Rows {
+			if batch.Rows[i].Status == BatchRowSending {
+				batch.Rows[i].Status = BatchRowInterrupted
+				batch.Rows[i].Error = "server stopped while sending payment; check payment status in the bank"
+				interrupted = true
+			}
+		}
+		batch.Summary = summarizeBatch(batch.Rows)
+		s.resume = append(s.resume, batch.ID)
+	}
+
+	if interrupted {
+		if err := s.persist(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Start досылает пакеты, прерванные перезапуском сервера
+func (s *PaymentBatchStore) Start() {
+	for _, id := range s.resume {
+		go s.run(id)
+	}
+	s.resume = nil
+}
+
+// Create сохраняет проверенные строки пакета и запускает отправку в фоне
+func (s *PaymentBatchStore) Create(userID string, rows []BatchRow, concurrency int, now time.Time) (*PaymentBatch, error) {
+	batch := &PaymentBatch{
+		ID:          "batch-" + uuid.New().String(),
+		UserID:      userID,
+		Status:      BatchRunning,
+		Concurrency: concurrency,
+		Rows:        rows,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for i := range batch.Rows {
+		batch.Rows[i].Status = BatchRowPending
+	}
+	batch.Summary = summarizeBatch(batch.Rows)
+
+	s.mu.Lock()
+	s.batches[batch.ID] = batch
+	if err := s.persist(); err != nil {
+		delete(s.batches, batch.ID)
+		s.mu.Unlock()
+		return nil, err
+	}
+	result := batch.clone(true)
+	s.mu.Unlock()
+
+	go s.run(batch.ID)
+
+	return &result, nil
+}
+
+// Get возвращает пакет пользователя со строками
+func (s *PaymentBatchStore) Get(userID, batchID string) (*PaymentBatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, exists := s.batches[batchID]
+	if !exists || batch.UserID != userID {
+		return nil, fmt.Errorf("payment batch %s: %w", batchID, ErrNotFound)
+	}
+
+	result := batch.clone(true)
+	return &result, nil
+}
+
+// List возвращает пакеты пользователя без строк, новые первыми
+func (s *PaymentBatchStore) List(userID string) []PaymentBatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]PaymentBatch, 0)
+	for _, batch := range s.batches {
+		if batch.UserID == userID {
+			result = append(result, batch.clone(false))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// EXECUTION
+
+// run отправляет неотправленные строки пакета, не больше Concurrency одновременно
+func (s *PaymentBatchStore) run(batchID string) {
+	s.mu.RLock()
+	batch := s.batches[batchID]
+	concurrency := batch.Concurrency
+	var pending []int
+	for i, row := range batch.Rows {
+		if row.Status == BatchRowPending {
+			pending = append(pending, i)
+		}
+	}
+	s.mu.RUnlock()
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, i := range pending {
+		slots <- struct{}{}
+
+		// Отметка об отправке сохраняется до запроса в банк, чтобы после
+		// перезапуска сервера не отправить платеж повторно
+		row, ok := s.startRow(batchID, i)
+		if !ok {
+			<-slots
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, row BatchRow) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.sendRow(batchID, i, row)
+		}(i, row)
+	}
+	wg.Wait()
+
+	s.finish(batchID)
+}
+
+// sendRow отправляет одну строку в банк и записывает результат
+func (s *PaymentBatchStore) sendRow(batchID string, i int, row BatchRow) {
+	s.mu.RLock()
+	userID := s.batches[batchID].UserID
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentExecuteTimeout)
+	ctx = context.WithValue(ctx, CtxIdempotencyKey,
+		bankIdempotencyKey(userID, IdempotencyScopeBatch, fmt.Sprintf("%s-%d", batchID, row.Row)))
+	resp, err := s.aggregator.CreatePayment(ctx, row.Bank, userID, row.Payment)
+	cancel()
+
+	now := time.Now().UTC()
+	if err != nil {
+		paymentsLog.WarnContext(ctx, "Batch row failed", "batch_id", batchID, "row", row.Row, "error", err)
+	} else if err := s.tracker.Track(userID, row.Bank, row.Payment, resp, PaymentSourceBatch, batchID, now); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to record payment", "batch_id", batchID, "payment_id", resp.PaymentID, "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.batches[batchID]
+	r := &batch.Rows[i]
+	r.FinishedAt = &now
+	if err != nil {
+		r.Status = BatchRowFailed
+		r.Error = err.Error()
+	} else {
+		r.Status = BatchRowSucceeded
+		r.PaymentID = resp.PaymentID
+		r.PaymentStatus = resp.Status
+	}
+	batch.Summary = summarizeBatch(batch.Rows)
+	batch.UpdatedAt = now
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save batch row result", "batch_id", batchID, "row", row.Row, "error", err)
+	}
+}
+
+// startRow помечает строку как отправляемую и сохраняет пакет
+func (s *PaymentBatchStore) startRow(batchID string, i int) (BatchRow, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.batches[batchID]
+	batch.Rows[i].Status = BatchRowSending
+	batch.Summary = summarizeBatch(batch.Rows)
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save batch, row not sent", "batch_id", batchID, "row", batch.Rows[i].Row, "error", err)
+		batch.Rows[i].Status = BatchRowFailed
+		batch.Rows[i].Error = "not sent: " + err.Error()
+		batch.Summary = summarizeBatch(batch.Rows)
+		return BatchRow{}, false
+	}
+
+	return batch.Rows[i], true
+}
+
+// finish выставляет итоговый статус пакета
+func (s *PaymentBatchStore) finish(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.batches[batchID]
+	now := time.Now().UTC()
+	batch.Summary = summarizeBatch(batch.Rows)
+	batch.FinishedAt = &now
+	batch.UpdatedAt = now
+
+	switch {
+	case batch.Summary.Failed == 0:
+		batch.Status = BatchCompleted
+	case batch.Summary.Succeeded == 0:
+		batch.Status = BatchFailed
+	default:
+		batch.Status = BatchPartiallyFailed
+	}
+
+	paymentsLog.Info("Batch finished", "batch_id", batchID, "status", batch.Status, "succeeded", batch.Summary.Succeeded, "failed", batch.Summary.Failed)
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save batch", "batch_id", batchID, "error", err)
+	}
+}
+
+// summarizeBatch пересчитывает счетчики строк и суммы по валютам
+func summarizeBatch(rows []BatchRow) BatchSummary {
+	summary := BatchSummary{Total: len(rows), Amounts: make(map[string]float64)}
+
+	for _, row := range rows {
+		switch row.Status {
+		case BatchRowSucceeded:
+			summary.Succeeded++
+		case BatchRowFailed, BatchRowInterrupted:
+			summary.Failed++
+		default:
+			summary.Pending++
+		}
+
+		// Строки с некорректной суммой или валютой в итоги не попадают
+		currency := row.Payment.Amount.Currency
+		amount := parseAmount(row.Payment.Amount.Amount)
+		if currency == "" || amount <= 0 {
+			continue
+		}
+		summary.Amounts[currency] = roundMoney(summary.Amounts[currency] + amount)
+	}
+
+	return summary
+}
+
+// clone возвращает копию пакета; без строк - для списков
+func (b *PaymentBatch) clone(withRows bool) PaymentBatch {
+	c := *b
+	c.Rows = nil
+	if withRows {
+		c.Rows = append([]BatchRow{}, b.Rows...)
+	}
+
+	c.Summary.Amounts = make(map[string]float64, len(b.Summary.Amounts))
+	for currency, amount := range b.Summary.Amounts {
+		c.Summary.Amounts[currency] = amount
+	}
+	return c
+}
+
+// persist сохраняет все пакеты (вызывается под блокировкой)
+func (s *PaymentBatchStore) persist() error {
+	batches := make([]*PaymentBatch, 0, len(s.batches))
+	for _, batch := range s.batches {
+		batches = append(batches, batch)
+	}
+	return s.store.Save(paymentBatchesCollection, batches)
+}
+
+// PARSING
+
+// parseBatchJSON разбирает JSON-пакет: объект BatchInput или массив платежей
+func parseBatchJSON(data []byte) (BatchInput, error) {
+	var input BatchInput
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &input.Payments); err != nil {
+			return input, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidInput, err)
+		}
+		return input, nil
+	}
+
+	if err := json.Unmarshal(data, &input); err != nil {
+		return input, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidInput, err)
+	}
+	return input, nil
+}
+
+// parseBatchCSV разбирает CSV с заголовком (колонки из batchCSVColumns).
+// Разделитель - запятая или точка с запятой (как сохраняет Excel).
+// Схема счета по умолчанию RU.CBR.PAN, валюта - RUB
+func parseBatchCSV(data []byte) ([]PaymentInput, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	if line, _, _ := bytes.Cut(data, []byte("\n")); bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: CSV header: %v", ErrInvalidInput, err)
+	}
+
+	setters := make([]func(*PaymentInput, string), len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		setter, ok := batchCSVColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown CSV column %q", ErrInvalidInput, name)
+		}
+		setters[i] = setter
+	}
+
+	var inputs []PaymentInput
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: CSV: %v", ErrInvalidInput, err)
+		}
+
+		var input PaymentInput
+		for i, value := range record {
+			if value = strings.TrimSpace(value); value != "" {
+				setters[i](&input, value)
+			}
+		}
+		if input.DebtorAccount.Identification != "" && input.DebtorAccount.SchemeName == "" {
+			input.DebtorAccount.SchemeName = SchemeAccountNumber
+		}
+		if input.CreditorAccount.Identification != "" && input.CreditorAccount.SchemeName == "" {
+			input.CreditorAccount.SchemeName = SchemeAccountNumber
+		}
+		if input.Amount.Amount != "" && input.Amount.Currency == "" {
+			input.Amount.Currency = "RUB"
+		}
+		inputs = append(inputs, input)
+	}
+
+	return inputs, nil
+}
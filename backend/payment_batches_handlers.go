@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PAYMENT BATCH ENDPOINTS
+
+// handleCreatePaymentBatch проверяет все строки пакета и, если ошибок нет, создает
+// черновик: пакет отправляется в фоне после подтверждения кодом
+// (POST /api/payments/{id}/confirm). С dry_run=true только проверяет
+// POST /api/payments/batch?bank=vbank&concurrency=4&dry_run=true
+// Тело: JSON (BatchInput или массив), text/csv или multipart с полем file
+func (s *Server) handleCreatePaymentBatch(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	concurrency := defaultBatchConcurrency
+	if v := r.URL.Query().Get("concurrency"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxBatchConcurrency {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid 'concurrency' (use 1..%d)", maxBatchConcurrency))
+			return
+		}
+		concurrency = n
+	}
+
+	input, err := readBatchInput(w, r)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Invalid batch: "+err.Error())
+		return
+	}
+	if v := r.URL.Query().Get("bank"); v != "" {
+		input.Bank = v
+	}
+
+	if len(input.Payments) == 0 {
+		writeError(w, r, http.StatusBadRequest, "Batch has no payments")
+		return
+	}
+	if len(input.Payments) > maxBatchRows {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Batch has %d payments, maximum is %d", len(input.Payments), maxBatchRows))
+		return
+	}
+
+	rows, errs := s.prepareBatchRows(r.Context(), userID, input)
+
+	if dryRun {
+		for i := range rows {
+			rows[i].Status = BatchRowPending
+		}
+		writeJSON(w, http.StatusOK, BatchValidation{
+			DryRun:  true,
+			Valid:   len(errs) == 0,
+			Summary: summarizeBatch(rows),
+			Rows:    rows,
+			Errors:  append([]FieldError{}, errs...),
+		})
+		return
+	}
+
+	// Пакет отправляется только целиком проверенным
+	if err := errs.err(); err != nil {
+		writeValidationError(w, r, "Invalid payments in batch", err)
+		return
+	}
+
+	draft, err := s.drafts.CreateBatch(r.Context(), userID, rows, concurrency, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create payment batch draft", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create payment batch draft: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, draft)
+}
+
+// handleListPaymentBatches возвращает пакеты пользователя (без строк)
+// GET /api/payments/batch
+func (s *Server) handleListPaymentBatches(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.batches.List(userID))
+}
+
+// handleGetPaymentBatch возвращает пакет со статусом каждой строки
+// GET /api/payments/batch/{id}
+func (s *Server) handleGetPaymentBatch(w http.ResponseWriter, r *http.Request) {
+	batchID := r.PathValue("id")
+	if batchID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing batch ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	batch, err := s.batches.Get(userID, batchID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get payment batch: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, batch)
+}
+
+// prepareBatchRows разворачивает шаблоны и получателей и проверяет реквизиты всех строк
+// и политику платежей (с учетом предыдущих строк пакета в лимитах).
+// Ошибки возвращаются по полям вида rows[N].field
+func (s *Server) prepareBatchRows(ctx context.Context, userID string, input BatchInput) ([]BatchRow, ValidationErrors) {
+	var errs ValidationErrors
+	rows := make([]BatchRow, 0, len(input.Payments))
+	var planned []PaymentRequest
+	now := time.Now().UTC()
+
+	for i, payment := range input.Payments {
+		prefix := fmt.Sprintf("rows[%d]", i+1)
+		errCount := len(errs)
+		row := BatchRow{Row: i + 1, TemplateID: payment.TemplateID, PayeeID: payment.PayeeID}
+
+		req, templateBank, err := s.payees.ResolvePayment(userID, payment)
+		if err != nil {
+			errs.add(prefix, "unresolved", "%s", err.Error())
+			rows = append(rows, row)
+			continue
+		}
+		row.Payment = req
+
+		row.Bank = input.Bank
+		if row.Bank == "" {
+			row.Bank = templateBank
+		}
+		if row.Bank == "" {
+			errs.add(prefix+".bank", "required", "bank is required (query, batch or template)")
+		} else if _, err := s.aggregator.GetBankByCode(ctx, row.Bank); err != nil {
+			errs.add(prefix+".bank", "invalid_value", "unknown bank %s", row.Bank)
+		}
+
+		if err := ValidatePaymentRequest(req); err != nil {
+			if fields, ok := err.(ValidationErrors); ok {
+				for _, f := range fields {
+					f.Field = prefix + "." + f.Field
+					errs = append(errs, f)
+				}
+			} else {
+				errs.add(prefix, "invalid_value", "%s", err.Error())
+			}
+		}
+
+		if len(errs) == errCount {
+			if err := s.policies.Check(userID, req, planned, now); err != nil {
+				errs.add(prefix, "policy_violation", "%s", err.Error())
+			} else {
+				planned = append(planned, req)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, errs
+}
+
+// readBatchInput читает пакет из JSON, CSV или загруженного файла
+func readBatchInput(w http.ResponseWriter, r *http.Request) (BatchInput, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var data []byte
+	isCSV := mediaType == "text/csv"
+
+	if mediaType == "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchFileSize+64<<10)
+		if err := r.ParseMultipartForm(maxBatchFileSize); err != nil {
+			return BatchInput{}, fmt.Errorf("%w: invalid multipart body (max %d bytes): %v", ErrInvalidInput, maxBatchFileSize, err)
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return BatchInput{}, fmt.Errorf("%w: missing 'file' form field", ErrInvalidInput)
+		}
+		defer file.Close()
+
+		if data, err = io.ReadAll(file); err != nil {
+			return BatchInput{}, fmt.Errorf("%w: read file: %v", ErrInvalidInput, err)
+		}
+		isCSV = strings.EqualFold(filepath.Ext(header.Filename), ".csv")
+	} else {
+		var err error
+		if data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchFileSize)); err != nil {
+			return BatchInput{}, fmt.Errorf("%w: read body (max %d bytes): %v", ErrInvalidInput, maxBatchFileSize, err)
+		}
+	}
+
+	if isCSV {
+		payments, err := parseBatchCSV(data)
+		return BatchInput{Payments: payments}, err
+	}
+	return parseBatchJSON(data)
+}
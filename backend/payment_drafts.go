@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// paymentDraftsCollection коллекция в хранилище
+const paymentDraftsCollection = "payment_drafts"
+
+// Операции, которые уходят в банк только после подтверждения кодом
+const (
+	DraftKindPayment  = "payment"
+	DraftKindBatch    = "batch"    // пакет платежей подтверждается один раз целиком
+	DraftKindTransfer = "transfer" // перевод между своими счетами
+	DraftKindSchedule = "schedule" // расписание подтверждается при создании, исполнения - без кода
+)
+
+// Способ подтверждения платежа
+const (
+	ConfirmByTOTP = "totp" // код из приложения-аутентификатора
+	ConfirmByCode = "code" // код, отправленный CodeNotifier
+)
+
+// Статусы черновика платежа
+const (
+	DraftPending     = "pending"
+	DraftConfirming  = "confirming" // код принят, платеж отправляется в банк
+	DraftConfirmed   = "confirmed"
+	DraftFailed      = "failed"      // банк не принял платеж
+	DraftExpired     = "expired"     // код не введен вовремя
+	DraftLocked      = "locked"      // исчерпаны попытки ввода кода
+	DraftInterrupted = "interrupted" // сервер остановился во время отправки, результат неизвестен
+)
+
+const (
+	paymentDraftTTL       = 10 * time.Minute
+	maxDraftAttempts      = 5
+	maxDraftCodeSends     = 3                  // первый код и два повторных
+	paymentDraftRetention = 7 * 24 * time.Hour // закрытые черновики потом удаляются
+)
+
+var (
+	// ErrDraftExpired срок подтверждения черновика истек
+	ErrDraftExpired = errors.New("payment draft expired")
+	// ErrDraftLocked исчерпаны попытки ввода кода
+	ErrDraftLocked = errors.New("too many invalid codes, payment draft is locked")
+	// ErrDraftClosed черновик уже подтвержден или закрыт
+	ErrDraftClosed = errors.New("payment draft is already confirmed or closed")
+)
+
+// BatchDraft проверенный пакет платежей, ожидающий подтверждения
+type BatchDraft struct {
+	Concurrency int          `json:"concurrency"`
+	Summary     BatchSummary `json:"summary"`
+	Rows        []BatchRow   `json:"rows"`
+}
+
+// PaymentDraft платеж, пакет, перевод или расписание, ожидающие подтверждения одноразовым кодом
+type PaymentDraft struct {
+	ID           string                 `json:"id"`
+	Kind         string                 `json:"kind"`
+	UserID       string                 `json:"user_id"`
+	OwnerID      string                 `json:"owner_id,omitempty"` // владелец счета списания, если он открыл счет пользователю
+	Bank         string                 `json:"bank"`
+	Payment      PaymentRequest         `json:"payment"` // для payment и schedule
+	Batch        *BatchDraft            `json:"batch,omitempty"`
+	Transfer     *TransferInput         `json:"transfer,omitempty"`
+	Schedule     *ScheduledPaymentInput `json:"schedule,omitempty"`
+	TemplateID   string                 `json:"template_id,omitempty"`
+	PayeeID      string                 `json:"payee_id,omitempty"`
+	Method       string                 `json:"method"`
+	Status       string                 `json:"status"`
+	Attempts     int                    `json:"attempts"`
+	AttemptsLeft int                    `json:"attempts_left"`
+	CodeSends    int                    `json:"code_sends,omitempty"`
+	CodeHash     string                 `json:"code_hash,omitempty"` // не отдается клиенту
+	PaymentID    string                 `json:"payment_id,omitempty"`
+	TargetID     string                 `json:"target_id,omitempty"` // пакет, перевод или расписание, созданные после подтверждения
+	Result       *PaymentResponse       `json:"result,omitempty"`    // ответ банка после подтверждения
+	Error        string                 `json:"error,omitempty"`
+	ExpiresAt    time.Time              `json:"expires_at"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	ConfirmedAt  *time.Time             `json:"confirmed_at,omitempty"`
+}
+
+// PaymentDraftStore хранит черновики платежей и отправляет их в банк после
+// подтверждения кодом: TOTP, если он подключен, иначе кодом через CodeNotifier.
+// Так же подтверждаются пакеты, переводы и расписания
+type PaymentDraftStore struct {
+	store      *JSONStore
+	aggregator *BankAggregator
+	tracker    *PaymentTracker
+	batches    *PaymentBatchStore
+	transfers  *TransferStore
+	scheduler  *PaymentScheduler
+	payees     *PayeeStore
+	otp        *OTPStore
+	households *HouseholdStore
+	notifier   CodeNotifier
+
+	mu     sync.Mutex
+	drafts map[string]*PaymentDraft // key: draft ID
+}
+
+// NewPaymentDraftStore загружает черновики. Черновики, которые отправлялись
+// в момент остановки сервера, помечаются interrupted и не отправляются повторно
+func NewPaymentDraftStore(store *JSONStore, aggregator *BankAggregator, tracker *PaymentTracker, batches *PaymentBatchStore, transfers *TransferStore, scheduler *PaymentScheduler, payees *PayeeStore, otp *OTPStore, households *HouseholdStore, notifier CodeNotifier) (*PaymentDraftStore, error) {
+	s := &PaymentDraftStore{
+		store:      store,
+		aggregator: aggregator,
+		tracker:    tracker,
+		batches:    batches,
+		transfers:  transfers,
+		scheduler:  scheduler,
+		payees:     payees,
+		otp:        otp,
+		households: households,
+		notifier:   notifier,
+		drafts:     make(map[string]*PaymentDraft),
+	}
+
+	var drafts []*PaymentDraft
+	if err := store.Load(paymentDraftsCollection, &drafts); err != nil {
+		return nil, fmt.Errorf("load payment drafts: %w", err)
+	}
+
+	interrupted := false
+	for _, draft := range drafts {
+		// Черновики до появления пакетов, переводов и расписаний - платежи
+		if draft.Kind == "" {
+			draft.Kind = DraftKindPayment
+		}
+		if draft.Status == DraftConfirming {
+			draft.Status = DraftInterrupted
+			draft.Error = "server stopped while sending payment; check payment status in the bank"
+			interrupted = true
+		}
+		s.drafts[draft.ID] = draft
+	}
+
+	if interrupted {
+		if err := s.persist(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Create сохраняет проверенный платеж как черновик и, если у пользователя нет TOTP,
+// отправляет ему код подтверждения. ownerID - владелец счета списания из домохозяйства
+// пользователя (пустой - собственный счет), право платить проверено вызывающим
+func (s *PaymentDraftStore) Create(ctx context.Context, userID, ownerID, bank string, input PaymentInput, req PaymentRequest, now time.Time) (*PaymentDraft, error) {
+	return s.open(ctx, &PaymentDraft{
+		Kind:       DraftKindPayment,
+		UserID:     userID,
+		OwnerID:    ownerID,
+		Bank:       bank,
+		Payment:    req,
+		TemplateID: input.TemplateID,
+		PayeeID:    input.PayeeID,
+	}, now)
+}
+
+// CreateBatch сохраняет проверенный пакет как черновик: после подтверждения
+// пакет создается и отправляется в фоне
+func (s *PaymentDraftStore) CreateBatch(ctx context.Context, userID string, rows []BatchRow, concurrency int, now time.Time) (*PaymentDraft, error) {
+	for i := range rows {
+		rows[i].Status = BatchRowPending
+	}
+	return s.open(ctx, &PaymentDraft{
+		Kind:   DraftKindBatch,
+		UserID: userID,
+		Batch:  &BatchDraft{Concurrency: concurrency, Summary: summarizeBatch(rows), Rows: rows},
+	}, now)
+}
+
+// CreateTransfer сохраняет перевод между своими счетами как черновик. Счета и
+// остаток проверяются еще раз при подтверждении
+func (s *PaymentDraftStore) CreateTransfer(ctx context.Context, userID string, input TransferInput, now time.Time) (*PaymentDraft, error) {
+	return s.open(ctx, &PaymentDraft{
+		Kind:     DraftKindTransfer,
+		UserID:   userID,
+		Bank:     input.From.Bank,
+		Transfer: &input,
+	}, now)
+}
+
+// CreateSchedule сохраняет платеж по расписанию как черновик. После подтверждения
+// расписание создается и исполняется без повторного кода
+func (s *PaymentDraftStore) CreateSchedule(ctx context.Context, userID, bank string, req PaymentRequest, input ScheduledPaymentInput, now time.Time) (*PaymentDraft, error) {
+	return s.open(ctx, &PaymentDraft{
+		Kind:       DraftKindSchedule,
+		UserID:     userID,
+		Bank:       bank,
+		Payment:    req,
+		TemplateID: input.Payment.TemplateID,
+		PayeeID:    input.Payment.PayeeID,
+		Schedule:   &input,
+	}, now)
+}
+
+// open сохраняет черновик и, если у пользователя нет TOTP, отправляет ему код подтверждения
+func (s *PaymentDraftStore) open(ctx context.Context, draft *PaymentDraft, now time.Time) (*PaymentDraft, error) {
+	draft.ID = "draft-" + uuid.New().String()
+	draft.Method = ConfirmByTOTP
+	draft.Status = DraftPending
+	draft.ExpiresAt = now.Add(paymentDraftTTL)
+	draft.CreatedAt = now
+	draft.UpdatedAt = now
+
+	userID := draft.UserID
+	var code string
+	if !s.otp.Active(userID) {
+		var err error
+		if code, err = generateCode(totpDigits); err != nil {
+			return nil, err
+		}
+		draft.Method = ConfirmByCode
+		draft.CodeHash = draftCodeHash(draft.ID, code)
+		draft.CodeSends = 1
+	}
+
+	s.mu.Lock()
+	s.purgeClosed(now)
+	s.drafts[draft.ID] = draft
+	if err := s.persist(); err != nil {
+		delete(s.drafts, draft.ID)
+		s.mu.Unlock()
+		return nil, err
+	}
+	result := draft.view(now)
+	s.mu.Unlock()
+
+	if code != "" {
+		if err := s.notifier.SendCode(ctx, userID, code, draftCodePurpose(draft)); err != nil {
+			s.discard(draft.ID)
+			return nil, fmt.Errorf("send confirmation code: %w", err)
+		}
+	}
+
+	return &result, nil
+}
+
+// ResendCode отправляет новый код для черновика, подтверждаемого кодом.
+// Предыдущий код перестает действовать, счетчик попыток не сбрасывается
+func (s *PaymentDraftStore) ResendCode(ctx context.Context, userID, draftID string, now time.Time) (*PaymentDraft, error) {
+	code, err := generateCode(totpDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	draft, err := s.pendingDraft(ctx, userID, draftID, now)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if draft.Method != ConfirmByCode {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: draft is confirmed with TOTP, use the code from the authenticator app", ErrInvalidInput)
+	}
+	if draft.CodeSends >= maxDraftCodeSends {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: code was already sent %d times", ErrInvalidInput, draft.CodeSends)
+	}
+
+	previous := *draft
+	draft.CodeHash = draftCodeHash(draft.ID, code)
+	draft.CodeSends++
+	draft.UpdatedAt = now
+	if err := s.persist(); err != nil {
+		*draft = previous
+		s.mu.Unlock()
+		return nil, err
+	}
+	result := draft.view(now)
+	s.mu.Unlock()
+
+	if err := s.notifier.SendCode(ctx, userID, code, draftCodePurpose(&result)); err != nil {
+		return nil, fmt.Errorf("send confirmation code: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Confirm проверяет код и отправляет платеж в банк (пакет, перевод, расписание -
+// создает). Неверный код уменьшает число оставшихся попыток, после последней черновик
+// блокируется. Платеж с чужого счета отправляется от имени владельца, если право
+// платить еще не отозвано
+func (s *PaymentDraftStore) Confirm(ctx context.Context, userID, draftID, code string, now time.Time) (*PaymentDraft, error) {
+	s.mu.Lock()
+	draft, err := s.pendingDraft(ctx, userID, draftID, now)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	debtorUserID := userID
+	if draft.OwnerID != "" {
+		share, err := s.households.Access(userID, draft.OwnerID, draft.Bank, draft.Payment.DebtorAccount.Identification)
+		if err == nil && share.Role != AccessPayer {
+			err = fmt.Errorf("%w: payer role required", ErrForbidden)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("debtor account access: %w", err)
+		}
+		debtorUserID = draft.OwnerID
+	}
+
+	valid := false
+	switch draft.Method {
+	case ConfirmByTOTP:
+		if valid, err = s.otp.Verify(userID, code, now); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	default:
+		valid = subtle.ConstantTimeCompare([]byte(draft.CodeHash), []byte(draftCodeHash(draft.ID, code))) == 1
+	}
+
+	previous := *draft
+	draft.UpdatedAt = now
+	if valid {
+		draft.Status = DraftConfirming
+		draft.CodeHash = ""
+	} else {
+		draft.Attempts++
+		if draft.Attempts >= maxDraftAttempts {
+			draft.Status = DraftLocked
+			draft.CodeHash = ""
+		}
+	}
+	if err := s.persist(); err != nil {
+		*draft = previous
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	confirmed := *draft
+	bank, req := draft.Bank, draft.Payment
+	input := PaymentInput{TemplateID: draft.TemplateID, PayeeID: draft.PayeeID}
+	attemptsLeft := maxDraftAttempts - draft.Attempts
+	s.mu.Unlock()
+
+	if !valid {
+		if attemptsLeft <= 0 {
+			return nil, ErrDraftLocked
+		}
+		var errs ValidationErrors
+		errs.add("code", "invalid_code", "invalid code, %d attempts left", attemptsLeft)
+		return nil, errs
+	}
+
+	if confirmed.Kind != DraftKindPayment {
+		return s.execute(ctx, userID, confirmed)
+	}
+
+	// Ключ постоянен для черновика: банк с поддержкой идемпотентности не проведет платеж дважды
+	ctx = context.WithValue(ctx, CtxIdempotencyKey, bankIdempotencyKey(userID, IdempotencyScopePayments, draftID))
+	payment, payErr := s.aggregator.CreatePayment(ctx, bank, debtorUserID, req)
+	finishedAt := time.Now().UTC()
+
+	s.mu.Lock()
+	draft = s.drafts[draftID]
+	draft.UpdatedAt = finishedAt
+	if payErr != nil {
+		draft.Status = DraftFailed
+		draft.Error = payErr.Error()
+	} else {
+		draft.Status = DraftConfirmed
+		draft.PaymentID = payment.PaymentID
+		draft.Result = payment
+		draft.ConfirmedAt = &finishedAt
+	}
+	if err := s.persist(); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to save payment draft", "draft_id", draftID, "error", err)
+	}
+	result := draft.view(finishedAt)
+	s.mu.Unlock()
+
+	if payErr != nil {
+		return nil, fmt.Errorf("create payment: %w", payErr)
+	}
+
+	if err := s.payees.RecordUsage(userID, input); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to record payee usage", "error", err)
+	}
+	// Статус платежа отслеживается от имени того, чей счет списания
+	if err := s.tracker.Track(debtorUserID, bank, req, payment, PaymentSourceAPI, "", finishedAt); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to record payment", "payment_id", payment.PaymentID, "error", err)
+	}
+
+	return &result, nil
+}
+
+// execute создает подтвержденный пакет, перевод или расписание и записывает результат в черновик
+func (s *PaymentDraftStore) execute(ctx context.Context, userID string, draft PaymentDraft) (*PaymentDraft, error) {
+	var targetID string
+	var err error
+	now := time.Now().UTC()
+
+	switch draft.Kind {
+	case DraftKindBatch:
+		var batch *PaymentBatch
+		// Статусы строк меняются при отправке: пакет получает свою копию
+		rows := append([]BatchRow{}, draft.Batch.Rows...)
+		if batch, err = s.batches.Create(userID, rows, draft.Batch.Concurrency, now); err == nil {
+			targetID = batch.ID
+		}
+	case DraftKindTransfer:
+		var transfer *Transfer
+		transferCtx := context.WithValue(ctx, CtxIdempotencyKey, bankIdempotencyKey(userID, IdempotencyScopeTransfers, draft.ID))
+		if transfer, err = s.transfers.Create(transferCtx, userID, *draft.Transfer, now); err == nil {
+			targetID = transfer.ID
+		}
+	case DraftKindSchedule:
+		var payment *ScheduledPayment
+		if payment, err = s.scheduler.Create(userID, draft.Bank, draft.Payment, *draft.Schedule, now); err == nil {
+			targetID = payment.ID
+		}
+	default:
+		err = fmt.Errorf("unknown draft kind %q", draft.Kind)
+	}
+	finishedAt := time.Now().UTC()
+
+	s.mu.Lock()
+	stored := s.drafts[draft.ID]
+	stored.UpdatedAt = finishedAt
+	if err != nil {
+		stored.Status = DraftFailed
+		stored.Error = err.Error()
+	} else {
+		stored.Status = DraftConfirmed
+		stored.TargetID = targetID
+		stored.ConfirmedAt = &finishedAt
+	}
+	if err := s.persist(); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to save payment draft", "draft_id", draft.ID, "error", err)
+	}
+	result := stored.view(finishedAt)
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", draft.Kind, err)
+	}
+	return &result, nil
+}
+
+// Get возвращает черновик пользователя
+func (s *PaymentDraftStore) Get(userID, draftID string, now time.Time) (*PaymentDraft, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft, exists := s.drafts[draftID]
+	if !exists || draft.UserID != userID {
+		return nil, fmt.Errorf("payment draft %s: %w", draftID, ErrNotFound)
+	}
+
+	result := draft.view(now)
+	return &result, nil
+}
+
+// List возвращает черновики пользователя, новые первыми
+func (s *PaymentDraftStore) List(userID string, now time.Time) []PaymentDraft {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]PaymentDraft, 0)
+	for _, draft := range s.drafts {
+		if draft.UserID == userID {
+			result = append(result, draft.view(now))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// pendingDraft возвращает черновик, который еще можно подтвердить (вызывается под блокировкой).
+// Просроченный черновик закрывается
+func (s *PaymentDraftStore) pendingDraft(ctx context.Context, userID, draftID string, now time.Time) (*PaymentDraft, error) {
+	draft, exists := s.drafts[draftID]
+	if !exists || draft.UserID != userID {
+		return nil, fmt.Errorf("payment draft %s: %w", draftID, ErrNotFound)
+	}
+
+	switch draft.Status {
+	case DraftPending:
+	case DraftExpired:
+		return nil, ErrDraftExpired
+	case DraftLocked:
+		return nil, ErrDraftLocked
+	default:
+		return nil, ErrDraftClosed
+	}
+
+	if now.After(draft.ExpiresAt) {
+		draft.Status = DraftExpired
+		draft.CodeHash = ""
+		draft.UpdatedAt = now
+		if err := s.persist(); err != nil {
+			paymentsLog.WarnContext(ctx, "Failed to save payment draft", "draft_id", draftID, "error", err)
+		}
+		return nil, ErrDraftExpired
+	}
+
+	return draft, nil
+}
+
+// discard удаляет черновик, код для которого не удалось отправить
+func (s *PaymentDraftStore) discard(draftID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.drafts, draftID)
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save payment drafts", "error", err)
+	}
+}
+
+// purgeClosed удаляет старые черновики, которые уже нельзя подтвердить (вызывается под блокировкой)
+func (s *PaymentDraftStore) purgeClosed(now time.Time) {
+	for id, draft := range s.drafts {
+		if draft.Status != DraftConfirming && now.Sub(draft.ExpiresAt) > paymentDraftRetention {
+			delete(s.drafts, id)
+		}
+	}
+}
+
+// view копия черновика для клиента: без хэша кода, с актуальным статусом срока
+func (d *PaymentDraft) view(now time.Time) PaymentDraft {
+	c := *d
+	c.CodeHash = ""
+	c.AttemptsLeft = maxDraftAttempts - d.Attempts
+	if c.AttemptsLeft < 0 {
+		c.AttemptsLeft = 0
+	}
+	if c.Status == DraftPending && now.After(c.ExpiresAt) {
+		c.Status = DraftExpired
+	}
+	if d.Result != nil {
+		result := *d.Result
+		c.Result = &result
+	}
+	if d.ConfirmedAt != nil {
+		confirmedAt := *d.ConfirmedAt
+		c.ConfirmedAt = &confirmedAt
+	}
+	return c
+}
+
+// persist сохраняет черновики (вызывается под блокировкой)
+func (s *PaymentDraftStore) persist() error {
+	drafts := make([]*PaymentDraft, 0, len(s.drafts))
+	for _, draft := range s.drafts {
+		drafts = append(drafts, draft)
+	}
+	return s.store.Save(paymentDraftsCollection, drafts)
+}
+
+// draftCodeHash хэш кода подтверждения: сам код не хранится
+func draftCodeHash(draftID, code string) string {
+	sum := sha256.Sum256([]byte(draftID + "|" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// draftCodePurpose текст, который увидит пользователь вместе с кодом
+func draftCodePurpose(draft *PaymentDraft) string {
+	var what string
+	switch draft.Kind {
+	case DraftKindBatch:
+		currencies := make([]string, 0, len(draft.Batch.Summary.Amounts))
+		for currency := range draft.Batch.Summary.Amounts {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		totals := make([]string, 0, len(currencies))
+		for _, currency := range currencies {
+			totals = append(totals, fmt.Sprintf("%.2f %s", draft.Batch.Summary.Amounts[currency], currency))
+		}
+		what = fmt.Sprintf("batch of %d payments totalling %s", len(draft.Batch.Rows), strings.Join(totals, ", "))
+	case DraftKindTransfer:
+		what = fmt.Sprintf("transfer of %s %s from %s %s to %s %s",
+			draft.Transfer.Amount.Amount, draft.Transfer.Amount.Currency,
+			draft.Transfer.From.Bank, draft.Transfer.From.AccountID, draft.Transfer.To.Bank, draft.Transfer.To.AccountID)
+	case DraftKindSchedule:
+		frequency := draft.Schedule.Frequency
+		if frequency == "" {
+			frequency = ScheduleOnce
+		}
+		what = fmt.Sprintf("%s scheduled payment of %s %s to %s starting %s", frequency,
+			draft.Payment.Amount.Amount, draft.Payment.Amount.Currency,
+			draft.Payment.CreditorAccount.Identification, draft.Schedule.StartDate.Format(time.DateOnly))
+	default:
+		what = fmt.Sprintf("payment of %s %s to %s",
+			draft.Payment.Amount.Amount, draft.Payment.Amount.Currency, draft.Payment.CreditorAccount.Identification)
+	}
+	return what + ", valid until " + draft.ExpiresAt.Format(time.RFC3339)
+}
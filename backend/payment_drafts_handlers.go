@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// PAYMENT CONFIRMATION ENDPOINTS
+
+// ConfirmPaymentInput тело запроса на подтверждение платежа
+type ConfirmPaymentInput struct {
+	Code string `json:"code"`
+}
+
+// handleConfirmPayment проверяет код и отправляет черновик платежа в банк
+// POST /api/payments/{id}/confirm
+// Тело: {"code": "123456"}
+func (s *Server) handleConfirmPayment(w http.ResponseWriter, r *http.Request) {
+	draftID := r.PathValue("id")
+	if draftID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payment draft ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input ConfirmPaymentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if input.Code == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'code'")
+		return
+	}
+
+	draft, err := s.drafts.Confirm(r.Context(), userID, draftID, input.Code, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to confirm payment", "draft_id", draftID, "error", err)
+		writeValidationError(w, r, "Failed to confirm payment", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, draft)
+}
+
+// handleResendPaymentCode отправляет новый код подтверждения
+// POST /api/payments/{id}/resend-code
+func (s *Server) handleResendPaymentCode(w http.ResponseWriter, r *http.Request) {
+	draftID := r.PathValue("id")
+	if draftID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payment draft ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	draft, err := s.drafts.ResendCode(r.Context(), userID, draftID, time.Now().UTC())
+	if err != nil {
+		writeValidationError(w, r, "Failed to resend code", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, draft)
+}
+
+// handleListPaymentDrafts возвращает черновики платежей пользователя
+// GET /api/payments/drafts
+func (s *Server) handleListPaymentDrafts(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.drafts.List(userID, time.Now().UTC()))
+}
+
+// handleGetPaymentDraft возвращает черновик платежа
+// GET /api/payments/drafts/{id}
+func (s *Server) handleGetPaymentDraft(w http.ResponseWriter, r *http.Request) {
+	draftID := r.PathValue("id")
+	if draftID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing payment draft ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	draft, err := s.drafts.Get(userID, draftID, time.Now().UTC())
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get payment draft: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, draft)
+}
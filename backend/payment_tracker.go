@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trackedPaymentsCollection коллекция в хранилище
+const trackedPaymentsCollection = "payments"
+
+// Обобщенное состояние платежа (статусы банков различаются)
+const (
+	PaymentStatePending   = "pending"
+	PaymentStateCompleted = "completed"
+	PaymentStateRejected  = "rejected"
+	PaymentStateCancelled = "cancelled"
+)
+
+// Откуда создан платеж
+const (
+	PaymentSourceAPI       = "api"
+	PaymentSourceScheduled = "scheduled"
+	PaymentSourceBatch     = "batch"
+	PaymentSourceTransfer  = "transfer"
+)
+
+const (
+	maxPaymentTrackingAge = 7 * 24 * time.Hour // дольше статус не опрашивается
+	paymentPollTimeout    = 30 * time.Second
+)
+
+// paymentPollDelays паузы между опросами статуса; последняя повторяется до конца отслеживания
+var paymentPollDelays = []time.Duration{
+	10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+}
+
+// paymentTerminalStatuses статусы банков (в нижнем регистре), после которых платеж не меняется.
+// Поддерживаются статусы Open Banking и коды ISO 20022
+var paymentTerminalStatuses = map[string]string{
+	"acceptedsettlementcompleted":       PaymentStateCompleted,
+	"acceptedcreditsettlementcompleted": PaymentStateCompleted,
+	"completed":                         PaymentStateCompleted,
+	"executed":                          PaymentStateCompleted,
+	"acsc":                              PaymentStateCompleted,
+	"accc":                              PaymentStateCompleted,
+	"rejected":                          PaymentStateRejected,
+	"rjct":                              PaymentStateRejected,
+	"cancelled":                         PaymentStateCancelled,
+	"canceled":                          PaymentStateCancelled,
+	"canc":                              PaymentStateCancelled,
+}
+
+// PaymentStatusChange смена статуса платежа
+type PaymentStatusChange struct {
+	Status     string    `json:"status"`
+	State      string    `json:"state"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// TrackedPayment платеж пользователя с историей статусов
+type TrackedPayment struct {
+	PaymentID          string                `json:"payment_id"`
+	UserID             string                `json:"user_id"`
+	Bank               string                `json:"bank"`
+	Source             string                `json:"source"`
+	ScheduledPaymentID string                `json:"scheduled_payment_id,omitempty"`
+	BatchID            string                `json:"batch_id,omitempty"`
+	TransferID         string                `json:"transfer_id,omitempty"`
+	DebtorAccount      AccountInfo           `json:"debtor_account"`
+	CreditorAccount    AccountInfo           `json:"creditor_account"`
+	Amount             AmountObj             `json:"amount"`
+	Reference          string                `json:"reference,omitempty"`
+	Status             string                `json:"status"` // последний статус банка
+	State              string                `json:"state"`
+	History            []PaymentStatusChange `json:"history"`
+	Tracking           bool                  `json:"tracking"` // статус еще опрашивается
+	Checks             int                   `json:"checks"`
+	NextCheckAt        *time.Time            `json:"next_check_at,omitempty"`
+	LastError          string                `json:"last_error,omitempty"`
+	CreatedAt          time.Time             `json:"created_at"`
+	UpdatedAt          time.Time             `json:"updated_at"`
+}
+
+// PaymentFilter фильтр истории платежей
+type PaymentFilter struct {
+	Bank  string
+	State string
+	From  *time.Time
+	To    *time.Time
+}
+
+// PaymentTracker запоминает созданные платежи и в фоне опрашивает их статус,
+// пока банк не вернет итоговый
+type PaymentTracker struct {
+	store      *JSONStore
+	aggregator *BankAggregator
+	interval   time.Duration
+
+	mu       sync.RWMutex
+	payments map[string]*TrackedPayment // key: "bank|paymentID"
+}
+
+// NewPaymentTracker загружает историю платежей
+func NewPaymentTracker(store *JSONStore, aggregator *BankAggregator, interval time.Duration) (*PaymentTracker, error) {
+	s := &PaymentTracker{
+		store:      store,
+		aggregator: aggregator,
+		interval:   interval,
+		payments:   make(map[string]*TrackedPayment),
+	}
+
+	var payments []*TrackedPayment
+	if err := store.Load(trackedPaymentsCollection, &payments); err != nil {
+		return nil, fmt.Errorf("load payments: %w", err)
+	}
+	for _, payment := range payments {
+		s.payments[payment.Bank+"|"+payment.PaymentID] = payment
+	}
+
+	return s, nil
+}
+
+// Start запускает фоновый опрос статусов
+func (s *PaymentTracker) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.PollDue(context.Background(), time.Now().UTC())
+			<-ticker.C
+		}
+	}()
+}
+
+// Track запоминает только что созданный платеж. sourceID - ID расписания, пакета или перевода
+func (s *PaymentTracker) Track(userID, bank string, req PaymentRequest, resp *PaymentResponse, source, sourceID string, now time.Time) error {
+	state := paymentState(resp.Status)
+	payment := &TrackedPayment{
+		PaymentID:       resp.PaymentID,
+		UserID:          userID,
+		Bank:            bank,
+		Source:          source,
+		DebtorAccount:   req.DebtorAccount,
+		CreditorAccount: req.CreditorAccount,
+		Amount:          req.Amount,
+		Reference:       req.Reference,
+		Status:          resp.Status,
+		State:           state,
+		History:         []PaymentStatusChange{{Status: resp.Status, State: state, DetectedAt: now}},
+		Tracking:        state == PaymentStatePending,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	switch source {
+	case PaymentSourceScheduled:
+		payment.ScheduledPaymentID = sourceID
+	case PaymentSourceBatch:
+		payment.BatchID = sourceID
+	case PaymentSourceTransfer:
+		payment.TransferID = sourceID
+	}
+	if payment.Tracking {
+		next := now.Add(paymentPollDelays[0])
+		payment.NextCheckAt = &next
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := bank + "|" + resp.PaymentID
+	s.payments[key] = payment
+	if err := s.persist(); err != nil {
+		delete(s.payments, key)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateStatus записывает свежий статус от банка. Платежи, которых нет в истории,
+// возвращают ErrNotFound
+func (s *PaymentTracker) UpdateStatus(userID, bank string, resp *PaymentResponse, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, exists := s.payments[bank+"|"+resp.PaymentID]
+	if !exists || payment.UserID != userID {
+		return fmt.Errorf("payment %s: %w", resp.PaymentID, ErrNotFound)
+	}
+	if resp.Status == payment.Status && payment.LastError == "" {
+		return nil
+	}
+
+	previous := payment.clone()
+	payment.applyStatus(resp.Status, now)
+	payment.LastError = ""
+
+	if err := s.persist(); err != nil {
+		*payment = previous
+		return err
+	}
+	return nil
+}
+
+// List возвращает платежи пользователя, новые первыми
+func (s *PaymentTracker) List(userID string, filter PaymentFilter) []TrackedPayment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TrackedPayment, 0)
+	for _, payment := range s.payments {
+		if payment.UserID != userID ||
+			(filter.Bank != "" && payment.Bank != filter.Bank) ||
+			(filter.State != "" && payment.State != filter.State) ||
+			(filter.From != nil && payment.CreatedAt.Before(*filter.From)) ||
+			(filter.To != nil && payment.CreatedAt.After(*filter.To)) {
+			continue
+		}
+		result = append(result, payment.clone())
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// Get ищет платеж пользователя по ID банка (в любом банке)
+func (s *PaymentTracker) Get(userID, paymentID string) (*TrackedPayment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, payment := range s.payments {
+		if payment.UserID == userID && payment.PaymentID == paymentID {
+			result := payment.clone()
+			return &result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("payment %s: %w", paymentID, ErrNotFound)
+}
+
+// PollDue запрашивает статусы платежей, для которых подошло время проверки
+func (s *PaymentTracker) PollDue(ctx context.Context, now time.Time) {
+	type duePayment struct {
+		bank, userID, paymentID string
+	}
+
+	s.mu.RLock()
+	var due []duePayment
+	for _, payment := range s.payments {
+		if payment.Tracking && payment.NextCheckAt != nil && !payment.NextCheckAt.After(now) {
+			due = append(due, duePayment{bank: payment.Bank, userID: payment.UserID, paymentID: payment.PaymentID})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, d := range due {
+		pollCtx, cancel := context.WithTimeout(ctx, paymentPollTimeout)
+		resp, err := s.aggregator.GetPaymentStatus(pollCtx, d.bank, d.paymentID, d.userID)
+		cancel()
+
+		if err != nil {
+			paymentsLog.WarnContext(ctx, "Failed to poll payment status", "bank", d.bank, "payment_id", d.paymentID, "error", err)
+		}
+		s.recordPoll(d.bank, d.paymentID, resp, err, time.Now().UTC())
+	}
+}
+
+// recordPoll сохраняет результат опроса и назначает следующую проверку
+func (s *PaymentTracker) recordPoll(bank, paymentID string, resp *PaymentResponse, pollErr error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, exists := s.payments[bank+"|"+paymentID]
+	if !exists || !payment.Tracking {
+		return
+	}
+
+	payment.Checks++
+	if pollErr != nil {
+		payment.LastError = pollErr.Error()
+		payment.UpdatedAt = now
+	} else {
+		payment.applyStatus(resp.Status, now)
+		payment.LastError = ""
+	}
+
+	if payment.Tracking && now.Sub(payment.CreatedAt) > maxPaymentTrackingAge {
+		payment.Tracking = false
+		payment.NextCheckAt = nil
+		payment.LastError = "status did not reach a final state, tracking stopped"
+	}
+	if payment.Tracking {
+		delay := paymentPollDelays[len(paymentPollDelays)-1]
+		if payment.Checks < len(paymentPollDelays) {
+			delay = paymentPollDelays[payment.Checks]
+		}
+		next := now.Add(delay)
+		payment.NextCheckAt = &next
+	}
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save payment status", "bank", bank, "payment_id", paymentID, "error", err)
+	}
+}
+
+// applyStatus добавляет статус в историю, если он изменился, и прекращает
+// отслеживание на итоговом статусе
+func (p *TrackedPayment) applyStatus(status string, now time.Time) {
+	if status == "" || status == p.Status {
+		return
+	}
+
+	p.Status = status
+	p.State = paymentState(status)
+	p.History = append(p.History, PaymentStatusChange{Status: status, State: p.State, DetectedAt: now})
+	p.UpdatedAt = now
+
+	if p.State != PaymentStatePending {
+		p.Tracking = false
+		p.NextCheckAt = nil
+	}
+}
+
+// paymentState приводит статус банка к обобщенному состоянию
+func paymentState(status string) string {
+	if state, ok := paymentTerminalStatuses[strings.ToLower(strings.TrimSpace(status))]; ok {
+		return state
+	}
+	return PaymentStatePending
+}
+
+// clone возвращает копию, не разделяющую срезы и указатели с оригиналом
+func (p *TrackedPayment) clone() TrackedPayment {
+	c := *p
+	c.History = append([]PaymentStatusChange{}, p.History...)
+	if p.NextCheckAt != nil {
+		next := *p.NextCheckAt
+		c.NextCheckAt = &next
+	}
+	return c
+}
+
+// persist сохраняет историю платежей (вызывается под блокировкой)
+func (s *PaymentTracker) persist() error {
+	payments := make([]*TrackedPayment, 0, len(s.payments))
+	for _, payment := range s.payments {
+		payments = append(payments, payment)
+	}
+	return s.store.Save(trackedPaymentsCollection, payments)
+}
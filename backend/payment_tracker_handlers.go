@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// PAYMENT HISTORY ENDPOINTS
+
+// handleListPayments возвращает историю платежей пользователя со статусами
+// GET /api/payments?bank=vbank&state=pending&from=2025-01-01T00:00:00Z&to=2025-12-31T23:59:59Z
+func (s *Server) handleListPayments(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	filter := PaymentFilter{
+		Bank:  r.URL.Query().Get("bank"),
+		State: r.URL.Query().Get("state"),
+	}
+
+	switch filter.State {
+	case "", PaymentStatePending, PaymentStateCompleted, PaymentStateRejected, PaymentStateCancelled:
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid 'state' (use pending, completed, rejected or cancelled)")
+		return
+	}
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'from' date format (use RFC3339)")
+			return
+		}
+		filter.From = &t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'to' date format (use RFC3339)")
+			return
+		}
+		filter.To = &t
+	}
+
+	writeJSON(w, http.StatusOK, s.tracker.List(userID, filter))
+}
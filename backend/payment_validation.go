@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SchemeAccountNumber схема идентификации счета по 20-значному номеру
+const SchemeAccountNumber = "RU.CBR.PAN"
+
+// Ограничения реквизитов платежа (как в платежном поручении)
+const (
+	maxPaymentReferenceLength = 210 // назначение платежа
+	maxPayeeNameLength        = 160 // наименование плательщика/получателя
+)
+
+// currencyDecimals количество знаков после запятой для валют, отличных от 2
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"BHD": 3,
+	"OMR": 3,
+}
+
+var (
+	reDigits   = regexp.MustCompile(`^[0-9]+$`)
+	reCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+	reKPP      = regexp.MustCompile(`^[0-9]{4}[0-9A-Z]{2}[0-9]{3}$`)
+	reAmount   = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+)
+
+// FieldError ошибка в конкретном поле запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors ошибки проверки запроса по полям.
+// Считается ErrInvalidInput, но отдается клиенту как 422 со списком полей
+type ValidationErrors []FieldError
+
+// Error реализует интерфейс error
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for _, e := range v {
+		parts = append(parts, e.Field+": "+e.Message)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// Is позволяет проверять ошибки валидации через errors.Is(err, ErrInvalidInput)
+func (v ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// add добавляет ошибку поля
+func (v *ValidationErrors) add(field, code, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// err возвращает nil, если ошибок нет
+func (v ValidationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// ValidatePaymentInfo проверяет реквизиты платежа для создания платежного консента
+func ValidatePaymentInfo(info PaymentInfo) error {
+	var errs ValidationErrors
+	validatePaymentParties(&errs, info.DebtorAccount, info.CreditorAccount)
+	validatePaymentAmount(&errs, "amount", info.Amount)
+	validateTextLength(&errs, "reference", info.Reference, maxPaymentReferenceLength)
+	return errs.err()
+}
+
+// ValidatePaymentRequest проверяет реквизиты платежа перед отправкой в банк
+func ValidatePaymentRequest(req PaymentRequest) error {
+	var errs ValidationErrors
+	validatePaymentParties(&errs, req.DebtorAccount, req.CreditorAccount)
+	validatePaymentAmount(&errs, "amount", req.Amount)
+	validateTextLength(&errs, "reference", req.Reference, maxPaymentReferenceLength)
+	validateTextLength(&errs, "remittance_information", req.RemittanceInfo, maxPaymentReferenceLength)
+	return errs.err()
+}
+
+// validatePaymentParties проверяет счета плательщика и получателя
+func validatePaymentParties(errs *ValidationErrors, debtor, creditor AccountInfo) {
+	validateAccountInfo(errs, "debtor_account", debtor)
+	validateAccountInfo(errs, "creditor_account", creditor)
+
+	if debtor.Identification != "" && debtor.Identification == creditor.Identification &&
+		debtor.SchemeName == creditor.SchemeName && debtor.BIC == creditor.BIC {
+		errs.add("creditor_account.identification", "same_account", "creditor account must differ from debtor account")
+	}
+}
+
+// validateAccountInfo проверяет один счет: номер, БИК с контрольным ключом,
+// корреспондентский счет, ИНН и КПП
+func validateAccountInfo(errs *ValidationErrors, prefix string, acc AccountInfo) {
+	field := func(name string) string { return prefix + "." + name }
+
+	id := strings.TrimSpace(acc.Identification)
+	if id == "" {
+		errs.add(field("identification"), "required", "account identification is required")
+	}
+
+	if acc.SchemeName == SchemeAccountNumber && id != "" {
+		if len(id) != 20 || !reDigits.MatchString(id) {
+			errs.add(field("identification"), "invalid_format", "account number must be 20 digits")
+			id = ""
+		}
+	}
+
+	validBIC := false
+	if acc.BIC != "" {
+		if len(acc.BIC) != 9 || !reDigits.MatchString(acc.BIC) || !strings.HasPrefix(acc.BIC, "04") {
+			errs.add(field("bic"), "invalid_format", "BIC must be 9 digits starting with 04")
+		} else {
+			validBIC = true
+		}
+	}
+
+	// Контрольный ключ номера счета можно проверить только вместе с БИК
+	if validBIC && acc.SchemeName == SchemeAccountNumber && id != "" && !accountKeyValid(acc.BIC, id) {
+		errs.add(field("identification"), "invalid_checksum", "account number control key does not match BIC")
+	}
+
+	if acc.CorrespondentAccount != "" {
+		corr := acc.CorrespondentAccount
+		switch {
+		case len(corr) != 20 || !reDigits.MatchString(corr):
+			errs.add(field("correspondent_account"), "invalid_format", "correspondent account must be 20 digits")
+		case !strings.HasPrefix(corr, "30101"):
+			errs.add(field("correspondent_account"), "invalid_format", "correspondent account must start with 30101")
+		case !validBIC:
+			errs.add(field("bic"), "required", "BIC is required with correspondent account")
+		case !correspondentKeyValid(acc.BIC, corr):
+			errs.add(field("correspondent_account"), "invalid_checksum", "correspondent account control key does not match BIC")
+		}
+	}
+
+	if acc.INN != "" && !innValid(acc.INN) {
+		errs.add(field("inn"), "invalid_checksum", "INN must be 10 or 12 digits with valid check digits")
+	}
+
+	if acc.KPP != "" {
+		switch {
+		case !reKPP.MatchString(acc.KPP):
+			errs.add(field("kpp"), "invalid_format", "KPP must be 9 characters (NNNNPPNNN)")
+		case len(acc.INN) != 10:
+			errs.add(field("kpp"), "not_applicable", "KPP is only allowed with a 10-digit organization INN")
+		}
+	}
+
+	validateTextLength(errs, field("name"), acc.Name, maxPayeeNameLength)
+}
+
+// validatePaymentAmount проверяет сумму, валюту и точность суммы для валюты
+func validatePaymentAmount(errs *ValidationErrors, prefix string, amount AmountObj) {
+	currency := strings.TrimSpace(amount.Currency)
+	if !reCurrency.MatchString(currency) {
+		errs.add(prefix+".currency", "invalid_format", "currency must be a 3-letter ISO 4217 code")
+	}
+
+	value := strings.TrimSpace(amount.Amount)
+	if !reAmount.MatchString(value) {
+		errs.add(prefix+".amount", "invalid_format", "amount must be a positive decimal number like 1500.00")
+		return
+	}
+	if parseAmount(value) <= 0 {
+		errs.add(prefix+".amount", "invalid_value", "amount must be greater than zero")
+	}
+
+	decimals, ok := currencyDecimals[currency]
+	if !ok {
+		decimals = 2
+	}
+	if dot := strings.IndexByte(value, '.'); dot >= 0 && len(value)-dot-1 > decimals {
+		errs.add(prefix+".amount", "invalid_precision", "%s amount allows at most %d decimal places", currency, decimals)
+	}
+}
+
+// validateTextLength проверяет длину текстового поля в символах
+func validateTextLength(errs *ValidationErrors, field, value string, max int) {
+	if len([]rune(value)) > max {
+		errs.add(field, "too_long", "must be at most %d characters", max)
+	}
+}
+
+// CHECKSUMS
+
+// accountKeyWeights весовые коэффициенты для контрольного ключа счета
+var accountKeyWeights = []int{7, 1, 3}
+
+// accountKeyValid проверяет контрольный ключ счета клиента: последние 3 цифры БИК + номер счета
+func accountKeyValid(bic, account string) bool {
+	return weightedSumMod10(bic[6:9]+account) == 0
+}
+
+// correspondentKeyValid проверяет ключ корсчета: "0" + 5-6 цифры БИК + номер корсчета
+func correspondentKeyValid(bic, account string) bool {
+	return weightedSumMod10("0"+bic[4:6]+account) == 0
+}
+
+// weightedSumMod10 сумма цифр с весами 7,1,3 по модулю 10
+func weightedSumMod10(digits string) int {
+	sum := 0
+	for i, ch := range digits {
+		sum += int(ch-'0') * accountKeyWeights[i%3]
+	}
+	return sum % 10
+}
+
+// innValid проверяет контрольные цифры ИНН организации (10 цифр) или физлица (12 цифр)
+func innValid(inn string) bool {
+	if !reDigits.MatchString(inn) {
+		return false
+	}
+
+	switch len(inn) {
+	case 10:
+		return innCheckDigit(inn, []int{2, 4, 10, 3, 5, 9, 4, 6, 8}) == int(inn[9]-'0')
+	case 12:
+		return innCheckDigit(inn, []int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == int(inn[10]-'0') &&
+			innCheckDigit(inn, []int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == int(inn[11]-'0')
+	default:
+		return false
+	}
+}
+
+// innCheckDigit контрольная цифра ИНН для набора весов
+func innCheckDigit(inn string, weights []int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += int(inn[i]-'0') * w
+	}
+	return sum % 11 % 10
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Реальные реквизиты: ПАО Сбербанк (БИК 044525225) и АО «Т-Банк» (БИК 044525974)
+const (
+	testBIC         = "044525225"
+	testCorrAccount = "30101810400000000225"
+	testAccount     = "40817810938160925982"
+	testOrgINN      = "7707083893"
+	testPersonINN   = "500100732259"
+	testKPP         = "773601001"
+)
+
+// fieldCodes собирает коды ошибок по полям для сравнения в тестах
+func fieldCodes(err error) map[string]string {
+	codes := map[string]string{}
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, e := range verrs {
+			codes[e.Field] = e.Code
+		}
+	}
+	return codes
+}
+
+func TestValidateAccountInfo(t *testing.T) {
+	valid := AccountInfo{
+		SchemeName:           SchemeAccountNumber,
+		Identification:       testAccount,
+		BIC:                  testBIC,
+		CorrespondentAccount: testCorrAccount,
+		INN:                  testOrgINN,
+		KPP:                  testKPP,
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(acc *AccountInfo)
+		field string // пусто, если счет валиден
+		code  string
+	}{
+		{"valid", func(acc *AccountInfo) {}, "", ""},
+		{"valid other bank", func(acc *AccountInfo) {
+			acc.BIC, acc.CorrespondentAccount = "044525974", "30101810145250000974"
+			acc.SchemeName, acc.Identification = "RU.CBR.CARD", "4000001234567899"
+		}, "", ""},
+		{"valid without BIC skips key", func(acc *AccountInfo) {
+			acc.BIC, acc.CorrespondentAccount, acc.Identification = "", "", "40817810000000000001"
+		}, "", ""},
+		{"missing identification", func(acc *AccountInfo) { acc.Identification = " " }, "identification", "required"},
+		{"short account", func(acc *AccountInfo) { acc.Identification = "4081781093816092598" }, "identification", "invalid_format"},
+		{"non-digit account", func(acc *AccountInfo) { acc.Identification = "4081781093816092598X" }, "identification", "invalid_format"},
+		{"account key mismatch", func(acc *AccountInfo) { acc.Identification = "40817810938160925983" }, "identification", "invalid_checksum"},
+		{"account of another bank", func(acc *AccountInfo) {
+			acc.BIC, acc.CorrespondentAccount = "044525974", "30101810145250000974"
+		}, "identification", "invalid_checksum"},
+		{"BIC too short", func(acc *AccountInfo) { acc.BIC = "04452522"; acc.CorrespondentAccount = "" }, "bic", "invalid_format"},
+		{"BIC wrong prefix", func(acc *AccountInfo) { acc.BIC = "144525225"; acc.CorrespondentAccount = "" }, "bic", "invalid_format"},
+		{"corr account wrong prefix", func(acc *AccountInfo) { acc.CorrespondentAccount = "40101810400000000225" }, "correspondent_account", "invalid_format"},
+		{"corr account too short", func(acc *AccountInfo) { acc.CorrespondentAccount = "3010181040000000022" }, "correspondent_account", "invalid_format"},
+		{"corr account key mismatch", func(acc *AccountInfo) { acc.CorrespondentAccount = "30101810500000000225" }, "correspondent_account", "invalid_checksum"},
+		{"corr account without BIC", func(acc *AccountInfo) { acc.BIC = "" }, "bic", "required"},
+		{"organization INN checksum", func(acc *AccountInfo) { acc.INN = "7707083894" }, "inn", "invalid_checksum"},
+		{"person INN", func(acc *AccountInfo) { acc.INN, acc.KPP = testPersonINN, "" }, "", ""},
+		{"person INN checksum", func(acc *AccountInfo) { acc.INN, acc.KPP = "500100732258", "" }, "inn", "invalid_checksum"},
+		{"INN wrong length", func(acc *AccountInfo) { acc.INN, acc.KPP = "77070838", "" }, "inn", "invalid_checksum"},
+		{"INN with letters", func(acc *AccountInfo) { acc.INN = "77070838A3" }, "inn", "invalid_checksum"},
+		{"KPP format", func(acc *AccountInfo) { acc.KPP = "77360100" }, "kpp", "invalid_format"},
+		{"KPP with letter reason code", func(acc *AccountInfo) { acc.KPP = "7736AB001" }, "", ""},
+		{"KPP with person INN", func(acc *AccountInfo) { acc.INN = testPersonINN }, "kpp", "not_applicable"},
+		{"name too long", func(acc *AccountInfo) { acc.Name = strings.Repeat("я", maxPayeeNameLength+1) }, "name", "too_long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := valid
+			tt.edit(&acc)
+
+			var errs ValidationErrors
+			validateAccountInfo(&errs, "creditor_account", acc)
+			codes := fieldCodes(errs.err())
+
+			if tt.field == "" {
+				if len(codes) != 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if got := codes["creditor_account."+tt.field]; got != tt.code {
+				t.Errorf("code for %s = %q, want %q (all: %v)", tt.field, got, tt.code, codes)
+			}
+		})
+	}
+}
+
+func TestValidatePaymentAmount(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		field, code      string // пусто, если сумма валидна
+	}{
+		{"1500.00", "RUB", "", ""},
+		{"1500", "RUB", "", ""},
+		{"0.01", "USD", "", ""},
+		{"1500.001", "RUB", "amount.amount", "invalid_precision"},
+		{"100", "JPY", "", ""},
+		{"100.5", "JPY", "amount.amount", "invalid_precision"},
+		{"1.125", "KWD", "", ""},
+		{"1.1255", "KWD", "amount.amount", "invalid_precision"},
+		{"0", "RUB", "amount.amount", "invalid_value"},
+		{"0.00", "RUB", "amount.amount", "invalid_value"},
+		{"-10", "RUB", "amount.amount", "invalid_format"},
+		{"1,50", "RUB", "amount.amount", "invalid_format"},
+		{"", "RUB", "amount.amount", "invalid_format"},
+		{"10", "rub", "amount.currency", "invalid_format"},
+		{"10", "RUBL", "amount.currency", "invalid_format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			var errs ValidationErrors
+			validatePaymentAmount(&errs, "amount", AmountObj{Amount: tt.amount, Currency: tt.currency})
+			codes := fieldCodes(errs.err())
+
+			if tt.field == "" {
+				if len(codes) != 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if got := codes[tt.field]; got != tt.code {
+				t.Errorf("code for %s = %q, want %q (all: %v)", tt.field, got, tt.code, codes)
+			}
+		})
+	}
+}
+
+func TestValidatePaymentRequest(t *testing.T) {
+	debtor := AccountInfo{SchemeName: SchemeAccountNumber, Identification: testAccount, BIC: testBIC}
+	req := PaymentRequest{
+		DebtorAccount:   debtor,
+		CreditorAccount: AccountInfo{SchemeName: SchemeAccountNumber, Identification: "40817810000000000001"},
+		Amount:          AmountObj{Amount: "1500.00", Currency: "RUB"},
+		Reference:       "Оплата по счету 42",
+	}
+	if err := ValidatePaymentRequest(req); err != nil {
+		t.Fatalf("valid request: %v", err)
+	}
+
+	req.CreditorAccount = debtor
+	req.Reference = strings.Repeat("x", maxPaymentReferenceLength+1)
+	err := ValidatePaymentRequest(req)
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("error = %v, want ErrInvalidInput", err)
+	}
+	codes := fieldCodes(err)
+	if codes["creditor_account.identification"] != "same_account" {
+		t.Errorf("same account not reported: %v", codes)
+	}
+	if codes["reference"] != "too_long" {
+		t.Errorf("long reference not reported: %v", codes)
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Коллекции в хранилище
+const (
+	paymentPoliciesCollection   = "payment_policies"
+	policyEvaluationsCollection = "policy_evaluations"
+)
+
+// Правила политики платежей (поле rule в ответе 403)
+const (
+	RuleAllowedCurrencies  = "allowed_currencies"
+	RuleMaxSingleAmount    = "max_single_amount"
+	RulePayeeAllowList     = "payee_allow_list"
+	RulePayeeBlockList     = "payee_block_list"
+	RuleNewPayeeCoolingOff = "new_payee_cooling_off"
+	RuleDailyLimit         = "daily_limit"
+	RuleMonthlyLimit       = "monthly_limit"
+)
+
+// Режим списка получателей
+const (
+	PayeeListAllow = "allow" // платить можно только получателям из списка
+	PayeeListBlock = "block" // получателям из списка платить нельзя
+)
+
+// Решение по платежу
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+const (
+	policyEvaluationRetention = 90 * 24 * time.Hour // журнал хранится дольше месячного лимита
+	maxCoolingOffHours        = 30 * 24
+	defaultEvaluationsLimit   = 100
+	maxEvaluationsLimit       = 1000
+)
+
+// SpendingLimit лимит списаний со счета за календарный день и/или месяц (UTC)
+type SpendingLimit struct {
+	Account  string  `json:"account,omitempty"` // номер счета списания; пустой - каждый счет по отдельности
+	Currency string  `json:"currency"`
+	Daily    float64 `json:"daily,omitempty"`
+	Monthly  float64 `json:"monthly,omitempty"`
+}
+
+// PaymentPolicyInput правила политики (тело PUT /api/policies)
+type PaymentPolicyInput struct {
+	MaxSingleAmount         map[string]float64 `json:"max_single_amount,omitempty"` // по валютам: {"RUB": 100000}
+	Limits                  []SpendingLimit    `json:"limits,omitempty"`
+	AllowedCurrencies       []string           `json:"allowed_currencies,omitempty"`
+	PayeeList               string             `json:"payee_list,omitempty"` // allow | block
+	Payees                  []string           `json:"payees,omitempty"`     // номера счетов получателей
+	NewPayeeCoolingOffHours int                `json:"new_payee_cooling_off_hours,omitempty"`
+}
+
+// PaymentPolicy правила пользователя, которые проверяются перед каждой отправкой платежа в банк
+type PaymentPolicy struct {
+	UserID string `json:"user_id"`
+	PaymentPolicyInput
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// PolicyViolation сработавшее правило политики (ответ 403)
+type PolicyViolation struct {
+	Rule         string     `json:"rule"`
+	Message      string     `json:"message"`
+	Limit        float64    `json:"limit,omitempty"`
+	Used         float64    `json:"used,omitempty"` // уже списано за период
+	Currency     string     `json:"currency,omitempty"`
+	RetryAfter   *time.Time `json:"retry_after,omitempty"` // когда правило перестанет срабатывать
+	EvaluationID string     `json:"evaluation_id,omitempty"`
+}
+
+// Error реализует интерфейс error
+func (v *PolicyViolation) Error() string {
+	return "payment blocked by policy rule " + v.Rule + ": " + v.Message
+}
+
+// PolicyEvaluation запись журнала проверок: решение по платежу и его результат
+type PolicyEvaluation struct {
+	ID           string           `json:"id"`
+	UserID       string           `json:"user_id"`
+	Bank         string           `json:"bank"`
+	Debtor       string           `json:"debtor_account"`
+	Creditor     string           `json:"creditor_account"`
+	Amount       AmountObj        `json:"amount"`
+	Decision     string           `json:"decision"`
+	Violation    *PolicyViolation `json:"violation,omitempty"`
+	PaymentID    string           `json:"payment_id,omitempty"`
+	PaymentError string           `json:"payment_error,omitempty"` // банк не принял платеж: в лимиты не засчитывается
+	EvaluatedAt  time.Time        `json:"evaluated_at"`
+}
+
+// PolicyStore хранит политики платежей, проверяет по ним платежи и ведет журнал решений.
+// Разрешенные платежи из журнала засчитываются в дневные и месячные лимиты
+type PolicyStore struct {
+	store  *JSONStore
+	payees *PayeeStore
+
+	mu          sync.Mutex
+	policies    map[string]*PaymentPolicy // key: userID
+	evaluations []*PolicyEvaluation       // старые первыми
+}
+
+// NewPolicyStore загружает политики и журнал проверок
+func NewPolicyStore(store *JSONStore, payees *PayeeStore) (*PolicyStore, error) {
+	s := &PolicyStore{
+		store:    store,
+		payees:   payees,
+		policies: make(map[string]*PaymentPolicy),
+	}
+
+	var policies []*PaymentPolicy
+	if err := store.Load(paymentPoliciesCollection, &policies); err != nil {
+		return nil, fmt.Errorf("load payment policies: %w", err)
+	}
+	for _, policy := range policies {
+		s.policies[policy.UserID] = policy
+	}
+
+	if err := store.Load(policyEvaluationsCollection, &s.evaluations); err != nil {
+		return nil, fmt.Errorf("load policy evaluations: %w", err)
+	}
+
+	return s, nil
+}
+
+// Get возвращает политику пользователя (пустую, если она не настроена)
+func (s *PolicyStore) Get(userID string) PaymentPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if policy, exists := s.policies[userID]; exists {
+		return policy.clone()
+	}
+	return PaymentPolicy{UserID: userID}
+}
+
+// Set проверяет и заменяет политику пользователя целиком
+func (s *PolicyStore) Set(userID string, input PaymentPolicyInput, now time.Time) (*PaymentPolicy, error) {
+	if err := input.normalize(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.policies[userID]
+	policy := &PaymentPolicy{UserID: userID, PaymentPolicyInput: input, UpdatedAt: &now}
+	s.policies[userID] = policy
+
+	if err := s.store.Save(paymentPoliciesCollection, s.policyList()); err != nil {
+		if exists {
+			s.policies[userID] = previous
+		} else {
+			delete(s.policies, userID)
+		}
+		return nil, err
+	}
+
+	result := policy.clone()
+	return &result, nil
+}
+
+// Evaluations возвращает журнал проверок пользователя, новые первыми
+func (s *PolicyStore) Evaluations(userID, decision string, limit int) []PolicyEvaluation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]PolicyEvaluation, 0)
+	for i := len(s.evaluations) - 1; i >= 0 && len(result) < limit; i-- {
+		evaluation := s.evaluations[i]
+		if evaluation.UserID != userID || (decision != "" && evaluation.Decision != decision) {
+			continue
+		}
+		result = append(result, evaluation.clone())
+	}
+
+	return result
+}
+
+// Check проверяет платеж без записи в журнал - для предварительной проверки
+// черновиков и пакетов. planned - платежи, которые будут отправлены раньше этого
+// (засчитываются в лимиты)
+func (s *PolicyStore) Check(userID string, req PaymentRequest, planned []PaymentRequest, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if violation := s.evaluate(userID, req, planned, now); violation != nil {
+		return violation
+	}
+	return nil
+}
+
+// Authorize проверяет платеж непосредственно перед отправкой в банк и записывает
+// решение в журнал. Разрешенный платеж сразу засчитывается в лимиты;
+// если банк его не примет, RecordResult вернет сумму в лимит
+func (s *PolicyStore) Authorize(ctx context.Context, userID, bank string, req PaymentRequest, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evaluation := &PolicyEvaluation{
+		ID:          "eval-" + uuid.New().String(),
+		UserID:      userID,
+		Bank:        bank,
+		Debtor:      req.DebtorAccount.Identification,
+		Creditor:    req.CreditorAccount.Identification,
+		Amount:      req.Amount,
+		Decision:    PolicyAllow,
+		EvaluatedAt: now,
+	}
+
+	violation := s.evaluate(userID, req, nil, now)
+	if violation != nil {
+		violation.EvaluationID = evaluation.ID
+		evaluation.Decision = PolicyDeny
+		evaluation.Violation = violation
+		paymentsLog.InfoContext(ctx, "Payment blocked by policy", "user_id", userID, "bank", bank, "amount", req.Amount.Amount, "currency", req.Amount.Currency, "rule", violation.Rule, "reason", violation.Message)
+	}
+
+	s.purgeEvaluations(now)
+	s.evaluations = append(s.evaluations, evaluation)
+	if err := s.persistEvaluations(); err != nil {
+		s.evaluations = s.evaluations[:len(s.evaluations)-1]
+		return "", fmt.Errorf("record policy evaluation: %w", err)
+	}
+
+	if violation != nil {
+		return "", violation
+	}
+	return evaluation.ID, nil
+}
+
+// RecordResult записывает в журнал результат отправки разрешенного платежа
+func (s *PolicyStore) RecordResult(evaluationID string, payment *PaymentResponse, paymentErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.evaluations) - 1; i >= 0; i-- {
+		evaluation := s.evaluations[i]
+		if evaluation.ID != evaluationID {
+			continue
+		}
+
+		if paymentErr != nil {
+			evaluation.PaymentError = paymentErr.Error()
+		} else if payment != nil {
+			evaluation.PaymentID = payment.PaymentID
+		}
+		if err := s.persistEvaluations(); err != nil {
+			paymentsLog.Warn("Failed to save policy evaluation", "evaluation_id", evaluationID, "error", err)
+		}
+		return
+	}
+}
+
+// evaluate проверяет правила по порядку и возвращает первое сработавшее (вызывается под блокировкой)
+func (s *PolicyStore) evaluate(userID string, req PaymentRequest, planned []PaymentRequest, now time.Time) *PolicyViolation {
+	policy, exists := s.policies[userID]
+	if !exists {
+		return nil
+	}
+
+	amount := parseAmount(req.Amount.Amount)
+	currency := strings.ToUpper(req.Amount.Currency)
+	debtor := req.DebtorAccount.Identification
+	creditor := req.CreditorAccount.Identification
+
+	if len(policy.AllowedCurrencies) > 0 && !containsString(policy.AllowedCurrencies, currency) {
+		return &PolicyViolation{
+			Rule:     RuleAllowedCurrencies,
+			Message:  fmt.Sprintf("payments in %s are not allowed (allowed: %s)", currency, strings.Join(policy.AllowedCurrencies, ", ")),
+			Currency: currency,
+		}
+	}
+
+	if max, ok := policy.MaxSingleAmount[currency]; ok && amount > max {
+		return &PolicyViolation{
+			Rule:     RuleMaxSingleAmount,
+			Message:  fmt.Sprintf("amount %.2f %s exceeds the single payment limit %.2f", amount, currency, max),
+			Limit:    max,
+			Currency: currency,
+		}
+	}
+
+	switch policy.PayeeList {
+	case PayeeListAllow:
+		if !containsString(policy.Payees, creditor) {
+			return &PolicyViolation{Rule: RulePayeeAllowList, Message: fmt.Sprintf("account %s is not in the payee allow-list", creditor)}
+		}
+	case PayeeListBlock:
+		if containsString(policy.Payees, creditor) {
+			return &PolicyViolation{Rule: RulePayeeBlockList, Message: fmt.Sprintf("account %s is in the payee block-list", creditor)}
+		}
+	}
+
+	if policy.NewPayeeCoolingOffHours > 0 && !s.paidBefore(userID, creditor) {
+		coolingOff := time.Duration(policy.NewPayeeCoolingOffHours) * time.Hour
+		since, saved := s.payees.PayeeSince(userID, creditor)
+		if !saved {
+			return &PolicyViolation{
+				Rule:    RuleNewPayeeCoolingOff,
+				Message: fmt.Sprintf("account %s is a new payee: save it as a payee, payments are allowed %d hours later", creditor, policy.NewPayeeCoolingOffHours),
+			}
+		}
+		if allowedAt := since.Add(coolingOff); now.Before(allowedAt) {
+			return &PolicyViolation{
+				Rule:       RuleNewPayeeCoolingOff,
+				Message:    fmt.Sprintf("account %s is a new payee, payments are allowed after %s", creditor, allowedAt.Format(time.RFC3339)),
+				RetryAfter: &allowedAt,
+			}
+		}
+	}
+
+	for _, limit := range policy.Limits {
+		if limit.Currency != currency || (limit.Account != "" && limit.Account != debtor) {
+			continue
+		}
+
+		periods := []struct {
+			rule  string
+			name  string
+			limit float64
+			start time.Time
+			end   time.Time
+		}{
+			{RuleDailyLimit, "daily", limit.Daily, truncatePeriod(now, IntervalDay), truncatePeriod(now, IntervalDay).AddDate(0, 0, 1)},
+			{RuleMonthlyLimit, "monthly", limit.Monthly, truncatePeriod(now, IntervalMonth), truncatePeriod(now, IntervalMonth).AddDate(0, 1, 0)},
+		}
+		for _, period := range periods {
+			if period.limit <= 0 {
+				continue
+			}
+			used := s.spent(userID, debtor, currency, period.start)
+			for _, p := range planned {
+				if p.DebtorAccount.Identification == debtor && strings.ToUpper(p.Amount.Currency) == currency {
+					used += parseAmount(p.Amount.Amount)
+				}
+			}
+			used = roundMoney(used)
+			if roundMoney(used+amount) > period.limit {
+				retryAfter := period.end
+				return &PolicyViolation{
+					Rule:       period.rule,
+					Message:    fmt.Sprintf("%s limit for account %s is %.2f %s, already spent %.2f", period.name, debtor, period.limit, currency, used),
+					Limit:      period.limit,
+					Used:       used,
+					Currency:   currency,
+					RetryAfter: &retryAfter,
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// spent сумма разрешенных платежей со счета с начала периода, кроме отклоненных банком
+// (вызывается под блокировкой)
+func (s *PolicyStore) spent(userID, debtor, currency string, since time.Time) float64 {
+	total := 0.0
+	for _, evaluation := range s.evaluations {
+		if evaluation.UserID == userID && evaluation.Decision == PolicyAllow && evaluation.PaymentError == "" &&
+			evaluation.Debtor == debtor && strings.ToUpper(evaluation.Amount.Currency) == currency &&
+			!evaluation.EvaluatedAt.Before(since) {
+			total += parseAmount(evaluation.Amount.Amount)
+		}
+	}
+	return total
+}
+
+// paidBefore сообщает, был ли на этот счет успешный платеж (вызывается под блокировкой)
+func (s *PolicyStore) paidBefore(userID, creditor string) bool {
+	for _, evaluation := range s.evaluations {
+		if evaluation.UserID == userID && evaluation.Creditor == creditor && evaluation.PaymentID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeEvaluations удаляет записи старше срока хранения (вызывается под блокировкой)
+func (s *PolicyStore) purgeEvaluations(now time.Time) {
+	cutoff := now.Add(-policyEvaluationRetention)
+	i := 0
+	for i < len(s.evaluations) && s.evaluations[i].EvaluatedAt.Before(cutoff) {
+		i++
+	}
+	s.evaluations = s.evaluations[i:]
+}
+
+// policyList политики для сохранения (вызывается под блокировкой)
+func (s *PolicyStore) policyList() []*PaymentPolicy {
+	policies := make([]*PaymentPolicy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].UserID < policies[j].UserID
+	})
+	return policies
+}
+
+// persistEvaluations сохраняет журнал (вызывается под блокировкой)
+func (s *PolicyStore) persistEvaluations() error {
+	return s.store.Save(policyEvaluationsCollection, s.evaluations)
+}
+
+// normalize проверяет правила и приводит валюты и номера счетов к единому виду
+func (in *PaymentPolicyInput) normalize() error {
+	var errs ValidationErrors
+
+	maxSingle := make(map[string]float64, len(in.MaxSingleAmount))
+	for currency, amount := range in.MaxSingleAmount {
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if !reCurrency.MatchString(currency) {
+			errs.add("max_single_amount."+currency, "invalid_format", "currency must be a 3-letter ISO 4217 code")
+		}
+		if amount <= 0 {
+			errs.add("max_single_amount."+currency, "invalid_value", "limit must be positive")
+		}
+		maxSingle[currency] = amount
+	}
+	in.MaxSingleAmount = maxSingle
+
+	for i := range in.Limits {
+		limit := &in.Limits[i]
+		field := fmt.Sprintf("limits[%d]", i)
+		limit.Account = strings.TrimSpace(limit.Account)
+		limit.Currency = strings.ToUpper(strings.TrimSpace(limit.Currency))
+		if !reCurrency.MatchString(limit.Currency) {
+			errs.add(field+".currency", "invalid_format", "currency must be a 3-letter ISO 4217 code")
+		}
+		if limit.Daily < 0 || limit.Monthly < 0 || (limit.Daily == 0 && limit.Monthly == 0) {
+			errs.add(field, "invalid_value", "set a positive daily and/or monthly limit")
+		}
+	}
+
+	for i, currency := range in.AllowedCurrencies {
+		in.AllowedCurrencies[i] = strings.ToUpper(strings.TrimSpace(currency))
+		if !reCurrency.MatchString(in.AllowedCurrencies[i]) {
+			errs.add(fmt.Sprintf("allowed_currencies[%d]", i), "invalid_format", "currency must be a 3-letter ISO 4217 code")
+		}
+	}
+
+	switch in.PayeeList {
+	case "", PayeeListAllow, PayeeListBlock:
+	default:
+		errs.add("payee_list", "invalid_value", "payee_list must be allow or block")
+	}
+	for i, account := range in.Payees {
+		in.Payees[i] = strings.TrimSpace(account)
+		if in.Payees[i] == "" {
+			errs.add(fmt.Sprintf("payees[%d]", i), "required", "account number is required")
+		}
+	}
+	if in.PayeeList == "" && len(in.Payees) > 0 {
+		errs.add("payee_list", "required", "payee_list is required when payees are set")
+	}
+
+	if in.NewPayeeCoolingOffHours < 0 || in.NewPayeeCoolingOffHours > maxCoolingOffHours {
+		errs.add("new_payee_cooling_off_hours", "invalid_value", "cooling-off must be between 0 and %d hours", maxCoolingOffHours)
+	}
+
+	return errs.err()
+}
+
+// clone возвращает копию, не разделяющую срезы и карты с оригиналом
+func (p *PaymentPolicy) clone() PaymentPolicy {
+	c := *p
+	c.MaxSingleAmount = make(map[string]float64, len(p.MaxSingleAmount))
+	for currency, amount := range p.MaxSingleAmount {
+		c.MaxSingleAmount[currency] = amount
+	}
+	c.Limits = append([]SpendingLimit{}, p.Limits...)
+	c.AllowedCurrencies = append([]string{}, p.AllowedCurrencies...)
+	c.Payees = append([]string{}, p.Payees...)
+	if p.UpdatedAt != nil {
+		updatedAt := *p.UpdatedAt
+		c.UpdatedAt = &updatedAt
+	}
+	return c
+}
+
+// clone возвращает копию записи журнала
+func (e *PolicyEvaluation) clone() PolicyEvaluation {
+	c := *e
+	if e.Violation != nil {
+		violation := *e.Violation
+		c.Violation = &violation
+	}
+	return c
+}
+
+// containsString сообщает, есть ли строка в срезе
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
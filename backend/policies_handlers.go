@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PAYMENT POLICY ENDPOINTS
+
+// handleGetPolicy возвращает политику платежей пользователя
+// GET /api/policies
+func (s *Server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.policies.Get(userID))
+}
+
+// handleSetPolicy заменяет политику платежей пользователя целиком
+// PUT /api/policies
+// Тело: {"max_single_amount": {"RUB": 50000}, "limits": [{"currency": "RUB", "daily": 100000}],
+// "allowed_currencies": ["RUB"], "payee_list": "block", "payees": ["40702810..."], "new_payee_cooling_off_hours": 24}
+func (s *Server) handleSetPolicy(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input PaymentPolicyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	policy, err := s.policies.Set(userID, input, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to save payment policy", "error", err)
+		writeValidationError(w, r, "Failed to save payment policy", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// handleListPolicyEvaluations возвращает журнал проверок платежей (новые первыми)
+// GET /api/policies/evaluations?decision=deny&limit=50
+func (s *Server) handleListPolicyEvaluations(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	decision := r.URL.Query().Get("decision")
+	if decision != "" && decision != PolicyAllow && decision != PolicyDeny {
+		writeError(w, r, http.StatusBadRequest, "Invalid 'decision' (use allow or deny)")
+		return
+	}
+
+	limit := defaultEvaluationsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEvaluationsLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit' (use 1..%d)", maxEvaluationsLimit))
+			return
+		}
+		limit = n
+	}
+
+	evaluations := s.policies.Evaluations(userID, decision, limit)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"evaluations": evaluations,
+		"count":       len(evaluations),
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestPolicyStore политики и получатели во временной директории
+func newTestPolicyStore(t *testing.T) (*PolicyStore, *PayeeStore) {
+	t.Helper()
+
+	store, err := NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payees, err := NewPayeeStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := NewPolicyStore(store, payees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policies, payees
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	const (
+		user        = "team1-1"
+		otherDebtor = "40817810000000000001"
+		savedPayee  = "40817810000000000002"
+		newPayee    = "40817810000000000003"
+	)
+	at := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	retryAt := func(t time.Time) *time.Time { return &t }
+	pay := func(debtor, creditor, amount, currency string) PaymentRequest {
+		return PaymentRequest{
+			DebtorAccount:   AccountInfo{Identification: debtor},
+			CreditorAccount: AccountInfo{Identification: creditor},
+			Amount:          AmountObj{Amount: amount, Currency: currency},
+		}
+	}
+
+	// Суббота 2025-03-15 12:00 UTC; получатель savedPayee сохранен 2 часа назад
+	now := at("2025-03-15 12:00")
+	savedAt := now.Add(-2 * time.Hour)
+
+	// sent платеж, отправленный раньше: bankErr - банк его не принял
+	type sent struct {
+		req     PaymentRequest
+		at      time.Time
+		bankErr bool
+	}
+	daily := []SpendingLimit{{Currency: "RUB", Daily: 10000}}
+	monthly := []SpendingLimit{{Currency: "RUB", Monthly: 10000}}
+
+	tests := []struct {
+		name      string
+		policy    *PaymentPolicyInput
+		history   []sent
+		planned   []PaymentRequest
+		req       PaymentRequest
+		wantRule  string // пусто - платеж разрешен
+		wantUsed  float64
+		wantRetry *time.Time
+	}{
+		{name: "no policy", req: pay(testAccount, newPayee, "1000000", "RUB")},
+
+		// Лимиты
+		{
+			name:    "daily limit reached exactly",
+			policy:  &PaymentPolicyInput{Limits: daily},
+			history: []sent{{req: pay(testAccount, savedPayee, "7000", "RUB"), at: at("2025-03-15 00:00")}},
+			req:     pay(testAccount, savedPayee, "3000", "RUB"),
+		},
+		{
+			name:      "daily limit exceeded by a cent",
+			policy:    &PaymentPolicyInput{Limits: daily},
+			history:   []sent{{req: pay(testAccount, savedPayee, "7000", "RUB"), at: at("2025-03-15 00:00")}},
+			req:       pay(testAccount, savedPayee, "3000.01", "RUB"),
+			wantRule:  RuleDailyLimit,
+			wantUsed:  7000,
+			wantRetry: retryAt(at("2025-03-16 00:00")),
+		},
+		{
+			name:    "yesterday does not count toward daily limit",
+			policy:  &PaymentPolicyInput{Limits: daily},
+			history: []sent{{req: pay(testAccount, savedPayee, "9000", "RUB"), at: at("2025-03-14 23:59")}},
+			req:     pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:   "monthly limit counts the whole calendar month",
+			policy: &PaymentPolicyInput{Limits: monthly},
+			history: []sent{
+				{req: pay(testAccount, savedPayee, "9000", "RUB"), at: at("2025-03-01 00:00")},
+				{req: pay(testAccount, savedPayee, "500", "RUB"), at: at("2025-03-15 09:00")},
+			},
+			req:       pay(testAccount, savedPayee, "600", "RUB"),
+			wantRule:  RuleMonthlyLimit,
+			wantUsed:  9500,
+			wantRetry: retryAt(at("2025-04-01 00:00")),
+		},
+		{
+			name:    "previous month does not count",
+			policy:  &PaymentPolicyInput{Limits: monthly},
+			history: []sent{{req: pay(testAccount, savedPayee, "9000", "RUB"), at: at("2025-02-28 23:59")}},
+			req:     pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:    "payment rejected by the bank does not count",
+			policy:  &PaymentPolicyInput{Limits: daily},
+			history: []sent{{req: pay(testAccount, savedPayee, "9000", "RUB"), at: at("2025-03-15 09:00"), bankErr: true}},
+			req:     pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:    "other debtor account has its own limit",
+			policy:  &PaymentPolicyInput{Limits: daily},
+			history: []sent{{req: pay(otherDebtor, savedPayee, "9000", "RUB"), at: at("2025-03-15 09:00")}},
+			req:     pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:   "limit for another account does not apply",
+			policy: &PaymentPolicyInput{Limits: []SpendingLimit{{Account: otherDebtor, Currency: "RUB", Daily: 100}}},
+			req:    pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:   "limit in another currency does not apply",
+			policy: &PaymentPolicyInput{Limits: []SpendingLimit{{Currency: "USD", Daily: 100}}},
+			req:    pay(testAccount, savedPayee, "5000", "RUB"),
+		},
+		{
+			name:      "planned payments count toward the limit",
+			policy:    &PaymentPolicyInput{Limits: daily},
+			planned:   []PaymentRequest{pay(testAccount, savedPayee, "6000", "RUB"), pay(otherDebtor, savedPayee, "6000", "RUB")},
+			req:       pay(testAccount, savedPayee, "5000", "RUB"),
+			wantRule:  RuleDailyLimit,
+			wantUsed:  6000,
+			wantRetry: retryAt(at("2025-03-16 00:00")),
+		},
+		{
+			name:     "single payment limit",
+			policy:   &PaymentPolicyInput{MaxSingleAmount: map[string]float64{"rub": 100000}},
+			req:      pay(testAccount, savedPayee, "100000.01", "RUB"),
+			wantRule: RuleMaxSingleAmount,
+		},
+		{
+			name:     "currency not allowed",
+			policy:   &PaymentPolicyInput{AllowedCurrencies: []string{"rub"}},
+			req:      pay(testAccount, savedPayee, "10", "USD"),
+			wantRule: RuleAllowedCurrencies,
+		},
+
+		// Списки получателей
+		{
+			name:   "payee in allow-list",
+			policy: &PaymentPolicyInput{PayeeList: PayeeListAllow, Payees: []string{" " + newPayee + " "}},
+			req:    pay(testAccount, newPayee, "10", "RUB"),
+		},
+		{
+			name:     "payee not in allow-list",
+			policy:   &PaymentPolicyInput{PayeeList: PayeeListAllow, Payees: []string{savedPayee}},
+			req:      pay(testAccount, newPayee, "10", "RUB"),
+			wantRule: RulePayeeAllowList,
+		},
+		{
+			name:     "payee in block-list",
+			policy:   &PaymentPolicyInput{PayeeList: PayeeListBlock, Payees: []string{newPayee}},
+			req:      pay(testAccount, newPayee, "10", "RUB"),
+			wantRule: RulePayeeBlockList,
+		},
+
+		// Период ожидания новых получателей
+		{
+			name:     "cooling-off: payee not saved",
+			policy:   &PaymentPolicyInput{NewPayeeCoolingOffHours: 24},
+			req:      pay(testAccount, newPayee, "10", "RUB"),
+			wantRule: RuleNewPayeeCoolingOff,
+		},
+		{
+			name:      "cooling-off: payee saved recently",
+			policy:    &PaymentPolicyInput{NewPayeeCoolingOffHours: 24},
+			req:       pay(testAccount, savedPayee, "10", "RUB"),
+			wantRule:  RuleNewPayeeCoolingOff,
+			wantRetry: retryAt(savedAt.Add(24 * time.Hour)),
+		},
+		{
+			name:   "cooling-off: period is over",
+			policy: &PaymentPolicyInput{NewPayeeCoolingOffHours: 2},
+			req:    pay(testAccount, savedPayee, "10", "RUB"),
+		},
+		{
+			name:    "cooling-off: payee already paid",
+			policy:  &PaymentPolicyInput{NewPayeeCoolingOffHours: 24},
+			history: []sent{{req: pay(testAccount, newPayee, "10", "RUB"), at: at("2025-03-10 09:00")}},
+			req:     pay(testAccount, newPayee, "10", "RUB"),
+		},
+		{
+			name:     "cooling-off: payment rejected by the bank is not a payment",
+			policy:   &PaymentPolicyInput{NewPayeeCoolingOffHours: 24},
+			history:  []sent{{req: pay(testAccount, newPayee, "10", "RUB"), at: at("2025-03-10 09:00"), bankErr: true}},
+			req:      pay(testAccount, newPayee, "10", "RUB"),
+			wantRule: RuleNewPayeeCoolingOff,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, payees := newTestPolicyStore(t)
+			payees.payees["payee-1"] = &Payee{
+				ID:           "payee-1",
+				UserID:       user,
+				Account:      AccountInfo{Identification: savedPayee},
+				AccountSince: savedAt,
+				CreatedAt:    savedAt,
+			}
+
+			// История отправляется до настройки политики, чтобы правила ее не отклонили
+			for _, h := range tt.history {
+				evaluationID, err := policies.Authorize(context.Background(), user, "vbank", h.req, h.at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if h.bankErr {
+					policies.RecordResult(evaluationID, nil, errors.New("bank rejected the payment"))
+				} else {
+					policies.RecordResult(evaluationID, &PaymentResponse{PaymentID: "p-" + evaluationID}, nil)
+				}
+			}
+			if tt.policy != nil {
+				if _, err := policies.Set(user, *tt.policy, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := policies.Check(user, tt.req, tt.planned, now)
+
+			var violation *PolicyViolation
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("payment denied: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &violation) || violation.Rule != tt.wantRule {
+				t.Fatalf("error = %v, want rule %s", err, tt.wantRule)
+			}
+			if violation.Used != tt.wantUsed {
+				t.Errorf("used = %.2f, want %.2f", violation.Used, tt.wantUsed)
+			}
+			if (violation.RetryAfter == nil) != (tt.wantRetry == nil) ||
+				(tt.wantRetry != nil && !violation.RetryAfter.Equal(*tt.wantRetry)) {
+				t.Errorf("retry after = %v, want %v", violation.RetryAfter, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestPaymentPolicyInputNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input PaymentPolicyInput
+		field string // пусто - политика валидна
+		code  string
+	}{
+		{"empty policy", PaymentPolicyInput{}, "", ""},
+		{"limit without amounts", PaymentPolicyInput{Limits: []SpendingLimit{{Currency: "RUB"}}}, "limits[0]", "invalid_value"},
+		{"negative limit", PaymentPolicyInput{Limits: []SpendingLimit{{Currency: "RUB", Daily: -1, Monthly: 100}}}, "limits[0]", "invalid_value"},
+		{"limit currency", PaymentPolicyInput{Limits: []SpendingLimit{{Currency: "RUBL", Daily: 100}}}, "limits[0].currency", "invalid_format"},
+		{"zero single amount", PaymentPolicyInput{MaxSingleAmount: map[string]float64{"RUB": 0}}, "max_single_amount.RUB", "invalid_value"},
+		{"unknown payee list mode", PaymentPolicyInput{PayeeList: "deny", Payees: []string{"40817810000000000002"}}, "payee_list", "invalid_value"},
+		{"payees without mode", PaymentPolicyInput{Payees: []string{"40817810000000000002"}}, "payee_list", "required"},
+		{"empty payee", PaymentPolicyInput{PayeeList: PayeeListAllow, Payees: []string{" "}}, "payees[0]", "required"},
+		{"cooling-off too long", PaymentPolicyInput{NewPayeeCoolingOffHours: maxCoolingOffHours + 1}, "new_payee_cooling_off_hours", "invalid_value"},
+		{"negative cooling-off", PaymentPolicyInput{NewPayeeCoolingOffHours: -1}, "new_payee_cooling_off_hours", "invalid_value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.normalize()
+			codes := fieldCodes(err)
+
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("unexpected errors: %v", err)
+				}
+				return
+			}
+			if got := codes[tt.field]; got != tt.code {
+				t.Errorf("code for %s = %q, want %q (all: %v)", tt.field, got, tt.code, codes)
+			}
+		})
+	}
+}
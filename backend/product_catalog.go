@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Поля сортировки каталога продуктов
+const (
+	CatalogSortRate      = "rate"
+	CatalogSortMinAmount = "min_amount"
+	CatalogSortTerm      = "term"
+	CatalogSortName      = "name"
+)
+
+// Единицы срока продукта
+const (
+	TermUnitDays   = "DAYS"
+	TermUnitMonths = "MONTHS"
+	TermUnitYears  = "YEARS"
+)
+
+// CatalogProduct продукт банка с нормализованными ставкой, суммами и сроком
+type CatalogProduct struct {
+	Bank          string   `json:"bank"`
+	ProductID     string   `json:"product_id"`
+	ProductType   string   `json:"product_type"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description,omitempty"`
+	Currency      string   `json:"currency,omitempty"`
+	InterestRate  *float64 `json:"interest_rate"` // ставка в процентах, как ее отдал банк
+	RateType      string   `json:"rate_type,omitempty"`
+	EffectiveRate *float64 `json:"effective_rate"` // годовая ставка в процентах
+	MinAmount     *float64 `json:"min_amount"`
+	MaxAmount     *float64 `json:"max_amount"`
+	TermMinMonths *float64 `json:"term_min_months"`
+	TermMaxMonths *float64 `json:"term_max_months"`
+}
+
+// CatalogFilter фильтры каталога (пустые поля не фильтруют)
+type CatalogFilter struct {
+	ProductType string
+	Currency    string
+	Amount      *float64 // продукт должен принимать эту сумму
+	TermMonths  *float64 // срок должен входить в диапазон продукта
+}
+
+// ProductCatalog результат поиска по продуктам всех банков
+type ProductCatalog struct {
+	Products         []CatalogProduct  `json:"products"`
+	UnavailableBanks map[string]string `json:"unavailable_banks,omitempty"` // банк -> ошибка
+}
+
+// GetProductCatalog собирает продукты всех банков, нормализует и фильтрует их.
+// Недоступные банки не прерывают поиск, а попадают в unavailable_banks
+func (a *BankAggregator) GetProductCatalog(ctx context.Context, userID string, filter CatalogFilter) ProductCatalog {
+	catalog := ProductCatalog{
+		Products:         []CatalogProduct{},
+		UnavailableBanks: make(map[string]string),
+	}
+
+	for _, bank := range a.Banks(ctx, userID) {
+		products, err := a.GetProducts(ctx, bank.Code, userID, filter.ProductType)
+		if err != nil {
+			aggregatorLog.WarnContext(ctx, "Failed to get products", "bank", bank.Code, "error", err)
+			catalog.UnavailableBanks[bank.Code] = err.Error()
+			continue
+		}
+
+		for _, p := range products {
+			item := normalizeProduct(bank.Code, p)
+			if filter.matches(item) {
+				catalog.Products = append(catalog.Products, item)
+			}
+		}
+	}
+
+	return catalog
+}
+
+// normalizeProduct переводит строковые поля продукта в числа, а срок - в месяцы
+func normalizeProduct(bankCode string, p Product) CatalogProduct {
+	item := CatalogProduct{
+		Bank:        bankCode,
+		ProductID:   p.ProductID,
+		ProductType: strings.ToUpper(p.ProductType),
+		Name:        p.Name,
+		Description: p.Description,
+		Currency:    strings.ToUpper(p.Currency),
+		RateType:    p.InterestRate.Type,
+		MinAmount:   parseLooseNumber(p.MinAmount),
+		MaxAmount:   parseLooseNumber(p.MaxAmount),
+	}
+
+	if rate := parseLooseNumber(p.InterestRate.Rate); rate != nil {
+		item.InterestRate = rate
+		annual := annualRate(*rate, p.InterestRate.Type)
+		item.EffectiveRate = &annual
+	}
+
+	item.TermMinMonths = termInMonths(p.Term.Min, p.Term.Unit)
+	item.TermMaxMonths = termInMonths(p.Term.Max, p.Term.Unit)
+
+	return item
+}
+
+// parseLooseNumber разбирает число из строки банка ("7,5%", "100 000", "1000.00").
+// Пустая или нечисловая строка - nil (значение неизвестно)
+func parseLooseNumber(s string) *float64 {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "%")
+	s = strings.ReplaceAll(s, " ", "")
+	s = strings.ReplaceAll(s, "\u00a0", "")
+	s = strings.ReplaceAll(s, ",", ".")
+	if s == "" {
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &v
+}
+
+// annualRate приводит ставку к годовой, если банк указал ее за месяц или за день
+func annualRate(rate float64, rateType string) float64 {
+	t := strings.ToUpper(rateType)
+	switch {
+	case strings.Contains(t, "MONTH"):
+		return roundMoney(rate * 12)
+	case strings.Contains(t, "DAY") || strings.Contains(t, "DAILY"):
+		return roundMoney(rate * 365)
+	default:
+		return rate
+	}
+}
+
+// termInMonths переводит срок в месяцы (0 - граница не задана)
+func termInMonths(value int, unit string) *float64 {
+	if value <= 0 {
+		return nil
+	}
+
+	months, err := convertTermToMonths(float64(value), unit)
+	if err != nil {
+		aggregatorLog.Warn("Unknown product term unit, assuming months", "error", err)
+		months = float64(value)
+	}
+
+	return &months
+}
+
+// convertTermToMonths переводит срок из указанной единицы в месяцы (пустая единица - месяцы)
+func convertTermToMonths(value float64, unit string) (float64, error) {
+	switch strings.ToUpper(unit) {
+	case TermUnitDays, "DAY":
+		return roundMoney(value * 12 / 365), nil
+	case TermUnitMonths, "MONTH", "":
+		return value, nil
+	case TermUnitYears, "YEAR":
+		return value * 12, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown term unit %q", ErrInvalidInput, unit)
+	}
+}
+
+// matches проверяет продукт по фильтру. Продукты без валюты или без границ
+// суммы и срока не отбрасываются - банк их просто не указал
+func (f CatalogFilter) matches(p CatalogProduct) bool {
+	if f.ProductType != "" && !strings.EqualFold(p.ProductType, f.ProductType) {
+		return false
+	}
+	if f.Currency != "" && p.Currency != "" && !strings.EqualFold(p.Currency, f.Currency) {
+		return false
+	}
+
+	if f.Amount != nil {
+		if p.MinAmount != nil && *f.Amount < *p.MinAmount {
+			return false
+		}
+		if p.MaxAmount != nil && *p.MaxAmount > 0 && *f.Amount > *p.MaxAmount {
+			return false
+		}
+	}
+
+	if f.TermMonths != nil {
+		if p.TermMinMonths != nil && *f.TermMonths < *p.TermMinMonths {
+			return false
+		}
+		if p.TermMaxMonths != nil && *f.TermMonths > *p.TermMaxMonths {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortCatalog сортирует продукты; продукты без значения поля всегда в конце
+func sortCatalog(products []CatalogProduct, by string, desc bool) error {
+	var value func(p CatalogProduct) *float64
+	switch by {
+	case CatalogSortRate:
+		value = func(p CatalogProduct) *float64 { return p.EffectiveRate }
+	case CatalogSortMinAmount:
+		value = func(p CatalogProduct) *float64 { return p.MinAmount }
+	case CatalogSortTerm:
+		value = func(p CatalogProduct) *float64 { return p.TermMinMonths }
+	case CatalogSortName:
+		sort.SliceStable(products, func(i, j int) bool {
+			if desc {
+				return strings.ToLower(products[i].Name) > strings.ToLower(products[j].Name)
+			}
+			return strings.ToLower(products[i].Name) < strings.ToLower(products[j].Name)
+		})
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidInput, by)
+	}
+
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := value(products[i]), value(products[j])
+		if a == nil || b == nil {
+			return a != nil
+		}
+		if desc {
+			return *a > *b
+		}
+		return *a < *b
+	})
+
+	return nil
+}
+
+// FindProduct ищет продукт банка по ID и возвращает его в нормализованном виде
+func (a *BankAggregator) FindProduct(ctx context.Context, bankCode, userID, productID string) (*CatalogProduct, error) {
+	products, err := a.GetProducts(ctx, bankCode, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range products {
+		if p.ProductID == productID {
+			item := normalizeProduct(bankCode, p)
+			return &item, nil
+		}
+	}
+
+	return nil, fmt.Errorf("product %s in bank %s: %w", productID, bankCode, ErrNotFound)
+}
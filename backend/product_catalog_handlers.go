@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// PRODUCT CATALOG ENDPOINTS
+
+// handleGetProductCatalog ищет продукты во всех банках и сортирует их по ставке
+// GET /api/products/catalog?type=DEPOSIT&currency=RUB&amount=100000&term=12&term_unit=MONTHS&sort=rate&order=desc
+func (s *Server) handleGetProductCatalog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	userID := getUserID(r.Context())
+
+	filter := CatalogFilter{
+		ProductType: query.Get("type"),
+		Currency:    query.Get("currency"),
+	}
+
+	if v := query.Get("amount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil || amount < 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'amount' (must be a non-negative number)")
+			return
+		}
+		filter.Amount = &amount
+	}
+
+	if v := query.Get("term"); v != "" {
+		term, err := strconv.ParseFloat(v, 64)
+		if err != nil || term <= 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'term' (must be a positive number)")
+			return
+		}
+		months, err := convertTermToMonths(term, query.Get("term_unit"))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid 'term_unit' (use DAYS, MONTHS or YEARS)")
+			return
+		}
+		filter.TermMonths = &months
+	}
+
+	sortBy := query.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = CatalogSortRate
+	case CatalogSortRate, CatalogSortMinAmount, CatalogSortTerm, CatalogSortName:
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid 'sort' (use rate, min_amount, term or name)")
+		return
+	}
+
+	// По ставке по умолчанию сначала лучшие предложения, по остальным полям - по возрастанию
+	desc := sortBy == CatalogSortRate
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid 'order' (use asc or desc)")
+		return
+	}
+
+	catalog := s.aggregator.GetProductCatalog(r.Context(), userID, filter)
+	if err := sortCatalog(catalog.Products, sortBy, desc); err != nil {
+		writeError(w, r, errorStatus(err), "Failed to sort products: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, catalog)
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// scheduledPaymentsCollection коллекция в хранилище
+const scheduledPaymentsCollection = "scheduled_payments"
+
+// Периодичность платежа
+const (
+	ScheduleOnce    = "once"
+	ScheduleWeekly  = "weekly"  // в день недели даты начала
+	ScheduleMonthly = "monthly" // в day_of_month каждого месяца
+)
+
+// Статусы платежа по расписанию
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCancelled = "cancelled"
+	ScheduleCompleted = "completed"
+)
+
+// Статусы исполнения
+const (
+	ExecutionPending     = "pending" // платеж отправляется в банк
+	ExecutionSucceeded   = "succeeded"
+	ExecutionFailed      = "failed"
+	ExecutionSkipped     = "skipped"     // срок прошел, пока сервер не работал или расписание стояло на паузе
+	ExecutionInterrupted = "interrupted" // сервер остановился во время отправки, результат неизвестен
+)
+
+const (
+	maxScheduleExecutions = 100             // сколько последних исполнений хранится
+	paymentExecuteTimeout = 2 * time.Minute // таймаут одной отправки в банк
+	maxScheduleYears      = 50              // самая поздняя дата начала/окончания от сегодня
+)
+
+// scheduleRetryDelays паузы перед повторными попытками исполнения.
+// Когда попытки кончились, расписание ставится на паузу
+var scheduleRetryDelays = []time.Duration{5 * time.Minute, 30 * time.Minute}
+
+// reClientErrorStatus код ответа банка в тексте ошибки ("create payment failed (422)", см. BankError)
+var reClientErrorStatus = regexp.MustCompile(`failed \((4[0-9]{2})\)`)
+
+// PaymentSchedule расписание платежа
+type PaymentSchedule struct {
+	Frequency  string     `json:"frequency"`
+	StartDate  time.Time  `json:"start_date"`             // первое исполнение, время суток сохраняется для всех
+	DayOfMonth int        `json:"day_of_month,omitempty"` // для monthly; 31 - последний день короткого месяца
+	EndDate    *time.Time `json:"end_date,omitempty"`     // последняя допустимая плановая дата
+	Count      int        `json:"count,omitempty"`        // сколько раз исполнить (0 - без ограничения)
+}
+
+// PaymentExecution одно исполнение платежа по расписанию
+type PaymentExecution struct {
+	Occurrence   int              `json:"occurrence"`
+	ScheduledFor time.Time        `json:"scheduled_for"` // плановая дата до переноса с выходных
+	Attempt      int              `json:"attempt"`
+	StartedAt    time.Time        `json:"started_at"`
+	FinishedAt   *time.Time       `json:"finished_at,omitempty"`
+	Status       string           `json:"status"`
+	Payment      *PaymentResponse `json:"payment,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// ScheduledPayment платеж, который сервер отправит в банк сам по расписанию
+type ScheduledPayment struct {
+	ID                  string             `json:"id"`
+	UserID              string             `json:"user_id"`
+	Bank                string             `json:"bank"`
+	Payment             PaymentRequest     `json:"payment"`
+	TemplateID          string             `json:"template_id,omitempty"`
+	PayeeID             string             `json:"payee_id,omitempty"`
+	Schedule            PaymentSchedule    `json:"schedule"`
+	Status              string             `json:"status"`
+	Occurrence          int                `json:"occurrence"` // номер очередного исполнения (с 0)
+	NextRunAt           *time.Time         `json:"next_run_at,omitempty"`
+	ExecutedCount       int                `json:"executed_count"`
+	ConsecutiveFailures int                `json:"consecutive_failures"`
+	LastError           string             `json:"last_error,omitempty"`
+	Executions          []PaymentExecution `json:"executions"` // новые в конце
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+}
+
+// ScheduledPaymentInput тело запроса на создание платежа по расписанию.
+// payment принимает то же, что POST /api/payments, включая template_id и payee_id
+type ScheduledPaymentInput struct {
+	Bank       string       `json:"bank,omitempty"`
+	Payment    PaymentInput `json:"payment"`
+	Frequency  string       `json:"frequency"`
+	StartDate  FlexibleTime `json:"start_date"`
+	DayOfMonth int          `json:"day_of_month,omitempty"`
+	EndDate    FlexibleTime `json:"end_date,omitempty"`
+	Count      int          `json:"count,omitempty"`
+}
+
+// PaymentScheduler хранит платежи по расписанию и исполняет их в фоне
+type PaymentScheduler struct {
+	store      *JSONStore
+	aggregator *BankAggregator
+	tracker    *PaymentTracker
+	interval   time.Duration
+
+	mu       sync.RWMutex
+	payments map[string]*ScheduledPayment // key: scheduled payment ID
+	running  map[string]bool              // сейчас отправляются в банк
+}
+
+// NewPaymentScheduler загружает платежи по расписанию. Исполнения, прерванные
+// остановкой сервера, не повторяются автоматически: расписание ставится на паузу,
+// чтобы пользователь проверил платеж в банке и не заплатил дважды
+func NewPaymentScheduler(store *JSONStore, aggregator *BankAggregator, tracker *PaymentTracker, interval time.Duration) (*PaymentScheduler, error) {
+	s := &PaymentScheduler{
+		store:      store,
+		aggregator: aggregator,
+		tracker:    tracker,
+		interval:   interval,
+		payments:   make(map[string]*ScheduledPayment),
+		running:    make(map[string]bool),
+	}
+
+	var payments []*ScheduledPayment
+	if err := store.Load(scheduledPaymentsCollection, &payments); err != nil {
+		return nil, fmt.Errorf("load scheduled payments: %w", err)
+	}
+
+	interrupted := false
+	for _, payment := range payments {
+		s.payments[payment.ID] = payment
+
+		last := len(payment.Executions) - 1
+		if last < 0 || payment.Executions[last].Status != ExecutionPending {
+			continue
+		}
+		payment.Executions[last].Status = ExecutionInterrupted
+		payment.Executions[last].Error = "server stopped while sending payment; check payment status in the bank before resuming"
+		payment.LastError = payment.Executions[last].Error
+		if payment.Status == ScheduleActive {
+			payment.Status = SchedulePaused
+		}
+		interrupted = true
+	}
+
+	if interrupted {
+		if err := s.persist(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Start запускает фоновую проверку расписаний
+func (s *PaymentScheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.RunDue(context.Background(), time.Now().UTC())
+			<-ticker.C
+		}
+	}()
+}
+
+// List возвращает платежи по расписанию пользователя, ближайшие первыми
+func (s *PaymentScheduler) List(userID string) []ScheduledPayment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]ScheduledPayment, 0)
+	for _, payment := range s.payments {
+		if payment.UserID == userID {
+			result = append(result, payment.clone())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].NextRunAt, result[j].NextRunAt
+		if a == nil || b == nil {
+			if a == nil && b == nil {
+				return result[i].CreatedAt.After(result[j].CreatedAt)
+			}
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+
+	return result
+}
+
+// Get возвращает платеж по расписанию пользователя
+func (s *PaymentScheduler) Get(userID, id string) (*ScheduledPayment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payment, err := s.payment(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := payment.clone()
+	return &result, nil
+}
+
+// Check проверяет расписание так же, как Create, но ничего не сохраняет.
+// Вызывается до отправки кода подтверждения
+func (s *PaymentScheduler) Check(input ScheduledPaymentInput, now time.Time) error {
+	_, err := newScheduledPayment("", "", PaymentRequest{}, input, now)
+	return err
+}
+
+// Create сохраняет платеж по расписанию. Реквизиты должны быть уже проверены
+func (s *PaymentScheduler) Create(userID, bank string, req PaymentRequest, input ScheduledPaymentInput, now time.Time) (*ScheduledPayment, error) {
+	payment, err := newScheduledPayment(userID, bank, req, input, now)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payments[payment.ID] = payment
+	if err := s.persist(); err != nil {
+		delete(s.payments, payment.ID)
+		return nil, err
+	}
+
+	result := payment.clone()
+	return &result, nil
+}
+
+// newScheduledPayment строит платеж по расписанию с первой датой исполнения
+func newScheduledPayment(userID, bank string, req PaymentRequest, input ScheduledPaymentInput, now time.Time) (*ScheduledPayment, error) {
+	schedule, err := buildPaymentSchedule(input, now)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &ScheduledPayment{
+		ID:         "sched-" + uuid.New().String(),
+		UserID:     userID,
+		Bank:       bank,
+		Payment:    req,
+		TemplateID: input.Payment.TemplateID,
+		PayeeID:    input.Payment.PayeeID,
+		Schedule:   schedule,
+		Status:     ScheduleActive,
+		Executions: []PaymentExecution{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	// Если day_of_month в первом месяце раньше даты начала, первое исполнение - в следующем
+	if schedule.occurrenceDate(0).Before(schedule.StartDate) {
+		payment.Occurrence = 1
+	}
+	if !payment.scheduleNext(payment.Occurrence) {
+		return nil, ValidationErrors{{Field: "end_date", Code: "invalid_value", Message: "schedule has no occurrences before end_date"}}
+	}
+
+	return payment, nil
+}
+
+// Pause приостанавливает расписание. Идущая отправка завершится
+func (s *PaymentScheduler) Pause(userID, id string, now time.Time) (*ScheduledPayment, error) {
+	return s.setStatus(userID, id, now, func(payment *ScheduledPayment) error {
+		if payment.Status != ScheduleActive {
+			return fmt.Errorf("%w: scheduled payment is %s", ErrInvalidInput, payment.Status)
+		}
+		payment.Status = SchedulePaused
+		return nil
+	})
+}
+
+// Resume возобновляет расписание. Очередное исполнение, срок которого уже прошел,
+// отправляется сразу (в том числе повтор после ошибок), более ранние пропущены
+func (s *PaymentScheduler) Resume(userID, id string, now time.Time) (*ScheduledPayment, error) {
+	return s.setStatus(userID, id, now, func(payment *ScheduledPayment) error {
+		if payment.Status != SchedulePaused {
+			return fmt.Errorf("%w: scheduled payment is %s", ErrInvalidInput, payment.Status)
+		}
+		if s.running[payment.ID] {
+			return fmt.Errorf("%w: payment is being sent, try again later", ErrInvalidInput)
+		}
+
+		payment.Status = ScheduleActive
+		payment.ConsecutiveFailures = 0
+		payment.LastError = ""
+		if !payment.scheduleNext(payment.Occurrence) {
+			payment.Status = ScheduleCompleted
+		}
+		return nil
+	})
+}
+
+// Cancel отменяет расписание окончательно, история исполнений сохраняется
+func (s *PaymentScheduler) Cancel(userID, id string, now time.Time) (*ScheduledPayment, error) {
+	return s.setStatus(userID, id, now, func(payment *ScheduledPayment) error {
+		if payment.Status == ScheduleCancelled || payment.Status == ScheduleCompleted {
+			return fmt.Errorf("%w: scheduled payment is already %s", ErrInvalidInput, payment.Status)
+		}
+		payment.Status = ScheduleCancelled
+		payment.NextRunAt = nil
+		return nil
+	})
+}
+
+// setStatus меняет расписание под блокировкой и откатывает изменение при ошибке сохранения
+func (s *PaymentScheduler) setStatus(userID, id string, now time.Time, change func(*ScheduledPayment) error) (*ScheduledPayment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payment, err := s.payment(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := payment.clone()
+	if err := change(payment); err != nil {
+		return nil, err
+	}
+	payment.UpdatedAt = now
+
+	if err := s.persist(); err != nil {
+		*payment = previous
+		return nil, err
+	}
+
+	result := payment.clone()
+	return &result, nil
+}
+
+// EXECUTION
+
+// RunDue отправляет в банк все платежи, срок которых наступил
+func (s *PaymentScheduler) RunDue(ctx context.Context, now time.Time) {
+	type dueExecution struct {
+		id         string
+		bank       string
+		userID     string
+		request    PaymentRequest
+		occurrence int
+	}
+
+	s.mu.Lock()
+	var due []dueExecution
+	for _, payment := range s.payments {
+		if payment.Status != ScheduleActive || payment.NextRunAt == nil ||
+			payment.NextRunAt.After(now) || s.running[payment.ID] {
+			continue
+		}
+
+		// Отметка о начале сохраняется до отправки, чтобы после падения сервера
+		// не отправить платеж повторно
+		payment.appendExecution(PaymentExecution{
+			Occurrence:   payment.Occurrence,
+			ScheduledFor: payment.Schedule.occurrenceDate(payment.Occurrence),
+			Attempt:      payment.ConsecutiveFailures + 1,
+			StartedAt:    now,
+			Status:       ExecutionPending,
+		})
+		s.running[payment.ID] = true
+		due = append(due, dueExecution{
+			id:         payment.ID,
+			bank:       payment.Bank,
+			userID:     payment.UserID,
+			request:    payment.Payment,
+			occurrence: payment.Occurrence,
+		})
+	}
+
+	if len(due) > 0 {
+		if err := s.persist(); err != nil {
+			// Без сохраненной отметки отправлять нельзя - попробуем на следующем тике
+			paymentsLog.WarnContext(ctx, "Failed to save scheduled payments, skipping run", "error", err)
+			for _, d := range due {
+				payment := s.payments[d.id]
+				payment.Executions = payment.Executions[:len(payment.Executions)-1]
+				delete(s.running, d.id)
+			}
+			due = nil
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range due {
+		// Ключ зависит от исполнения: банк с поддержкой Idempotency-Key не проведет
+		// повтор того же исполнения дважды
+		execCtx, cancel := context.WithTimeout(ctx, paymentExecuteTimeout)
+		execCtx = context.WithValue(execCtx, CtxIdempotencyKey,
+			bankIdempotencyKey(d.userID, IdempotencyScopeScheduled, fmt.Sprintf("%s-%d", d.id, d.occurrence)))
+		resp, err := s.aggregator.CreatePayment(execCtx, d.bank, d.userID, d.request)
+		cancel()
+
+		if err != nil {
+			paymentsLog.WarnContext(ctx, "Scheduled payment failed", "scheduled_payment_id", d.id, "occurrence", d.occurrence, "error", err)
+		} else {
+			paymentsLog.InfoContext(ctx, "Scheduled payment sent", "scheduled_payment_id", d.id, "occurrence", d.occurrence, "payment_id", resp.PaymentID)
+			if err := s.tracker.Track(d.userID, d.bank, d.request, resp, PaymentSourceScheduled, d.id, time.Now().UTC()); err != nil {
+				paymentsLog.WarnContext(ctx, "Failed to record payment", "scheduled_payment_id", d.id, "payment_id", resp.PaymentID, "error", err)
+			}
+		}
+
+		s.finishExecution(d.id, resp, err, time.Now().UTC())
+	}
+}
+
+// finishExecution записывает результат отправки и планирует следующее исполнение
+func (s *PaymentScheduler) finishExecution(id string, resp *PaymentResponse, execErr error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, id)
+	payment, exists := s.payments[id]
+	if !exists {
+		return
+	}
+
+	execution := &payment.Executions[len(payment.Executions)-1]
+	execution.FinishedAt = &now
+	payment.UpdatedAt = now
+
+	if execErr == nil {
+		execution.Status = ExecutionSucceeded
+		execution.Payment = resp
+		payment.ExecutedCount++
+		payment.ConsecutiveFailures = 0
+		payment.LastError = ""
+
+		if !payment.scheduleNext(payment.Occurrence+1) && payment.Status == ScheduleActive {
+			payment.Status = ScheduleCompleted
+		}
+		// Исполнения, чей срок прошел, пока шла эта отправка или сервер стоял, не догоняем
+		for payment.NextRunAt != nil && payment.NextRunAt.Before(now) {
+			payment.appendExecution(PaymentExecution{
+				Occurrence:   payment.Occurrence,
+				ScheduledFor: payment.Schedule.occurrenceDate(payment.Occurrence),
+				StartedAt:    now,
+				FinishedAt:   &now,
+				Status:       ExecutionSkipped,
+			})
+			if !payment.scheduleNext(payment.Occurrence+1) && payment.Status == ScheduleActive {
+				payment.Status = ScheduleCompleted
+			}
+		}
+	} else {
+		execution.Status = ExecutionFailed
+		execution.Error = execErr.Error()
+		payment.ConsecutiveFailures++
+		payment.LastError = execErr.Error()
+
+		// Временные ошибки повторяем; после исчерпания попыток или при ошибке
+		// в реквизитах ставим на паузу, не переходя к следующему исполнению
+		retry := payment.ConsecutiveFailures - 1
+		if isPermanentPaymentError(execErr) || retry >= len(scheduleRetryDelays) {
+			if payment.Status == ScheduleActive {
+				payment.Status = SchedulePaused
+			}
+		} else {
+			next := now.Add(scheduleRetryDelays[retry])
+			payment.NextRunAt = &next
+		}
+	}
+
+	if payment.Status == ScheduleCancelled {
+		payment.NextRunAt = nil
+	}
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save scheduled payment result", "scheduled_payment_id", id, "error", err)
+	}
+}
+
+// isPermanentPaymentError ошибка, которую бесполезно повторять: неверные реквизиты,
+// запрет политикой платежей или отказ банка с кодом 4xx (кроме 408 и 429)
+func isPermanentPaymentError(err error) bool {
+	var violation *PolicyViolation
+	if errors.Is(err, ErrInvalidInput) || errors.As(err, &violation) {
+		return true
+	}
+	m := reClientErrorStatus.FindStringSubmatch(err.Error())
+	return m != nil && m[1] != "408" && m[1] != "429"
+}
+
+// SCHEDULE
+
+// buildPaymentSchedule проверяет параметры расписания из запроса
+func buildPaymentSchedule(input ScheduledPaymentInput, now time.Time) (PaymentSchedule, error) {
+	var errs ValidationErrors
+	today := truncatePeriod(now, IntervalDay)
+	latest := today.AddDate(maxScheduleYears, 0, 0)
+
+	schedule := PaymentSchedule{
+		Frequency:  input.Frequency,
+		StartDate:  input.StartDate.UTC(),
+		DayOfMonth: input.DayOfMonth,
+		Count:      input.Count,
+	}
+	if schedule.Frequency == "" {
+		schedule.Frequency = ScheduleOnce
+	}
+
+	switch schedule.Frequency {
+	case ScheduleOnce, ScheduleWeekly, ScheduleMonthly:
+	default:
+		errs.add("frequency", "invalid_value", "frequency must be %q, %q or %q", ScheduleOnce, ScheduleWeekly, ScheduleMonthly)
+	}
+
+	switch {
+	case input.StartDate.IsZero():
+		errs.add("start_date", "required", "start_date is required")
+	case schedule.StartDate.Before(today):
+		errs.add("start_date", "invalid_value", "start_date must not be in the past")
+	case schedule.StartDate.After(latest):
+		errs.add("start_date", "invalid_value", "start_date must be within %d years", maxScheduleYears)
+	}
+
+	if schedule.Frequency == ScheduleMonthly {
+		if schedule.DayOfMonth == 0 {
+			schedule.DayOfMonth = schedule.StartDate.Day()
+		}
+		if schedule.DayOfMonth < 1 || schedule.DayOfMonth > 31 {
+			errs.add("day_of_month", "invalid_value", "day_of_month must be between 1 and 31")
+		}
+	} else if schedule.DayOfMonth != 0 {
+		errs.add("day_of_month", "not_applicable", "day_of_month is only allowed for monthly schedules")
+	}
+
+	if schedule.Frequency == ScheduleOnce && (schedule.Count != 0 || !input.EndDate.IsZero()) {
+		errs.add("frequency", "not_applicable", "count and end_date are only allowed for recurring schedules")
+	}
+	if schedule.Count < 0 {
+		errs.add("count", "invalid_value", "count must not be negative")
+	}
+
+	if !input.EndDate.IsZero() {
+		// Дата окончания включительно: платеж в этот день еще исполняется
+		end := truncatePeriod(input.EndDate.UTC(), IntervalDay).AddDate(0, 0, 1).Add(-time.Nanosecond)
+		if end.Before(schedule.StartDate) || end.After(latest) {
+			errs.add("end_date", "invalid_value", "end_date must be after start_date and within %d years", maxScheduleYears)
+		}
+		schedule.EndDate = &end
+	}
+
+	return schedule, errs.err()
+}
+
+// occurrenceDate плановая дата n-го исполнения (до переноса с выходных)
+func (p PaymentSchedule) occurrenceDate(n int) time.Time {
+	start := p.StartDate
+
+	switch p.Frequency {
+	case ScheduleWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case ScheduleMonthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1,
+			start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+		day := p.DayOfMonth
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return first.AddDate(0, 0, day-1)
+	default:
+		return start
+	}
+}
+
+// nextBusinessDay переносит дату с субботы и воскресенья на понедельник.
+// Праздничные дни банки через API не отдают, поэтому не учитываются
+func nextBusinessDay(t time.Time) time.Time {
+	switch t.Weekday() {
+	case time.Saturday:
+		return t.AddDate(0, 0, 2)
+	case time.Sunday:
+		return t.AddDate(0, 0, 1)
+	default:
+		return t
+	}
+}
+
+// scheduleNext делает n-е исполнение очередным. Возвращает false, если расписание исчерпано
+func (p *ScheduledPayment) scheduleNext(n int) bool {
+	p.Occurrence = n
+
+	date := p.Schedule.occurrenceDate(n)
+	exhausted := (p.Schedule.Frequency == ScheduleOnce && n > 0) ||
+		(p.Schedule.Count > 0 && p.ExecutedCount >= p.Schedule.Count) ||
+		(p.Schedule.EndDate != nil && date.After(*p.Schedule.EndDate))
+	if exhausted {
+		p.NextRunAt = nil
+		return false
+	}
+
+	next := nextBusinessDay(date)
+	p.NextRunAt = &next
+	return true
+}
+
+// appendExecution добавляет исполнение, оставляя только последние
+func (p *ScheduledPayment) appendExecution(execution PaymentExecution) {
+	p.Executions = append(p.Executions, execution)
+	if extra := len(p.Executions) - maxScheduleExecutions; extra > 0 {
+		p.Executions = append([]PaymentExecution(nil), p.Executions[extra:]...)
+	}
+}
+
+// clone возвращает копию, не разделяющую срезы и указатели с оригиналом
+func (p *ScheduledPayment) clone() ScheduledPayment {
+	c := *p
+	c.Executions = append([]PaymentExecution{}, p.Executions...)
+	if p.NextRunAt != nil {
+		next := *p.NextRunAt
+		c.NextRunAt = &next
+	}
+	if p.Schedule.EndDate != nil {
+		end := *p.Schedule.EndDate
+		c.Schedule.EndDate = &end
+	}
+	return c
+}
+
+// payment ищет платеж по расписанию пользователя (вызывается под блокировкой)
+func (s *PaymentScheduler) payment(userID, id string) (*ScheduledPayment, error) {
+	payment, exists := s.payments[id]
+	if !exists || payment.UserID != userID {
+		return nil, fmt.Errorf("scheduled payment %s: %w", id, ErrNotFound)
+	}
+	return payment, nil
+}
+
+// persist сохраняет все платежи по расписанию (вызывается под блокировкой)
+func (s *PaymentScheduler) persist() error {
+	payments := make([]*ScheduledPayment, 0, len(s.payments))
+	for _, payment := range s.payments {
+		payments = append(payments, payment)
+	}
+	return s.store.Save(scheduledPaymentsCollection, payments)
+}
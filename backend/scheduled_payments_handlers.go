@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SCHEDULED PAYMENT ENDPOINTS
+
+// handleListScheduledPayments возвращает платежи по расписанию пользователя
+// GET /api/scheduled-payments
+func (s *Server) handleListScheduledPayments(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.scheduler.List(userID))
+}
+
+// handleCreateScheduledPayment проверяет разовый или повторяющийся платеж и создает
+// черновик: расписание начинает действовать после подтверждения кодом
+// (POST /api/payments/{id}/confirm), исполнения по нему кода не требуют
+// POST /api/scheduled-payments
+func (s *Server) handleCreateScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input ScheduledPaymentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	req, templateBank, err := s.payees.ResolvePayment(userID, input.Payment)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to resolve payment: "+err.Error())
+		return
+	}
+
+	bankCode := input.Bank
+	if bankCode == "" {
+		bankCode = templateBank
+	}
+	if bankCode == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing 'bank' field")
+		return
+	}
+	if _, err := s.aggregator.GetBankByCode(r.Context(), bankCode); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Unknown bank: "+bankCode)
+		return
+	}
+
+	if err := ValidatePaymentRequest(req); err != nil {
+		writeValidationError(w, r, "Invalid payment details", err)
+		return
+	}
+
+	if err := s.scheduler.Check(input, time.Now().UTC()); err != nil {
+		writeValidationError(w, r, "Failed to create scheduled payment", err)
+		return
+	}
+
+	draft, err := s.drafts.CreateSchedule(r.Context(), userID, bankCode, req, input, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create scheduled payment draft", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create scheduled payment draft: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, draft)
+}
+
+// handleGetScheduledPayment возвращает платеж по расписанию с историей исполнений
+// GET /api/scheduled-payments/{id}
+func (s *Server) handleGetScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing scheduled payment ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	payment, err := s.scheduler.Get(userID, id)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get scheduled payment: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payment)
+}
+
+// handlePauseScheduledPayment приостанавливает расписание
+// POST /api/scheduled-payments/{id}/pause
+func (s *Server) handlePauseScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	s.changeScheduledPayment(w, r, "pause", s.scheduler.Pause)
+}
+
+// handleResumeScheduledPayment возобновляет расписание
+// POST /api/scheduled-payments/{id}/resume
+func (s *Server) handleResumeScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	s.changeScheduledPayment(w, r, "resume", s.scheduler.Resume)
+}
+
+// handleCancelScheduledPayment отменяет расписание
+// POST /api/scheduled-payments/{id}/cancel
+func (s *Server) handleCancelScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	s.changeScheduledPayment(w, r, "cancel", s.scheduler.Cancel)
+}
+
+// changeScheduledPayment общая часть pause/resume/cancel
+func (s *Server) changeScheduledPayment(w http.ResponseWriter, r *http.Request, action string,
+	change func(userID, id string, now time.Time) (*ScheduledPayment, error)) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing scheduled payment ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	payment, err := change(userID, id, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to "+action+" scheduled payment", "scheduled_payment_id", id, "error", err)
+		writeError(w, r, errorStatus(err), "Failed to "+action+" scheduled payment: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payment)
+}
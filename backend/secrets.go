@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reSecretName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,127}$`)
+
+// keystoreAAD привязка шифротекста к хранилищу секретов
+const keystoreAAD = "keystore"
+
+// SecretProvider источник секретов (client_secret банков и т.п.). Имена секретов -
+// строчные: client_secret, client_secret_vbank, client_secret_team053_vbank
+type SecretProvider interface {
+	// Name название источника для логов (без значений секретов)
+	Name() string
+	// Lookup возвращает секрет по имени; ok=false - в источнике его нет
+	Lookup(name string) (value string, ok bool)
+	// Reload перечитывает источник и сообщает, изменились ли секреты
+	Reload() (changed bool, err error)
+}
+
+// EnvSecretProvider секреты из переменных окружения (и .env): client_secret_vbank -
+// CLIENT_SECRET_VBANK. Окружение процесса не меняется, поэтому Reload ничего не делает
+type EnvSecretProvider struct{}
+
+// Name название источника
+func (EnvSecretProvider) Name() string {
+	return "env"
+}
+
+// Lookup читает переменную окружения
+func (EnvSecretProvider) Lookup(name string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(envSecretName(name)))
+	return value, value != ""
+}
+
+// Reload окружение процесса не перечитывается
+func (EnvSecretProvider) Reload() (bool, error) {
+	return false, nil
+}
+
+// envSecretName имя переменной окружения для секрета
+func envSecretName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// FileSecretProvider секреты из файлов в директории (Docker secrets, Kubernetes
+// secret volume): имя файла - имя секрета, содержимое - значение
+type FileSecretProvider struct {
+	dir string
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewFileSecretProvider читает секреты из директории
+func NewFileSecretProvider(dir string) (*FileSecretProvider, error) {
+	values, err := readSecretFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSecretProvider{dir: dir, values: values}, nil
+}
+
+// Name название источника
+func (p *FileSecretProvider) Name() string {
+	return "files " + p.dir
+}
+
+// Lookup возвращает секрет из файла
+func (p *FileSecretProvider) Lookup(name string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	value, ok := p.values[name]
+	return value, ok
+}
+
+// Reload перечитывает директорию (Kubernetes обновляет смонтированные секреты на месте)
+func (p *FileSecretProvider) Reload() (bool, error) {
+	values, err := readSecretFiles(p.dir)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if maps.Equal(values, p.values) {
+		return false, nil
+	}
+	p.values = values
+	return true, nil
+}
+
+// readSecretFiles читает файлы директории. Скрытые файлы и поддиректории (служебные
+// ..data в Kubernetes) пропускаются, символические ссылки разыменовываются
+func readSecretFiles(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read secrets dir: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret %s: %w", name, err)
+		}
+		if value := strings.TrimSpace(string(data)); value != "" {
+			values[strings.ToLower(name)] = value
+		}
+	}
+
+	return values, nil
+}
+
+// KeystoreSecretProvider секреты из локального хранилища: JSON, зашифрованный
+// мастер-ключами из ENCRYPTION_KEYS (см. Encryptor). Меняется командой keystore
+type KeystoreSecretProvider struct {
+	path string
+	enc  *Encryptor
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewKeystoreSecretProvider открывает хранилище секретов
+func NewKeystoreSecretProvider(path string, enc *Encryptor) (*KeystoreSecretProvider, error) {
+	if !enc.Enabled() {
+		return nil, fmt.Errorf("SECRETS_KEYSTORE requires ENCRYPTION_KEYS")
+	}
+
+	values, err := readKeystore(path, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	// После ротации мастер-ключа хранилище перешифровывается активным ключом
+	if data, err := os.ReadFile(path); err == nil && enc.NeedsReencrypt(data) {
+		if err := writeKeystore(path, enc, values); err != nil {
+			return nil, err
+		}
+		storageLog.Info("Keystore re-encrypted", "path", path, "key_id", enc.keys.ActiveKeyID())
+	}
+
+	return &KeystoreSecretProvider{path: path, enc: enc, values: values}, nil
+}
+
+// Name название источника
+func (p *KeystoreSecretProvider) Name() string {
+	return "keystore " + p.path
+}
+
+// Lookup возвращает секрет из хранилища
+func (p *KeystoreSecretProvider) Lookup(name string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	value, ok := p.values[name]
+	return value, ok
+}
+
+// Reload перечитывает файл хранилища
+func (p *KeystoreSecretProvider) Reload() (bool, error) {
+	values, err := readKeystore(p.path, p.enc)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if maps.Equal(values, p.values) {
+		return false, nil
+	}
+	p.values = values
+	return true, nil
+}
+
+// readKeystore читает и расшифровывает хранилище (нет файла - нет секретов)
+func readKeystore(path string, enc *Encryptor) (map[string]string, error) {
+	values := make(map[string]string)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read keystore: %w", err)
+	}
+	if enc.KeyID(data) == "" {
+		return nil, fmt.Errorf("keystore %s is not encrypted", path)
+	}
+
+	data, err = enc.Open(keystoreAAD, data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt keystore: %w", err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parse keystore: %w", err)
+	}
+
+	return values, nil
+}
+
+// writeKeystore шифрует и атомарно записывает хранилище
+func writeKeystore(path string, enc *Encryptor, values map[string]string) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	data, err = enc.Seal(keystoreAAD, data)
+	if err != nil {
+		return fmt.Errorf("encrypt keystore: %w", err)
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// Secrets цепочка источников секретов: значение берется из первого источника,
+// где оно есть. Источники периодически перечитываются
+type Secrets struct {
+	providers []SecretProvider
+}
+
+// NewSecrets создает цепочку источников (в порядке приоритета)
+func NewSecrets(providers ...SecretProvider) *Secrets {
+	return &Secrets{providers: providers}
+}
+
+// loadSecrets собирает источники из конфигурации: хранилище (SECRETS_KEYSTORE),
+// файлы (SECRETS_DIR), окружение
+func loadSecrets(keystorePath, dir string, encryptionKeys []MasterKey) (*Secrets, error) {
+	var providers []SecretProvider
+
+	if keystorePath != "" {
+		enc, err := keystoreEncryptor(encryptionKeys)
+		if err != nil {
+			return nil, err
+		}
+		keystore, err := NewKeystoreSecretProvider(keystorePath, enc)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, keystore)
+	}
+
+	if dir != "" {
+		files, err := NewFileSecretProvider(dir)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, files)
+	}
+
+	return NewSecrets(append(providers, EnvSecretProvider{})...), nil
+}
+
+// keystoreEncryptor шифратор хранилища секретов на мастер-ключах данных
+func keystoreEncryptor(encryptionKeys []MasterKey) (*Encryptor, error) {
+	if len(encryptionKeys) == 0 {
+		return nil, fmt.Errorf("SECRETS_KEYSTORE requires ENCRYPTION_KEYS")
+	}
+	keys, err := NewLocalKeyProvider(encryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("load encryption keys: %w", err)
+	}
+	return NewEncryptor(keys), nil
+}
+
+// Providers названия источников в порядке приоритета
+func (s *Secrets) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for _, p := range s.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Lookup ищет первый найденный секрет из списка имен (от более конкретного к общему).
+// source - источник и имя секрета для логов
+func (s *Secrets) Lookup(names ...string) (value, source string, ok bool) {
+	for _, name := range names {
+		for _, p := range s.providers {
+			if value, ok := p.Lookup(name); ok {
+				return value, p.Name() + ": " + name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// ClientSecret client_secret арендатора для банка. Порядок имен: для банка и команды,
+// для банка, общий (два последних - только для команды из TEAM_ID). Без секрета в
+// источниках используется client_secret из TENANTS_FILE
+func (s *Secrets) ClientSecret(tenant Tenant, bank TenantBank) (value, source string, err error) {
+	names := clientSecretNames(tenant, bank.Code)
+	if value, source, ok := s.Lookup(names...); ok {
+		return value, source, nil
+	}
+	if bank.ClientSecret != "" {
+		return bank.ClientSecret, "tenants file", nil
+	}
+
+	envNames := make([]string, 0, len(names))
+	for _, name := range names {
+		envNames = append(envNames, envSecretName(name))
+	}
+	return "", "", fmt.Errorf("no client secret for tenant %s bank %s (set one of %s)", tenant.ID, bank.Code, strings.Join(envNames, ", "))
+}
+
+// clientSecretNames имена секрета от более конкретного к общему
+func clientSecretNames(tenant Tenant, bankCode string) []string {
+	tenantID := strings.ToLower(tenant.ID)
+	bankCode = strings.ToLower(bankCode)
+
+	names := []string{"client_secret_" + tenantID + "_" + bankCode}
+	if tenant.shared {
+		names = append(names, "client_secret_"+bankCode, "client_secret")
+	}
+	return names
+}
+
+// Start периодически перечитывает источники и вызывает onChange, если секреты изменились
+func (s *Secrets) Start(interval time.Duration, onChange func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if s.Reload() {
+				onChange()
+			}
+		}
+	}()
+}
+
+// Reload перечитывает все источники. Ошибка источника логируется, его прежние
+// значения остаются в силе
+func (s *Secrets) Reload() bool {
+	changed := false
+	for _, p := range s.providers {
+		ok, err := p.Reload()
+		if err != nil {
+			storageLog.Warn("Failed to reload secrets", "provider", p.Name(), "error", err)
+			continue
+		}
+		if ok {
+			storageLog.Info("Secrets changed", "provider", p.Name())
+			changed = true
+		}
+	}
+	return changed
+}
+
+// runKeystoreCommand управляет хранилищем секретов из командной строки:
+//
+//	backend keystore list
+//	backend keystore set <name>   (значение читается из stdin)
+//	backend keystore delete <name>
+func runKeystoreCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	path := os.Getenv("SECRETS_KEYSTORE")
+	if path == "" {
+		return fmt.Errorf("SECRETS_KEYSTORE is not set")
+	}
+	keys, err := loadMasterKeys(os.Getenv("ENCRYPTION_KEYS_FILE"), os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		return err
+	}
+	enc, err := keystoreEncryptor(keys)
+	if err != nil {
+		return err
+	}
+
+	values, err := readKeystore(path, enc)
+	if err != nil {
+		return err
+	}
+
+	usage := fmt.Errorf("usage: keystore list | set <name> | delete <name>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+
+	case args[0] == "set" && len(args) == 2:
+		name := strings.ToLower(args[1])
+		if !reSecretName.MatchString(name) {
+			return fmt.Errorf("invalid secret name %q", args[1])
+		}
+		data, err := io.ReadAll(io.LimitReader(stdin, 64<<10))
+		if err != nil {
+			return fmt.Errorf("read secret value: %w", err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return fmt.Errorf("empty secret value")
+		}
+		values[name] = value
+
+	case args[0] == "delete" && len(args) == 2:
+		name := strings.ToLower(args[1])
+		if _, exists := values[name]; !exists {
+			return fmt.Errorf("secret %s: %w", name, ErrNotFound)
+		}
+		delete(values, name)
+
+	default:
+		return usage
+	}
+
+	// Файл перечитывается работающим сервером в течение SECRETS_RELOAD_INTERVAL
+	return writeKeystore(path, enc, values)
+}
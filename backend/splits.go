@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// splitsCollection имя коллекции в хранилище
+const splitsCollection = "transaction_splits"
+
+// maxSplitParts максимальное количество частей одной транзакции
+const maxSplitParts = 20
+
+// TransactionSplit разбиение одной транзакции на части с собственными категориями
+type TransactionSplit struct {
+	UserID         string      `json:"user_id"`
+	Bank           string      `json:"bank"`
+	TransactionID  string      `json:"transaction_id"`
+	OriginalAmount float64     `json:"original_amount"` // сумма транзакции со знаком на момент разбиения
+	Currency       string      `json:"currency"`
+	Parts          []SplitPart `json:"parts"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// SplitPart часть транзакции (сумма без знака, знак берется у исходной транзакции)
+type SplitPart struct {
+	Amount   float64 `json:"amount"`
+	Category string  `json:"category"`
+	Note     string  `json:"note,omitempty"`
+}
+
+// SplitInput тело запроса на разбиение транзакции
+type SplitInput struct {
+	Parts []SplitPart `json:"parts"`
+}
+
+// SplitStore хранит разбиения транзакций по категориям
+type SplitStore struct {
+	store *JSONStore
+
+	mu     sync.RWMutex
+	splits map[string]*TransactionSplit // key: "userID|bank|transactionID"
+}
+
+// NewSplitStore загружает разбиения из хранилища
+func NewSplitStore(store *JSONStore) (*SplitStore, error) {
+	s := &SplitStore{
+		store:  store,
+		splits: make(map[string]*TransactionSplit),
+	}
+
+	var splits []*TransactionSplit
+	if err := store.Load(splitsCollection, &splits); err != nil {
+		return nil, fmt.Errorf("load transaction splits: %w", err)
+	}
+	for _, split := range splits {
+		s.splits[annotationKey(split.UserID, split.Bank, split.TransactionID)] = split
+	}
+
+	return s, nil
+}
+
+// Get возвращает разбиение транзакции
+func (s *SplitStore) Get(userID, bank, transactionID string) (*TransactionSplit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	split, exists := s.splits[annotationKey(userID, bank, transactionID)]
+	if !exists {
+		return nil, fmt.Errorf("split for transaction %s: %w", transactionID, ErrNotFound)
+	}
+
+	c := split.clone()
+	return &c, nil
+}
+
+// Set проверяет, что части в сумме дают исходную транзакцию, и сохраняет разбиение
+func (s *SplitStore) Set(userID string, tx Transaction, input SplitInput) (*TransactionSplit, error) {
+	parts, err := validateSplitParts(tx.Amount, input.Parts)
+	if err != nil {
+		return nil, err
+	}
+
+	split := &TransactionSplit{
+		UserID:         userID,
+		Bank:           tx.Bank,
+		TransactionID:  tx.ID,
+		OriginalAmount: tx.Amount,
+		Currency:       tx.Currency,
+		Parts:          parts,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	key := annotationKey(userID, tx.Bank, tx.ID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.splits[key]
+	s.splits[key] = split
+	if err := s.persist(); err != nil {
+		if existed {
+			s.splits[key] = previous
+		} else {
+			delete(s.splits, key)
+		}
+		return nil, err
+	}
+
+	c := split.clone()
+	return &c, nil
+}
+
+// Delete отменяет разбиение транзакции
+func (s *SplitStore) Delete(userID, bank, transactionID string) error {
+	key := annotationKey(userID, bank, transactionID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	split, exists := s.splits[key]
+	if !exists {
+		return fmt.Errorf("split for transaction %s: %w", transactionID, ErrNotFound)
+	}
+
+	delete(s.splits, key)
+	if err := s.persist(); err != nil {
+		s.splits[key] = split
+		return err
+	}
+
+	return nil
+}
+
+// Attach добавляет к транзакциям их разбиения (поле splits), не меняя список
+func (s *SplitStore) Attach(userID string, transactions []Transaction) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range transactions {
+		if split, ok := s.current(userID, transactions[i]); ok {
+			transactions[i].Splits = append([]SplitPart{}, split.Parts...)
+		}
+	}
+
+	return transactions
+}
+
+// Expand заменяет разбитые транзакции их частями - так их видят аналитика и бюджеты.
+// Части наследуют дату, банк, мерчанта и теги исходной транзакции
+func (s *SplitStore) Expand(userID string, transactions []Transaction) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		split, ok := s.current(userID, tx)
+		if !ok {
+			result = append(result, tx)
+			continue
+		}
+
+		sign := 1.0
+		if tx.Amount < 0 {
+			sign = -1.0
+		}
+
+		for i, part := range split.Parts {
+			child := tx
+			child.ID = tx.ID + "#" + strconv.Itoa(i+1)
+			child.ParentID = tx.ID
+			child.Amount = sign * part.Amount
+			child.Category = part.Category
+			child.Note = part.Note
+			child.Attachments = []Attachment{}
+			child.Splits = nil
+			result = append(result, child)
+		}
+	}
+
+	return result
+}
+
+// current возвращает актуальное разбиение транзакции (вызывается под блокировкой).
+// Если банк изменил сумму транзакции, разбиение считается устаревшим и игнорируется
+func (s *SplitStore) current(userID string, tx Transaction) (*TransactionSplit, bool) {
+	split, exists := s.splits[annotationKey(userID, tx.Bank, tx.ID)]
+	if !exists {
+		return nil, false
+	}
+
+	if toCents(split.OriginalAmount) != toCents(tx.Amount) {
+		handlersLog.Warn("Transaction split is stale", "bank", tx.Bank, "transaction_id", tx.ID,
+			"amount", tx.Amount, "split_amount", split.OriginalAmount)
+		return nil, false
+	}
+
+	return split, true
+}
+
+// persist сохраняет все разбиения (вызывается под блокировкой)
+func (s *SplitStore) persist() error {
+	splits := make([]*TransactionSplit, 0, len(s.splits))
+	for _, split := range s.splits {
+		splits = append(splits, split)
+	}
+
+	return s.store.Save(splitsCollection, splits)
+}
+
+// clone возвращает глубокую копию разбиения
+func (t *TransactionSplit) clone() TransactionSplit {
+	c := *t
+	c.Parts = append([]SplitPart{}, t.Parts...)
+	return c
+}
+
+// validateSplitParts проверяет части и их сумму с точностью до копейки
+func validateSplitParts(amount float64, parts []SplitPart) ([]SplitPart, error) {
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: split needs at least 2 parts", ErrInvalidInput)
+	}
+	if len(parts) > maxSplitParts {
+		return nil, fmt.Errorf("%w: split can have at most %d parts", ErrInvalidInput, maxSplitParts)
+	}
+
+	var total int64
+	result := make([]SplitPart, 0, len(parts))
+	for i, part := range parts {
+		cents := toCents(part.Amount)
+		if cents <= 0 || math.Abs(part.Amount*100-float64(cents)) > 1e-6 {
+			return nil, fmt.Errorf("%w: part %d amount must be positive with at most 2 decimal places", ErrInvalidInput, i+1)
+		}
+
+		category := strings.TrimSpace(part.Category)
+		if category == "" {
+			return nil, fmt.Errorf("%w: part %d category is required", ErrInvalidInput, i+1)
+		}
+		if len([]rune(part.Note)) > maxNoteLength {
+			return nil, fmt.Errorf("%w: part %d note is longer than %d characters", ErrInvalidInput, i+1, maxNoteLength)
+		}
+
+		total += cents
+		result = append(result, SplitPart{
+			Amount:   float64(cents) / 100,
+			Category: category,
+			Note:     strings.TrimSpace(part.Note),
+		})
+	}
+
+	want := toCents(math.Abs(amount))
+	if total != want {
+		return nil, fmt.Errorf("%w: parts sum to %.2f, transaction amount is %.2f",
+			ErrInvalidInput, float64(total)/100, float64(want)/100)
+	}
+
+	return result, nil
+}
+
+// toCents переводит сумму в копейки для точного сравнения
+func toCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TRANSACTION SPLIT ENDPOINTS
+
+// handleGetSplit возвращает разбиение транзакции
+// GET /api/transactions/{bank}/{id}/splits
+func (s *Server) handleGetSplit(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	split, err := s.splits.Get(userID, bankCode, transactionID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get split: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, split)
+}
+
+// handleSetSplit разбивает транзакцию на части (сумма частей должна совпасть с суммой транзакции)
+// PUT /api/transactions/{bank}/{id}/splits
+func (s *Server) handleSetSplit(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	var input SplitInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Сумму сверяем с данными банка, а не с тем, что прислал клиент
+	tx, err := s.aggregator.FindTransaction(r.Context(), bankCode, userID, transactionID)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to find transaction for split", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to find transaction: "+err.Error())
+		return
+	}
+
+	split, err := s.splits.Set(userID, *tx, input)
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to save split", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to save split: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, split)
+}
+
+// handleDeleteSplit отменяет разбиение транзакции
+// DELETE /api/transactions/{bank}/{id}/splits
+func (s *Server) handleDeleteSplit(w http.ResponseWriter, r *http.Request) {
+	bankCode, transactionID, ok := s.annotationTarget(w, r)
+	if !ok {
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	if err := s.splits.Delete(userID, bankCode, transactionID); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to delete split", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to delete split: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"message": "Split deleted successfully",
+	})
+}
+
+// applySplits добавляет разбиения к транзакциям или, при splits=expand, заменяет транзакции частями
+func (s *Server) applySplits(r *http.Request, userID string, transactions []Transaction) []Transaction {
+	if r.URL.Query().Get("splits") == "expand" {
+		return s.splits.Expand(userID, transactions)
+	}
+	return s.splits.Attach(userID, transactions)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateSplitParts(t *testing.T) {
+	part := func(amount float64, category string) SplitPart {
+		return SplitPart{Amount: amount, Category: category}
+	}
+	tooMany := make([]SplitPart, maxSplitParts+1)
+	for i := range tooMany {
+		tooMany[i] = part(1, "food")
+	}
+
+	tests := []struct {
+		name    string
+		amount  float64
+		parts   []SplitPart
+		wantErr bool
+	}{
+		{"sum matches", 1500, []SplitPart{part(1000, "food"), part(500, "transport")}, false},
+		{"expense amount is negative", -1500, []SplitPart{part(1000, "food"), part(500, "transport")}, false},
+		// 0.1 + 0.2 в float64 не равно 0.3, в копейках - равно
+		{"float sum in cents", 0.3, []SplitPart{part(0.1, "food"), part(0.2, "transport")}, false},
+		{"thirds rounded to cents", 100, []SplitPart{part(33.33, "food"), part(33.33, "home"), part(33.34, "fun")}, false},
+		{"sum short by a cent", 100, []SplitPart{part(33.33, "food"), part(33.33, "home"), part(33.33, "fun")}, true},
+		{"sum over by a cent", 1500, []SplitPart{part(1000.01, "food"), part(500, "transport")}, true},
+		{"fraction of a cent", 1500, []SplitPart{part(999.995, "food"), part(500.005, "transport")}, true},
+		{"single part", 1500, []SplitPart{part(1500, "food")}, true},
+		{"too many parts", float64(maxSplitParts + 1), tooMany, true},
+		{"zero part", 1500, []SplitPart{part(1500, "food"), part(0, "transport")}, true},
+		{"negative part", 1000, []SplitPart{part(1500, "food"), part(-500, "transport")}, true},
+		{"empty category", 1500, []SplitPart{part(1000, "food"), part(500, " ")}, true},
+		{"long note", 1500, []SplitPart{part(1000, "food"), {Amount: 500, Category: "transport", Note: strings.Repeat("я", maxNoteLength+1)}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := validateSplitParts(tt.amount, tt.parts)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidInput) {
+					t.Errorf("error = %v, want ErrInvalidInput", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var total int64
+			for _, p := range parts {
+				total += toCents(p.Amount)
+			}
+			if total != toCents(math.Abs(tt.amount)) {
+				t.Errorf("parts sum to %d cents, transaction amount %.2f", total, tt.amount)
+			}
+		})
+	}
+}
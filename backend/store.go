@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Общие ошибки пользовательских хранилищ (обработчики маппят их в HTTP статусы)
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// JSONStore простое файловое хранилище пользовательских данных.
+// Каждая коллекция хранится в отдельном файле <dir>/<name>.json,
+// с включенным шифрованием - в конверте (см. Encryptor)
+type JSONStore struct {
+	dir string
+	enc *Encryptor
+	mu  sync.Mutex
+}
+
+// NewJSONStore создает хранилище в указанной директории
+func NewJSONStore(dir string, enc *Encryptor) (*JSONStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data dir %s: %w", dir, err)
+	}
+
+	return &JSONStore{dir: dir, enc: enc}, nil
+}
+
+// Load читает коллекцию в target. Отсутствующий файл не считается ошибкой
+func (s *JSONStore) Load(name string, target interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+
+	data, err = s.enc.Open(collectionAAD(name), data)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Save атомарно записывает коллекцию (через временный файл и rename)
+func (s *JSONStore) Save(name string, data interface{}) error {
+	bytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", name, err)
+	}
+
+	bytes, err = s.enc.Seal(collectionAAD(name), bytes)
+	if err != nil {
+		return fmt.Errorf("encrypt %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeFileAtomic(s.path(name), bytes)
+}
+
+// path возвращает путь к файлу коллекции
+func (s *JSONStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// collections имена коллекций, сохраненных на диске
+func (s *JSONStore) collections() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	return names, nil
+}
+
+// keyIDs количество коллекций по ключам шифрования
+func (s *JSONStore) keyIDs() (map[string]int, error) {
+	names, err := s.collections()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, name := range names {
+		data, err := os.ReadFile(s.path(name))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		counts[fileKeyLabel(s.enc, data)]++
+	}
+	return counts, nil
+}
+
+// reencrypt перешифровывает коллекции активным ключом
+func (s *JSONStore) reencrypt(report *ReencryptReport) {
+	names, err := s.collections()
+	if err != nil {
+		report.Failed = append(report.Failed, "collections: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		report.Checked++
+		path := s.path(name)
+		changed, err := reencryptFile(s.enc, path, collectionAAD(name))
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("collection %s: %v", name, err))
+			continue
+		}
+		if changed {
+			report.Reencrypted++
+		}
+	}
+}
+
+// collectionAAD привязка шифротекста к коллекции
+func collectionAAD(name string) string {
+	return "collection:" + name
+}
+
+// BlobStore хранит бинарные файлы (вложения) в отдельной директории
+type BlobStore struct {
+	dir string
+	enc *Encryptor
+	mu  sync.Mutex // не дает перешифрованию вернуть удаленный файл
+}
+
+// NewBlobStore создает хранилище файлов в указанной директории
+func NewBlobStore(dir string, enc *Encryptor) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create blob dir %s: %w", dir, err)
+	}
+
+	return &BlobStore{dir: dir, enc: enc}, nil
+}
+
+// Put сохраняет файл под указанным ID
+func (b *BlobStore) Put(id string, data []byte) error {
+	path, err := b.path(id)
+	if err != nil {
+		return err
+	}
+
+	data, err = b.enc.Seal(blobAAD(id), data)
+	if err != nil {
+		return fmt.Errorf("encrypt blob %s: %w", id, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return writeFileAtomic(path, data)
+}
+
+// Get читает файл по ID
+func (b *BlobStore) Get(id string) ([]byte, error) {
+	path, err := b.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read blob %s: %w", id, err)
+	}
+
+	data, err = b.enc.Open(blobAAD(id), data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt blob %s: %w", id, err)
+	}
+
+	return data, nil
+}
+
+// Delete удаляет файл по ID (отсутствующий файл не считается ошибкой)
+func (b *BlobStore) Delete(id string) error {
+	path, err := b.path(id)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete blob %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// path возвращает путь к файлу, не допуская выхода за пределы директории
+func (b *BlobStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("%w: invalid blob id %q", ErrInvalidInput, id)
+	}
+
+	return filepath.Join(b.dir, id), nil
+}
+
+// ids ID сохраненных файлов (без временных)
+func (b *BlobStore) ids() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read blob dir: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// keyIDs количество файлов по ключам шифрования
+func (b *BlobStore) keyIDs() (map[string]int, error) {
+	ids, err := b.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, id := range ids {
+		data, err := os.ReadFile(filepath.Join(b.dir, id))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read blob %s: %w", id, err)
+		}
+		counts[fileKeyLabel(b.enc, data)]++
+	}
+	return counts, nil
+}
+
+// reencrypt перешифровывает файлы активным ключом
+func (b *BlobStore) reencrypt(report *ReencryptReport) {
+	ids, err := b.ids()
+	if err != nil {
+		report.Failed = append(report.Failed, "blobs: "+err.Error())
+		return
+	}
+
+	for _, id := range ids {
+		b.mu.Lock()
+		changed, err := reencryptFile(b.enc, filepath.Join(b.dir, id), blobAAD(id))
+		b.mu.Unlock()
+
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		report.Checked++
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("blob %s: %v", id, err))
+			continue
+		}
+		if changed {
+			report.Reencrypted++
+		}
+	}
+}
+
+// blobAAD привязка шифротекста к ID файла
+func blobAAD(id string) string {
+	return "blob:" + id
+}
+
+// reencryptFile перешифровывает файл, если он открыт или зашифрован не активным ключом
+func reencryptFile(enc *Encryptor, path, aad string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if !enc.NeedsReencrypt(data) {
+		return false, nil
+	}
+
+	plaintext, err := enc.Open(aad, data)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := enc.Seal(aad, plaintext)
+	if err != nil {
+		return false, err
+	}
+	return true, writeFileAtomic(path, sealed)
+}
+
+// writeFileAtomic записывает файл так, чтобы при сбое не остался обрезанный JSON
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var reTenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// Tenant команда-партнер со своими учетными данными в банках. ID - это TEAM_ID
+// команды: префикс client_id ее пользователей (<ID>-N)
+type Tenant struct {
+	ID    string       `json:"id"`
+	Name  string       `json:"name,omitempty"`
+	Banks []TenantBank `json:"banks"`
+
+	shared bool // команда из TEAM_ID: ей доступны общие секреты CLIENT_SECRET и CLIENT_SECRET_<BANK>
+}
+
+// TenantBank подключение арендатора к банку
+type TenantBank struct {
+	Code         string `json:"code"`
+	BaseURL      string `json:"base_url,omitempty"`      // пустой - BASE_URL_<CODE>
+	ClientID     string `json:"client_id,omitempty"`     // пустой - ID арендатора
+	ClientSecret string `json:"client_secret,omitempty"` // пустой - из источников секретов (CLIENT_SECRET_<TENANT>_<BANK>)
+
+	SupportsIdempotencyKey bool `json:"supports_idempotency_key,omitempty"` // или SUPPORTS_IDEMPOTENCY_KEY_<CODE> для банка из BANKS
+}
+
+// loadTenants читает арендаторов из JSON файла (TENANTS_FILE). Банки без base_url
+// берут адрес из BANKS/BASE_URL_<CODE>
+func loadTenants(path string, banks []Bank) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants file: %w", err)
+	}
+
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("parse tenants file %s: %w", path, err)
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("tenants file %s has no tenants", path)
+	}
+
+	seen := make(map[string]bool)
+	for i := range tenants {
+		tenant := &tenants[i]
+		tenant.ID = strings.TrimSpace(tenant.ID)
+		if !reTenantID.MatchString(tenant.ID) {
+			return nil, fmt.Errorf("tenant %d: invalid id %q", i+1, tenant.ID)
+		}
+		if seen[tenant.ID] {
+			return nil, fmt.Errorf("tenant %s is defined twice", tenant.ID)
+		}
+		seen[tenant.ID] = true
+
+		if len(tenant.Banks) == 0 {
+			return nil, fmt.Errorf("tenant %s: no banks configured", tenant.ID)
+		}
+		codes := make(map[string]bool)
+		for j := range tenant.Banks {
+			bank := &tenant.Banks[j]
+			bank.Code = strings.TrimSpace(bank.Code)
+			if bank.Code == "" || codes[bank.Code] {
+				return nil, fmt.Errorf("tenant %s: empty or duplicate bank code %q", tenant.ID, bank.Code)
+			}
+			codes[bank.Code] = true
+
+			for _, b := range banks {
+				if b.Code != bank.Code {
+					continue
+				}
+				if bank.BaseURL == "" {
+					bank.BaseURL = b.BaseURL
+				}
+				bank.SupportsIdempotencyKey = bank.SupportsIdempotencyKey || b.SupportsIdempotencyKey
+			}
+			if !strings.HasPrefix(bank.BaseURL, "http://") && !strings.HasPrefix(bank.BaseURL, "https://") {
+				return nil, fmt.Errorf("tenant %s: bank %s has no valid base_url and is not in BANKS", tenant.ID, bank.Code)
+			}
+			bank.BaseURL = strings.TrimSuffix(bank.BaseURL, "/")
+
+			if bank.ClientID == "" {
+				bank.ClientID = tenant.ID
+			}
+		}
+	}
+
+	return tenants, nil
+}
+
+// envTenant арендатор из TEAM_ID со всеми банками из BANKS. Секреты берутся из
+// источников секретов (CLIENT_SECRET или CLIENT_SECRET_<BANK>)
+func envTenant(teamID string, banks []Bank) Tenant {
+	tenant := Tenant{ID: teamID, Name: teamID, shared: true}
+	for _, bank := range banks {
+		tenant.Banks = append(tenant.Banks, TenantBank{
+			Code:                   bank.Code,
+			BaseURL:                bank.BaseURL,
+			ClientID:               teamID,
+			SupportsIdempotencyKey: bank.SupportsIdempotencyKey,
+		})
+	}
+	return tenant
+}
+
+// BankList банки арендатора в виде конфигурации Bank
+func (t Tenant) BankList() []Bank {
+	banks := make([]Bank, 0, len(t.Banks))
+	for _, bank := range t.Banks {
+		banks = append(banks, Bank{Code: bank.Code, BaseURL: bank.BaseURL, SupportsIdempotencyKey: bank.SupportsIdempotencyKey})
+	}
+	return banks
+}
+
+// FindTenant ищет арендатора по ID
+func (c Config) FindTenant(id string) (Tenant, bool) {
+	for _, tenant := range c.Tenants {
+		if tenant.ID == id {
+			return tenant, true
+		}
+	}
+	return Tenant{}, false
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transfersCollection коллекция в хранилище
+const transfersCollection = "transfers"
+
+// Статусы перевода между своими счетами
+const (
+	TransferSent        = "sent"        // платеж создан, ждем зачисления на счет получателя
+	TransferCompleted   = "completed"   // зачисление найдено в выписке счета получателя
+	TransferFailed      = "failed"      // банк отклонил или отменил платеж
+	TransferUnconfirmed = "unconfirmed" // зачисление не появилось за maxTransferCreditWait
+)
+
+const (
+	maxTransferCreditWait = 3 * 24 * time.Hour // сколько ждем зачисления
+	defaultTransferRef    = "Перевод между своими счетами"
+)
+
+// TransferAccountRef счет пользователя, как его вернул /api/accounts
+type TransferAccountRef struct {
+	Bank      string `json:"bank"`
+	AccountID string `json:"account_id"`
+}
+
+// TransferInput тело запроса на перевод между своими счетами
+type TransferInput struct {
+	From      TransferAccountRef `json:"from"`
+	To        TransferAccountRef `json:"to"`
+	Amount    AmountObj          `json:"amount"` // валюта по умолчанию - валюта счета списания
+	Reference string             `json:"reference,omitempty"`
+}
+
+// TransferAccount счет перевода с реквизитами, полученными от банка
+type TransferAccount struct {
+	Bank           string `json:"bank"`
+	AccountID      string `json:"account_id"`
+	SchemeName     string `json:"scheme_name"`
+	Identification string `json:"identification"`
+	Currency       string `json:"currency"`
+}
+
+// Transfer перевод между счетами пользователя, в том числе в разных банках
+type Transfer struct {
+	ID                  string          `json:"id"`
+	UserID              string          `json:"user_id"`
+	From                TransferAccount `json:"from"`
+	To                  TransferAccount `json:"to"`
+	Amount              AmountObj       `json:"amount"`
+	Reference           string          `json:"reference"`
+	Status              string          `json:"status"`
+	PaymentID           string          `json:"payment_id"`
+	PaymentStatus       string          `json:"payment_status"`
+	CreditTransactionID string          `json:"credit_transaction_id,omitempty"` // зачисление на счете получателя
+	CreditedAt          *time.Time      `json:"credited_at,omitempty"`
+	Checks              int             `json:"checks"`
+	LastError           string          `json:"last_error,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+}
+
+// TransferStore создает переводы между своими счетами и в фоне ищет
+// зачисление на счете получателя
+type TransferStore struct {
+	store      *JSONStore
+	aggregator *BankAggregator
+	tracker    *PaymentTracker
+	interval   time.Duration
+
+	mu        sync.RWMutex
+	transfers map[string]*Transfer // key: transfer ID
+}
+
+// NewTransferStore загружает переводы
+func NewTransferStore(store *JSONStore, aggregator *BankAggregator, tracker *PaymentTracker, interval time.Duration) (*TransferStore, error) {
+	s := &TransferStore{
+		store:      store,
+		aggregator: aggregator,
+		tracker:    tracker,
+		interval:   interval,
+		transfers:  make(map[string]*Transfer),
+	}
+
+	var transfers []*Transfer
+	if err := store.Load(transfersCollection, &transfers); err != nil {
+		return nil, fmt.Errorf("load transfers: %w", err)
+	}
+	for _, transfer := range transfers {
+		s.transfers[transfer.ID] = transfer
+	}
+
+	return s, nil
+}
+
+// Start запускает фоновый поиск зачислений
+func (s *TransferStore) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.CheckCredits(context.Background(), time.Now().UTC())
+			<-ticker.C
+		}
+	}()
+}
+
+// preparedTransfer перевод, прошедший все проверки: счета найдены, остатка хватает
+type preparedTransfer struct {
+	from, to  TransferAccount
+	amount    AmountObj
+	reference string
+	request   PaymentRequest
+}
+
+// Check проверяет перевод так же, как Create, но ничего не отправляет в банк.
+// Вызывается до отправки кода подтверждения
+func (s *TransferStore) Check(ctx context.Context, userID string, input TransferInput) error {
+	_, err := s.prepare(ctx, userID, input)
+	return err
+}
+
+// Create находит оба счета в банках, проверяет валюту и доступный остаток
+// и отправляет платеж из банка счета списания
+func (s *TransferStore) Create(ctx context.Context, userID string, input TransferInput, now time.Time) (*Transfer, error) {
+	prepared, err := s.prepare(ctx, userID, input)
+	if err != nil {
+		return nil, err
+	}
+	from, req := prepared.from, prepared.request
+
+	payment, err := s.aggregator.CreatePayment(ctx, from.Bank, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := &Transfer{
+		ID:            "transfer-" + uuid.New().String(),
+		UserID:        userID,
+		From:          from,
+		To:            prepared.to,
+		Amount:        prepared.amount,
+		Reference:     prepared.reference,
+		Status:        TransferSent,
+		PaymentID:     payment.PaymentID,
+		PaymentStatus: payment.Status,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if state := paymentState(payment.Status); state == PaymentStateRejected || state == PaymentStateCancelled {
+		transfer.Status = TransferFailed
+		transfer.LastError = "payment " + state + " by bank"
+	}
+
+	if err := s.tracker.Track(userID, from.Bank, req, payment, PaymentSourceTransfer, transfer.ID, now); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to record transfer payment", "transfer_id", transfer.ID, "error", err)
+	}
+
+	// Платеж уже создан: перевод не теряем, даже если сохранить его не удалось
+	s.mu.Lock()
+	s.transfers[transfer.ID] = transfer
+	if err := s.persist(); err != nil {
+		paymentsLog.WarnContext(ctx, "Failed to save transfer", "transfer_id", transfer.ID, "error", err)
+	}
+	result := transfer.clone()
+	s.mu.Unlock()
+
+	return &result, nil
+}
+
+// prepare находит оба счета в банках, проверяет реквизиты, валюту и доступный остаток
+func (s *TransferStore) prepare(ctx context.Context, userID string, input TransferInput) (*preparedTransfer, error) {
+	var errs ValidationErrors
+	checkTransferRef(&errs, "from", input.From)
+	checkTransferRef(&errs, "to", input.To)
+	if input.From == input.To && input.From.AccountID != "" {
+		errs.add("to.account_id", "same_account", "source and destination accounts must differ")
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	from, fromInfo, err := s.resolveAccount(ctx, userID, "from", input.From)
+	if err != nil {
+		return nil, err
+	}
+	to, toInfo, err := s.resolveAccount(ctx, userID, "to", input.To)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := input.Amount
+	if amount.Currency == "" {
+		amount.Currency = from.Currency
+	}
+	if from.Currency != "" && amount.Currency != from.Currency {
+		errs.add("amount.currency", "currency_mismatch", "source account currency is %s", from.Currency)
+	}
+	if to.Currency != "" && to.Currency != amount.Currency {
+		errs.add("to.account_id", "currency_mismatch", "destination account currency is %s, transfer currency is %s", to.Currency, amount.Currency)
+	}
+
+	reference := input.Reference
+	if reference == "" {
+		reference = defaultTransferRef
+	}
+	req := PaymentRequest{
+		DebtorAccount:   fromInfo,
+		CreditorAccount: toInfo,
+		Amount:          amount,
+		Reference:       reference,
+	}
+	if err := ValidatePaymentRequest(req); err != nil {
+		var fields ValidationErrors
+		if !errors.As(err, &fields) {
+			return nil, err
+		}
+		errs = append(errs, fields...)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	// Остаток проверяем последним, когда реквизиты уже в порядке
+	balance, currency, err := s.aggregator.GetCurrentBalance(ctx, from.Bank, userID, from.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("get source balance: %w", err)
+	}
+	if currency != "" && currency != amount.Currency {
+		errs.add("amount.currency", "currency_mismatch", "source account balance is in %s", currency)
+	} else if parseAmount(amount.Amount) > roundMoney(balance) {
+		errs.add("amount.amount", "insufficient_funds", "available balance is %.2f %s", balance, amount.Currency)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	return &preparedTransfer{from: from, to: to, amount: amount, reference: reference, request: req}, nil
+}
+
+// Get возвращает перевод пользователя
+func (s *TransferStore) Get(userID, transferID string) (*Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transfer, exists := s.transfers[transferID]
+	if !exists || transfer.UserID != userID {
+		return nil, fmt.Errorf("transfer %s: %w", transferID, ErrNotFound)
+	}
+
+	result := transfer.clone()
+	return &result, nil
+}
+
+// List возвращает переводы пользователя, новые первыми
+func (s *TransferStore) List(userID string) []Transfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Transfer, 0)
+	for _, transfer := range s.transfers {
+		if transfer.UserID == userID {
+			result = append(result, transfer.clone())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	return result
+}
+
+// CREDIT MATCHING
+
+// CheckCredits ищет зачисления для отправленных переводов. Зачисление - операция
+// на счете получателя с той же суммой и валютой не раньше дня перевода,
+// еще не сопоставленная с другим переводом
+func (s *TransferStore) CheckCredits(ctx context.Context, now time.Time) {
+	s.mu.RLock()
+	var due []Transfer
+	for _, transfer := range s.transfers {
+		if transfer.Status == TransferSent {
+			due = append(due, transfer.clone())
+		}
+	}
+	s.mu.RUnlock()
+
+	// Старые переводы первыми: одинаковые суммы сопоставляются по порядку отправки
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+
+	for _, transfer := range due {
+		var paymentStatus string
+		if tracked, err := s.tracker.Get(transfer.UserID, transfer.PaymentID); err == nil {
+			paymentStatus = tracked.Status
+		}
+
+		pollCtx, cancel := context.WithTimeout(ctx, paymentPollTimeout)
+		since := truncatePeriod(transfer.CreatedAt, IntervalDay)
+		transactions, err := s.aggregator.GetAccountTransactions(pollCtx, transfer.To.Bank, transfer.UserID, transfer.To.AccountID, since, now)
+		cancel()
+
+		if err != nil {
+			paymentsLog.WarnContext(ctx, "Failed to check transfer credit", "transfer_id", transfer.ID, "bank", transfer.To.Bank, "error", err)
+		}
+		s.recordCheck(transfer.ID, paymentStatus, transactions, err, time.Now().UTC())
+	}
+}
+
+// recordCheck сопоставляет операции счета получателя с переводом и сохраняет результат
+func (s *TransferStore) recordCheck(transferID, paymentStatus string, transactions []Transaction, checkErr error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfer, exists := s.transfers[transferID]
+	if !exists || transfer.Status != TransferSent {
+		return
+	}
+
+	transfer.Checks++
+	transfer.UpdatedAt = now
+	if paymentStatus != "" {
+		transfer.PaymentStatus = paymentStatus
+	}
+
+	switch state := paymentState(transfer.PaymentStatus); {
+	case state == PaymentStateRejected || state == PaymentStateCancelled:
+		transfer.Status = TransferFailed
+		transfer.LastError = "payment " + state + " by bank"
+	case checkErr != nil:
+		transfer.LastError = checkErr.Error()
+	default:
+		transfer.LastError = ""
+		if tx, ok := s.matchCredit(transfer, transactions); ok {
+			transfer.Status = TransferCompleted
+			transfer.CreditTransactionID = tx.ID
+			creditedAt := tx.Date
+			transfer.CreditedAt = &creditedAt
+		}
+	}
+
+	if transfer.Status == TransferSent && now.Sub(transfer.CreatedAt) > maxTransferCreditWait {
+		transfer.Status = TransferUnconfirmed
+		transfer.LastError = "credit did not appear on destination account, check it in the bank"
+	}
+
+	if err := s.persist(); err != nil {
+		paymentsLog.Warn("Failed to save transfer", "transfer_id", transferID, "error", err)
+	}
+}
+
+// matchCredit ищет зачисление перевода среди операций (вызывается под блокировкой)
+func (s *TransferStore) matchCredit(transfer *Transfer, transactions []Transaction) (Transaction, bool) {
+	claimed := make(map[string]bool)
+	for _, other := range s.transfers {
+		if other.CreditTransactionID != "" && other.To.Bank == transfer.To.Bank && other.To.AccountID == transfer.To.AccountID {
+			claimed[other.CreditTransactionID] = true
+		}
+	}
+
+	amount := roundMoney(parseAmount(transfer.Amount.Amount))
+	since := truncatePeriod(transfer.CreatedAt, IntervalDay)
+
+	for _, tx := range transactions {
+		if claimed[tx.ID] || roundMoney(tx.Amount) != amount || tx.Date.Before(since) {
+			continue
+		}
+		if tx.Currency != "" && tx.Currency != transfer.Amount.Currency {
+			continue
+		}
+		return tx, true
+	}
+
+	return Transaction{}, false
+}
+
+// HELPERS
+
+// checkTransferRef проверяет, что счет указан и не ручной
+func checkTransferRef(errs *ValidationErrors, field string, ref TransferAccountRef) {
+	if ref.Bank == "" {
+		errs.add(field+".bank", "required", "bank is required")
+	} else if ref.Bank == ManualBankCode {
+		errs.add(field+".bank", "invalid_value", "manual accounts cannot be used in transfers")
+	}
+	if ref.AccountID == "" {
+		errs.add(field+".account_id", "required", "account_id is required")
+	}
+}
+
+// resolveAccount получает от банка схему и номер счета
+func (s *TransferStore) resolveAccount(ctx context.Context, userID, field string, ref TransferAccountRef) (TransferAccount, AccountInfo, error) {
+	if _, err := s.aggregator.GetBankByCode(ctx, ref.Bank); err != nil {
+		var errs ValidationErrors
+		errs.add(field+".bank", "invalid_value", "unknown bank %s", ref.Bank)
+		return TransferAccount{}, AccountInfo{}, errs
+	}
+
+	detail, err := s.aggregator.FindAccountDetail(ctx, ref.Bank, userID, ref.AccountID)
+	if errors.Is(err, ErrNotFound) {
+		var errs ValidationErrors
+		errs.add(field+".account_id", "not_found", "account %s not found in %s", ref.AccountID, ref.Bank)
+		return TransferAccount{}, AccountInfo{}, errs
+	}
+	if err != nil {
+		return TransferAccount{}, AccountInfo{}, fmt.Errorf("resolve %s account: %w", field, err)
+	}
+
+	var info AccountInfo
+	for _, acc := range detail.Account {
+		if acc.Identification != "" {
+			info = AccountInfo{SchemeName: acc.SchemeName, Identification: acc.Identification, Name: acc.Name}
+			break
+		}
+	}
+	if info.Identification == "" {
+		var errs ValidationErrors
+		errs.add(field+".account_id", "invalid_value", "bank returned no account number for %s", ref.AccountID)
+		return TransferAccount{}, AccountInfo{}, errs
+	}
+	if info.SchemeName == "" {
+		info.SchemeName = "RU.CBR.PAN"
+	}
+
+	// БИК банка счета, если банк его передает
+	servicerScheme := strings.ToUpper(detail.Servicer.SchemeName)
+	if strings.Contains(servicerScheme, "BIC") || strings.Contains(servicerScheme, "BIK") {
+		info.BIC = detail.Servicer.Identification
+	}
+
+	account := TransferAccount{
+		Bank:           ref.Bank,
+		AccountID:      ref.AccountID,
+		SchemeName:     info.SchemeName,
+		Identification: info.Identification,
+		Currency:       detail.Currency,
+	}
+	return account, info, nil
+}
+
+// clone возвращает копию, не разделяющую указатели с оригиналом
+func (t *Transfer) clone() Transfer {
+	c := *t
+	if t.CreditedAt != nil {
+		creditedAt := *t.CreditedAt
+		c.CreditedAt = &creditedAt
+	}
+	return c
+}
+
+// persist сохраняет переводы (вызывается под блокировкой)
+func (s *TransferStore) persist() error {
+	transfers := make([]*Transfer, 0, len(s.transfers))
+	for _, transfer := range s.transfers {
+		transfers = append(transfers, transfer)
+	}
+	return s.store.Save(transfersCollection, transfers)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TRANSFER ENDPOINTS
+
+// handleCreateTransfer проверяет перевод между своими счетами (в том числе в разных
+// банках) и создает черновик: в банк перевод уходит после подтверждения кодом
+// (POST /api/payments/{id}/confirm). Счета указываются по ID из /api/accounts
+// POST /api/transfers
+func (s *Server) handleCreateTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	var input TransferInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Перевод, который не пройдет проверки, не подтверждаем: код пользователю не отправляется
+	if err := s.transfers.Check(r.Context(), userID, input); err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create transfer", "error", err)
+		writeValidationError(w, r, "Failed to create transfer", err)
+		return
+	}
+
+	draft, err := s.drafts.CreateTransfer(r.Context(), userID, input, time.Now().UTC())
+	if err != nil {
+		handlersLog.WarnContext(r.Context(), "Failed to create transfer draft", "error", err)
+		writeError(w, r, errorStatus(err), "Failed to create transfer draft: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, draft)
+}
+
+// handleListTransfers возвращает переводы пользователя
+// GET /api/transfers
+func (s *Server) handleListTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r.Context())
+
+	writeJSON(w, http.StatusOK, s.transfers.List(userID))
+}
+
+// handleGetTransfer возвращает перевод со статусом зачисления
+// GET /api/transfers/{id}
+func (s *Server) handleGetTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID := r.PathValue("id")
+	if transferID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing transfer ID in path")
+		return
+	}
+
+	userID := getUserID(r.Context())
+
+	transfer, err := s.transfers.Get(userID, transferID)
+	if err != nil {
+		writeError(w, r, errorStatus(err), "Failed to get transfer: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transfer)
+}